@@ -1,7 +1,7 @@
 package mediasoup
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -14,9 +14,18 @@ import (
 
 type channelSubscriber func(event string, data []byte)
 
+// DefaultRequestTimeout is the time a request to mediasoup-worker is given to be answered, unless
+// set otherwise by WorkerSettings.RequestTimeout.
+const DefaultRequestTimeout = 3 * time.Second
+
+// ErrRequestTimeout is wrapped by the error returned by a request to mediasoup-worker which is not
+// answered before the request timeout.
+var ErrRequestTimeout = errors.New("request timed out")
+
 type Channel struct {
 	logger          logr.Logger
 	codec           netcodec.Codec
+	messageCodec    ChannelCodec
 	closed          int32
 	pid             int
 	nextId          int64
@@ -26,20 +35,23 @@ type Channel struct {
 	useHandlerID    bool
 	oldCloseMethods map[string]string
 	subscribers     sync.Map
+	requestTimeout  time.Duration
 }
 
-func newChannel(codec netcodec.Codec, pid int, useHandlerID bool) *Channel {
+func newChannel(codec netcodec.Codec, messageCodec ChannelCodec, pid int, useHandlerID bool) *Channel {
 	logger := NewLogger("Channel")
 
 	logger.V(1).Info("constructor()", "useHandlerID", useHandlerID)
 
 	channel := &Channel{
-		logger:       logger,
-		codec:        codec,
-		pid:          pid,
-		sentChan:     make(chan sentInfo),
-		closeCh:      make(chan struct{}),
-		useHandlerID: useHandlerID,
+		logger:         logger,
+		codec:          codec,
+		messageCodec:   messageCodec,
+		pid:            pid,
+		sentChan:       make(chan sentInfo),
+		closeCh:        make(chan struct{}),
+		useHandlerID:   useHandlerID,
+		requestTimeout: DefaultRequestTimeout,
 		oldCloseMethods: map[string]string{
 			"worker.closeWebRtcServer":    "webRtcServer.close",
 			"worker.closeRouter":          "router.close",
@@ -73,7 +85,21 @@ func (c *Channel) Closed() bool {
 	return atomic.LoadInt32(&c.closed) > 0
 }
 
-func (c *Channel) Request(method string, internal internalData, data ...interface{}) (rsp workerResponse) {
+// Request sends a request to mediasoup-worker and waits for its response, failing with an error
+// wrapping ErrRequestTimeout if it is not answered within the request timeout.
+func (c *Channel) Request(method string, internal internalData, data ...interface{}) workerResponse {
+	return c.RequestCtx(context.Background(), method, internal, data...)
+}
+
+// RequestCtx is like Request but also returns an error wrapping ctx.Err() if ctx is done before
+// the response. A deadline of ctx replaces the request timeout.
+func (c *Channel) RequestCtx(ctx context.Context, method string, internal internalData, data ...interface{}) (rsp workerResponse) {
+	if RequestMetrics != nil {
+		defer func(method string, start time.Time) {
+			reportRequestMetrics(method, internal, start, rsp.err)
+		}(method, time.Now())
+	}
+
 	if c.Closed() {
 		rsp.err = NewInvalidStateError("Channel closed")
 		return
@@ -89,50 +115,45 @@ func (c *Channel) Request(method string, internal internalData, data ...interfac
 
 	c.logger.V(1).Info("request()", "method", method, "id", id)
 
-	var (
-		rawData []byte
-		request []byte
-	)
-
+	channelRequest := ChannelRequest{
+		Id:        id,
+		Method:    method,
+		HandlerId: internal.HandlerID(method),
+		Internal:  internal,
+	}
 	if len(data) > 0 {
-		if rawData, rsp.err = json.Marshal(data[0]); rsp.err != nil {
-			return
-		}
-	} else {
-		rawData, _ = json.Marshal(nil)
+		channelRequest.Data = data[0]
 	}
 
-	if c.useHandlerID {
-		request = []byte(fmt.Sprintf("%d:%s:%s:%s", id, method, internal.HandlerID(method), rawData))
-	} else {
-		request, _ = json.Marshal(workerRequest{
-			Id:       id,
-			Method:   method,
-			Internal: internal,
-			Data:     rawData,
-		})
+	request, err := c.messageCodec.EncodeRequest(channelRequest)
+	if err != nil {
+		rsp.err = err
+		return
 	}
 
 	if len(request) > NS_MESSAGE_MAX_LEN {
 		return workerResponse{err: errors.New("Channel request too big")}
 	}
 
-	sent := sentInfo{
-		method:  method,
-		request: request,
-		respCh:  make(chan workerResponse),
-	}
+	sent := newSentInfo(method, request, nil)
 	c.sents.Store(id, sent)
 	defer c.sents.Delete(id)
 
-	timer := time.NewTimer(time.Duration(3000) * time.Millisecond)
-	defer timer.Stop()
+	// The deadline of ctx, if any, is the only timeout.
+	var timeout <-chan time.Time
+	if _, ok := ctx.Deadline(); !ok {
+		timer := time.NewTimer(c.requestTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 
 	// send request
 	select {
 	case c.sentChan <- sent:
-	case <-timer.C:
-		rsp.err = fmt.Errorf("Channel request timeout, id: %d, method: %s", id, method)
+	case <-timeout:
+		rsp.err = fmt.Errorf("Channel %w before being sent, id: %d, method: %s", ErrRequestTimeout, id, method)
+	case <-ctx.Done():
+		rsp.err = fmt.Errorf("Channel request not sent, id: %d, method: %s: %w", id, method, ctx.Err())
 	case <-c.closeCh:
 		rsp.err = NewInvalidStateError("Channel closed, id: %d, method: %s", id, method)
 	}
@@ -143,8 +164,10 @@ func (c *Channel) Request(method string, internal internalData, data ...interfac
 	// wait response
 	select {
 	case rsp = <-sent.respCh:
-	case <-timer.C:
-		rsp.err = fmt.Errorf("Channel response timeout, id: %d, method: %s", id, method)
+	case <-timeout:
+		rsp.err = fmt.Errorf("Channel %w waiting for the response, id: %d, method: %s", ErrRequestTimeout, id, method)
+	case <-ctx.Done():
+		rsp.err = fmt.Errorf("Channel request not answered, id: %d, method: %s: %w", id, method, ctx.Err())
 	case <-c.closeCh:
 		rsp.err = NewInvalidStateError("Channel closed, id: %d, method: %s", id, method)
 	}
@@ -190,8 +213,6 @@ func (c *Channel) runReadLoop() {
 
 func (c *Channel) processPayload(nsPayload []byte) {
 	switch nsPayload[0] {
-	case '{':
-		c.processMessage(nsPayload)
 	case 'D':
 		c.logger.V(1).Info(string(nsPayload[1:]), "pid", c.pid)
 	case 'W':
@@ -201,25 +222,14 @@ func (c *Channel) processPayload(nsPayload []byte) {
 	case 'X':
 		fmt.Printf("%s\n", nsPayload[1:])
 	default:
-		c.logger.Error(errors.New(string(nsPayload[1:])), "unexpected data", "pid", c.pid)
+		c.processMessage(nsPayload)
 	}
 }
 
 func (c *Channel) processMessage(nsPayload []byte) {
-	var msg struct {
-		// response
-		Id       int64  `json:"id,omitempty"`
-		Accepted bool   `json:"accepted,omitempty"`
-		Error    string `json:"error,omitempty"`
-		Reason   string `json:"reason,omitempty"`
-		// notification
-		TargetId interface{} `json:"targetId,omitempty"`
-		Event    string      `json:"event,omitempty"`
-		// common data
-		Data json.RawMessage `json:"data,omitempty"`
-	}
-	if err := json.Unmarshal(nsPayload, &msg); err != nil {
-		c.logger.Error(err, "received response, failed to unmarshal to json", "payload", json.RawMessage(nsPayload))
+	msg, err := c.messageCodec.DecodeMessage(nsPayload)
+	if err != nil {
+		c.logger.Error(err, "received unexpected data, failed to decode", "pid", c.pid, "payload", string(nsPayload))
 		return
 	}
 
@@ -246,17 +256,8 @@ func (c *Channel) processMessage(nsPayload []byte) {
 		} else {
 			c.logger.Error(nil, "received response is not accepted nor rejected", "method", sent.method, "id", msg.Id)
 		}
-	} else if msg.TargetId != nil && len(msg.Event) > 0 {
-		var targetId string
-		// The type of msg.TargetId should be string or float64
-		switch v := msg.TargetId.(type) {
-		case string:
-			targetId = v
-		case float64:
-			targetId = fmt.Sprintf("%0.0f", v)
-		default:
-			targetId = fmt.Sprintf("%v", v)
-		}
+	} else if len(msg.TargetId) > 0 && len(msg.Event) > 0 {
+		targetId := msg.TargetId
 
 		if handler, ok := c.subscribers.Load(targetId); ok {
 			handler.(channelSubscriber)(msg.Event, msg.Data)
@@ -0,0 +1,119 @@
+package mediasoup
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ChannelRequest is a request sent to the worker through the Channel.
+type ChannelRequest struct {
+	Id     int64
+	Method string
+
+	// HandlerId is the id of the entity handling the request, used by workers >= 3.10.6.
+	HandlerId string
+
+	// Internal holds the ids of the entity handling the request, used by older workers.
+	Internal interface{}
+
+	// Data is the request data, nil if none.
+	Data interface{}
+}
+
+// ChannelMessage is a response or a notification received from the worker through the Channel.
+type ChannelMessage struct {
+	// Id, Accepted, Error and Reason are set for responses.
+	Id       int64
+	Accepted bool
+	Error    string
+	Reason   string
+
+	// TargetId and Event are set for notifications.
+	TargetId string
+	Event    string
+
+	// Data is the response or notification data, which is decoded by the entities as JSON.
+	Data []byte
+}
+
+// ChannelCodec encodes the requests sent to the worker and decodes the messages received from it
+// through the Channel. It works on top of the netcodec.Codec framing the messages, so a binary
+// protocol (such as FlatBuffers) can be plugged without changing the Channel. The default one is
+// returned by NewJsonChannelCodec().
+type ChannelCodec interface {
+	EncodeRequest(request ChannelRequest) ([]byte, error)
+	DecodeMessage(payload []byte) (ChannelMessage, error)
+}
+
+type jsonChannelCodec struct {
+	useHandlerID bool
+}
+
+// NewJsonChannelCodec returns the JSON ChannelCodec. useHandlerID define whether requests are
+// encoded in the "id:method:handlerId:data" format of workers >= 3.10.6.
+func NewJsonChannelCodec(useHandlerID bool) ChannelCodec {
+	return jsonChannelCodec{useHandlerID: useHandlerID}
+}
+
+func (c jsonChannelCodec) EncodeRequest(request ChannelRequest) ([]byte, error) {
+	rawData, err := json.Marshal(request.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.useHandlerID {
+		return []byte(fmt.Sprintf("%d:%s:%s:%s", request.Id, request.Method, request.HandlerId, rawData)), nil
+	}
+
+	return json.Marshal(struct {
+		Id       int64           `json:"id,omitempty"`
+		Method   string          `json:"method,omitempty"`
+		Internal interface{}     `json:"internal,omitempty"`
+		Data     json.RawMessage `json:"data,omitempty"`
+	}{
+		Id:       request.Id,
+		Method:   request.Method,
+		Internal: request.Internal,
+		Data:     rawData,
+	})
+}
+
+func (c jsonChannelCodec) DecodeMessage(payload []byte) (message ChannelMessage, err error) {
+	var msg struct {
+		// response
+		Id       int64  `json:"id,omitempty"`
+		Accepted bool   `json:"accepted,omitempty"`
+		Error    string `json:"error,omitempty"`
+		Reason   string `json:"reason,omitempty"`
+		// notification
+		TargetId interface{} `json:"targetId,omitempty"`
+		Event    string      `json:"event,omitempty"`
+		// common data
+		Data json.RawMessage `json:"data,omitempty"`
+	}
+	if err = json.Unmarshal(payload, &msg); err != nil {
+		return
+	}
+
+	message = ChannelMessage{
+		Id:       msg.Id,
+		Accepted: msg.Accepted,
+		Error:    msg.Error,
+		Reason:   msg.Reason,
+		Event:    msg.Event,
+		Data:     msg.Data,
+	}
+
+	// The type of msg.TargetId should be string or float64
+	switch v := msg.TargetId.(type) {
+	case nil:
+	case string:
+		message.TargetId = v
+	case float64:
+		message.TargetId = fmt.Sprintf("%0.0f", v)
+	default:
+		message.TargetId = fmt.Sprintf("%v", v)
+	}
+
+	return
+}
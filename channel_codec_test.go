@@ -0,0 +1,97 @@
+package mediasoup
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anjingxw/mediasoup-go/netcodec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJsonChannelCodecEncodeRequest(t *testing.T) {
+	request := ChannelRequest{
+		Id:        1,
+		Method:    "router.createWebRtcTransport",
+		HandlerId: "router-id",
+		Internal:  internalData{RouterId: "router-id"},
+		Data:      H{"foo": "bar"},
+	}
+
+	data, err := NewJsonChannelCodec(true).EncodeRequest(request)
+	require.NoError(t, err)
+	assert.Equal(t, `1:router.createWebRtcTransport:router-id:{"foo":"bar"}`, string(data))
+
+	data, err = NewJsonChannelCodec(false).EncodeRequest(request)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"id": 1,
+		"method": "router.createWebRtcTransport",
+		"internal": {"routerId": "router-id"},
+		"data": {"foo": "bar"}
+	}`, string(data))
+
+	request.Data = nil
+	data, err = NewJsonChannelCodec(true).EncodeRequest(request)
+	require.NoError(t, err)
+	assert.Equal(t, `1:router.createWebRtcTransport:router-id:null`, string(data))
+}
+
+func TestJsonChannelCodecDecodeMessage(t *testing.T) {
+	codec := NewJsonChannelCodec(true)
+
+	msg, err := codec.DecodeMessage([]byte(`{"id":2,"accepted":true,"data":{"foo":"bar"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, ChannelMessage{Id: 2, Accepted: true, Data: []byte(`{"foo":"bar"}`)}, msg)
+
+	msg, err = codec.DecodeMessage([]byte(`{"id":3,"error":"TypeError","reason":"wrong"}`))
+	require.NoError(t, err)
+	assert.Equal(t, ChannelMessage{Id: 3, Error: "TypeError", Reason: "wrong"}, msg)
+
+	msg, err = codec.DecodeMessage([]byte(`{"targetId":1234,"event":"running"}`))
+	require.NoError(t, err)
+	assert.Equal(t, ChannelMessage{TargetId: "1234", Event: "running"}, msg)
+
+	_, err = codec.DecodeMessage([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestChannelWithJsonCodec(t *testing.T) {
+	channelReader, workerWriter := io.Pipe()
+	workerReader, channelWriter := io.Pipe()
+
+	worker := netcodec.NewNetLVCodec(workerWriter, workerReader)
+	channel := newChannel(netcodec.NewNetLVCodec(channelWriter, channelReader), NewJsonChannelCodec(true), 0, true)
+	channel.Start()
+	defer channel.Close()
+
+	notified := make(chan string, 1)
+	channel.Subscribe("1234", func(event string, data []byte) {
+		notified <- event
+	})
+
+	go func() {
+		payload, err := worker.ReadPayload()
+		if err != nil {
+			return
+		}
+		id := strings.SplitN(string(payload), ":", 2)[0]
+
+		worker.WritePayload([]byte("Dsome debug log"))
+		worker.WritePayload([]byte(`{"targetId":1234,"event":"running"}`))
+		worker.WritePayload([]byte(`{"id":` + id + `,"accepted":true,"data":{"foo":"bar"}}`))
+	}()
+
+	var result H
+	require.NoError(t, channel.Request("worker.dump", internalData{}).Unmarshal(&result))
+	assert.Equal(t, H{"foo": "bar"}, result)
+
+	select {
+	case event := <-notified:
+		assert.Equal(t, "running", event)
+	case <-time.After(time.Second):
+		assert.Fail(t, "notification not received")
+	}
+}
@@ -0,0 +1,85 @@
+package mediasoup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/anjingxw/mediasoup-go/netcodec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelRequestTimeout(t *testing.T) {
+	channelReader, workerWriter := io.Pipe()
+	workerReader, channelWriter := io.Pipe()
+	defer workerWriter.Close()
+
+	// The worker reads the requests and never answers.
+	worker := netcodec.NewNetLVCodec(workerWriter, workerReader)
+	go func() {
+		for {
+			if _, err := worker.ReadPayload(); err != nil {
+				return
+			}
+		}
+	}()
+
+	channel := newChannel(netcodec.NewNetLVCodec(channelWriter, channelReader), NewJsonChannelCodec(true), 0, true)
+	channel.requestTimeout = 10 * time.Millisecond
+	channel.Start()
+	defer channel.Close()
+
+	start := time.Now()
+	err := channel.Request("worker.dump", internalData{}).Err()
+	assert.True(t, errors.Is(err, ErrRequestTimeout), "%v", err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	// The request slot is reclaimed.
+	channel.sents.Range(func(key, value interface{}) bool {
+		t.Errorf("request %v still pending", key)
+		return true
+	})
+
+	// The deadline of the context replaces the request timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	err = channel.RequestCtx(ctx, "worker.dump", internalData{}).Err()
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	assert.False(t, errors.Is(err, ErrRequestTimeout))
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(30*time.Millisecond))
+}
+
+func TestChannelLateResponse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	workerCh := make(chan netcodec.Codec, 1)
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		if req.method == "worker.dump" {
+			// The requester gives up before the response.
+			workerCh <- req.worker
+			cancel()
+			return "", errFakeWorkerNoResponse
+		}
+		return "{}", nil
+	})
+
+	err := channel.RequestCtx(ctx, "worker.dump", internalData{}).Err()
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	worker := <-workerCh
+
+	// A late response received while the request is still registered, before the requester
+	// removes it, does not block the read loop.
+	channel.sents.Store(int64(1000), newSentInfo("worker.dump", nil, nil))
+	worker.WritePayload([]byte(`{"id":1000,"accepted":true}`))
+
+	// A late response received once the request is removed is dropped.
+	worker.WritePayload([]byte(`{"id":1,"accepted":true}`))
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, channel.RequestCtx(ctx, "worker.getResourceUsage", internalData{}).Err())
+}
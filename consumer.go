@@ -1,8 +1,14 @@
 package mediasoup
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/go-logr/logr"
 )
@@ -53,8 +59,107 @@ type ConsumerOptions struct {
 	AppData interface{} `json:"appData,omitempty"`
 
 	Ssrc uint32 `json:"ssrc,omitempty"`
+
+	// RtpQueue define whether "rtp" events are delivered on a dedicated goroutine through a
+	// bounded queue. If unset, "rtp" handlers are called synchronously by the PayloadChannel.
+	RtpQueue *RtpQueueOptions `json:"-"`
+
+	// Context is the parent of the Consumer's lifecycle context, which is passed to event
+	// handlers accepting a context (such as OnScoreCtx). Its values, like tracing spans, are
+	// inherited. Default context.Background().
+	Context context.Context `json:"-"`
+
+	// EmitInitialState define whether the Consumer emits synthetic events reflecting its initial
+	// state ("producerpause" and "pause" if created paused, "score" and "layerschange" if known),
+	// so the same handlers cover the initial and subsequent states. They are emitted right after
+	// the "newconsumer" event of the transport observer, so handlers must be set in a listener
+	// of that event to receive them. Default false.
+	EmitInitialState bool `json:"-"`
+
+	// SuppressRtpWhilePaused define whether "rtp" events are not delivered while the Consumer is
+	// paused by Pause(), so recorders do not capture the packets (such as probation ones) still
+	// sent by mediasoup-worker meanwhile. They are delivered again after Resume(). Default false.
+	SuppressRtpWhilePaused bool `json:"-"`
+
+	// PipeSsrcRange define the range the SSRCs sent by a pipe Consumer, including the RTX ones, are
+	// taken from, so Consumers piped from several Routers to the same Router do not collide. Just
+	// valid for PipeTransport.Consume(). In any case, the Consumers of a PipeTransport never share
+	// SSRCs. Payload types are not remapped by mediasoup-worker.
+	PipeSsrcRange *SsrcRange `json:"-"`
+
+	// DisableObserver define whether the deprecated Observer() events are not emitted, saving the
+	// work of emitting them for each notification when only the On* handlers are used. They are
+	// not emitted either while the observer has no listener. Default false.
+	DisableObserver bool `json:"-"`
+
+	// StatsHistorySize is the number of the last stats returned by GetStats(), including the ones
+	// polled by StatsStream(), kept in the history returned by StatsHistory(). Default 0, meaning
+	// no history.
+	StatsHistorySize int `json:"-"`
+
+	// StrictLayers define whether SetPreferredLayers() fails with an error wrapping
+	// ErrLayersOutOfRange if the requested layers exceed the ones of the Consumer. If unset, they
+	// are clamped to the highest available ones and a warning is logged. Default false.
+	StrictLayers bool `json:"-"`
+
+	// ForceCodec define the codec the Consumer must use when the Producer offers several ones,
+	// such as VP8 and H264, so every Consumer of a recording or a room uses the same codec. The
+	// codec must be consumable by the consuming endpoint, otherwise Consume() fails with an
+	// error wrapping ErrCodecNotConsumable. It only selects the codec of the Consumer RTP
+	// parameters: it does not make the Producer send that codec, and mediasoup-worker does not
+	// transcode, so a Consumer forced to a codec the Producer is not sending receives no media
+	// without any error. Just valid for non pipe Consumers.
+	ForceCodec *ForcedCodec `json:"-"`
+
+	// ReducedSizeRtcp define whether reduced size RTCP (RFC 5506) is used with the consuming
+	// endpoint rather than compound RTCP, as negotiated with it (e.g. a=rtcp-rsize in SDP). It is
+	// reflected in RtpParameters().Rtcp.ReducedSize so the endpoint can be signaled accordingly.
+	// Just valid for non pipe Consumers, the ones of a PipeTransport keeping the RTCP parameters
+	// of the Producer. Default nil, meaning true.
+	ReducedSizeRtcp *bool `json:"-"`
+
+	// DumpWatchInterval is the interval at which the Consumer dumps itself, emitting
+	// "dumpchange" when the dump differs from the previous one, until it is closed. Default 0,
+	// meaning no periodic dump.
+	DumpWatchInterval time.Duration `json:"-"`
+
+	// ReplayLatestOnSubscribe define whether setting a handler with OnScore, OnScoreCtx,
+	// OnLayersChange, OnPause or OnProducerPause calls it at once with the latest state of the
+	// Consumer (its score, current layers if any, and pause if paused), so a handler set late does
+	// not miss it. Default false.
+	ReplayLatestOnSubscribe bool `json:"-"`
+}
+
+// ForcedCodec identifies a codec of the consumable RTP parameters of a Producer.
+type ForcedCodec struct {
+	// MimeType is the MIME type of the codec, case insensitive.
+	MimeType string
+
+	// PayloadType is the payload type of the codec in the consumable RTP parameters of the
+	// Producer, to select one of several codecs with the same MIME type (such as H264 with
+	// different profiles). 0 matches the first codec with MimeType.
+	PayloadType byte
 }
 
+// ErrIncompatibleReplacement is wrapped by the error returned by Consumer.ReplaceProducer() when
+// the new Producer can not be consumed without renegotiation.
+var ErrIncompatibleReplacement = errors.New("incompatible producer replacement")
+
+// ErrCannotConsume is wrapped by the UnsupportedError returned by Transport.Consume() and
+// Consumer.ReplaceProducer() when the RtpCapabilities of the consuming endpoint have no codec
+// compatible with the Producer. The error message lists the Producer media codecs.
+var ErrCannotConsume = errors.New("cannot consume")
+
+// ErrCodecNotConsumable is wrapped by the UnsupportedError returned by Transport.Consume() when
+// the codec of ConsumerOptions.ForceCodec is not offered by the Producer or not supported by the
+// consuming endpoint.
+var ErrCodecNotConsumable = errors.New("codec not consumable")
+
+// ErrLayersOutOfRange is wrapped by the error returned by Consumer.SetPreferredLayers() when the
+// requested layers exceed the ones of a Consumer created with StrictLayers, and by
+// Consumer.SetPreferredTemporalLayer() when the temporal layer exceeds them.
+var ErrLayersOutOfRange = errors.New("preferred layers out of range")
+
 // ConsumerTraceEventType is valid types for "trace" event.
 type ConsumerTraceEventType string
 
@@ -71,7 +176,8 @@ type ConsumerTraceEventData struct {
 	// Type is trace type.
 	Type ConsumerTraceEventType `json:"type,omitempty"`
 
-	// timestamp is event timestamp.
+	// Timestamp is event timestamp in milliseconds of the worker monotonic clock. Use Time()
+	// to get the wall-clock time.
 	Timestamp int64 `json:"timestamp,omitempty"`
 
 	// Direction is event direction, "in" | "out".
@@ -79,6 +185,23 @@ type ConsumerTraceEventData struct {
 
 	// Info is per type information.
 	Info H `json:"info,omitempty"`
+
+	// clock is captured by the Consumer which received the event.
+	clock *TraceClock
+}
+
+// Monotonic returns the raw timestamp as a duration of the worker monotonic clock.
+func (t ConsumerTraceEventData) Monotonic() time.Duration {
+	return time.Duration(t.Timestamp) * time.Millisecond
+}
+
+// Time returns the wall-clock time of the event. It returns zero time if the event
+// was not received by a Consumer.
+func (t ConsumerTraceEventData) Time() time.Time {
+	if t.clock == nil {
+		return time.Time{}
+	}
+	return t.clock.Time(t.Timestamp)
 }
 
 // ConsumerScore define "score" event data
@@ -102,10 +225,18 @@ type ConsumerLayers struct {
 	TemporalLayer uint8 `json:"temporalLayer"`
 }
 
+// StatType define the type of a RTP stream stat.
+type StatType string
+
+const (
+	StatType_InboundRtp  StatType = "inbound-rtp"
+	StatType_OutboundRtp StatType = "outbound-rtp"
+)
+
 // ConsumerStat include two entries: the statistics of the RTP stream in the consumer (type: "outbound-rtp")
 // and the statistics of the associated RTP stream in the producer (type: "inbound-rtp").
 type ConsumerStat struct {
-	// Common to all RtpStreams
+	// Common to all RtpStreams. Counters are not omitted when zero, since zero is meaningful.
 	Type                 string  `json:"type,omitempty"`
 	Timestamp            int64   `json:"timestamp,omitempty"`
 	Ssrc                 uint32  `json:"ssrc,omitempty"`
@@ -113,21 +244,33 @@ type ConsumerStat struct {
 	Rid                  string  `json:"rid,omitempty"`
 	Kind                 string  `json:"kind,omitempty"`
 	MimeType             string  `json:"mimeType,omitempty"`
-	PacketsLost          uint32  `json:"packetsLost,omitempty"`
-	FractionLost         uint32  `json:"fractionLost,omitempty"`
-	PacketsDiscarded     uint32  `json:"packetsDiscarded,omitempty"`
-	PacketsRetransmitted uint32  `json:"packetsRetransmitted,omitempty"`
-	PacketsRepaired      uint32  `json:"packetsRepaired,omitempty"`
-	NackCount            uint32  `json:"nackCount,omitempty"`
-	NackPacketCount      uint32  `json:"nackPacketCount,omitempty"`
-	PliCount             uint32  `json:"pliCount,omitempty"`
-	FirCount             uint32  `json:"firCount,omitempty"`
-	Score                uint32  `json:"score,omitempty"`
-	PacketCount          int64   `json:"packetCount,omitempty"`
-	ByteCount            int64   `json:"byteCount,omitempty"`
-	Bitrate              uint32  `json:"bitrate,omitempty"`
-	RoundTripTime        float32 `json:"roundTripTime,omitempty"`
-	RtxPacketsDiscarded  uint32  `json:"rtxPacketsDiscarded,omitempty"`
+	PacketsLost          uint32  `json:"packetsLost"`
+	FractionLost         uint32  `json:"fractionLost"`
+	PacketsDiscarded     uint32  `json:"packetsDiscarded"`
+	PacketsRetransmitted uint32  `json:"packetsRetransmitted"`
+	PacketsRepaired      uint32  `json:"packetsRepaired"`
+	NackCount            uint32  `json:"nackCount"`
+	NackPacketCount      uint32  `json:"nackPacketCount"`
+	PliCount             uint32  `json:"pliCount"`
+	FirCount             uint32  `json:"firCount"`
+	Score                uint32  `json:"score"`
+	PacketCount          int64   `json:"packetCount"`
+	ByteCount            int64   `json:"byteCount"`
+	Bitrate              uint32  `json:"bitrate"`
+	RoundTripTime        float32 `json:"roundTripTime"`
+	RtxPacketsDiscarded  uint32  `json:"rtxPacketsDiscarded"`
+	// Jitter is the interarrival jitter in RTP timestamp units, only in the "inbound-rtp" entry.
+	Jitter uint32 `json:"jitter"`
+}
+
+// StatType returns the type of the stat as a StatType.
+func (stat ConsumerStat) StatType() StatType {
+	return StatType(stat.Type)
+}
+
+// MediaKind returns the kind of the stat as a MediaKind.
+func (stat ConsumerStat) MediaKind() MediaKind {
+	return MediaKind(stat.Kind)
 }
 
 // ProducerType define Consumer type.
@@ -140,17 +283,41 @@ const (
 	ConsumerType_Pipe      ConsumerType = "pipe"
 )
 
+// ConsumerInitialState is the state of a Consumer returned by the worker on creation.
+type ConsumerInitialState struct {
+	Paused          bool
+	ProducerPaused  bool
+	Score           *ConsumerScore
+	PreferredLayers *ConsumerLayers
+}
+
 type consumerParams struct {
 	// internal uses routerId, transportId, consumerId, producerId
-	internal        internalData
-	data            consumerData
-	channel         *Channel
-	payloadChannel  *PayloadChannel
-	appData         interface{}
-	paused          bool
-	producerPaused  bool
-	score           *ConsumerScore
-	preferredLayers *ConsumerLayers
+	internal            internalData
+	data                consumerData
+	channel             *Channel
+	payloadChannel      *PayloadChannel
+	appData             interface{}
+	paused              bool
+	producerPaused      bool
+	score               *ConsumerScore
+	preferredLayers     *ConsumerLayers
+	intendedLayers      *ConsumerLayers // Preferred layers requested by the application.
+	rtpQueue            *RtpQueueOptions
+	producerRids        []string
+	producerMaxBitrates []int
+	rtpEnabled          bool // Whether "rtp" events are delivered, i.e. consuming on a DirectTransport.
+	suppressPausedRtp   bool
+	strictLayers        bool
+	statsHistorySize    int
+	dumpWatchInterval   time.Duration
+	disableObserver     bool
+	replayLatest        bool
+	ssrcMapping         map[uint32]uint32
+	setupTimings        ConsumerSetupTimings // Completed by newConsumer().
+	ctx                 context.Context
+	options             ConsumerOptions // Options the Consumer was created with.
+	replaceProducer     func(consumer *Consumer, producerId string, rtpCapabilities RtpCapabilities) (*Consumer, error)
 }
 
 type consumerData struct {
@@ -169,37 +336,113 @@ type consumerData struct {
 //   - @emits producerresume
 //   - @emits score - (score *ConsumerScore)
 //   - @emits layerschange - (layers *ConsumerLayers | nil)
+//   - @emits rtpparameterschange - (rtpParameters RtpParameters)
 //   - @emits rtp - (packet []byte)
+//   - @emits rtcp - (packet []byte)
 //   - @emits trace - (trace *ConsumerTraceEventData)
+//   - @emits alert - (alert Alert)
+//   - @emits dumpchange - (dump *ConsumerDump, diff []string)
 //   - @emits @close
 //   - @emits @producerclose
+//   - @emits @flowing
 type Consumer struct {
 	IEventEmitter
-	logger           logr.Logger
-	internal         internalData
-	data             consumerData
-	channel          *Channel
-	payloadChannel   *PayloadChannel
-	appData          interface{}
-	paused           bool
-	closed           uint32
-	producerPaused   bool
-	priority         uint32
-	score            *ConsumerScore
-	preferredLayers  *ConsumerLayers
-	currentLayers    *ConsumerLayers // Current video layers (just for video with simulcast or SVC).
-	observer         IEventEmitter
-	onClose          func()
-	onProducerClose  func()
-	onTransportClose func()
-	onPause          func()
-	onResume         func()
-	onProducerPause  func()
-	onProducerResume func()
-	onScore          func(*ConsumerScore)
-	onLayersChange   func(*ConsumerLayers)
-	onTrace          func(*ConsumerTraceEventData)
-	onRtp            func([]byte)
+	eventCounts           ConsumerEventStats
+	logger                logr.Logger
+	internal              internalData
+	data                  consumerData
+	channel               *Channel
+	payloadChannel        *PayloadChannel
+	appData               interface{}
+	labels                map[string]string
+	labelsLocker          sync.RWMutex
+	paused                bool
+	closed                uint32
+	producerPaused        bool
+	priority              uint32
+	producerScore         uint32 // ProducerScore of the latest score received, 0 if none.
+	score                 *ConsumerScore
+	preferredLayers       *ConsumerLayers
+	intendedLayers        *ConsumerLayers // Preferred layers requested by the application.
+	appliedLayers         *ConsumerLayers // Preferred layers last answered by the worker.
+	intendedGeneration    uint64          // Incremented each time intendedLayers is set.
+	restoringLayers       uint32
+	intendedLayerSent     bool            // Whether the intended spatial layer was sent at the last score.
+	currentLayers         *ConsumerLayers // Current video layers (just for video with simulcast or SVC).
+	traceClock            *TraceClock     // Captured on the first "trace" event.
+	traceLocker           sync.Mutex      // Guards traceEventTypes, traceEnabled, traceWaiters and keyFrameCount.
+	traceUpdateLocker     sync.Mutex      // Serializes "consumer.enableTraceEvent" requests.
+	traceEventTypes       []ConsumerTraceEventType
+	traceEnabled          map[ConsumerTraceEventType]bool // Set of traceEventTypes.
+	traceWaiters          map[ConsumerTraceEventType]map[chan struct{}]struct{}
+	keyFrameCount         uint64      // "keyframe" trace events since the type was enabled.
+	traceExpiry           *time.Timer // Disables the trace events enabled by EnableTraceEventFor().
+	traceExpiryLocker     sync.Mutex
+	rtpQueue              *rtpQueue
+	scoreSampler          *scoreSampler
+	layersCoalescer       *layersCoalescer
+	producerRids          []string // RIDs of the Producer encodings, if any.
+	producerMaxBitrates   []int    // Max bitrates of the Producer encodings, 0 if unknown.
+	maxBitrate            int64
+	maxBitrateLayer       *uint8 // Highest spatial layer allowed by maxBitrate, nil if unlimited.
+	parentCtx             context.Context
+	ctx                   context.Context
+	cancel                context.CancelFunc
+	createdAt             time.Time
+	setupTimings          ConsumerSetupTimings
+	initialState          ConsumerInitialState
+	pausedLocker          sync.Mutex
+	pausedAt              time.Time // Zero unless paused or producer paused.
+	pausedDuration        time.Duration
+	closedAt              time.Time
+	rtpEnabled            bool
+	suppressPausedRtp     bool
+	strictLayers          bool
+	disableObserver       bool
+	replayLatest          bool              // Whether On* handlers are called with the latest state.
+	ssrcMapping           map[uint32]uint32 // Consumable SSRC:SSRC sent, for pipe Consumers.
+	statsHistorySize      int
+	statsHistory          []StatsSnapshot // Oldest first.
+	statsHistoryLocker    sync.Mutex
+	alerts                consumerAlerts
+	lastDump              *ConsumerDump // Latest dump of the periodic dump, see DumpWatchInterval.
+	lastDumpLocker        sync.Mutex
+	firstRtpLocker        sync.Mutex
+	resumedAt             time.Time // Time of the last successful Resume().
+	timeToFirstRtp        time.Duration
+	firstRtpReceived      bool          // Whether a "rtp" event was received since resumedAt.
+	firstRtp              chan struct{} // Closed on the first "rtp" event since resumedAt.
+	settingsLocker        sync.Mutex    // Serializes SetPreferredLayers() and SetPriority().
+	layersLocker          sync.RWMutex  // Guards preferredLayers, intendedLayers, intendedGeneration, appliedLayers and currentLayers.
+	asyncLayersLocker     sync.Mutex
+	asyncLayersPending    *asyncLayersRequest // Latest SetPreferredLayersAsync() request not sent yet.
+	asyncLayersSending    bool                // Whether a goroutine sends the SetPreferredLayersAsync() requests.
+	scoreLocker           sync.RWMutex        // Guards score.
+	rtpParametersLocker   sync.RWMutex        // Guards data.RtpParameters.
+	deliveries            consumerDeliveries
+	options               ConsumerOptions // Options the Consumer was created with, reused by ReplaceProducer().
+	replaceProducer       func(consumer *Consumer, producerId string, rtpCapabilities RtpCapabilities) (*Consumer, error)
+	observer              IEventEmitter
+	onClose               func()
+	onProducerClose       func()
+	onTransportClose      func()
+	onPause               func()
+	onResume              func()
+	onProducerPause       func()
+	onProducerResume      func()
+	onScore               func(*ConsumerScore)
+	onScoreCtx            func(context.Context, *ConsumerScore)
+	onLayersChange        func(*ConsumerLayers)
+	onRtpParametersChange func(RtpParameters)
+	onTrace               func(*ConsumerTraceEventData)
+	onTraceType           map[ConsumerTraceEventType]func(*ConsumerTraceEventData)
+	onTraceTypeLocker     sync.Mutex
+	onRtp                 func([]byte)
+	onRtpGap              func(missing, from, to uint16)
+	rtpSequence           rtpSequenceTracker
+	onRtcp                func([]byte)
+	onAlert               func(Alert)
+	onDumpChange          func(dump *ConsumerDump, diff []string)
 }
 
 func newConsumer(params consumerParams) *Consumer {
@@ -218,23 +461,68 @@ func newConsumer(params consumerParams) *Consumer {
 	}
 
 	consumer := &Consumer{
-		IEventEmitter:   NewEventEmitter(),
-		logger:          logger,
-		internal:        params.internal,
-		data:            params.data,
-		channel:         params.channel,
-		payloadChannel:  params.payloadChannel,
-		appData:         params.appData,
-		paused:          params.paused,
-		producerPaused:  params.producerPaused,
-		priority:        1,
-		score:           score,
-		preferredLayers: params.preferredLayers,
-		observer:        NewEventEmitter(),
+		IEventEmitter:       NewEventEmitter(),
+		logger:              logger,
+		internal:            params.internal,
+		data:                params.data,
+		channel:             params.channel,
+		payloadChannel:      params.payloadChannel,
+		appData:             params.appData,
+		paused:              params.paused,
+		producerPaused:      params.producerPaused,
+		priority:            1,
+		score:               score,
+		preferredLayers:     params.preferredLayers,
+		appliedLayers:       params.preferredLayers,
+		intendedLayers:      params.intendedLayers,
+		producerRids:        params.producerRids,
+		producerMaxBitrates: params.producerMaxBitrates,
+		rtpEnabled:          params.rtpEnabled,
+		suppressPausedRtp:   params.suppressPausedRtp,
+		strictLayers:        params.strictLayers,
+		statsHistorySize:    params.statsHistorySize,
+		disableObserver:     params.disableObserver,
+		replayLatest:        params.replayLatest,
+		ssrcMapping:         params.ssrcMapping,
+		options:             params.options,
+		replaceProducer:     params.replaceProducer,
+		observer:            NewEventEmitter(),
+	}
+
+	ctx := params.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	consumer.parentCtx = ctx
+	consumer.ctx, consumer.cancel = context.WithCancel(ctx)
+
+	if params.score != nil {
+		consumer.producerScore = uint32(params.score.ProducerScore)
+	}
+
+	consumer.createdAt = time.Now()
+	consumer.initialState = ConsumerInitialState{
+		Paused:          consumer.paused,
+		ProducerPaused:  consumer.producerPaused,
+		Score:           params.score, // Not the default score, which the worker did not send.
+		PreferredLayers: consumer.preferredLayers,
+	}
+	// Start counting the paused time if created paused.
+	consumer.setPausedFlag(&consumer.paused, consumer.paused)
+
+	if params.rtpQueue != nil {
+		consumer.rtpQueue = newRtpQueue(*params.rtpQueue, consumer.emitRtp)
 	}
 
 	consumer.handleWorkerNotifications()
 
+	consumer.setupTimings = params.setupTimings
+	consumer.setupTimings.Subscribed = time.Now()
+
+	if params.dumpWatchInterval > 0 {
+		go consumer.watchDump(params.dumpWatchInterval)
+	}
+
 	return consumer
 }
 
@@ -265,6 +553,9 @@ func (consumer *Consumer) Kind() MediaKind {
 
 // RtpParameters returns RTP parameters.
 func (consumer *Consumer) RtpParameters() RtpParameters {
+	consumer.rtpParametersLocker.RLock()
+	defer consumer.rtpParametersLocker.RUnlock()
+
 	return consumer.data.RtpParameters
 }
 
@@ -273,33 +564,115 @@ func (consumer *Consumer) Type() ConsumerType {
 	return consumer.data.Type
 }
 
+// SpatialLayers returns the number of spatial layers the Consumer can select with
+// SetPreferredLayers(), 1 if it is not a simulcast or SVC Consumer.
+func (consumer *Consumer) SpatialLayers() uint8 {
+	return consumer.scalabilityMode().SpatialLayers
+}
+
+// TemporalLayers returns the number of temporal layers the Consumer can select with
+// SetPreferredLayers(), 1 if it is not a simulcast or SVC Consumer.
+func (consumer *Consumer) TemporalLayers() uint8 {
+	return consumer.scalabilityMode().TemporalLayers
+}
+
+// scalabilityMode returns the scalability mode of the Consumer encodings, as computed by
+// getConsumerRtpParameters() (simulcast streams are counted as spatial layers).
+func (consumer *Consumer) scalabilityMode() ScalabilityMode {
+	encodings := consumer.RtpParameters().Encodings
+
+	if len(encodings) == 0 {
+		return ParseScalabilityMode("")
+	}
+
+	mode := ParseScalabilityMode(encodings[0].ScalabilityMode)
+
+	// Pipe Consumers keep every encoding of the Producer.
+	if len(encodings) > 1 {
+		mode.SpatialLayers = uint8(len(encodings))
+	}
+
+	return mode
+}
+
 // Paused returns whether the Consumer is paused.
 func (consumer *Consumer) Paused() bool {
+	consumer.pausedLocker.Lock()
+	defer consumer.pausedLocker.Unlock()
+
 	return consumer.paused
 }
 
 // ProducerPaused returns whether the associate Producer is paused.
 func (consumer *Consumer) ProducerPaused() bool {
+	consumer.pausedLocker.Lock()
+	defer consumer.pausedLocker.Unlock()
+
 	return consumer.producerPaused
 }
 
+// EffectivelyPaused returns whether no media flows through the Consumer because either it or its
+// Producer is paused.
+func (consumer *Consumer) EffectivelyPaused() bool {
+	consumer.pausedLocker.Lock()
+	defer consumer.pausedLocker.Unlock()
+
+	return consumer.paused || consumer.producerPaused
+}
+
 // Priority returns current priority.
 func (consumer *Consumer) Priority() uint32 {
-	return consumer.priority
+	return atomic.LoadUint32(&consumer.priority)
 }
 
 // Score returns consumer score with consumer and consumer keys.
 func (consumer *Consumer) Score() *ConsumerScore {
+	consumer.scoreLocker.RLock()
+	defer consumer.scoreLocker.RUnlock()
+
 	return consumer.score
 }
 
+// LatestProducerScore returns the score of the RTP stream of the Producer, as cached from the
+// latest score of the Consumer, without a GetStats() request. It returns 0 if mediasoup-worker
+// reported no score yet.
+func (consumer *Consumer) LatestProducerScore() uint16 {
+	return uint16(atomic.LoadUint32(&consumer.producerScore))
+}
+
+func (consumer *Consumer) setScore(score *ConsumerScore) {
+	consumer.scoreLocker.Lock()
+	consumer.score = score
+	consumer.scoreLocker.Unlock()
+
+	if score != nil {
+		atomic.StoreUint32(&consumer.producerScore, uint32(score.ProducerScore))
+	}
+}
+
 // PreferredLayers returns preferred video layers.
 func (consumer *Consumer) PreferredLayers() *ConsumerLayers {
+	consumer.layersLocker.RLock()
+	defer consumer.layersLocker.RUnlock()
+
 	return consumer.preferredLayers
 }
 
+// IntendedPreferredLayers returns the preferred layers requested by the application, through
+// ConsumerOptions.PreferredLayers or the last successful SetPreferredLayers(), or nil if none.
+// They may differ from PreferredLayers(), which are the ones in effect in mediasoup-worker.
+func (consumer *Consumer) IntendedPreferredLayers() *ConsumerLayers {
+	consumer.layersLocker.RLock()
+	defer consumer.layersLocker.RUnlock()
+
+	return consumer.intendedLayers
+}
+
 // CurrentLayers returns current video layers.
 func (consumer *Consumer) CurrentLayers() *ConsumerLayers {
+	consumer.layersLocker.RLock()
+	defer consumer.layersLocker.RUnlock()
+
 	return consumer.currentLayers
 }
 
@@ -308,7 +681,200 @@ func (consumer *Consumer) AppData() interface{} {
 	return consumer.appData
 }
 
-// Deprecated
+// SetLabels replaces the labels of the Consumer, such as the room or the quality tier, which
+// unlike AppData are typed key/values the Consumers can be filtered by, see
+// Router.ConsumersByLabel(). The map is copied.
+func (consumer *Consumer) SetLabels(labels map[string]string) {
+	copied := make(map[string]string, len(labels))
+	for key, value := range labels {
+		copied[key] = value
+	}
+
+	consumer.labelsLocker.Lock()
+	consumer.labels = copied
+	consumer.labelsLocker.Unlock()
+}
+
+// Labels returns a copy of the labels of the Consumer.
+func (consumer *Consumer) Labels() map[string]string {
+	consumer.labelsLocker.RLock()
+	defer consumer.labelsLocker.RUnlock()
+
+	labels := make(map[string]string, len(consumer.labels))
+	for key, value := range consumer.labels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// hasLabel returns whether the Consumer has the label key with value.
+func (consumer *Consumer) hasLabel(key, value string) bool {
+	consumer.labelsLocker.RLock()
+	defer consumer.labelsLocker.RUnlock()
+
+	v, ok := consumer.labels[key]
+	return ok && v == value
+}
+
+// String returns a one-line description of the Consumer for logging. It only reads the state
+// cached from the worker notifications and never issues a request.
+func (consumer *Consumer) String() string {
+	score, currentLayers, preferredLayers := "-", "-", "-"
+
+	if s := consumer.Score(); s != nil {
+		score = fmt.Sprintf("%d/%d", s.Score, s.ProducerScore)
+	}
+	if l := consumer.CurrentLayers(); l != nil {
+		currentLayers = fmt.Sprintf("%d/%d", l.SpatialLayer, l.TemporalLayer)
+	}
+	if l := consumer.PreferredLayers(); l != nil {
+		preferredLayers = fmt.Sprintf("%d/%d", l.SpatialLayer, l.TemporalLayer)
+	}
+
+	return fmt.Sprintf("Consumer(id:%s kind:%s type:%s producerId:%s paused:%t producerPaused:%t "+
+		"score:%s priority:%d currentLayers:%s preferredLayers:%s)",
+		consumer.Id(), consumer.Kind(), consumer.Type(), consumer.ProducerId(), consumer.Paused(),
+		consumer.ProducerPaused(), score, consumer.Priority(), currentLayers, preferredLayers)
+}
+
+// TimeToFirstRtp returns the delay between the last Resume() and the first "rtp" event received
+// after it. It returns false if no RTP packet was received since the last Resume(), or if "rtp"
+// events are not delivered for this Consumer (that is, it was not created on a DirectTransport).
+func (consumer *Consumer) TimeToFirstRtp() (time.Duration, bool) {
+	if !consumer.rtpEnabled {
+		return 0, false
+	}
+
+	consumer.firstRtpLocker.Lock()
+	defer consumer.firstRtpLocker.Unlock()
+
+	return consumer.timeToFirstRtp, consumer.firstRtpReceived
+}
+
+// Context returns the lifecycle context of the Consumer, which is canceled once it is closed.
+func (consumer *Consumer) Context() context.Context {
+	return consumer.ctx
+}
+
+// InitialState returns the state of the Consumer on creation, as returned by the worker. Use
+// ConsumerOptions.EmitInitialState to get it as events.
+func (consumer *Consumer) InitialState() ConsumerInitialState {
+	return consumer.initialState
+}
+
+// CreatedAt returns the time the Consumer was created.
+func (consumer *Consumer) CreatedAt() time.Time {
+	return consumer.createdAt
+}
+
+// TotalPausedDuration returns the cumulative time the Consumer has been paused, either by itself
+// or because the Producer was paused. It stops growing once the Consumer is closed.
+func (consumer *Consumer) TotalPausedDuration() time.Duration {
+	consumer.pausedLocker.Lock()
+	defer consumer.pausedLocker.Unlock()
+
+	duration := consumer.pausedDuration
+	if !consumer.pausedAt.IsZero() {
+		duration += time.Since(consumer.pausedAt)
+	}
+	return duration
+}
+
+// ConsumerEventStats counts the events delivered by a Consumer to its listeners and handlers, to
+// help tuning the size of the RtpQueue.
+type ConsumerEventStats struct {
+	// Score is the number of "score" events, including the synthetic initial one.
+	Score uint64 `json:"score"`
+
+	// Layers is the number of "layerschange" events, including the synthetic initial one.
+	Layers uint64 `json:"layers"`
+
+	// Trace is the number of "trace" events.
+	Trace uint64 `json:"trace"`
+
+	// Rtp is the number of "rtp" events.
+	Rtp uint64 `json:"rtp"`
+
+	// DroppedRtp is the number of "rtp" events dropped since the RtpQueue was full. "rtp" events
+	// not delivered due to SuppressRtpWhilePaused are not counted.
+	DroppedRtp uint64 `json:"droppedRtp"`
+}
+
+// EventStats returns the numbers of events delivered and dropped so far.
+func (consumer *Consumer) EventStats() ConsumerEventStats {
+	return ConsumerEventStats{
+		Score:      atomic.LoadUint64(&consumer.eventCounts.Score),
+		Layers:     atomic.LoadUint64(&consumer.eventCounts.Layers),
+		Trace:      atomic.LoadUint64(&consumer.eventCounts.Trace),
+		Rtp:        atomic.LoadUint64(&consumer.eventCounts.Rtp),
+		DroppedRtp: consumer.DroppedRtpPackets(),
+	}
+}
+
+// SsrcMapping returns, for a pipe Consumer, the SSRC it sends for each consumable SSRC of the
+// Producer, including RTX ones, as assigned by PipeTransport.Consume(). It returns nil for other
+// Consumers. The stats and "rtp" events of the Consumer use the SSRCs it sends.
+func (consumer *Consumer) SsrcMapping() map[uint32]uint32 {
+	if consumer.ssrcMapping == nil {
+		return nil
+	}
+	mapping := make(map[uint32]uint32, len(consumer.ssrcMapping))
+	for consumable, ssrc := range consumer.ssrcMapping {
+		mapping[consumable] = ssrc
+	}
+	return mapping
+}
+
+// Cname returns the RTCP CNAME of the Consumer, as in its RtpParameters, to build the
+// "a=ssrc:<ssrc> cname:<cname>" lines of an SDP.
+func (consumer *Consumer) Cname() string {
+	return consumer.RtpParameters().Rtcp.Cname
+}
+
+// ConsumerSsrc is the SSRC of an encoding sent by a Consumer, with the SSRC of its RTX stream.
+type ConsumerSsrc struct {
+	Ssrc uint32
+
+	// RtxSsrc is 0 if the encoding has no RTX stream.
+	RtxSsrc uint32
+}
+
+// Ssrcs returns the SSRCs sent by the Consumer, one per encoding of its RtpParameters with the RTX
+// SSRC paired, so an SDP can write "a=ssrc-group:FID" lines.
+func (consumer *Consumer) Ssrcs() []ConsumerSsrc {
+	encodings := consumer.RtpParameters().Encodings
+	ssrcs := make([]ConsumerSsrc, 0, len(encodings))
+
+	for _, encoding := range encodings {
+		if encoding.Ssrc == 0 {
+			continue
+		}
+		ssrc := ConsumerSsrc{Ssrc: encoding.Ssrc}
+		if encoding.Rtx != nil {
+			ssrc.RtxSsrc = encoding.Rtx.Ssrc
+		}
+		ssrcs = append(ssrcs, ssrc)
+	}
+	return ssrcs
+}
+
+// observerEnabled returns whether the observer events must be emitted, which is checked before
+// building their arguments.
+func (consumer *Consumer) observerEnabled() bool {
+	return !consumer.disableObserver && consumer.observer.ListenerCount() > 0
+}
+
+// DroppedRtpPackets returns the number of RTP packets dropped by the "rtp" queue. It is
+// always 0 if ConsumerOptions.RtpQueue is unset.
+func (consumer *Consumer) DroppedRtpPackets() uint64 {
+	if consumer.rtpQueue == nil {
+		return 0
+	}
+	return consumer.rtpQueue.droppedCount()
+}
+
+// Deprecated: use the handlers set by OnClose, OnPause, OnResume, OnScore, OnLayersChange and
+// OnTrace, which are called for every observer event. Set DeprecatedUsage to find the usages.
 //
 //   - @emits close
 //   - @emits pause
@@ -317,10 +883,15 @@ func (consumer *Consumer) AppData() interface{} {
 //   - @emits layerschange - (layers *ConsumerLayers | nil)
 //   - @emits trace - (trace *ConsumerTraceEventData)
 func (consumer *Consumer) Observer() IEventEmitter {
+	reportDeprecatedUsage("Consumer.Observer")
+
 	return consumer.observer
 }
 
-// Close the Consumer.
+// Close the Consumer. No "rtp" or "rtcp" handler call starts once Close() is called, but a call
+// already in progress on the PayloadChannel goroutine can still be running when it returns. Call
+// WaitDeliveries() after Close() when handlers must not run anymore, e.g. before releasing what
+// they use, unless Close() is called by one of these handlers.
 func (consumer *Consumer) Close() (err error) {
 	if atomic.CompareAndSwapUint32(&consumer.closed, 0, 1) {
 		consumer.logger.V(1).Info("close()")
@@ -346,8 +917,31 @@ func (consumer *Consumer) Close() (err error) {
 
 // close send "close" event.
 func (consumer *Consumer) close() {
+	defer consumer.cancel()
+
+	consumer.pausedLocker.Lock()
+	consumer.closedAt = time.Now()
+	if !consumer.pausedAt.IsZero() {
+		consumer.pausedDuration += consumer.closedAt.Sub(consumer.pausedAt)
+		consumer.pausedAt = time.Time{}
+	}
+	consumer.pausedLocker.Unlock()
+
+	if consumer.rtpQueue != nil {
+		consumer.rtpQueue.close()
+	}
+	if sampler := consumer.scoreSampler; sampler != nil {
+		sampler.close()
+	}
+	if coalescer := consumer.layersCoalescer; coalescer != nil {
+		coalescer.close()
+	}
+	consumer.stopTraceExpiry()
+
 	// Emit observer event.
-	consumer.observer.SafeEmit("close")
+	if consumer.observerEnabled() {
+		consumer.observer.SafeEmit("close")
+	}
 	consumer.observer.RemoveAllListeners()
 
 	if handler := consumer.onClose; handler != nil {
@@ -355,6 +949,29 @@ func (consumer *Consumer) close() {
 	}
 }
 
+// producerClosed is called when the Producer was closed, either by the Producer itself or when the
+// "producerclose" notification is received.
+func (consumer *Consumer) producerClosed() {
+	if atomic.CompareAndSwapUint32(&consumer.closed, 0, 1) {
+		consumer.logger.V(1).Info("producerClosed()")
+
+		consumer.channel.Unsubscribe(consumer.internal.ConsumerId)
+		consumer.payloadChannel.Unsubscribe(consumer.internal.ConsumerId)
+
+		// A panicking "@producerclose" listener must not prevent the Consumer from
+		// being closed nor the OnProducerClose handler from being called.
+		consumer.SafeEmit("@producerclose")
+		safeEmitCtx(consumer.IEventEmitter, consumer.ctx, "producerclose")
+		consumer.RemoveAllListeners()
+
+		if handler := consumer.onProducerClose; handler != nil {
+			handler()
+		}
+
+		consumer.close()
+	}
+}
+
 // transportClosed is called when transport was closed.
 func (consumer *Consumer) transportClosed() {
 	if atomic.CompareAndSwapUint32(&consumer.closed, 0, 1) {
@@ -390,16 +1007,156 @@ func (consumer *Consumer) GetStats() (stats []*ConsumerStat, err error) {
 	consumer.logger.V(1).Info("getStats()")
 
 	resp := consumer.channel.Request("consumer.getStats", consumer.internal)
-	err = resp.Unmarshal(&stats)
+	if err = resp.Unmarshal(&stats); err != nil {
+		return
+	}
+
+	consumer.addStatsSnapshot(stats)
+	consumer.evaluateAlerts(stats)
 
 	return
 }
 
-// Pause the Consumer.
+// StatsSnapshot is stats returned by GetStats() at a given time.
+type StatsSnapshot struct {
+	Time  time.Time
+	Stats []*ConsumerStat
+}
+
+// StatsHistory returns the last stats returned by GetStats(), oldest first, up to
+// ConsumerOptions.StatsHistorySize.
+func (consumer *Consumer) StatsHistory() []StatsSnapshot {
+	consumer.statsHistoryLocker.Lock()
+	defer consumer.statsHistoryLocker.Unlock()
+
+	history := make([]StatsSnapshot, len(consumer.statsHistory))
+	copy(history, consumer.statsHistory)
+
+	return history
+}
+
+func (consumer *Consumer) addStatsSnapshot(stats []*ConsumerStat) {
+	if consumer.statsHistorySize <= 0 {
+		return
+	}
+
+	consumer.statsHistoryLocker.Lock()
+	defer consumer.statsHistoryLocker.Unlock()
+
+	history := consumer.statsHistory
+	if drop := len(history) - consumer.statsHistorySize + 1; drop > 0 {
+		// Shift rather than reslice, so the underlying array does not grow.
+		history = history[:copy(history, history[drop:])]
+	}
+	consumer.statsHistory = append(history, StatsSnapshot{
+		Time:  time.Now(),
+		Stats: stats,
+	})
+}
+
+// StatsStream polls GetStats() every interval and sends the stats on the returned channel, until
+// ctx is done or the Consumer is closed, then closes the channel. A failed poll is logged and
+// skipped without stopping the stream. Stats are not sent while the previous ones are not read.
+func (consumer *Consumer) StatsStream(ctx context.Context, interval time.Duration) <-chan []*ConsumerStat {
+	consumer.logger.V(1).Info("statsStream()", "interval", interval)
+
+	ch := make(chan []*ConsumerStat)
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-consumer.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			stats, err := consumer.GetStats()
+			if err != nil {
+				if !consumer.Closed() {
+					consumer.logger.Error(err, "statsStream() | failed to get stats")
+				}
+				continue
+			}
+
+			select {
+			case ch <- stats:
+			case <-ctx.Done():
+				return
+			case <-consumer.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// LastDump returns the latest dump taken by the periodic dump of the Consumer, nil if
+// ConsumerOptions.DumpWatchInterval is not set or no dump succeeded yet.
+func (consumer *Consumer) LastDump() *ConsumerDump {
+	consumer.lastDumpLocker.Lock()
+	defer consumer.lastDumpLocker.Unlock()
+
+	return consumer.lastDump
+}
+
+// watchDump dumps the Consumer every interval until it is closed, emitting "dumpchange" with the
+// DumpDiff() from the previous dump when it differs. The first dump is the baseline and emits
+// nothing. A failed dump is logged and skipped.
+func (consumer *Consumer) watchDump(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-consumer.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		dump, err := consumer.Dump()
+		if err != nil {
+			if !consumer.Closed() {
+				consumer.logger.Error(err, "watchDump() | failed to dump")
+			}
+			continue
+		}
+
+		consumer.lastDumpLocker.Lock()
+		last := consumer.lastDump
+		consumer.lastDump = dump
+		consumer.lastDumpLocker.Unlock()
+
+		if last == nil {
+			continue
+		}
+		if diff := DumpDiff(last, dump); len(diff) > 0 {
+			consumer.SafeEmit("dumpchange", dump, diff)
+
+			if handler := consumer.onDumpChange; handler != nil {
+				handler(dump, diff)
+			}
+		}
+	}
+}
+
+// Pause the Consumer. Pausing an already paused Consumer does nothing.
 func (consumer *Consumer) Pause() (err error) {
 	consumer.logger.V(1).Info("pause()")
 
-	wasPaused := consumer.paused || consumer.producerPaused
+	if consumer.Closed() {
+		return NewInvalidStateError("Consumer closed")
+	}
+	if consumer.Paused() {
+		return
+	}
 
 	response := consumer.channel.Request("consumer.pause", consumer.internal)
 
@@ -407,11 +1164,13 @@ func (consumer *Consumer) Pause() (err error) {
 		return
 	}
 
-	consumer.paused = true
+	wasPaused, _ := consumer.setPausedFlag(&consumer.paused, true)
 
 	// Emit observer event.
 	if !wasPaused {
-		consumer.observer.SafeEmit("pause")
+		if consumer.observerEnabled() {
+			consumer.observer.SafeEmit("pause")
+		}
 
 		if handler := consumer.onPause; handler != nil {
 			handler()
@@ -421,11 +1180,18 @@ func (consumer *Consumer) Pause() (err error) {
 	return
 }
 
-// Resume the Consumer.
+// Resume the Consumer. Resuming a Consumer which is not paused does nothing. It only clears the
+// pause of the Consumer itself: media does not flow while the Producer is paused, see
+// EffectivelyPaused() and WaitUntilFlowing().
 func (consumer *Consumer) Resume() (err error) {
 	consumer.logger.V(1).Info("resume()")
 
-	wasPaused := consumer.paused || consumer.producerPaused
+	if consumer.Closed() {
+		return NewInvalidStateError("Consumer closed")
+	}
+	if !consumer.Paused() {
+		return
+	}
 
 	response := consumer.channel.Request("consumer.resume", consumer.internal)
 
@@ -433,11 +1199,16 @@ func (consumer *Consumer) Resume() (err error) {
 		return
 	}
 
-	consumer.paused = false
+	wasPaused, paused := consumer.setPausedFlag(&consumer.paused, false)
+	consumer.startFirstRtpTimer()
 
 	// Emit observer event.
-	if wasPaused && !consumer.producerPaused {
-		consumer.observer.SafeEmit("resume")
+	if wasPaused && !paused {
+		consumer.Emit("@flowing")
+
+		if consumer.observerEnabled() {
+			consumer.observer.SafeEmit("resume")
+		}
 
 		if handler := consumer.onResume; handler != nil {
 			handler()
@@ -447,69 +1218,778 @@ func (consumer *Consumer) Resume() (err error) {
 	return
 }
 
-// SetPreferredLayers set preferred video layers.
-func (consumer *Consumer) SetPreferredLayers(layers ConsumerLayers) (err error) {
-	consumer.logger.V(1).Info("setPreferredLayers()")
+// WaitUntilFlowing returns once neither the Consumer nor its Producer is paused, at once if it is
+// already the case. It returns ctx.Err() if ctx is done before, or an InvalidStateError if the
+// Consumer is closed meanwhile.
+func (consumer *Consumer) WaitUntilFlowing(ctx context.Context) error {
+	flowing := make(chan struct{}, 1)
+	defer listen(consumer.IEventEmitter, "@flowing", func() {
+		select {
+		case flowing <- struct{}{}:
+		default:
+		}
+	})()
 
-	response := consumer.channel.Request("consumer.setPreferredLayers", consumer.internal, layers)
-	err = response.Unmarshal(&consumer.preferredLayers)
+	if consumer.Closed() {
+		return NewInvalidStateError("Consumer closed")
+	}
+	if !consumer.EffectivelyPaused() {
+		return nil
+	}
 
-	return
+	select {
+	case <-flowing:
+		return nil
+	case <-consumer.ctx.Done():
+		return NewInvalidStateError("Consumer closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// SetPriority set priority.
-func (consumer *Consumer) SetPriority(priority uint32) (err error) {
-	consumer.logger.V(1).Info("setPriority()")
-
-	response := consumer.channel.Request("consumer.setPriority", consumer.internal, H{"priority": priority})
-
-	var result struct {
-		Priority uint32
-	}
-	if err = response.Unmarshal(&result); err != nil {
-		return
+// ResumeAndWaitForMedia resumes the Consumer and waits for media to flow: the first "rtp" event
+// on a DirectTransport, otherwise the first "keyframe" trace event for video or "rtp" trace event
+// for audio. The trace event type is enabled for the time of the call if needed, in addition to
+// the types enabled by EnableTraceEvent(), and its events are not emitted unless enabled there. It
+// returns an error wrapping ctx.Err() if no media flows before ctx is done.
+func (consumer *Consumer) ResumeAndWaitForMedia(ctx context.Context) (err error) {
+	consumer.logger.V(1).Info("resumeAndWaitForMedia()")
+
+	start := time.Now()
+
+	if consumer.rtpEnabled {
+		err = consumer.resumeAndWaitForFirstRtp(ctx)
+	} else {
+		traceType := ConsumerTraceEventType_Rtp
+		if consumer.Kind() == MediaKind_Video {
+			traceType = ConsumerTraceEventType_Keyframe
+		}
+		err = consumer.waitForTraceEvent(ctx, traceType, consumer.Resume)
 	}
 
-	consumer.priority = result.Priority
+	if err != nil && err == ctx.Err() {
+		err = fmt.Errorf("no media received %s after resume: %w", time.Since(start).Round(time.Millisecond), err)
+	}
 
 	return
 }
 
-// UnsetPriority unset priority.
-func (consumer *Consumer) UnsetPriority() (err error) {
-	consumer.logger.V(1).Info("unsetPriority()")
+// resumeAndWaitForFirstRtp resumes the Consumer and waits for the "rtp" event measured by
+// TimeToFirstRtp().
+func (consumer *Consumer) resumeAndWaitForFirstRtp(ctx context.Context) error {
+	if err := consumer.Resume(); err != nil {
+		return err
+	}
 
-	return consumer.SetPriority(1)
+	consumer.firstRtpLocker.Lock()
+	received := consumer.firstRtpChannel()
+	consumer.firstRtpLocker.Unlock()
+
+	select {
+	case <-received:
+		return nil
+	case <-consumer.ctx.Done():
+		return NewInvalidStateError("Consumer closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// RequestKeyFrame request a key frame to the Producer.
-func (consumer *Consumer) RequestKeyFrame() error {
-	consumer.logger.V(1).Info("requestKeyFrame()")
+// SetPreferredLayers set preferred video layers.
+//
+// The requested layers are remembered as the intended ones: if mediasoup-worker applies lower ones
+// since the requested spatial layer is not available at the moment, the requested ones are set
+// again once the Producer sends that layer again, as reported by the "score" events. If a bitrate
+// cap is set by SetMaxBitrate(), the spatial layer sent to mediasoup-worker is limited by it.
+//
+// For simulcast and SVC Consumers, layers beyond SpatialLayers()/TemporalLayers() are clamped to
+// the highest available ones, or rejected if the Consumer was created with StrictLayers.
+func (consumer *Consumer) SetPreferredLayers(layers ConsumerLayers) (err error) {
+	consumer.logger.V(1).Info("setPreferredLayers()")
 
-	response := consumer.channel.Request("consumer.requestKeyFrame", consumer.internal)
+	if layers, err = consumer.checkPreferredLayers(layers); err != nil {
+		return
+	}
 
-	return response.Err()
+	return consumer.setPreferredLayers(layers)
 }
 
-// EnableTraceEvent eenable "trace" event.
-func (consumer *Consumer) EnableTraceEvent(types ...ConsumerTraceEventType) error {
-	consumer.logger.V(1).Info("enableTraceEvent()")
-
-	if types == nil {
-		types = []ConsumerTraceEventType{}
+// SetPreferredLayersAsync sets the preferred layers like SetPreferredLayers() without waiting for
+// the response of mediasoup-worker, for adaptation loops where the latency of each request
+// matters. PreferredLayers() returns the requested layers at once, then the layers applied by
+// mediasoup-worker once it answers. Requests are sent one at a time: while one is in flight, only
+// the latest layers requested meanwhile are kept and sent next, the superseded ones being dropped
+// without calling their onError. If a request fails, onError, if not nil, is called with the error
+// and PreferredLayers() returns again the layers applied before, unless other layers were
+// requested meanwhile. Layers out of range are reported by the returned error as by
+// SetPreferredLayers().
+func (consumer *Consumer) SetPreferredLayersAsync(layers ConsumerLayers, onError func(err error)) (err error) {
+	consumer.logger.V(1).Info("setPreferredLayersAsync()")
+
+	if layers, err = consumer.checkPreferredLayers(layers); err != nil {
+		return
 	}
 
-	response := consumer.channel.Request("consumer.enableTraceEvent", consumer.internal, H{"types": types})
+	consumer.layersLocker.Lock()
+	optimistic := consumer.capLayers(layers)
+	consumer.preferredLayers = &optimistic
+	consumer.layersLocker.Unlock()
 
-	return response.Err()
-}
+	consumer.asyncLayersLocker.Lock()
+	consumer.asyncLayersPending = &asyncLayersRequest{
+		layers:     layers,
+		optimistic: &optimistic,
+		onError:    onError,
+	}
+	sending := consumer.asyncLayersSending
+	consumer.asyncLayersSending = true
+	consumer.asyncLayersLocker.Unlock()
+
+	if !sending {
+		go consumer.sendAsyncLayers()
+	}
+
+	return
+}
+
+// asyncLayersRequest is a SetPreferredLayersAsync() request.
+type asyncLayersRequest struct {
+	layers     ConsumerLayers
+	optimistic *ConsumerLayers // Layers cached by PreferredLayers() until mediasoup-worker answers.
+	onError    func(err error)
+}
+
+// sendAsyncLayers sends the pending SetPreferredLayersAsync() requests until there is none left.
+func (consumer *Consumer) sendAsyncLayers() {
+	for {
+		consumer.asyncLayersLocker.Lock()
+		request := consumer.asyncLayersPending
+		consumer.asyncLayersPending = nil
+		if request == nil {
+			consumer.asyncLayersSending = false
+		}
+		consumer.asyncLayersLocker.Unlock()
+
+		if request == nil {
+			return
+		}
+
+		err := consumer.setPreferredLayers(request.layers)
+		if err == nil {
+			continue
+		}
+		consumer.logger.Error(err, "setPreferredLayersAsync() | failed to set preferred layers", "layers", request.layers)
+
+		consumer.layersLocker.Lock()
+		if consumer.preferredLayers == request.optimistic {
+			consumer.preferredLayers = consumer.appliedLayers
+		}
+		consumer.layersLocker.Unlock()
+
+		if request.onError != nil {
+			request.onError(err)
+		}
+	}
+}
+
+// checkPreferredLayers returns the layers clamped to the ones of a simulcast or SVC Consumer, or
+// an error wrapping ErrLayersOutOfRange if they exceed them and StrictLayers is set.
+func (consumer *Consumer) checkPreferredLayers(layers ConsumerLayers) (ConsumerLayers, error) {
+	if typ := consumer.Type(); typ == ConsumerType_Simulcast || typ == ConsumerType_Svc {
+		spatialLayers, temporalLayers := consumer.SpatialLayers(), consumer.TemporalLayers()
+		clamped, ok := clampLayers(layers, spatialLayers, temporalLayers)
+		if !ok {
+			if consumer.strictLayers {
+				return layers, fmt.Errorf("%w: requested %+v, spatialLayers %d, temporalLayers %d",
+					ErrLayersOutOfRange, layers, spatialLayers, temporalLayers)
+			}
+			consumer.logger.Info("setPreferredLayers() | requested layers out of range, clamped",
+				"requested", layers, "clamped", clamped)
+			layers = clamped
+		}
+	}
+	return layers, nil
+}
+
+// SetPreferredLayersAndWait sets the preferred layers like SetPreferredLayers() and reports whether
+// the layers sent by the Consumer effectively changed, so applications can avoid signaling no-op
+// changes. It returns false at once if the current layers already are the requested ones,
+// otherwise it waits for the next "layerschange" event until ctx is done, returning false if none
+// came meanwhile.
+func (consumer *Consumer) SetPreferredLayersAndWait(ctx context.Context, layers ConsumerLayers) (changed bool, err error) {
+	before := consumer.CurrentLayers()
+
+	layersChanged := make(chan *ConsumerLayers, 1)
+	remove := listen(consumer.IEventEmitter, "layerschange", func(layers *ConsumerLayers) {
+		select {
+		case layersChanged <- layers:
+		default:
+		}
+	})
+	defer remove()
+
+	if err = consumer.SetPreferredLayers(layers); err != nil {
+		return
+	}
+	if before != nil && *before == layers {
+		return false, nil
+	}
+
+	select {
+	case after := <-layersChanged:
+		return !equalLayers(before, after), nil
+	case <-ctx.Done():
+		return false, nil
+	case <-consumer.ctx.Done():
+		return false, NewInvalidStateError("Consumer closed")
+	}
+}
+
+// equalLayers returns whether the layers are both nil or equal.
+func equalLayers(a, b *ConsumerLayers) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// SetPreferredTemporalLayer sets the preferred temporal layer, keeping the preferred spatial layer,
+// or the current one if there are no preferred layers, or the highest one if there are none of
+// them either. The temporal layer must be lower than TemporalLayers().
+func (consumer *Consumer) SetPreferredTemporalLayer(temporalLayer uint8) error {
+	consumer.logger.V(1).Info("setPreferredTemporalLayer()", "temporalLayer", temporalLayer)
+
+	if typ := consumer.Type(); typ != ConsumerType_Simulcast && typ != ConsumerType_Svc {
+		return NewUnsupportedError("preferred layers require a simulcast or SVC consumer")
+	}
+	if temporalLayers := consumer.TemporalLayers(); temporalLayer >= temporalLayers {
+		return fmt.Errorf("%w: requested temporal layer %d, temporalLayers %d",
+			ErrLayersOutOfRange, temporalLayer, temporalLayers)
+	}
+
+	spatialLayer := consumer.SpatialLayers() - 1
+	if layers := consumer.PreferredLayers(); layers != nil {
+		spatialLayer = layers.SpatialLayer
+	} else if layers := consumer.CurrentLayers(); layers != nil {
+		spatialLayer = layers.SpatialLayer
+	}
+
+	return consumer.SetPreferredLayers(ConsumerLayers{
+		SpatialLayer:  spatialLayer,
+		TemporalLayer: temporalLayer,
+	})
+}
+
+// clampLayers clamps the layers to the given numbers of layers, ok being false if they were out
+// of range.
+func clampLayers(layers ConsumerLayers, spatialLayers, temporalLayers uint8) (clamped ConsumerLayers, ok bool) {
+	clamped, ok = layers, true
+
+	if spatialLayers > 0 && layers.SpatialLayer >= spatialLayers {
+		clamped.SpatialLayer, ok = spatialLayers-1, false
+	}
+	if temporalLayers > 0 && layers.TemporalLayer >= temporalLayers {
+		clamped.TemporalLayer, ok = temporalLayers-1, false
+	}
+
+	return
+}
+
+func (consumer *Consumer) setPreferredLayers(layers ConsumerLayers) (err error) {
+	consumer.settingsLocker.Lock()
+	defer consumer.settingsLocker.Unlock()
+
+	return consumer.sendPreferredLayers(layers, true)
+}
+
+// restorePreferredLayers sets the intended layers again, unless other ones were set since
+// generation or they are already in effect.
+func (consumer *Consumer) restorePreferredLayers(intended ConsumerLayers, generation uint64) (err error) {
+	consumer.settingsLocker.Lock()
+	defer consumer.settingsLocker.Unlock()
+
+	consumer.layersLocker.RLock()
+	capped := consumer.capLayers(intended)
+	stale := consumer.intendedGeneration != generation || equalLayers(consumer.preferredLayers, &capped)
+	consumer.layersLocker.RUnlock()
+
+	if stale {
+		return
+	}
+
+	consumer.logger.V(1).Info("restoring intended preferred layers", "layers", intended)
+
+	return consumer.sendPreferredLayers(intended, false)
+}
+
+// sendPreferredLayers sends the preferred layers, limited by the bitrate cap, to mediasoup-worker
+// and, if intended, records them as the intended ones once accepted. settingsLocker must be held.
+func (consumer *Consumer) sendPreferredLayers(layers ConsumerLayers, intended bool) (err error) {
+	consumer.layersLocker.RLock()
+	capped := consumer.capLayers(layers)
+	consumer.layersLocker.RUnlock()
+
+	response := consumer.channel.Request("consumer.setPreferredLayers", consumer.internal, capped)
+
+	var preferredLayers *ConsumerLayers
+	if err = response.Unmarshal(&preferredLayers); err != nil {
+		return
+	}
+
+	consumer.layersLocker.Lock()
+	consumer.preferredLayers = preferredLayers
+	consumer.appliedLayers = preferredLayers
+	if intended {
+		consumer.intendedLayers = &layers
+		consumer.intendedGeneration++
+	}
+	consumer.layersLocker.Unlock()
+
+	return
+}
+
+// SetPriority set priority.
+func (consumer *Consumer) SetPriority(priority uint32) (err error) {
+	consumer.logger.V(1).Info("setPriority()")
+
+	consumer.settingsLocker.Lock()
+	defer consumer.settingsLocker.Unlock()
+
+	response := consumer.channel.Request("consumer.setPriority", consumer.internal, H{"priority": priority})
+
+	var result struct {
+		Priority uint32
+	}
+	if err = response.Unmarshal(&result); err != nil {
+		return
+	}
+
+	atomic.StoreUint32(&consumer.priority, result.Priority)
+
+	return
+}
+
+// SetMaxBitrate caps the bitrate forwarded to the Consumer, 0 meaning unlimited. mediasoup-worker
+// has no per Consumer bitrate cap, so it is approximated by limiting the preferred spatial layer
+// to the highest one whose bitrate does not exceed the cap, using the maxBitrate of the Producer
+// encodings. For SVC, where there is a single encoding, each spatial layer is assumed to take a
+// quarter of the bitrate of the next one. The temporal layer is not limited, so the actual
+// bitrate may exceed the cap. It is not supported by simple Consumers or if the maxBitrate of the
+// Producer encodings is unknown.
+//
+// The cap is kept apart from the layers set by SetPreferredLayers(), which are clamped by it
+// rather than replaced: IntendedPreferredLayers() is not changed, and removing the cap sets the
+// intended layers again, or the highest ones if none.
+func (consumer *Consumer) SetMaxBitrate(bitrate int) error {
+	consumer.logger.V(1).Info("setMaxBitrate()", "bitrate", bitrate)
+
+	if bitrate < 0 {
+		return NewTypeError("negative bitrate")
+	}
+
+	typ := consumer.Type()
+	if typ != ConsumerType_Simulcast && typ != ConsumerType_Svc {
+		return NewUnsupportedError("bitrate cap requires a simulcast or SVC consumer")
+	}
+
+	spatialLayers := int(consumer.SpatialLayers())
+
+	var maxLayer *uint8
+	if bitrate > 0 {
+		layerBitrates := consumer.estimateLayerBitrates(spatialLayers)
+		if layerBitrates == nil {
+			return NewUnsupportedError("unknown maxBitrate of the producer encodings")
+		}
+		spatialLayer := spatialLayers - 1
+		for spatialLayer > 0 && layerBitrates[spatialLayer] > bitrate {
+			spatialLayer--
+		}
+		layer := uint8(spatialLayer)
+		maxLayer = &layer
+	}
+
+	consumer.settingsLocker.Lock()
+	defer consumer.settingsLocker.Unlock()
+
+	consumer.layersLocker.Lock()
+	previous := consumer.maxBitrateLayer
+	consumer.maxBitrateLayer = maxLayer
+	intended := consumer.intendedLayers
+	consumer.layersLocker.Unlock()
+
+	if previous != nil || maxLayer != nil {
+		layers := ConsumerLayers{
+			SpatialLayer:  uint8(spatialLayers - 1),
+			TemporalLayer: consumer.TemporalLayers() - 1,
+		}
+		if intended != nil {
+			layers = *intended
+		}
+
+		if err := consumer.sendPreferredLayers(layers, false); err != nil {
+			consumer.layersLocker.Lock()
+			consumer.maxBitrateLayer = previous
+			consumer.layersLocker.Unlock()
+
+			return err
+		}
+	}
+
+	atomic.StoreInt64(&consumer.maxBitrate, int64(bitrate))
+
+	return nil
+}
+
+// capLayers returns the layers with the spatial layer limited by the bitrate cap set by
+// SetMaxBitrate(), if any. layersLocker must be held.
+func (consumer *Consumer) capLayers(layers ConsumerLayers) ConsumerLayers {
+	if maxLayer := consumer.maxBitrateLayer; maxLayer != nil && layers.SpatialLayer > *maxLayer {
+		layers.SpatialLayer = *maxLayer
+	}
+	return layers
+}
+
+// MaxBitrate returns the last bitrate cap set by SetMaxBitrate(), 0 if unlimited.
+func (consumer *Consumer) MaxBitrate() int {
+	return int(atomic.LoadInt64(&consumer.maxBitrate))
+}
+
+// estimateLayerBitrates returns the estimated bitrate of each spatial layer, or nil if unknown.
+func (consumer *Consumer) estimateLayerBitrates(spatialLayers int) []int {
+	bitrates := make([]int, spatialLayers)
+
+	if len(consumer.producerMaxBitrates) == spatialLayers {
+		for i, bitrate := range consumer.producerMaxBitrates {
+			if bitrate <= 0 {
+				return nil
+			}
+			bitrates[i] = bitrate
+		}
+		return bitrates
+	}
+
+	if len(consumer.producerMaxBitrates) != 1 || consumer.producerMaxBitrates[0] <= 0 {
+		return nil
+	}
+	bitrate := consumer.producerMaxBitrates[0]
+	for i := spatialLayers - 1; i >= 0; i-- {
+		bitrates[i] = bitrate
+		bitrate /= 4
+	}
+	return bitrates
+}
+
+// UnsetPriority unset priority.
+func (consumer *Consumer) UnsetPriority() (err error) {
+	consumer.logger.V(1).Info("unsetPriority()")
+
+	return consumer.SetPriority(1)
+}
+
+// PauseEncoding pauses the forwarding of the Producer encoding with the given RID. mediasoup-worker
+// does not support pausing a single encoding, so after validating the RID it always returns an
+// UnsupportedError. Use SetPreferredLayers() to limit the forwarded layers instead.
+func (consumer *Consumer) PauseEncoding(rid string) error {
+	consumer.logger.V(1).Info("pauseEncoding()", "rid", rid)
+
+	if err := consumer.validateRid(rid); err != nil {
+		return err
+	}
+	return NewUnsupportedError("pausing a single encoding is not supported by the worker")
+}
+
+// ResumeEncoding resumes the forwarding of the Producer encoding with the given RID. See
+// PauseEncoding().
+func (consumer *Consumer) ResumeEncoding(rid string) error {
+	consumer.logger.V(1).Info("resumeEncoding()", "rid", rid)
+
+	if err := consumer.validateRid(rid); err != nil {
+		return err
+	}
+	return NewUnsupportedError("resuming a single encoding is not supported by the worker")
+}
+
+func (consumer *Consumer) validateRid(rid string) error {
+	if consumer.Type() != ConsumerType_Simulcast {
+		return NewTypeError("consumer type %q is not simulcast", consumer.Type())
+	}
+	for _, producerRid := range consumer.producerRids {
+		if producerRid == rid {
+			return nil
+		}
+	}
+	return NewTypeError("rid %q not found in the producer encodings", rid)
+}
+
+// RequestKeyFrame request a key frame to the Producer. triggered is false if mediasoup-worker
+// ignores the request since the Consumer is an audio one, or it or its Producer is paused, as
+// known locally, so callers do not wait for a key frame which is not coming.
+func (consumer *Consumer) RequestKeyFrame() (triggered bool, err error) {
+	consumer.logger.V(1).Info("requestKeyFrame()")
+
+	response := consumer.channel.Request("consumer.requestKeyFrame", consumer.internal)
+	if err = response.Err(); err != nil {
+		return
+	}
+
+	triggered = consumer.Kind() == MediaKind_Video && !consumer.Paused() && !consumer.ProducerPaused()
+
+	return
+}
+
+// RequestKeyFrameForLayer checks that spatialLayer is one of the SpatialLayers() of the Consumer
+// and requests a key frame like RequestKeyFrame(). mediasoup-worker has no per layer key frame
+// request: the key frame is requested for the whole stream, that is for the spatial layer the
+// Consumer is switching to or, if none, the one it currently sends. To get a key frame of another
+// layer, select it with SetPreferredLayers(), which makes the worker request one.
+func (consumer *Consumer) RequestKeyFrameForLayer(spatialLayer uint8) error {
+	consumer.logger.V(1).Info("requestKeyFrameForLayer()", "spatialLayer", spatialLayer)
+
+	if spatialLayers := consumer.SpatialLayers(); spatialLayer >= spatialLayers {
+		return NewTypeError("invalid spatialLayer %d, the Consumer has %d spatial layers", spatialLayer, spatialLayers)
+	}
+
+	_, err := consumer.RequestKeyFrame()
+
+	return err
+}
+
+// ReplaceProducer switches the consumed Producer. mediasoup-worker can not change the Producer
+// of a Consumer, so this Consumer is closed and a new one is created on the same transport
+// with the same ConsumerOptions, paused state, preferred layers and app data, reusing its MID,
+// SSRCs and RTCP CNAME, so the remote endpoint can keep the same transceiver. The returned
+// Consumer must be used from now on. Handlers set on this Consumer are not moved and its close
+// handlers are called.
+//
+// If the new Producer can not be consumed with the same codecs, encodings and header extensions,
+// an error wrapping ErrIncompatibleReplacement is returned, this Consumer is kept open and the
+// caller should fall back to creating a new Consumer.
+//
+// If mediasoup-worker fails to create the new Consumer once this one is closed, a Consumer of the
+// current Producer is created again with the same id and RTP parameters, and it is returned
+// along with the error. The returned Consumer is nil if that fails too.
+func (consumer *Consumer) ReplaceProducer(newProducerId string, rtpCapabilities RtpCapabilities) (*Consumer, error) {
+	consumer.logger.V(1).Info("replaceProducer()", "producerId", newProducerId)
+
+	if consumer.replaceProducer == nil {
+		return nil, NewUnsupportedError("replaceProducer is not supported")
+	}
+	return consumer.replaceProducer(consumer, newProducerId, rtpCapabilities)
+}
+
+// EnableTraceEvent eenable "trace" event.
+func (consumer *Consumer) EnableTraceEvent(types ...ConsumerTraceEventType) error {
+	consumer.logger.V(1).Info("enableTraceEvent()")
+
+	consumer.stopTraceExpiry()
+
+	if types == nil {
+		types = []ConsumerTraceEventType{}
+	}
+
+	return consumer.updateTraceEvent(types)
+}
+
+// EnableTraceEventFor enables the given trace event types like EnableTraceEvent() and disables
+// them all once d elapsed, so expensive tracing enabled for debugging is not left on. Calling
+// EnableTraceEvent() or EnableTraceEventFor() again, or closing the Consumer, cancels the
+// pending disabling.
+func (consumer *Consumer) EnableTraceEventFor(d time.Duration, types ...ConsumerTraceEventType) error {
+	consumer.logger.V(1).Info("enableTraceEventFor()", "duration", d)
+
+	if consumer.Closed() {
+		return NewInvalidStateError("Consumer closed")
+	}
+	if err := consumer.EnableTraceEvent(types...); err != nil {
+		return err
+	}
+
+	consumer.traceExpiryLocker.Lock()
+	defer consumer.traceExpiryLocker.Unlock()
+
+	var timer *time.Timer
+	timer = timeAfterFunc(d, func() {
+		// Expiry is checked while the requests are serialized, so types enabled again by a request
+		// that did not stop the timer yet are not disabled.
+		consumer.traceUpdateLocker.Lock()
+		defer consumer.traceUpdateLocker.Unlock()
+
+		consumer.traceExpiryLocker.Lock()
+		expired := consumer.traceExpiry == timer
+		if expired {
+			consumer.traceExpiry = nil
+		}
+		consumer.traceExpiryLocker.Unlock()
+
+		if !expired || consumer.Closed() {
+			return
+		}
+		if err := consumer.sendTraceEvent([]ConsumerTraceEventType{}); err != nil && !consumer.Closed() {
+			consumer.logger.Error(err, "failed to disable expired trace events")
+		}
+	})
+	consumer.traceExpiry = timer
+
+	return nil
+}
+
+// waitForTraceEvent waits for a trace event of type typ, calling start, if any, once the type is
+// enabled. The type is enabled while waiting, in addition to the types enabled by
+// EnableTraceEvent(), and the Consumer does not emit its events unless enabled there.
+func (consumer *Consumer) waitForTraceEvent(ctx context.Context, typ ConsumerTraceEventType, start func() error) error {
+	received := make(chan struct{}, 1)
+
+	consumer.traceLocker.Lock()
+	if consumer.traceWaiters == nil {
+		consumer.traceWaiters = make(map[ConsumerTraceEventType]map[chan struct{}]struct{})
+	}
+	if consumer.traceWaiters[typ] == nil {
+		consumer.traceWaiters[typ] = make(map[chan struct{}]struct{})
+	}
+	consumer.traceWaiters[typ][received] = struct{}{}
+	first := len(consumer.traceWaiters[typ]) == 1
+	consumer.traceLocker.Unlock()
+
+	defer func() {
+		consumer.traceLocker.Lock()
+		delete(consumer.traceWaiters[typ], received)
+		last := len(consumer.traceWaiters[typ]) == 0
+		if last {
+			delete(consumer.traceWaiters, typ)
+		}
+		consumer.traceLocker.Unlock()
+
+		if last && !consumer.Closed() {
+			if err := consumer.updateTraceEvent(nil); err != nil && !consumer.Closed() {
+				consumer.logger.Error(err, "failed to disable waited trace event", "type", typ)
+			}
+		}
+	}()
+
+	if first {
+		if err := consumer.updateTraceEvent(nil); err != nil {
+			return err
+		}
+	}
+
+	if start != nil {
+		if err := start(); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case <-received:
+		return nil
+	case <-consumer.ctx.Done():
+		return NewInvalidStateError("Consumer closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// updateTraceEvent enables the trace event types set by EnableTraceEvent() plus the ones
+// waitForTraceEvent() is waiting for. If types is not nil, it replaces the types set by
+// EnableTraceEvent() once the worker accepted them. Requests are serialized so the last one sent
+// has the latest types, but traceLocker is not held during the request since trace events are
+// delivered by the goroutine reading the response.
+func (consumer *Consumer) updateTraceEvent(types []ConsumerTraceEventType) error {
+	consumer.traceUpdateLocker.Lock()
+	defer consumer.traceUpdateLocker.Unlock()
+
+	return consumer.sendTraceEvent(types)
+}
+
+// sendTraceEvent sends the "consumer.enableTraceEvent" request of updateTraceEvent().
+// traceUpdateLocker must be held.
+func (consumer *Consumer) sendTraceEvent(types []ConsumerTraceEventType) error {
+	consumer.traceLocker.Lock()
+	enabled := types
+	if enabled == nil {
+		enabled = consumer.traceEventTypes
+	}
+	set := make(map[ConsumerTraceEventType]bool, len(enabled))
+	for _, typ := range enabled {
+		set[typ] = true
+	}
+	var waited []string
+	for typ := range consumer.traceWaiters {
+		if !set[typ] {
+			waited = append(waited, string(typ))
+		}
+	}
+	consumer.traceLocker.Unlock()
+
+	// Sorted so the request does not depend on the map order.
+	sort.Strings(waited)
+	requested := append([]ConsumerTraceEventType{}, enabled...)
+	for _, typ := range waited {
+		requested = append(requested, ConsumerTraceEventType(typ))
+	}
+
+	response := consumer.channel.Request("consumer.enableTraceEvent", consumer.internal, H{"types": requested})
+
+	if err := response.Err(); err != nil {
+		return err
+	}
+
+	if types != nil {
+		consumer.traceLocker.Lock()
+		defer consumer.traceLocker.Unlock()
+
+		// The count restarts when "keyframe" is enabled again.
+		if !consumer.traceEnabled[ConsumerTraceEventType_Keyframe] {
+			consumer.keyFrameCount = 0
+		}
+		consumer.traceEventTypes = append([]ConsumerTraceEventType{}, types...)
+		consumer.traceEnabled = set
+	}
+
+	return nil
+}
+
+// stopTraceExpiry cancels the disabling of the trace events pending after EnableTraceEventFor().
+func (consumer *Consumer) stopTraceExpiry() {
+	consumer.traceExpiryLocker.Lock()
+	defer consumer.traceExpiryLocker.Unlock()
+
+	if consumer.traceExpiry != nil {
+		consumer.traceExpiry.Stop()
+		consumer.traceExpiry = nil
+	}
+}
+
+// TraceEventTypes returns a copy of the types last enabled by EnableTraceEvent(), so they can be
+// enabled again on a Consumer recreated after a worker restart. Unknown types ignored by the
+// worker are kept as given.
+func (consumer *Consumer) TraceEventTypes() []ConsumerTraceEventType {
+	consumer.traceLocker.Lock()
+	defer consumer.traceLocker.Unlock()
+
+	return append([]ConsumerTraceEventType(nil), consumer.traceEventTypes...)
+}
+
+// KeyFrameCount returns the number of "keyframe" trace events received since the "keyframe" type
+// was enabled with EnableTraceEvent(). It returns 0 while the type is not enabled, and counts
+// again from 0 once it is enabled again.
+func (consumer *Consumer) KeyFrameCount() uint64 {
+	consumer.traceLocker.Lock()
+	defer consumer.traceLocker.Unlock()
+
+	if !consumer.traceEnabled[ConsumerTraceEventType_Keyframe] {
+		return 0
+	}
+	return consumer.keyFrameCount
+}
 
 // OnClose set handler on "close" event
 func (consumer *Consumer) OnClose(handler func()) {
 	consumer.onClose = handler
 }
 
-// OnProducerClose set handler on "producerclose" event
+// OnProducerClose set handler on "producerclose" event. It is called exactly once when the
+// Producer is closed, unless the Consumer was closed before. It is kept apart from the listeners,
+// so RemoveAllListeners() does not remove it.
 func (consumer *Consumer) OnProducerClose(handler func()) {
 	consumer.onProducerClose = handler
 }
@@ -519,9 +1999,14 @@ func (consumer *Consumer) OnTransportClose(handler func()) {
 	consumer.onTransportClose = handler
 }
 
-// OnPause set handler on "pause" event
+// OnPause set handler on "pause" event. With ConsumerOptions.ReplayLatestOnSubscribe, it is
+// called at once if the Consumer or its Producer is paused.
 func (consumer *Consumer) OnPause(handler func()) {
 	consumer.onPause = handler
+
+	if consumer.replayLatest && handler != nil && consumer.EffectivelyPaused() {
+		handler()
+	}
 }
 
 // OnResume set handler on "resume" event
@@ -529,9 +2014,14 @@ func (consumer *Consumer) OnResume(handler func()) {
 	consumer.onResume = handler
 }
 
-// OnProducerPause set handler on "producerpause" event
+// OnProducerPause set handler on "producerpause" event. With
+// ConsumerOptions.ReplayLatestOnSubscribe, it is called at once if the Producer is paused.
 func (consumer *Consumer) OnProducerPause(handler func()) {
 	consumer.onProducerPause = handler
+
+	if consumer.replayLatest && handler != nil && consumer.ProducerPaused() {
+		handler()
+	}
 }
 
 // OnProducerResume set handler on "producerresume" event
@@ -539,14 +2029,81 @@ func (consumer *Consumer) OnProducerResume(handler func()) {
 	consumer.onProducerResume = handler
 }
 
-// OnScore set handler on "score" event
+// OnScore set handler on "score" event. With ConsumerOptions.ReplayLatestOnSubscribe, it is
+// called at once with the latest score.
 func (consumer *Consumer) OnScore(handler func(score *ConsumerScore)) {
 	consumer.onScore = handler
+
+	if consumer.replayLatest && handler != nil {
+		if score := consumer.Score(); score != nil {
+			handler(score)
+		}
+	}
+}
+
+// OnScoreCtx set handler on "score" event, receiving the Consumer's lifecycle context. With
+// ConsumerOptions.ReplayLatestOnSubscribe, it is called at once with the latest score.
+func (consumer *Consumer) OnScoreCtx(handler func(ctx context.Context, score *ConsumerScore)) {
+	consumer.onScoreCtx = handler
+
+	if consumer.replayLatest && handler != nil {
+		if score := consumer.Score(); score != nil {
+			handler(consumer.ctx, score)
+		}
+	}
 }
 
-// OnLayersChange set handler on "layerschange" event
+// OnScoreSampled set handler on "score" event which is called at most once per minInterval with
+// the latest score. The pending score, if any, is flushed when the Consumer is closed. Use
+// OnScore to get every score update.
+func (consumer *Consumer) OnScoreSampled(minInterval time.Duration, handler func(score *ConsumerScore)) {
+	if sampler := consumer.scoreSampler; sampler != nil {
+		sampler.close()
+	}
+	if handler == nil {
+		consumer.scoreSampler = nil
+		return
+	}
+	consumer.scoreSampler = newScoreSampler(minInterval, handler)
+}
+
+// OnLayersChange set handler on "layerschange" event. With
+// ConsumerOptions.ReplayLatestOnSubscribe, it is called at once with the current layers, if any.
 func (consumer *Consumer) OnLayersChange(handler func(layers *ConsumerLayers)) {
 	consumer.onLayersChange = handler
+
+	if consumer.replayLatest && handler != nil {
+		if layers := consumer.CurrentLayers(); layers != nil {
+			handler(layers)
+		}
+	}
+}
+
+// OnLayersChangeCoalesced set handler on "layerschange" event which is called with the latest
+// layers once window elapsed since the first change, so rapid simulcast switches are seen as a
+// single one. The pending layers, if any, are flushed when the Consumer is closed. Use
+// OnLayersChange to get every change.
+func (consumer *Consumer) OnLayersChangeCoalesced(window time.Duration, handler func(layers *ConsumerLayers)) {
+	if coalescer := consumer.layersCoalescer; coalescer != nil {
+		coalescer.close()
+	}
+	if handler == nil {
+		consumer.layersCoalescer = nil
+		return
+	}
+	consumer.layersCoalescer = newLayersCoalescer(window, handler)
+}
+
+// OnRtpParametersChange set handler on "rtpparameterschange" event, emitted when the worker
+// updates the RTP parameters of the Consumer, which must then be signaled to the endpoint.
+// Current mediasoup-worker versions never send it.
+func (consumer *Consumer) OnRtpParametersChange(handler func(rtpParameters RtpParameters)) {
+	consumer.onRtpParametersChange = handler
+}
+
+// OnDumpChange set handler on "dumpchange" event
+func (consumer *Consumer) OnDumpChange(handler func(dump *ConsumerDump, diff []string)) {
+	consumer.onDumpChange = handler
 }
 
 // OnTrace set handler on "trace" event
@@ -554,79 +2111,61 @@ func (consumer *Consumer) OnTrace(handler func(trace *ConsumerTraceEventData)) {
 	consumer.onTrace = handler
 }
 
-// OnRtp set handler on "rtp" event
+// OnTraceType set handler on "trace" event of type typ only, called after the OnTrace handler.
+// The type must be enabled with EnableTraceEvent(). A nil handler removes the one of typ.
+func (consumer *Consumer) OnTraceType(typ ConsumerTraceEventType, handler func(trace *ConsumerTraceEventData)) {
+	consumer.onTraceTypeLocker.Lock()
+	defer consumer.onTraceTypeLocker.Unlock()
+
+	if handler == nil {
+		delete(consumer.onTraceType, typ)
+		return
+	}
+	if consumer.onTraceType == nil {
+		consumer.onTraceType = make(map[ConsumerTraceEventType]func(*ConsumerTraceEventData))
+	}
+	consumer.onTraceType[typ] = handler
+}
+
+// OnRtp set handler on "rtp" event. Handlers which must be removed separately, such as recorders,
+// can be added with Listen("rtp", handler) instead.
 func (consumer *Consumer) OnRtp(handler func(data []byte)) {
 	consumer.onRtp = handler
 }
 
+// Listen adds listener for the event, like On(), and returns a function removing this very
+// listener while keeping the other ones, e.g. Listen("rtp", func(data []byte) {...}). The listener
+// is not called anymore once remove returns, unless a call is already in progress. Calling remove
+// several times is harmless.
+func (consumer *Consumer) Listen(event string, listener interface{}) (remove func()) {
+	return listen(consumer.IEventEmitter, event, listener)
+}
+
+// OnRtpGap set handler called when RTP packets delivered to the "rtp" event are missing: from
+// and to are the sequence numbers of the packets around the gap. Setting it enables parsing the
+// header of every delivered packet. Late (reordered) and duplicated packets are not reported.
+func (consumer *Consumer) OnRtpGap(handler func(missing, from, to uint16)) {
+	consumer.onRtpGap = handler
+}
+
+// OnRtcp set handler on "rtcp" event. The packet is the raw compound RTCP packet.
+func (consumer *Consumer) OnRtcp(handler func(data []byte)) {
+	consumer.onRtcp = handler
+}
+
 func (consumer *Consumer) handleWorkerNotifications() {
 	logger := consumer.logger
 
 	consumer.channel.Subscribe(consumer.Id(), func(event string, data []byte) {
 		switch event {
 		case "producerclose":
-			if atomic.CompareAndSwapUint32(&consumer.closed, 0, 1) {
-				consumer.channel.Unsubscribe(consumer.internal.ConsumerId)
-				consumer.payloadChannel.Unsubscribe(consumer.internal.ConsumerId)
-
-				consumer.Emit("@producerclose")
-				consumer.SafeEmit("producerclose")
-				consumer.RemoveAllListeners()
-
-				if handler := consumer.onProducerClose; handler != nil {
-					handler()
-				}
-
-				consumer.close()
-			}
+			consumer.producerClosed()
 
 		case "producerpause":
-			if consumer.producerPaused {
-				break
-			}
-
-			wasPaused := consumer.paused || consumer.producerPaused
-
-			consumer.producerPaused = true
-
-			consumer.SafeEmit("producerpause")
-
-			if handler := consumer.onProducerPause; handler != nil {
-				handler()
-			}
-
-			if !wasPaused {
-				// Emit observer event.
-				consumer.observer.SafeEmit("pause")
-
-				if handler := consumer.onPause; handler != nil {
-					handler()
-				}
-			}
+			consumer.setProducerPaused(true)
 
 		case "producerresume":
-			if !consumer.producerPaused {
-				break
-			}
-
-			wasPaused := consumer.paused || consumer.producerPaused
-
-			consumer.producerPaused = false
-
-			consumer.SafeEmit("producerresume")
-
-			if handler := consumer.onProducerResume; handler != nil {
-				handler()
-			}
-
-			if wasPaused && !consumer.paused {
-				// Emit observer event.
-				consumer.observer.SafeEmit("resume")
-
-				if handler := consumer.onResume; handler != nil {
-					handler()
-				}
-			}
+			consumer.setProducerPaused(false)
 
 		case "score":
 			var score *ConsumerScore
@@ -636,16 +2175,9 @@ func (consumer *Consumer) handleWorkerNotifications() {
 				return
 			}
 
-			consumer.score = score
-
-			consumer.SafeEmit("score", score)
-
-			// Emit observer event.
-			consumer.observer.SafeEmit("score", &score)
-
-			if handler := consumer.onScore; handler != nil {
-				handler(score)
-			}
+			consumer.setScore(score)
+			consumer.emitScore(score)
+			consumer.restoreIntendedLayers(score)
 
 		case "layerschange":
 			var layers *ConsumerLayers
@@ -655,15 +2187,28 @@ func (consumer *Consumer) handleWorkerNotifications() {
 				return
 			}
 
+			consumer.layersLocker.Lock()
 			consumer.currentLayers = layers
+			consumer.layersLocker.Unlock()
 
-			consumer.SafeEmit("layerschange", layers)
+			consumer.emitLayersChange(layers)
 
-			// Emit observer event.
-			consumer.observer.SafeEmit("layerschange", layers)
+		case "rtpparameterschange":
+			var rtpParameters RtpParameters
 
-			if handler := consumer.onLayersChange; handler != nil {
-				handler(layers)
+			if err := json.Unmarshal([]byte(data), &rtpParameters); err != nil {
+				logger.Error(err, "failed to unmarshal rtp parameters", "data", json.RawMessage(data))
+				return
+			}
+
+			consumer.rtpParametersLocker.Lock()
+			consumer.data.RtpParameters = rtpParameters
+			consumer.rtpParametersLocker.Unlock()
+
+			safeEmitCtx(consumer.IEventEmitter, consumer.ctx, "rtpparameterschange", rtpParameters)
+
+			if handler := consumer.onRtpParametersChange; handler != nil {
+				handler(rtpParameters)
 			}
 
 		case "trace":
@@ -674,15 +2219,49 @@ func (consumer *Consumer) handleWorkerNotifications() {
 				return
 			}
 
-			consumer.SafeEmit("trace", trace)
+			if consumer.traceClock == nil {
+				consumer.traceClock = NewTraceClock(trace.Timestamp, time.Now())
+			}
+			trace.clock = consumer.traceClock
+
+			consumer.traceLocker.Lock()
+			for waiter := range consumer.traceWaiters[trace.Type] {
+				select {
+				case waiter <- struct{}{}:
+				default:
+				}
+			}
+			enabled := consumer.traceEnabled[trace.Type]
+			if enabled && trace.Type == ConsumerTraceEventType_Keyframe {
+				consumer.keyFrameCount++
+			}
+			consumer.traceLocker.Unlock()
+
+			// Only enabled for waitForTraceEvent().
+			if !enabled {
+				return
+			}
+
+			atomic.AddUint64(&consumer.eventCounts.Trace, 1)
+			safeEmitCtx(consumer.IEventEmitter, consumer.ctx, "trace", trace)
 
 			// Emit observer event.
-			consumer.observer.SafeEmit("trace", trace)
+			if consumer.observerEnabled() {
+				consumer.observer.SafeEmit("trace", trace)
+			}
 
 			if handler := consumer.onTrace; handler != nil {
 				handler(trace)
 			}
 
+			consumer.onTraceTypeLocker.Lock()
+			handler := consumer.onTraceType[trace.Type]
+			consumer.onTraceTypeLocker.Unlock()
+
+			if handler != nil {
+				handler(trace)
+			}
+
 		default:
 			consumer.logger.Error(nil, "ignoring unknown event in channel listener", "event", event)
 		}
@@ -694,14 +2273,351 @@ func (consumer *Consumer) handleWorkerNotifications() {
 			if consumer.Closed() {
 				return
 			}
-			consumer.SafeEmit("rtp", payload)
+			if consumer.suppressPausedRtp && consumer.Paused() {
+				return
+			}
+			consumer.stopFirstRtpTimer()
 
-			if handler := consumer.onRtp; handler != nil {
-				handler(payload)
+			if consumer.rtpQueue != nil {
+				consumer.rtpQueue.push(payload)
+			} else {
+				consumer.emitRtp(payload)
 			}
 
+		case "rtcp":
+			consumer.emitRtcp(payload)
+
 		default:
 			consumer.logger.Error(nil, "ignoring unknown event in payload channel listener", "event", event)
 		}
 	})
 }
+
+// emitRtp send "rtp" event.
+func (consumer *Consumer) emitRtp(packet []byte) {
+	consumer.deliveries.begin()
+	defer consumer.deliveries.end()
+
+	if consumer.Closed() {
+		return
+	}
+	atomic.AddUint64(&consumer.eventCounts.Rtp, 1)
+	safeEmitCtx(consumer.IEventEmitter, consumer.ctx, "rtp", packet)
+
+	if handler := consumer.onRtp; handler != nil {
+		handler(packet)
+	}
+
+	if handler := consumer.onRtpGap; handler != nil {
+		if seq, ok := rtpSequenceNumber(packet); ok {
+			if missing, from, to := consumer.rtpSequence.push(seq); missing > 0 {
+				handler(missing, from, to)
+			}
+		}
+	}
+}
+
+// emitRtcp send "rtcp" event.
+func (consumer *Consumer) emitRtcp(packet []byte) {
+	consumer.deliveries.begin()
+	defer consumer.deliveries.end()
+
+	if consumer.Closed() {
+		return
+	}
+	safeEmitCtx(consumer.IEventEmitter, consumer.ctx, "rtcp", packet)
+
+	if handler := consumer.onRtcp; handler != nil {
+		handler(packet)
+	}
+}
+
+// WaitDeliveries waits until the "rtp" and "rtcp" handlers being called return, or ctx is done.
+// Once the Consumer is closed no new call starts, so waiting after Close() is required to be sure
+// that none of them runs anymore. It must not be called by a handler of the Consumer, which would wait for
+// itself until ctx is done.
+func (consumer *Consumer) WaitDeliveries(ctx context.Context) error {
+	idle := consumer.deliveries.idleCh()
+	if idle == nil {
+		return nil
+	}
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// consumerDeliveries counts the "rtp" and "rtcp" handler calls in progress.
+type consumerDeliveries struct {
+	locker   sync.Mutex
+	inFlight int
+	idle     chan struct{} // Closed once inFlight drops to zero, nil if nobody waits.
+}
+
+func (d *consumerDeliveries) begin() {
+	d.locker.Lock()
+	d.inFlight++
+	d.locker.Unlock()
+}
+
+func (d *consumerDeliveries) end() {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	d.inFlight--
+	if d.inFlight == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// idleCh returns a channel closed once no handler call is in progress, or nil if none is.
+func (d *consumerDeliveries) idleCh() chan struct{} {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	if d.inFlight == 0 {
+		return nil
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	return d.idle
+}
+
+// restoreIntendedLayers sets the intended preferred layers again if they differ from the ones in
+// effect and the score shows that the Producer sends the intended spatial layer again. It is
+// called by the goroutine delivering the notifications only.
+func (consumer *Consumer) restoreIntendedLayers(score *ConsumerScore) {
+	if score == nil {
+		return
+	}
+
+	consumer.layersLocker.RLock()
+	intended, preferred := consumer.intendedLayers, consumer.preferredLayers
+	generation := consumer.intendedGeneration
+	var capped ConsumerLayers
+	if intended != nil {
+		capped = consumer.capLayers(*intended)
+	}
+	consumer.layersLocker.RUnlock()
+
+	if intended == nil {
+		return
+	}
+
+	// Simulcast Producers have a score per spatial layer, SVC ones a single score.
+	index := 0
+	if len(score.ProducerScores) > 1 {
+		index = int(intended.SpatialLayer)
+	}
+	sent := index < len(score.ProducerScores) && score.ProducerScores[index] > 0
+	wasSent := consumer.intendedLayerSent
+	consumer.intendedLayerSent = sent
+
+	// Only retry when the layer comes back, so layers mediasoup-worker never accepts are not
+	// requested again on every score.
+	if !sent || wasSent || (preferred != nil && *preferred == capped) {
+		return
+	}
+
+	if !atomic.CompareAndSwapUint32(&consumer.restoringLayers, 0, 1) {
+		return
+	}
+
+	// The request is sent from another goroutine since its response is delivered by the one
+	// delivering this notification. Layers set meanwhile by the application are not overwritten.
+	go func() {
+		defer atomic.StoreUint32(&consumer.restoringLayers, 0)
+
+		if err := consumer.restorePreferredLayers(*intended, generation); err != nil && !consumer.Closed() {
+			consumer.logger.Error(err, "failed to restore intended preferred layers")
+		}
+	}()
+}
+
+func (consumer *Consumer) emitScore(score *ConsumerScore) {
+	atomic.AddUint64(&consumer.eventCounts.Score, 1)
+	safeEmitCtx(consumer.IEventEmitter, consumer.ctx, "score", score)
+
+	// Emit observer event.
+	if consumer.observerEnabled() {
+		consumer.observer.SafeEmit("score", score)
+	}
+
+	if handler := consumer.onScore; handler != nil {
+		handler(score)
+	}
+
+	if handler := consumer.onScoreCtx; handler != nil {
+		handler(consumer.ctx, score)
+	}
+
+	if sampler := consumer.scoreSampler; sampler != nil {
+		sampler.push(score)
+	}
+}
+
+func (consumer *Consumer) emitLayersChange(layers *ConsumerLayers) {
+	atomic.AddUint64(&consumer.eventCounts.Layers, 1)
+	safeEmitCtx(consumer.IEventEmitter, consumer.ctx, "layerschange", layers)
+
+	// Emit observer event.
+	if consumer.observerEnabled() {
+		consumer.observer.SafeEmit("layerschange", layers)
+	}
+
+	if handler := consumer.onLayersChange; handler != nil {
+		handler(layers)
+	}
+
+	if coalescer := consumer.layersCoalescer; coalescer != nil {
+		coalescer.push(layers)
+	}
+}
+
+// emitInitialState emits synthetic events reflecting the state the Consumer was created with:
+// "producerpause" and "pause" if paused, "score" and "layerschange" if sent by the worker.
+func (consumer *Consumer) emitInitialState() {
+	if consumer.ProducerPaused() {
+		safeEmitCtx(consumer.IEventEmitter, consumer.ctx, "producerpause")
+
+		if handler := consumer.onProducerPause; handler != nil {
+			handler()
+		}
+	}
+
+	if consumer.EffectivelyPaused() {
+		// Emit observer event.
+		if consumer.observerEnabled() {
+			consumer.observer.SafeEmit("pause")
+		}
+
+		if handler := consumer.onPause; handler != nil {
+			handler()
+		}
+	}
+
+	if score := consumer.initialState.Score; score != nil {
+		consumer.emitScore(score)
+	}
+
+	if layers := consumer.CurrentLayers(); layers != nil {
+		consumer.emitLayersChange(layers)
+	}
+}
+
+// setProducerPaused applies a "producerpause" or "producerresume" notification. The worker sends
+// them in order with no sequence number, so the latest one is taken as the producer state: a
+// notification not changing the state (i.e. a duplicate pause or resume) is logged and ignored
+// instead of being applied as a transition, so events are emitted once per actual change.
+func (consumer *Consumer) setProducerPaused(producerPaused bool) {
+	if consumer.ProducerPaused() == producerPaused {
+		consumer.logger.Info("ignoring producer pause notification not changing the state",
+			"producerPaused", producerPaused)
+		return
+	}
+
+	wasPaused, paused := consumer.setPausedFlag(&consumer.producerPaused, producerPaused)
+
+	if producerPaused {
+		safeEmitCtx(consumer.IEventEmitter, consumer.ctx, "producerpause")
+
+		if handler := consumer.onProducerPause; handler != nil {
+			handler()
+		}
+
+		if !wasPaused {
+			// Emit observer event.
+			if consumer.observerEnabled() {
+				consumer.observer.SafeEmit("pause")
+			}
+
+			if handler := consumer.onPause; handler != nil {
+				handler()
+			}
+		}
+	} else {
+		safeEmitCtx(consumer.IEventEmitter, consumer.ctx, "producerresume")
+
+		if handler := consumer.onProducerResume; handler != nil {
+			handler()
+		}
+
+		if wasPaused && !paused {
+			consumer.Emit("@flowing")
+
+			// Emit observer event.
+			if consumer.observerEnabled() {
+				consumer.observer.SafeEmit("resume")
+			}
+
+			if handler := consumer.onResume; handler != nil {
+				handler()
+			}
+		}
+	}
+}
+
+// startFirstRtpTimer resets the time to first RTP measurement on resume.
+func (consumer *Consumer) startFirstRtpTimer() {
+	consumer.firstRtpLocker.Lock()
+	defer consumer.firstRtpLocker.Unlock()
+
+	consumer.resumedAt = time.Now()
+	consumer.timeToFirstRtp = 0
+	if consumer.firstRtpReceived {
+		consumer.firstRtp = nil
+	}
+	consumer.firstRtpReceived = false
+}
+
+// stopFirstRtpTimer records the time to first RTP on the first "rtp" event after a resume.
+func (consumer *Consumer) stopFirstRtpTimer() {
+	consumer.firstRtpLocker.Lock()
+	defer consumer.firstRtpLocker.Unlock()
+
+	if consumer.resumedAt.IsZero() || consumer.firstRtpReceived {
+		return
+	}
+	consumer.timeToFirstRtp = time.Since(consumer.resumedAt)
+	consumer.firstRtpReceived = true
+	close(consumer.firstRtpChannel())
+}
+
+// firstRtpChannel returns the channel closed on the first "rtp" event since the last Resume().
+// firstRtpLocker must be held.
+func (consumer *Consumer) firstRtpChannel() chan struct{} {
+	if consumer.firstRtp == nil {
+		consumer.firstRtp = make(chan struct{})
+	}
+	return consumer.firstRtp
+}
+
+// setPausedFlag sets flag (either paused or producerPaused) under pausedLocker, accumulates the
+// paused time on pause/resume transitions and returns whether the Consumer was and is now
+// effectively paused.
+func (consumer *Consumer) setPausedFlag(flag *bool, value bool) (wasPaused, paused bool) {
+	consumer.pausedLocker.Lock()
+	defer consumer.pausedLocker.Unlock()
+
+	wasPaused = consumer.paused || consumer.producerPaused
+	*flag = value
+	paused = consumer.paused || consumer.producerPaused
+
+	if !consumer.closedAt.IsZero() {
+		return
+	}
+
+	if paused && consumer.pausedAt.IsZero() {
+		consumer.pausedAt = time.Now()
+	} else if !paused && !consumer.pausedAt.IsZero() {
+		consumer.pausedDuration += time.Since(consumer.pausedAt)
+		consumer.pausedAt = time.Time{}
+	}
+
+	return
+}
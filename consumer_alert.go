@@ -0,0 +1,149 @@
+package mediasoup
+
+import (
+	"sync"
+	"time"
+)
+
+// AlertMetric is a stat of a Consumer evaluated against an AlertThresholds.
+type AlertMetric string
+
+const (
+	AlertMetric_FractionLost AlertMetric = "fractionLost"
+	AlertMetric_Score        AlertMetric = "score"
+	AlertMetric_Rtt          AlertMetric = "rtt"
+)
+
+// AlertThresholds define the thresholds on the stats of the RTP stream sent by a Consumer beyond
+// which an Alert is raised. A zero threshold is not evaluated.
+type AlertThresholds struct {
+	// MaxFractionLost is the highest fraction of packets lost reported by the remote endpoint, in
+	// 1/256 units as in RTCP receiver reports.
+	MaxFractionLost uint32
+
+	// MinScore is the lowest score, from 1 to 10. The score to reach to clear the Alert is at most
+	// 10, whatever the ClearMargin.
+	MinScore uint32
+
+	// MaxRtt is the highest round trip time.
+	MaxRtt time.Duration
+
+	// ClearMargin is the margin, relative to the threshold, by which a value must come back
+	// within the threshold to clear the Alert, so a value oscillating around the threshold does
+	// not raise and clear it at every sample. Default 0.1.
+	ClearMargin float64
+}
+
+// Alert is raised when a stat of a Consumer crosses its threshold and cleared when it comes back
+// within the threshold, see Consumer.SetAlertThresholds().
+type Alert struct {
+	Metric AlertMetric
+
+	// Active is true when the Alert is raised and false when it is cleared.
+	Active bool
+
+	// Value is the value of the stat, the round trip time being in milliseconds.
+	Value float64
+
+	// Threshold is the threshold of the stat, the round trip time being in milliseconds.
+	Threshold float64
+}
+
+// consumerAlerts evaluates the stats of a Consumer against its AlertThresholds.
+type consumerAlerts struct {
+	locker     sync.Mutex
+	thresholds AlertThresholds
+	active     map[AlertMetric]bool
+}
+
+// SetAlertThresholds sets the thresholds evaluated on the stats returned by every GetStats()
+// call, including the ones polled by StatsStream(). An "alert" event is emitted when a stat
+// crosses its threshold, then again once it comes back within the threshold by the ClearMargin.
+// Alerts raised before are forgotten without being cleared.
+func (consumer *Consumer) SetAlertThresholds(thresholds AlertThresholds) {
+	consumer.logger.V(1).Info("setAlertThresholds()", "thresholds", thresholds)
+
+	if thresholds.ClearMargin <= 0 {
+		thresholds.ClearMargin = 0.1
+	}
+
+	consumer.alerts.locker.Lock()
+	defer consumer.alerts.locker.Unlock()
+
+	consumer.alerts.thresholds = thresholds
+	consumer.alerts.active = make(map[AlertMetric]bool)
+}
+
+// OnAlert set handler on "alert" event
+func (consumer *Consumer) OnAlert(handler func(alert Alert)) {
+	consumer.onAlert = handler
+}
+
+// evaluateAlerts evaluates the "outbound-rtp" stat of stats and emits the alerts raised or
+// cleared.
+func (consumer *Consumer) evaluateAlerts(stats []*ConsumerStat) {
+	var stat *ConsumerStat
+	for _, s := range stats {
+		if s.StatType() == StatType_OutboundRtp {
+			stat = s
+			break
+		}
+	}
+	if stat == nil {
+		return
+	}
+
+	alerts := consumer.alerts.evaluate(stat)
+
+	for _, alert := range alerts {
+		consumer.SafeEmit("alert", alert)
+
+		if handler := consumer.onAlert; handler != nil {
+			handler(alert)
+		}
+	}
+}
+
+func (a *consumerAlerts) evaluate(stat *ConsumerStat) (alerts []Alert) {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	thresholds := a.thresholds
+	margin := thresholds.ClearMargin
+
+	// check raises or clears the alert of metric, higher values being worse unless lowerIsWorse.
+	// maxValue, if not zero, is the highest value of the metric, which the value to reach to clear
+	// the alert can not exceed.
+	check := func(metric AlertMetric, value, threshold float64, lowerIsWorse bool, maxValue float64) {
+		if threshold <= 0 {
+			return
+		}
+		var crossed, recovered bool
+		if lowerIsWorse {
+			clearValue := threshold * (1 + margin)
+			if maxValue > 0 && clearValue > maxValue {
+				clearValue = maxValue
+			}
+			crossed, recovered = value < threshold, value >= clearValue
+		} else {
+			crossed, recovered = value > threshold, value <= threshold*(1-margin)
+		}
+
+		active := a.active[metric]
+		if !active && crossed || active && recovered {
+			a.active[metric] = !active
+			alerts = append(alerts, Alert{
+				Metric:    metric,
+				Active:    !active,
+				Value:     value,
+				Threshold: threshold,
+			})
+		}
+	}
+
+	check(AlertMetric_FractionLost, float64(stat.FractionLost), float64(thresholds.MaxFractionLost), false, 0)
+	check(AlertMetric_Score, float64(stat.Score), float64(thresholds.MinScore), true, 10)
+	check(AlertMetric_Rtt, float64(stat.RoundTripTime), float64(thresholds.MaxRtt)/float64(time.Millisecond), false, 0)
+
+	return
+}
@@ -0,0 +1,60 @@
+package mediasoup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumerAlerts(t *testing.T) {
+	consumer := &Consumer{
+		IEventEmitter: NewEventEmitter(),
+		logger:        NewLogger("Consumer"),
+	}
+	var alerts []Alert
+	consumer.OnAlert(func(alert Alert) { alerts = append(alerts, alert) })
+
+	sample := func(fractionLost, score uint32, rtt float32) []Alert {
+		alerts = nil
+		consumer.evaluateAlerts([]*ConsumerStat{
+			{Type: "inbound-rtp", FractionLost: 255, Score: 0, RoundTripTime: 1000},
+			{Type: "outbound-rtp", FractionLost: fractionLost, Score: score, RoundTripTime: rtt},
+		})
+		return alerts
+	}
+
+	// No threshold, no alert.
+	assert.Empty(t, sample(255, 0, 1000))
+
+	consumer.SetAlertThresholds(AlertThresholds{MaxFractionLost: 50, MinScore: 5, MaxRtt: 200 * time.Millisecond})
+
+	assert.Empty(t, sample(10, 10, 50))
+	assert.Equal(t, []Alert{
+		{Metric: AlertMetric_FractionLost, Active: true, Value: 60, Threshold: 50},
+		{Metric: AlertMetric_Rtt, Active: true, Value: 250, Threshold: 200},
+	}, sample(60, 10, 250))
+
+	// Still beyond the thresholds, or back within them but not by the clear margin.
+	assert.Empty(t, sample(70, 10, 300))
+	assert.Empty(t, sample(48, 10, 190))
+
+	assert.Equal(t, []Alert{
+		{Metric: AlertMetric_FractionLost, Active: false, Value: 40, Threshold: 50},
+		{Metric: AlertMetric_Score, Active: true, Value: 4, Threshold: 5},
+	}, sample(40, 4, 190))
+	assert.Equal(t, []Alert{
+		{Metric: AlertMetric_Score, Active: false, Value: 6, Threshold: 5},
+		{Metric: AlertMetric_Rtt, Active: false, Value: 100, Threshold: 200},
+	}, sample(40, 6, 100))
+
+	// The score to reach to clear the alert does not exceed the highest score.
+	consumer.SetAlertThresholds(AlertThresholds{MinScore: 10})
+	assert.Equal(t, []Alert{{Metric: AlertMetric_Score, Active: true, Value: 9, Threshold: 10}}, sample(0, 9, 0))
+	assert.Equal(t, []Alert{{Metric: AlertMetric_Score, Active: false, Value: 10, Threshold: 10}}, sample(0, 10, 0))
+
+	// Stats without outbound stream are ignored.
+	alerts = nil
+	consumer.evaluateAlerts([]*ConsumerStat{{Type: "inbound-rtp", FractionLost: 255}})
+	assert.Empty(t, alerts)
+}
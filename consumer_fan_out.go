@@ -0,0 +1,32 @@
+package mediasoup
+
+import (
+	"fmt"
+)
+
+// FanOut consumes the Producer of the given id on each of the transports with the same options,
+// typically to feed several recording DirectTransports or PipeTransports. The Consumers are
+// returned in the order of the transports. If one of them can not be created, the ones already
+// created are closed and the error is returned, wrapped with the id of the failed Transport.
+//
+// options.ProducerId is ignored, and options.ConsumerId must be empty as a Consumer id is unique.
+func FanOut(producerId string, transports []ITransport, options ConsumerOptions) ([]*Consumer, error) {
+	if len(options.ConsumerId) > 0 {
+		return nil, NewTypeError("consumerId can not be shared by fanned out Consumers")
+	}
+	options.ProducerId = producerId
+
+	var consumers []*Consumer
+	for _, transport := range transports {
+		consumer, err := transport.Consume(options)
+		if err != nil {
+			for _, consumer := range consumers {
+				consumer.Close()
+			}
+			return nil, fmt.Errorf("fan out to transport %q: %w", transport.Id(), err)
+		}
+		consumers = append(consumers, consumer)
+	}
+
+	return consumers, nil
+}
@@ -0,0 +1,75 @@
+package mediasoup
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFanOutClosesCreatedConsumersOnFailure(t *testing.T) {
+	// The Consumer can not be created on the transport "t2".
+	var (
+		closedLocker sync.Mutex
+		closed       []string
+	)
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		switch {
+		case req.method == "transport.consume" && req.handlerId == "t2":
+			return "", errors.New("boom")
+		case req.method == "transport.closeConsumer":
+			closedLocker.Lock()
+			closed = append(closed, req.handlerId)
+			closedLocker.Unlock()
+		}
+		return "{}", nil
+	})
+
+	producer := &Producer{
+		internal: internalData{ProducerId: "producer"},
+		data: producerData{
+			Kind: MediaKind_Audio,
+			Type: ProducerType_Simple,
+			ConsumableRtpParameters: RtpParameters{
+				Codecs: []*RtpCodecParameters{
+					{MimeType: "audio/opus", PayloadType: 100, ClockRate: 48000, Channels: 2},
+				},
+				Encodings: []RtpEncodingParameters{{Ssrc: 1111}},
+			},
+		},
+	}
+
+	payloadChannel, _ := newFakePayloadChannel(t)
+	var transports []ITransport
+	for _, transportId := range []string{"t1", "t2", "t3"} {
+		transports = append(transports, newDirectTransport(transportParams{
+			internal:        internalData{RouterId: "router", TransportId: transportId},
+			channel:         channel,
+			payloadChannel:  payloadChannel,
+			getProducerById: func(string) *Producer { return producer },
+		}))
+	}
+
+	consumers, err := FanOut("producer", transports, ConsumerOptions{
+		RtpCapabilities: RtpCapabilities{
+			Codecs: []*RtpCodecCapability{
+				{Kind: MediaKind_Audio, MimeType: "audio/opus", PreferredPayloadType: 100, ClockRate: 48000, Channels: 2},
+			},
+		},
+	})
+	assert.Nil(t, consumers)
+	require.EqualError(t, err, `fan out to transport "t2": boom`)
+
+	// The Consumer created on "t1" is closed, none is created on "t3".
+	closedLocker.Lock()
+	assert.Equal(t, []string{"t1"}, closed)
+	closedLocker.Unlock()
+	for _, transport := range transports {
+		assert.Empty(t, transport.Consumers())
+	}
+
+	_, err = FanOut("producer", transports, ConsumerOptions{ConsumerId: "consumer"})
+	assert.IsType(t, TypeError{}, err)
+}
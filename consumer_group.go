@@ -0,0 +1,169 @@
+package mediasoup
+
+import (
+	"sync"
+
+	"github.com/go-logr/logr"
+)
+
+type consumerGroupMember struct {
+	consumer        *Consumer
+	score           *ConsumerScore
+	removeListeners []func()
+}
+
+// ConsumerGroup aggregates the scores of a set of Consumers, typically all the Consumers of a
+// peer, to drive a "network quality" indicator. Consumers are removed from the group when closed.
+//
+//   - @emits aggregatescore - (min, avg uint16)
+type ConsumerGroup struct {
+	IEventEmitter
+	logger           logr.Logger
+	locker           sync.Mutex
+	members          map[string]*consumerGroupMember // consumerId:*consumerGroupMember
+	onAggregateScore func(min, avg uint16)
+}
+
+// NewConsumerGroup creates an empty ConsumerGroup.
+func NewConsumerGroup() *ConsumerGroup {
+	return &ConsumerGroup{
+		IEventEmitter: NewEventEmitter(),
+		logger:        NewLogger("ConsumerGroup"),
+		members:       make(map[string]*consumerGroupMember),
+	}
+}
+
+// AddConsumer adds the consumer to the group, taking its current score into account at once.
+// Adding a Consumer already in the group or closed does nothing.
+func (g *ConsumerGroup) AddConsumer(consumer *Consumer) {
+	g.logger.V(1).Info("addConsumer()", "consumerId", consumer.Id())
+
+	if consumer.Closed() {
+		return
+	}
+
+	g.locker.Lock()
+	if _, ok := g.members[consumer.Id()]; ok {
+		g.locker.Unlock()
+		return
+	}
+	member := &consumerGroupMember{
+		consumer: consumer,
+		score:    consumer.Score(),
+	}
+	g.members[consumer.Id()] = member
+
+	// The listeners are added with the lock held so removeMember() always sees them. A score
+	// emitted meanwhile waits for the lock and is then ignored if the member was removed.
+	scoreChanged := func(score *ConsumerScore) {
+		g.locker.Lock()
+		if g.members[consumer.Id()] != member {
+			g.locker.Unlock()
+			return
+		}
+		member.score = score
+		g.locker.Unlock()
+
+		g.emitAggregateScore()
+	}
+	member.removeListeners = append(member.removeListeners, listen(consumer.IEventEmitter, "score", scoreChanged))
+
+	consumerClosed := func() {
+		g.removeMember(member)
+	}
+	for _, event := range []string{"@close", "@producerclose", "transportclose"} {
+		member.removeListeners = append(member.removeListeners, listen(consumer.IEventEmitter, event, consumerClosed))
+	}
+	g.locker.Unlock()
+
+	// The consumer may have been closed meanwhile.
+	if consumer.Closed() {
+		g.removeMember(member)
+		return
+	}
+
+	g.emitAggregateScore()
+}
+
+// RemoveConsumer removes the consumer from the group.
+func (g *ConsumerGroup) RemoveConsumer(consumer *Consumer) {
+	g.logger.V(1).Info("removeConsumer()", "consumerId", consumer.Id())
+
+	g.locker.Lock()
+	member := g.members[consumer.Id()]
+	g.locker.Unlock()
+
+	if member != nil {
+		g.removeMember(member)
+	}
+}
+
+// Consumers returns the Consumers in the group.
+func (g *ConsumerGroup) Consumers() []*Consumer {
+	g.locker.Lock()
+	defer g.locker.Unlock()
+
+	consumers := make([]*Consumer, 0, len(g.members))
+	for _, member := range g.members {
+		consumers = append(consumers, member.consumer)
+	}
+	return consumers
+}
+
+// AggregateScore returns the minimum and the average of the latest scores of the Consumers in
+// the group, ok being false if none of them has a score yet.
+func (g *ConsumerGroup) AggregateScore() (min, avg uint16, ok bool) {
+	g.locker.Lock()
+	defer g.locker.Unlock()
+
+	var sum, count int
+	for _, member := range g.members {
+		if member.score == nil {
+			continue
+		}
+		if count == 0 || member.score.Score < min {
+			min = member.score.Score
+		}
+		sum += int(member.score.Score)
+		count++
+	}
+	if count == 0 {
+		return 0, 0, false
+	}
+	return min, uint16(sum / count), true
+}
+
+// OnAggregateScore set handler on "aggregatescore" event, emitted each time a member score
+// changes or the members change, as long as a member has a score.
+func (g *ConsumerGroup) OnAggregateScore(handler func(min, avg uint16)) {
+	g.onAggregateScore = handler
+}
+
+func (g *ConsumerGroup) removeMember(member *consumerGroupMember) {
+	g.locker.Lock()
+	if g.members[member.consumer.Id()] != member {
+		g.locker.Unlock()
+		return
+	}
+	delete(g.members, member.consumer.Id())
+	g.locker.Unlock()
+
+	for _, remove := range member.removeListeners {
+		remove()
+	}
+
+	g.emitAggregateScore()
+}
+
+func (g *ConsumerGroup) emitAggregateScore() {
+	min, avg, ok := g.AggregateScore()
+	if !ok {
+		return
+	}
+
+	g.SafeEmit("aggregatescore", min, avg)
+
+	if handler := g.onAggregateScore; handler != nil {
+		handler(min, avg)
+	}
+}
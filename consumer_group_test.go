@@ -0,0 +1,74 @@
+package mediasoup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumerGroup(t *testing.T) {
+	newFakeConsumer := func(id string, score *ConsumerScore) *Consumer {
+		return &Consumer{
+			IEventEmitter: NewEventEmitter(),
+			internal:      internalData{ConsumerId: id},
+			score:         score,
+		}
+	}
+
+	type aggregate struct{ min, avg uint16 }
+	var aggregates []aggregate
+
+	group := NewConsumerGroup()
+	group.OnAggregateScore(func(min, avg uint16) {
+		aggregates = append(aggregates, aggregate{min, avg})
+	})
+
+	c1 := newFakeConsumer("c1", &ConsumerScore{Score: 10})
+	c2 := newFakeConsumer("c2", nil)
+	c3 := newFakeConsumer("c3", &ConsumerScore{Score: 6})
+
+	group.AddConsumer(c1)
+	group.AddConsumer(c2)
+	group.AddConsumer(c3)
+	group.AddConsumer(c3)
+	assert.Len(t, group.Consumers(), 3)
+	assert.Equal(t, []aggregate{{10, 10}, {10, 10}, {6, 8}}, aggregates)
+
+	// Fake score streams.
+	aggregates = nil
+	c2.SafeEmit("score", &ConsumerScore{Score: 5})
+	c1.SafeEmit("score", &ConsumerScore{Score: 9})
+	c3.SafeEmit("score", &ConsumerScore{Score: 7})
+	assert.Equal(t, []aggregate{{5, 7}, {5, 6}, {5, 7}}, aggregates)
+
+	min, avg, ok := group.AggregateScore()
+	assert.True(t, ok)
+	assert.EqualValues(t, 5, min)
+	assert.EqualValues(t, 7, avg)
+
+	// Closed members are removed.
+	aggregates = nil
+	c2.Emit("@close")
+	assert.Len(t, group.Consumers(), 2)
+	assert.Equal(t, []aggregate{{7, 8}}, aggregates)
+
+	c2.SafeEmit("score", &ConsumerScore{Score: 1})
+	assert.Equal(t, []aggregate{{7, 8}}, aggregates)
+
+	// Removed members are ignored, even once added again.
+	aggregates = nil
+	group.RemoveConsumer(c3)
+	c3.SafeEmit("score", &ConsumerScore{Score: 1})
+	assert.Equal(t, []aggregate{{9, 9}}, aggregates)
+
+	// The fake consumer Score() is not updated by the emitted scores.
+	group.AddConsumer(c3)
+	c3.SafeEmit("score", &ConsumerScore{Score: 3})
+	assert.Equal(t, []aggregate{{9, 9}, {6, 7}, {3, 6}}, aggregates)
+
+	group.RemoveConsumer(c1)
+	group.RemoveConsumer(c3)
+	_, _, ok = group.AggregateScore()
+	assert.False(t, ok)
+	assert.Empty(t, group.Consumers())
+}
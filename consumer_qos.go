@@ -0,0 +1,112 @@
+package mediasoup
+
+import (
+	"strings"
+	"time"
+)
+
+// ConsumerQoS is a flat summary of the stats of a Consumer, with the same fields whatever the
+// type of the Consumer, for dashboards. Fields of the sent stream come from the "outbound-rtp"
+// entries, and fields of the stream received by the Producer from the "inbound-rtp" entries. If
+// there are several entries of a type (e.g. a pipe Consumer of a simulcast Producer), the worst
+// score, loss, jitter and rtt are kept and the bitrates are summed.
+type ConsumerQoS struct {
+	Kind     MediaKind
+	MimeType string
+
+	// Score is the 0-10 score of the RTP stream sent by the Consumer.
+	Score uint32
+
+	// LossPercent is the percentage of packets lost reported by the remote endpoint.
+	LossPercent float64
+
+	// Rtt is the round trip time to the remote endpoint.
+	Rtt time.Duration
+
+	// Bitrate is the bitrate in bps sent by the Consumer.
+	Bitrate uint32
+
+	// ProducerScore is the 0-10 score of the RTP stream received by the Producer.
+	ProducerScore uint32
+
+	// ProducerLossPercent is the percentage of packets lost by the Producer.
+	ProducerLossPercent float64
+
+	// Jitter is the interarrival jitter of the RTP stream received by the Producer.
+	Jitter time.Duration
+
+	// ProducerBitrate is the bitrate in bps received by the Producer.
+	ProducerBitrate uint32
+}
+
+// QoS fetches the stats of the Consumer and returns them as a ConsumerQoS.
+func (consumer *Consumer) QoS() (qos ConsumerQoS, err error) {
+	stats, err := consumer.GetStats()
+	if err != nil {
+		return
+	}
+
+	return newConsumerQoS(stats, consumer.RtpParameters().Codecs), nil
+}
+
+// newConsumerQoS merges stats into a ConsumerQoS, using the clock rate of the codec of the
+// "inbound-rtp" entries to convert the jitter.
+func newConsumerQoS(stats []*ConsumerStat, codecs []*RtpCodecParameters) (qos ConsumerQoS) {
+	var hasOutbound, hasInbound bool
+
+	for _, stat := range stats {
+		if len(qos.Kind) == 0 {
+			qos.Kind = stat.MediaKind()
+		}
+		if len(qos.MimeType) == 0 {
+			qos.MimeType = stat.MimeType
+		}
+
+		// The fraction lost is a 8 bits fixed point number, as in RTCP receiver reports.
+		lossPercent := float64(stat.FractionLost) * 100 / 256
+
+		switch stat.StatType() {
+		case StatType_OutboundRtp:
+			if !hasOutbound || stat.Score < qos.Score {
+				qos.Score = stat.Score
+			}
+			hasOutbound = true
+
+			if lossPercent > qos.LossPercent {
+				qos.LossPercent = lossPercent
+			}
+			// The round trip time is in milliseconds.
+			if rtt := time.Duration(float64(stat.RoundTripTime) * float64(time.Millisecond)); rtt > qos.Rtt {
+				qos.Rtt = rtt
+			}
+			qos.Bitrate += stat.Bitrate
+
+		case StatType_InboundRtp:
+			if !hasInbound || stat.Score < qos.ProducerScore {
+				qos.ProducerScore = stat.Score
+			}
+			hasInbound = true
+
+			if lossPercent > qos.ProducerLossPercent {
+				qos.ProducerLossPercent = lossPercent
+			}
+			if jitter := rtpTimestampDuration(stat.Jitter, stat.MimeType, codecs); jitter > qos.Jitter {
+				qos.Jitter = jitter
+			}
+			qos.ProducerBitrate += stat.Bitrate
+		}
+	}
+
+	return
+}
+
+// rtpTimestampDuration converts a number of RTP timestamp units to a duration, with the clock
+// rate of the codec of mimeType. It returns zero if the codec is not found.
+func rtpTimestampDuration(units uint32, mimeType string, codecs []*RtpCodecParameters) time.Duration {
+	for _, codec := range codecs {
+		if strings.EqualFold(codec.MimeType, mimeType) && codec.ClockRate > 0 {
+			return time.Duration(units) * time.Second / time.Duration(codec.ClockRate)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,61 @@
+package mediasoup
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConsumerQoS(t *testing.T) {
+	codecs := []*RtpCodecParameters{
+		{MimeType: "video/VP8", PayloadType: 101, ClockRate: 90000},
+		{MimeType: "video/rtx", PayloadType: 102, ClockRate: 90000},
+	}
+
+	// Stats of a simulcast Consumer, as sent by the worker.
+	var stats []*ConsumerStat
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"type":"outbound-rtp","timestamp":10000,"ssrc":2222,"kind":"video","mimeType":"video/VP8",
+			"packetsLost":3,"fractionLost":64,"score":8,"packetCount":1000,"byteCount":900000,
+			"bitrate":500000,"roundTripTime":42.5},
+		{"type":"inbound-rtp","timestamp":10000,"ssrc":1111,"rid":"r1","kind":"video","mimeType":"video/VP8",
+			"packetsLost":1,"fractionLost":13,"score":10,"packetCount":1200,"byteCount":1000000,
+			"bitrate":600000,"jitter":900,"bitrateByLayer":{"1.0":600000}}
+	]`), &stats))
+
+	assert.Equal(t, ConsumerQoS{
+		Kind:                MediaKind_Video,
+		MimeType:            "video/VP8",
+		Score:               8,
+		LossPercent:         25,
+		Rtt:                 42500 * time.Microsecond,
+		Bitrate:             500000,
+		ProducerScore:       10,
+		ProducerLossPercent: float64(13) * 100 / 256,
+		Jitter:              10 * time.Millisecond,
+		ProducerBitrate:     600000,
+	}, newConsumerQoS(stats, codecs))
+
+	// A pipe Consumer sends all the streams of a simulcast Producer.
+	stats = []*ConsumerStat{
+		{Type: "outbound-rtp", Kind: "video", MimeType: "video/VP8", Score: 10, FractionLost: 0, Bitrate: 100000},
+		{Type: "outbound-rtp", Kind: "video", MimeType: "video/VP8", Score: 6, FractionLost: 128, Bitrate: 300000},
+		{Type: "outbound-rtp", Kind: "video", MimeType: "video/VP8", Score: 9, FractionLost: 32, Bitrate: 800000},
+	}
+	assert.Equal(t, ConsumerQoS{
+		Kind:        MediaKind_Video,
+		MimeType:    "video/VP8",
+		Score:       6,
+		LossPercent: 50,
+		Bitrate:     1200000,
+	}, newConsumerQoS(stats, codecs))
+
+	// The jitter can not be converted without the clock rate of the codec.
+	stats = []*ConsumerStat{{Type: "inbound-rtp", MimeType: "video/H264", Jitter: 900}}
+	assert.Zero(t, newConsumerQoS(stats, codecs).Jitter)
+
+	assert.Equal(t, ConsumerQoS{}, newConsumerQoS(nil, codecs))
+}
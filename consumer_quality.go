@@ -0,0 +1,61 @@
+package mediasoup
+
+// QualityLabel is a label of the quality of a RTP stream derived from its 0-10 score.
+type QualityLabel string
+
+const (
+	QualityLabel_Excellent QualityLabel = "excellent"
+	QualityLabel_Good      QualityLabel = "good"
+	QualityLabel_Fair      QualityLabel = "fair"
+	QualityLabel_Poor      QualityLabel = "poor"
+	QualityLabel_Bad       QualityLabel = "bad"
+)
+
+// QualityThresholds define the lowest score of each QualityLabel, a score lower than Poor being
+// Bad.
+type QualityThresholds struct {
+	Excellent uint16
+	Good      uint16
+	Fair      uint16
+	Poor      uint16
+}
+
+// DefaultQualityThresholds are the thresholds used by ScoreToQuality() and Consumer.Quality().
+// They can be changed at startup, before any use.
+var DefaultQualityThresholds = QualityThresholds{
+	Excellent: 9,
+	Good:      7,
+	Fair:      5,
+	Poor:      3,
+}
+
+// Quality returns the QualityLabel of score according to the thresholds.
+func (t QualityThresholds) Quality(score uint16) QualityLabel {
+	switch {
+	case score >= t.Excellent:
+		return QualityLabel_Excellent
+	case score >= t.Good:
+		return QualityLabel_Good
+	case score >= t.Fair:
+		return QualityLabel_Fair
+	case score >= t.Poor:
+		return QualityLabel_Poor
+	default:
+		return QualityLabel_Bad
+	}
+}
+
+// ScoreToQuality returns the QualityLabel of a 0-10 score according to DefaultQualityThresholds.
+func ScoreToQuality(score uint16) QualityLabel {
+	return DefaultQualityThresholds.Quality(score)
+}
+
+// Quality returns the QualityLabel of the RTP stream sent by the Consumer, from its latest score
+// and DefaultQualityThresholds, without a GetStats() request.
+func (consumer *Consumer) Quality() QualityLabel {
+	var score uint16
+	if s := consumer.Score(); s != nil {
+		score = s.Score
+	}
+	return ScoreToQuality(score)
+}
@@ -0,0 +1,41 @@
+package mediasoup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScoreToQuality(t *testing.T) {
+	expected := []QualityLabel{
+		QualityLabel_Bad, QualityLabel_Bad, QualityLabel_Bad,
+		QualityLabel_Poor, QualityLabel_Poor,
+		QualityLabel_Fair, QualityLabel_Fair,
+		QualityLabel_Good, QualityLabel_Good,
+		QualityLabel_Excellent, QualityLabel_Excellent,
+	}
+	for score, quality := range expected {
+		assert.Equal(t, quality, ScoreToQuality(uint16(score)), "score %d", score)
+	}
+
+	thresholds := QualityThresholds{Excellent: 10, Good: 8, Fair: 6, Poor: 1}
+	assert.Equal(t, QualityLabel_Good, thresholds.Quality(9))
+	assert.Equal(t, QualityLabel_Poor, thresholds.Quality(1))
+	assert.Equal(t, QualityLabel_Bad, thresholds.Quality(0))
+
+	defaultThresholds := DefaultQualityThresholds
+	defer func() { DefaultQualityThresholds = defaultThresholds }()
+	DefaultQualityThresholds = thresholds
+	assert.Equal(t, QualityLabel_Good, ScoreToQuality(9))
+}
+
+func TestConsumerQuality(t *testing.T) {
+	consumer := &Consumer{}
+	assert.Equal(t, QualityLabel_Bad, consumer.Quality())
+
+	consumer.setScore(&ConsumerScore{Score: 10, ProducerScore: 2})
+	assert.Equal(t, QualityLabel_Excellent, consumer.Quality())
+
+	consumer.setScore(&ConsumerScore{Score: 6, ProducerScore: 10})
+	assert.Equal(t, QualityLabel_Fair, consumer.Quality())
+}
@@ -0,0 +1,51 @@
+package mediasoup
+
+import (
+	"time"
+)
+
+// ConsumerSetupTimings are the times at which the phases of the creation of a Consumer by
+// Consume() ended. They are taken from the monotonic clock, so the durations between them are
+// not affected by wall clock changes.
+type ConsumerSetupTimings struct {
+	// Started is the time Consume() was called.
+	Started time.Time
+
+	// RequestSent is the time the "transport.consume" request was issued, once the RTP parameters
+	// of the Consumer were computed.
+	RequestSent time.Time
+
+	// Responded is the time the response of mediasoup-worker was received.
+	Responded time.Time
+
+	// Subscribed is the time the Consumer subscribed to its notifications, after which it is
+	// ready.
+	Subscribed time.Time
+}
+
+// Preparation returns the time spent computing the RTP parameters of the Consumer.
+func (t ConsumerSetupTimings) Preparation() time.Duration {
+	return t.RequestSent.Sub(t.Started)
+}
+
+// WorkerRequest returns the time spent waiting for mediasoup-worker to create the Consumer,
+// including the time the request was queued in the Channel.
+func (t ConsumerSetupTimings) WorkerRequest() time.Duration {
+	return t.Responded.Sub(t.RequestSent)
+}
+
+// Subscription returns the time spent creating the Consumer and subscribing to its
+// notifications.
+func (t ConsumerSetupTimings) Subscription() time.Duration {
+	return t.Subscribed.Sub(t.Responded)
+}
+
+// Total returns the time spent in Consume().
+func (t ConsumerSetupTimings) Total() time.Duration {
+	return t.Subscribed.Sub(t.Started)
+}
+
+// SetupTimings returns the timings of the creation of the Consumer.
+func (consumer *Consumer) SetupTimings() ConsumerSetupTimings {
+	return consumer.setupTimings
+}
@@ -0,0 +1,60 @@
+package mediasoup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerSetupTimings(t *testing.T) {
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		time.Sleep(5 * time.Millisecond)
+		return "{}", nil
+	})
+
+	producer := &Producer{
+		internal: internalData{ProducerId: "producer"},
+		data: producerData{
+			Kind: MediaKind_Audio,
+			Type: ProducerType_Simple,
+			ConsumableRtpParameters: RtpParameters{
+				Codecs: []*RtpCodecParameters{
+					{MimeType: "audio/opus", PayloadType: 100, ClockRate: 48000, Channels: 2},
+				},
+				Encodings: []RtpEncodingParameters{{Ssrc: 1111}},
+			},
+		},
+	}
+
+	payloadChannel, _ := newFakePayloadChannel(t)
+	transport := newDirectTransport(transportParams{
+		internal:        internalData{RouterId: "router", TransportId: "transport"},
+		channel:         channel,
+		payloadChannel:  payloadChannel,
+		getProducerById: func(string) *Producer { return producer },
+	})
+
+	before := time.Now()
+	consumer, err := transport.Consume(ConsumerOptions{
+		ProducerId: "producer",
+		RtpCapabilities: RtpCapabilities{
+			Codecs: []*RtpCodecCapability{
+				{Kind: MediaKind_Audio, MimeType: "audio/opus", PreferredPayloadType: 100, ClockRate: 48000, Channels: 2},
+			},
+		},
+	})
+	require.NoError(t, err)
+	after := time.Now()
+
+	timings := consumer.SetupTimings()
+	assert.False(t, timings.Started.Before(before))
+	assert.False(t, timings.RequestSent.Before(timings.Started))
+	assert.False(t, timings.Responded.Before(timings.RequestSent))
+	assert.False(t, timings.Subscribed.Before(timings.Responded))
+	assert.False(t, after.Before(timings.Subscribed))
+
+	assert.True(t, timings.WorkerRequest() >= 5*time.Millisecond, timings.WorkerRequest())
+	assert.Equal(t, timings.Total(), timings.Preparation()+timings.WorkerRequest()+timings.Subscription())
+}
@@ -0,0 +1,62 @@
+package mediasoup
+
+import "time"
+
+// ConsumerStatDelta holds the changes of the counters of a ConsumerStat between two samples and
+// the rates derived from them.
+type ConsumerStatDelta struct {
+	// Interval is the time elapsed between the two samples, from their timestamps.
+	Interval time.Duration
+
+	// Reset is true if the previous sample is missing, belongs to another stream or if the
+	// counters went backwards (e.g. the stream was recreated). The current sample is then a fresh
+	// baseline and the other fields are zero.
+	Reset bool
+
+	PacketCount          int64
+	ByteCount            int64
+	PacketsLost          int64
+	PacketsRetransmitted int64
+	NackCount            int64
+	NackPacketCount      int64
+	PliCount             int64
+	FirCount             int64
+
+	// Bitrate is the bitrate in bps computed from ByteCount over Interval.
+	Bitrate uint32
+
+	// PacketRate is the number of packets per second computed from PacketCount over Interval.
+	PacketRate float64
+}
+
+// StatsDelta computes the changes between the prev and cur samples of the same RTP stream, so
+// applications building per interval metrics from GetStats() polling do not need to handle
+// counter resets themselves.
+func StatsDelta(prev, cur *ConsumerStat) (delta ConsumerStatDelta) {
+	if prev == nil || cur == nil || prev.Ssrc != cur.Ssrc || cur.Timestamp < prev.Timestamp ||
+		cur.PacketCount < prev.PacketCount || cur.ByteCount < prev.ByteCount ||
+		cur.PacketsLost < prev.PacketsLost || cur.PacketsRetransmitted < prev.PacketsRetransmitted ||
+		cur.NackCount < prev.NackCount || cur.NackPacketCount < prev.NackPacketCount ||
+		cur.PliCount < prev.PliCount || cur.FirCount < prev.FirCount {
+		delta.Reset = true
+		return
+	}
+
+	// Timestamps are in milliseconds.
+	delta.Interval = time.Duration(cur.Timestamp-prev.Timestamp) * time.Millisecond
+	delta.PacketCount = cur.PacketCount - prev.PacketCount
+	delta.ByteCount = cur.ByteCount - prev.ByteCount
+	delta.PacketsLost = int64(cur.PacketsLost) - int64(prev.PacketsLost)
+	delta.PacketsRetransmitted = int64(cur.PacketsRetransmitted) - int64(prev.PacketsRetransmitted)
+	delta.NackCount = int64(cur.NackCount) - int64(prev.NackCount)
+	delta.NackPacketCount = int64(cur.NackPacketCount) - int64(prev.NackPacketCount)
+	delta.PliCount = int64(cur.PliCount) - int64(prev.PliCount)
+	delta.FirCount = int64(cur.FirCount) - int64(prev.FirCount)
+
+	if seconds := delta.Interval.Seconds(); seconds > 0 {
+		delta.Bitrate = uint32(float64(delta.ByteCount*8) / seconds)
+		delta.PacketRate = float64(delta.PacketCount) / seconds
+	}
+
+	return
+}
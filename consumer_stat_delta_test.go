@@ -0,0 +1,60 @@
+package mediasoup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsDelta(t *testing.T) {
+	prev := &ConsumerStat{
+		Type:        "outbound-rtp",
+		Timestamp:   10000,
+		Ssrc:        1111,
+		PacketCount: 100,
+		ByteCount:   100000,
+		PacketsLost: 2,
+		NackCount:   1,
+		PliCount:    1,
+	}
+	cur := &ConsumerStat{
+		Type:        "outbound-rtp",
+		Timestamp:   12000,
+		Ssrc:        1111,
+		PacketCount: 300,
+		ByteCount:   350000,
+		PacketsLost: 5,
+		NackCount:   4,
+		PliCount:    2,
+	}
+
+	assert.Equal(t, ConsumerStatDelta{
+		Interval:    2 * time.Second,
+		PacketCount: 200,
+		ByteCount:   250000,
+		PacketsLost: 3,
+		NackCount:   3,
+		PliCount:    1,
+		Bitrate:     1000000,
+		PacketRate:  100,
+	}, StatsDelta(prev, cur))
+
+	// Counters going backwards are a fresh baseline.
+	reset := *cur
+	reset.Timestamp = 14000
+	reset.PacketCount = 10
+	reset.ByteCount = 8000
+	assert.Equal(t, ConsumerStatDelta{Reset: true}, StatsDelta(cur, &reset))
+
+	other := *cur
+	other.Ssrc = 2222
+	assert.True(t, StatsDelta(prev, &other).Reset)
+	assert.True(t, StatsDelta(nil, cur).Reset)
+
+	// No rates without elapsed time.
+	delta := StatsDelta(cur, cur)
+	assert.False(t, delta.Reset)
+	assert.Zero(t, delta.Bitrate)
+	assert.Zero(t, delta.PacketRate)
+}
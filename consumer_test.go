@@ -1,11 +1,22 @@
 package mediasoup
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"regexp"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/anjingxw/mediasoup-go/h264"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -265,6 +276,8 @@ func (suite *ConsumerTestingSuite) TestTransportConsume_Succeeds() {
 	}, videoConsumer.RtpParameters().Codecs[1])
 
 	suite.EqualValues(ConsumerType_Simulcast, videoConsumer.Type())
+	suite.EqualValues(4, videoConsumer.SpatialLayers())
+	suite.EqualValues(1, videoConsumer.TemporalLayers())
 	suite.True(videoConsumer.Paused())
 	suite.True(videoConsumer.ProducerPaused())
 	suite.EqualValues(1, videoConsumer.Priority())
@@ -400,6 +413,8 @@ func (suite *ConsumerTestingSuite) TestTransportConsume_UnsupportedError() {
 		RtpCapabilities: invalidDeviceCapabilities,
 	})
 	suite.IsType(NewUnsupportedError(""), err)
+	suite.True(errors.Is(err, ErrCannotConsume))
+	suite.Contains(err.Error(), "audio/opus/48000/2")
 
 	invalidDeviceCapabilities = RtpCapabilities{}
 
@@ -410,6 +425,7 @@ func (suite *ConsumerTestingSuite) TestTransportConsume_UnsupportedError() {
 		RtpCapabilities: invalidDeviceCapabilities,
 	})
 	suite.IsType(NewUnsupportedError(""), err)
+	suite.Empty(transport2.Consumers())
 }
 
 func (suite *ConsumerTestingSuite) TestConsumerDump() {
@@ -606,6 +622,18 @@ func (suite *ConsumerTestingSuite) TestConsumerSetPreferredLayersSucceed() {
 	suite.Require().Equal(&ConsumerLayers{SpatialLayer: 2, TemporalLayer: 0}, videoConsumer.PreferredLayers())
 }
 
+func (suite *ConsumerTestingSuite) TestConsumerRequestKeyFrameForLayer() {
+	videoConsumer := suite.videoConsumer(false)
+
+	suite.NoError(videoConsumer.RequestKeyFrameForLayer(3))
+	suite.IsType(TypeError{}, videoConsumer.RequestKeyFrameForLayer(4))
+
+	audioConsumer := suite.audioConsumer()
+
+	suite.NoError(audioConsumer.RequestKeyFrameForLayer(0))
+	suite.IsType(TypeError{}, audioConsumer.RequestKeyFrameForLayer(1))
+}
+
 func (suite *ConsumerTestingSuite) TestConsumerSetPrioritySucceed() {
 	videoConsumer := suite.videoConsumer(false)
 
@@ -614,6 +642,35 @@ func (suite *ConsumerTestingSuite) TestConsumerSetPrioritySucceed() {
 	suite.Require().EqualValues(2, videoConsumer.Priority())
 }
 
+func (suite *ConsumerTestingSuite) TestConsumerConcurrentSetPreferredLayersAndPriority() {
+	videoConsumer := suite.videoConsumer(false)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+
+		go func(i int) {
+			defer wg.Done()
+			videoConsumer.SetPreferredLayers(ConsumerLayers{SpatialLayer: uint8(i % 4)})
+		}(i)
+
+		go func(i int) {
+			defer wg.Done()
+			videoConsumer.SetPriority(uint32(i%5 + 1))
+			_ = videoConsumer.Priority()
+			_ = videoConsumer.PreferredLayers()
+		}(i)
+	}
+
+	wg.Wait()
+
+	dump, err := videoConsumer.Dump()
+	suite.Require().NoError(err)
+	suite.EqualValues(dump.Priority, videoConsumer.Priority())
+	suite.EqualValues(dump.PreferredSpatialLayer, videoConsumer.PreferredLayers().SpatialLayer)
+}
+
 func (suite *ConsumerTestingSuite) TestConsumerSetPriorityRejectWithTypeError() {
 	videoConsumer := suite.videoConsumer(false)
 
@@ -636,22 +693,197 @@ func (suite *ConsumerTestingSuite) TestEnableTraceEventSucceed() {
 
 	dump, _ := audioConsumer.Dump()
 	suite.Require().Equal("rtp,pli", dump.TraceEventTypes)
+	suite.Equal([]ConsumerTraceEventType{ConsumerTraceEventType_Rtp, ConsumerTraceEventType_Pli},
+		dump.EnabledTraceEventTypes())
 
 	audioConsumer.EnableTraceEvent()
 
 	dump, _ = audioConsumer.Dump()
 	suite.Require().Empty(dump.TraceEventTypes)
+	suite.Empty(dump.EnabledTraceEventTypes())
 
 	audioConsumer.EnableTraceEvent("nack", "FOO", "fir")
 
 	dump, _ = audioConsumer.Dump()
 	suite.Require().Equal("nack,fir", dump.TraceEventTypes)
+	// Unknown types are ignored by the worker but kept by TraceEventTypes().
+	suite.Equal([]ConsumerTraceEventType{ConsumerTraceEventType_Nack, ConsumerTraceEventType_Fir},
+		dump.EnabledTraceEventTypes())
+	suite.Equal([]ConsumerTraceEventType{"nack", "FOO", "fir"}, audioConsumer.TraceEventTypes())
 
 	audioConsumer.EnableTraceEvent()
 
 	dump, _ = audioConsumer.Dump()
 	suite.Require().Empty(dump.TraceEventTypes)
+	suite.Empty(dump.EnabledTraceEventTypes())
+
+}
+
+func (suite *ConsumerTestingSuite) TestTraceEventTypesCanBeRestored() {
+	audioConsumer := suite.audioConsumer()
+	suite.Empty(audioConsumer.TraceEventTypes())
+
+	audioConsumer.EnableTraceEvent("rtp", "pli")
+	suite.Equal([]ConsumerTraceEventType{"rtp", "pli"}, audioConsumer.TraceEventTypes())
+
+	// Simulate a restart by consuming again and replaying the cached types.
+	types := audioConsumer.TraceEventTypes()
+	audioConsumer.Close()
+
+	audioConsumer = suite.audioConsumer()
+	suite.NoError(audioConsumer.EnableTraceEvent(types...))
+
+	dump, _ := audioConsumer.Dump()
+	suite.Equal("rtp,pli", dump.TraceEventTypes)
+
+	audioConsumer.EnableTraceEvent()
+	suite.Empty(audioConsumer.TraceEventTypes())
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerReplaceProducer() {
+	audioConsumer := suite.audioConsumer()
+	oldRtpParameters := audioConsumer.RtpParameters()
+
+	audioProducer2, err := suite.transport1.Produce(ProducerOptions{
+		Kind: MediaKind_Audio,
+		RtpParameters: RtpParameters{
+			Mid: "AUDIO2",
+			Codecs: []*RtpCodecParameters{
+				{
+					MimeType:    "audio/opus",
+					PayloadType: 111,
+					ClockRate:   48000,
+					Channels:    2,
+					Parameters: RtpCodecSpecificParameters{
+						Useinbandfec: 1,
+						Usedtx:       1,
+					},
+				},
+			},
+			HeaderExtensions: suite.audioProducer.RtpParameters().HeaderExtensions,
+			Encodings:        []RtpEncodingParameters{{Ssrc: 11111112}},
+			Rtcp: RtcpParameters{
+				Cname: "audio-2",
+			},
+		},
+	})
+	suite.Require().NoError(err)
+
+	newConsumer, err := audioConsumer.ReplaceProducer(audioProducer2.Id(), suite.consumerDeviceCapabilities)
+	suite.Require().NoError(err)
+
+	suite.True(audioConsumer.Closed())
+	suite.False(newConsumer.Closed())
+	suite.NotEqual(audioConsumer.Id(), newConsumer.Id())
+	suite.Equal(audioProducer2.Id(), newConsumer.ProducerId())
+	suite.Equal(oldRtpParameters.Mid, newConsumer.RtpParameters().Mid)
+	suite.Equal(oldRtpParameters.Encodings[0].Ssrc, newConsumer.RtpParameters().Encodings[0].Ssrc)
+	suite.Equal(oldRtpParameters.Rtcp.Cname, newConsumer.RtpParameters().Rtcp.Cname)
+
+	transportDump, _ := suite.transport2.Dump()
+	suite.Equal([]string{newConsumer.Id()}, transportDump.ConsumerIds)
+
+	_, err = newConsumer.ReplaceProducer(suite.videoProducer.Id(), suite.consumerDeviceCapabilities)
+	suite.True(errors.Is(err, ErrIncompatibleReplacement))
+	suite.False(newConsumer.Closed())
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerPauseEncoding() {
+	simulcastProducer, err := suite.transport1.Produce(ProducerOptions{
+		Kind: MediaKind_Video,
+		RtpParameters: RtpParameters{
+			Mid: "VIDEO2",
+			Codecs: []*RtpCodecParameters{
+				{
+					MimeType:    "video/H264",
+					PayloadType: 112,
+					ClockRate:   90000,
+					Parameters: RtpCodecSpecificParameters{
+						RtpParameter: h264.RtpParameter{
+							PacketizationMode: 1,
+							ProfileLevelId:    "4d0032",
+						},
+					},
+				},
+			},
+			Encodings: []RtpEncodingParameters{
+				{Rid: "r0"},
+				{Rid: "r1"},
+			},
+		},
+	})
+	suite.Require().NoError(err)
+
+	videoConsumer, err := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      simulcastProducer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+	})
+	suite.Require().NoError(err)
+	suite.Equal(ConsumerType_Simulcast, videoConsumer.Type())
+
+	suite.IsType(UnsupportedError{}, videoConsumer.PauseEncoding("r0"))
+	suite.IsType(UnsupportedError{}, videoConsumer.ResumeEncoding("r1"))
+	suite.IsType(TypeError{}, videoConsumer.PauseEncoding("r2"))
+
+	audioConsumer := suite.audioConsumer()
+	suite.IsType(TypeError{}, audioConsumer.PauseEncoding("r0"))
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerTotalPausedDuration() {
+	audioConsumer := suite.audioConsumer()
+
+	suite.WithinDuration(time.Now(), audioConsumer.CreatedAt(), time.Second)
+	suite.Zero(audioConsumer.TotalPausedDuration())
+
+	for i := 0; i < 2; i++ {
+		audioConsumer.Pause()
+		time.Sleep(20 * time.Millisecond)
+		audioConsumer.Resume()
+		time.Sleep(10 * time.Millisecond)
+	}
+	paused := audioConsumer.TotalPausedDuration()
+	suite.GreaterOrEqual(int64(paused), int64(40*time.Millisecond))
+	suite.Less(int64(paused), int64(time.Since(audioConsumer.CreatedAt())))
+
+	// Pausing the producer counts as paused too, overlapping periods are counted once.
+	suite.audioProducer.Pause()
+	audioConsumer.Pause()
+	time.Sleep(20 * time.Millisecond)
+	suite.audioProducer.Resume()
+	audioConsumer.Resume()
+	suite.GreaterOrEqual(int64(audioConsumer.TotalPausedDuration()), int64(paused+20*time.Millisecond))
+
+	// The duration is finalized at close, including a pending paused period.
+	audioConsumer.Pause()
+	time.Sleep(10 * time.Millisecond)
+	audioConsumer.Close()
+	paused = audioConsumer.TotalPausedDuration()
+	suite.GreaterOrEqual(int64(paused), int64(70*time.Millisecond))
+	time.Sleep(10 * time.Millisecond)
+	suite.Equal(paused, audioConsumer.TotalPausedDuration())
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerEmitsRtcp() {
+	audioConsumer := suite.audioConsumer()
+
+	onRtcp := NewMockFunc(suite.T())
+	audioConsumer.On("rtcp", onRtcp.Fn())
+
+	var received []byte
+	audioConsumer.OnRtcp(func(data []byte) {
+		received = data
+	})
 
+	subscriber, _ := audioConsumer.payloadChannel.subscribers.Load(audioConsumer.Id())
+	emit := subscriber.(payloadChannelSubscriber)
+
+	// RTCP receiver report with no report blocks.
+	packet := []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}
+	emit("rtcp", nil, packet)
+
+	onRtcp.ExpectCalledTimes(1)
+	onRtcp.ExpectCalledWith(packet)
+	suite.Equal(packet, received)
 }
 
 func (suite *ConsumerTestingSuite) TestConsumerEmitsProducerPauseAndProducerResume() {
@@ -673,130 +905,2179 @@ func (suite *ConsumerTestingSuite) TestConsumerEmitsProducerPauseAndProducerResu
 	suite.False(audioConsumer.ProducerPaused())
 }
 
-func (suite *ConsumerTestingSuite) TestConsumerEmitsScore() {
+func (suite *ConsumerTestingSuite) TestConsumerProducerPauseNotificationsReordered() {
 	audioConsumer := suite.audioConsumer()
 
-	onScore := NewMockFunc(suite.T())
-	audioConsumer.On("score", onScore.Fn())
+	var producerPauses, producerResumes, pauses, resumes int
+	audioConsumer.OnProducerPause(func() { producerPauses++ })
+	audioConsumer.OnProducerResume(func() { producerResumes++ })
+	audioConsumer.OnPause(func() { pauses++ })
+	audioConsumer.OnResume(func() { resumes++ })
 
-	channel := audioConsumer.channel
-	subscriber, _ := channel.subscribers.Load(audioConsumer.Id())
+	subscriber, _ := audioConsumer.channel.subscribers.Load(audioConsumer.Id())
 	emit := subscriber.(channelSubscriber)
 
-	emit("score", []byte(`{"producerScore": 10, "score": 9}`))
-	emit("score", []byte(`{"producerScore": 9, "score": 9}`))
-	emit("score", []byte(`{"producerScore": 8, "score": 8}`))
+	emit("producerpause", nil)
+	emit("producerpause", nil)
+	suite.True(audioConsumer.ProducerPaused())
 
-	onScore.ExpectCalledTimes(3)
-	suite.Equal(&ConsumerScore{ProducerScore: 8, Score: 8}, audioConsumer.Score())
+	emit("producerresume", nil)
+	emit("producerresume", nil)
+	suite.False(audioConsumer.ProducerPaused())
+
+	suite.Equal(1, producerPauses)
+	suite.Equal(1, producerResumes)
+	suite.Equal(1, pauses)
+	suite.Equal(1, resumes)
+
+	// A resume with no pause before is ignored, the following pause is applied.
+	emit("producerresume", nil)
+	emit("producerpause", nil)
+	suite.True(audioConsumer.ProducerPaused())
+	suite.Equal(2, producerPauses)
+	suite.Equal(1, producerResumes)
+
+	// The consumer itself paused while the producer is paused: resuming the producer must not
+	// emit "resume".
+	suite.NoError(audioConsumer.Pause())
+	emit("producerresume", nil)
+	emit("producerresume", nil)
+	suite.False(audioConsumer.ProducerPaused())
+	suite.True(audioConsumer.Paused())
+	suite.Equal(2, producerResumes)
+	suite.Equal(1, resumes)
 }
 
-func (suite *ConsumerTestingSuite) TestConsumerClose() {
-	audioConsumer := suite.audioConsumer()
+func (suite *ConsumerTestingSuite) TestConsumerString() {
 	videoConsumer := suite.videoConsumer(true)
 
-	onObserverClose := NewMockFunc(suite.T())
+	description := videoConsumer.String()
+	suite.Contains(description, "id:"+videoConsumer.Id())
+	suite.Contains(description, "kind:video")
+	suite.Contains(description, "type:simulcast")
+	suite.Contains(description, "producerId:"+suite.videoProducer.Id())
+	suite.Contains(description, "paused:true")
+	suite.Contains(description, "producerPaused:false")
+	suite.Contains(description, "priority:1")
+	suite.Contains(description, "currentLayers:-")
+	suite.Contains(description, "preferredLayers:")
+	suite.Equal(description, fmt.Sprint(videoConsumer))
+}
 
-	audioConsumer.Observer().Once("close", onObserverClose.Fn())
-	audioConsumer.Close()
+func (suite *ConsumerTestingSuite) TestConsumeWithProducerPaused() {
+	suite.NoError(suite.audioProducer.Pause())
 
-	onObserverClose.ExpectCalledTimes(1)
-	suite.True(audioConsumer.Closed())
+	var producerPauses, pauses int
 
-	routerDump, _ := suite.router.Dump()
+	suite.transport2.Observer().Once("newconsumer", func(consumer *Consumer) {
+		consumer.OnProducerPause(func() { producerPauses++ })
+		consumer.OnPause(func() { pauses++ })
+	})
 
-	suite.Empty(routerDump.MapProducerIdConsumerIds[suite.audioProducer.Id()])
-	suite.Equal(suite.videoProducer.Id(), routerDump.MapConsumerIdProducerId[videoConsumer.Id()])
+	audioConsumer, err := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:       suite.audioProducer.Id(),
+		RtpCapabilities:  suite.consumerDeviceCapabilities,
+		EmitInitialState: true,
+	})
+	suite.Require().NoError(err)
 
-	videoPipeConsumer, _ := suite.transport2.Consume(ConsumerOptions{
-		ProducerId:      suite.videoProducer.Id(),
-		RtpCapabilities: suite.consumerDeviceCapabilities,
-		Pipe:            true,
+	suite.False(audioConsumer.Paused())
+	suite.True(audioConsumer.ProducerPaused())
+	suite.Equal(ConsumerInitialState{
+		Paused:         false,
+		ProducerPaused: true,
+		Score:          audioConsumer.Score(),
+	}, audioConsumer.InitialState())
+	suite.Equal(1, producerPauses)
+	suite.Equal(1, pauses)
+
+	// The initial state is kept once the producer is resumed.
+	suite.NoError(suite.audioProducer.Resume())
+	suite.Eventually(func() bool { return !audioConsumer.ProducerPaused() }, time.Second, 10*time.Millisecond)
+	suite.True(audioConsumer.InitialState().ProducerPaused)
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerEmitInitialState() {
+	var pauses int
+	var scores []*ConsumerScore
+
+	suite.transport2.Observer().Once("newconsumer", func(consumer *Consumer) {
+		consumer.OnPause(func() { pauses++ })
+		consumer.OnScore(func(score *ConsumerScore) { scores = append(scores, score) })
 	})
 
-	transportDump, _ := suite.transport2.Dump()
+	audioConsumer, err := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:       suite.audioProducer.Id(),
+		RtpCapabilities:  suite.consumerDeviceCapabilities,
+		Paused:           true,
+		EmitInitialState: true,
+	})
+	suite.Require().NoError(err)
+	suite.True(audioConsumer.Paused())
+	suite.Equal(1, pauses)
 
-	suite.Equal(suite.transport2.Id(), transportDump.Id)
-	suite.Empty(transportDump.ProducerIds)
-	suite.ElementsMatch([]string{videoConsumer.Id(), videoPipeConsumer.Id()}, transportDump.ConsumerIds)
+	// The score returned by the worker on creation is emitted.
+	suite.Require().NotNil(audioConsumer.InitialState().Score)
+	suite.Equal([]*ConsumerScore{audioConsumer.InitialState().Score}, scores)
 }
 
-func (suite *ConsumerTestingSuite) TestConsumerRejectIfClosed() {
-	audioConsumer := suite.audioConsumer()
-	audioConsumer.Close()
+func (suite *ConsumerTestingSuite) TestConsumerKeyFrameCount() {
+	videoConsumer := suite.videoConsumer(false)
 
-	_, err := audioConsumer.Dump()
-	suite.Error(err)
+	subscriber, _ := videoConsumer.channel.subscribers.Load(videoConsumer.Id())
+	emit := subscriber.(channelSubscriber)
+	keyframe := []byte(`{"type": "keyframe", "timestamp": 1, "direction": "out"}`)
 
-	_, err = audioConsumer.GetStats()
+	suite.Zero(videoConsumer.KeyFrameCount())
 
-	suite.Error(err)
-	suite.Error(audioConsumer.Pause())
-	suite.Error(audioConsumer.Resume())
-	suite.Error(audioConsumer.SetPreferredLayers(ConsumerLayers{}))
-	suite.Error(audioConsumer.RequestKeyFrame())
+	suite.NoError(videoConsumer.EnableTraceEvent(ConsumerTraceEventType_Keyframe))
+
+	emit("trace", keyframe)
+	emit("trace", []byte(`{"type": "pli", "timestamp": 2, "direction": "in"}`))
+	emit("trace", keyframe)
+	suite.EqualValues(2, videoConsumer.KeyFrameCount())
+
+	suite.NoError(videoConsumer.EnableTraceEvent())
+	suite.Zero(videoConsumer.KeyFrameCount())
+
+	// The count restarts once enabled again.
+	suite.NoError(videoConsumer.EnableTraceEvent(ConsumerTraceEventType_Keyframe))
+	suite.Zero(videoConsumer.KeyFrameCount())
+	emit("trace", keyframe)
+	suite.EqualValues(1, videoConsumer.KeyFrameCount())
 }
 
-func (suite *ConsumerTestingSuite) TestConsumerEmitsProducerClosed() {
-	audioConsumer := suite.audioConsumer()
+func (suite *ConsumerTestingSuite) TestConsumerObserverParity() {
+	var deprecatedUsages []string
+	DeprecatedUsage = func(api string) {
+		deprecatedUsages = append(deprecatedUsages, api)
+	}
+	defer func() { DeprecatedUsage = nil }()
 
-	onObserverClose := NewMockFunc(suite.T())
-	audioConsumer.Observer().Once("close", onObserverClose.Fn())
+	videoConsumer := suite.videoConsumer(false)
 
-	observer := NewMockFunc(suite.T())
+	observed := map[string]int{}
+	handled := map[string]int{}
+	observer := videoConsumer.Observer()
+	suite.Equal([]string{"Consumer.Observer"}, deprecatedUsages)
+
+	observer.On("close", func() { observed["close"]++ })
+	observer.On("pause", func() { observed["pause"]++ })
+	observer.On("resume", func() { observed["resume"]++ })
+	observer.On("score", func(*ConsumerScore) { observed["score"]++ })
+	observer.On("layerschange", func(*ConsumerLayers) { observed["layerschange"]++ })
+	observer.On("trace", func(*ConsumerTraceEventData) { observed["trace"]++ })
+
+	videoConsumer.OnClose(func() { handled["close"]++ })
+	videoConsumer.OnPause(func() { handled["pause"]++ })
+	videoConsumer.OnResume(func() { handled["resume"]++ })
+	videoConsumer.OnScore(func(*ConsumerScore) { handled["score"]++ })
+	videoConsumer.OnLayersChange(func(*ConsumerLayers) { handled["layerschange"]++ })
+	videoConsumer.OnTrace(func(*ConsumerTraceEventData) { handled["trace"]++ })
+
+	subscriber, _ := videoConsumer.channel.subscribers.Load(videoConsumer.Id())
+	emit := subscriber.(channelSubscriber)
 
-	audioConsumer.On("producerclose", observer.Fn())
+	suite.NoError(videoConsumer.Pause())
+	suite.NoError(videoConsumer.Resume())
+	emit("producerpause", nil)
+	emit("producerresume", nil)
+	emit("score", []byte(`{"producerScore": 10, "score": 9}`))
+	emit("layerschange", []byte(`{"spatialLayer": 1, "temporalLayer": 0}`))
+	emit("trace", []byte(`{"type": "pli", "timestamp": 1, "direction": "in"}`))
+	videoConsumer.Close()
+
+	suite.Equal(map[string]int{
+		"close":        1,
+		"pause":        2,
+		"resume":       2,
+		"score":        1,
+		"layerschange": 1,
+		"trace":        1,
+	}, observed)
+	suite.Equal(observed, handled)
+}
 
-	suite.audioProducer.Close()
+func (suite *ConsumerTestingSuite) TestConsumerEmitsRtpParametersChange() {
+	audioConsumer := suite.audioConsumer()
 
-	observer.ExpectCalledTimes(1)
-	onObserverClose.ExpectCalledTimes(1)
-	suite.True(audioConsumer.Closed())
+	var changed RtpParameters
+	audioConsumer.OnRtpParametersChange(func(rtpParameters RtpParameters) {
+		changed = rtpParameters
+	})
+
+	rtpParameters := audioConsumer.RtpParameters()
+	rtpParameters.Codecs = rtpParameters.Codecs[:1]
+	rtpParameters.Encodings = []RtpEncodingParameters{{Ssrc: 12345678}}
+	data, _ := json.Marshal(rtpParameters)
+
+	subscriber, _ := audioConsumer.channel.subscribers.Load(audioConsumer.Id())
+	emit := subscriber.(channelSubscriber)
+	emit("rtpparameterschange", data)
+
+	suite.EqualValues(12345678, changed.Encodings[0].Ssrc)
+	suite.Equal(changed, audioConsumer.RtpParameters())
 }
 
-func (suite *ConsumerTestingSuite) TestConsumerEmitsTransportClosed() {
-	videoConsumer := suite.videoConsumer(false)
+func (suite *ConsumerTestingSuite) TestConsumerEmitsScore() {
+	audioConsumer := suite.audioConsumer()
 
-	onObserverClose := NewMockFunc(suite.T())
-	videoConsumer.Observer().Once("close", onObserverClose.Fn())
+	onScore := NewMockFunc(suite.T())
+	audioConsumer.On("score", onScore.Fn())
 
-	observer := NewMockFunc(suite.T())
-	videoConsumer.On("transportclose", observer.Fn())
+	channel := audioConsumer.channel
+	subscriber, _ := channel.subscribers.Load(audioConsumer.Id())
+	emit := subscriber.(channelSubscriber)
 
-	suite.transport2.Close()
+	emit("score", []byte(`{"producerScore": 10, "score": 9}`))
+	emit("score", []byte(`{"producerScore": 9, "score": 9}`))
+	emit("score", []byte(`{"producerScore": 8, "score": 8}`))
 
-	observer.ExpectCalledTimes(1)
-	onObserverClose.ExpectCalledTimes(1)
-	suite.True(videoConsumer.Closed())
+	onScore.ExpectCalledTimes(3)
+	suite.Equal(&ConsumerScore{ProducerScore: 8, Score: 8}, audioConsumer.Score())
+}
 
-	routerDump, _ := suite.router.Dump()
+func (suite *ConsumerTestingSuite) TestConsumerScoreCarriesContext() {
+	type ctxKey struct{}
 
-	suite.Empty(routerDump.MapProducerIdConsumerIds[suite.audioProducer.Id()])
-	suite.Empty(routerDump.MapConsumerIdProducerId)
+	ctx := context.WithValue(context.Background(), ctxKey{}, "span")
+	audioConsumer, err := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      suite.audioProducer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+		Context:         ctx,
+	})
+	suite.Require().NoError(err)
+
+	var scoreCtx context.Context
+	audioConsumer.OnScoreCtx(func(ctx context.Context, score *ConsumerScore) {
+		scoreCtx = ctx
+	})
+
+	subscriber, _ := audioConsumer.channel.subscribers.Load(audioConsumer.Id())
+	emit := subscriber.(channelSubscriber)
+	emit("score", []byte(`{"producerScore": 10, "score": 9}`))
+
+	suite.Equal(audioConsumer.Context(), scoreCtx)
+	suite.Equal("span", scoreCtx.Value(ctxKey{}))
+
+	audioConsumer.Close()
+	suite.Equal(context.Canceled, audioConsumer.Context().Err())
 }
 
-func (suite *ConsumerTestingSuite) audioConsumer() *Consumer {
+func (suite *ConsumerTestingSuite) TestConsumerSetMaxBitrate() {
 	audioConsumer, err := suite.transport2.Consume(ConsumerOptions{
 		ProducerId:      suite.audioProducer.Id(),
 		RtpCapabilities: suite.consumerDeviceCapabilities,
-		AppData:         H{"baz": "LOL"},
 	})
 	suite.Require().NoError(err)
+	suite.IsType(UnsupportedError{}, audioConsumer.SetMaxBitrate(100000))
 
-	return audioConsumer
+	videoConsumer, err := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      suite.videoProducer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+	})
+	suite.Require().NoError(err)
+	suite.IsType(TypeError{}, videoConsumer.SetMaxBitrate(-1))
+
+	// The encodings of the producer have no maxBitrate.
+	suite.IsType(UnsupportedError{}, videoConsumer.SetMaxBitrate(100000))
+	suite.Zero(videoConsumer.MaxBitrate())
+
+	// Without cap set, removing it does not touch the preferred layers.
+	suite.NoError(videoConsumer.SetMaxBitrate(0))
+	suite.Nil(videoConsumer.IntendedPreferredLayers())
+
+	producer, err := suite.transport1.Produce(ProducerOptions{
+		Kind: MediaKind_Video,
+		RtpParameters: RtpParameters{
+			Mid:    "VIDEO2",
+			Codecs: suite.videoProducer.RtpParameters().Codecs,
+			Encodings: []RtpEncodingParameters{
+				{Ssrc: 33333332, MaxBitrate: 150000},
+				{Ssrc: 33333334, MaxBitrate: 500000},
+				{Ssrc: 33333336, MaxBitrate: 1200000},
+			},
+		},
+	})
+	suite.Require().NoError(err)
+
+	videoConsumer, err = suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+	})
+	suite.Require().NoError(err)
+
+	suite.NoError(videoConsumer.SetMaxBitrate(600000))
+	suite.Equal(600000, videoConsumer.MaxBitrate())
+	suite.Equal(&ConsumerLayers{SpatialLayer: 1, TemporalLayer: 0}, videoConsumer.PreferredLayers())
+
+	suite.Nil(videoConsumer.IntendedPreferredLayers())
+
+	// Below the lowest layer, the lowest layer is kept.
+	suite.NoError(videoConsumer.SetMaxBitrate(1000))
+	suite.Equal(&ConsumerLayers{SpatialLayer: 0, TemporalLayer: 0}, videoConsumer.PreferredLayers())
+
+	// Removing the cap sets the highest layers since none were set by the application.
+	suite.NoError(videoConsumer.SetMaxBitrate(0))
+	suite.Equal(&ConsumerLayers{SpatialLayer: 2, TemporalLayer: 0}, videoConsumer.PreferredLayers())
 }
 
-func (suite *ConsumerTestingSuite) videoConsumer(paused bool) *Consumer {
-	videoConsumer, _ := suite.transport2.Consume(ConsumerOptions{
+func (suite *ConsumerTestingSuite) TestConsumerSetPreferredLayersOutOfRange() {
+	videoConsumer, err := suite.transport2.Consume(ConsumerOptions{
 		ProducerId:      suite.videoProducer.Id(),
 		RtpCapabilities: suite.consumerDeviceCapabilities,
-		Paused:          paused,
-		AppData:         H{"baz": "LOL"},
 	})
+	suite.Require().NoError(err)
 
-	return videoConsumer
+	// The producer has 4 encodings with a single temporal layer.
+	suite.NoError(videoConsumer.SetPreferredLayers(ConsumerLayers{SpatialLayer: 4, TemporalLayer: 2}))
+	suite.Equal(&ConsumerLayers{SpatialLayer: 3, TemporalLayer: 0}, videoConsumer.PreferredLayers())
+
+	strictConsumer, err := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      suite.videoProducer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+		StrictLayers:    true,
+	})
+	suite.Require().NoError(err)
+
+	err = strictConsumer.SetPreferredLayers(ConsumerLayers{SpatialLayer: 4, TemporalLayer: 0})
+	suite.True(errors.Is(err, ErrLayersOutOfRange))
+	suite.NoError(strictConsumer.SetPreferredLayers(ConsumerLayers{SpatialLayer: 1, TemporalLayer: 0}))
+	suite.Equal(&ConsumerLayers{SpatialLayer: 1, TemporalLayer: 0}, strictConsumer.PreferredLayers())
 }
 
-func TestConsumerTestingSuite(t *testing.T) {
-	suite.Run(t, new(ConsumerTestingSuite))
+func (suite *ConsumerTestingSuite) TestConsumerSetPreferredTemporalLayer() {
+	audioConsumer := suite.audioConsumer()
+	suite.IsType(UnsupportedError{}, audioConsumer.SetPreferredTemporalLayer(0))
+
+	producer, err := suite.transport1.Produce(ProducerOptions{
+		Kind: MediaKind_Video,
+		RtpParameters: RtpParameters{
+			Mid:    "VIDEO2",
+			Codecs: suite.videoProducer.RtpParameters().Codecs,
+			Encodings: []RtpEncodingParameters{
+				{Ssrc: 33333332, ScalabilityMode: "L1T3"},
+				{Ssrc: 33333334, ScalabilityMode: "L1T3"},
+				{Ssrc: 33333336, ScalabilityMode: "L1T3"},
+			},
+		},
+	})
+	suite.Require().NoError(err)
+
+	videoConsumer, err := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+		PreferredLayers: &ConsumerLayers{SpatialLayer: 1, TemporalLayer: 2},
+	})
+	suite.Require().NoError(err)
+	suite.EqualValues(3, videoConsumer.TemporalLayers())
+
+	suite.NoError(videoConsumer.SetPreferredTemporalLayer(0))
+	suite.Equal(&ConsumerLayers{SpatialLayer: 1, TemporalLayer: 0}, videoConsumer.PreferredLayers())
+
+	suite.NoError(videoConsumer.SetPreferredTemporalLayer(1))
+	suite.Equal(&ConsumerLayers{SpatialLayer: 1, TemporalLayer: 1}, videoConsumer.PreferredLayers())
+
+	err = videoConsumer.SetPreferredTemporalLayer(3)
+	suite.True(errors.Is(err, ErrLayersOutOfRange))
+	suite.Equal(&ConsumerLayers{SpatialLayer: 1, TemporalLayer: 1}, videoConsumer.PreferredLayers())
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerOnLayersChangeCoalesced() {
+	videoConsumer := suite.videoConsumer(false)
+
+	var raw int
+	videoConsumer.OnLayersChange(func(layers *ConsumerLayers) {
+		raw++
+	})
+	coalesced := make(chan *ConsumerLayers, 10)
+	videoConsumer.OnLayersChangeCoalesced(50*time.Millisecond, func(layers *ConsumerLayers) {
+		coalesced <- layers
+	})
+
+	subscriber, _ := videoConsumer.channel.subscribers.Load(videoConsumer.Id())
+	emit := subscriber.(channelSubscriber)
+	emit("layerschange", []byte(`{"spatialLayer": 0, "temporalLayer": 0}`))
+	emit("layerschange", []byte(`{"spatialLayer": 1, "temporalLayer": 0}`))
+	emit("layerschange", []byte(`{"spatialLayer": 2, "temporalLayer": 0}`))
+	suite.Equal(3, raw)
+
+	select {
+	case layers := <-coalesced:
+		suite.Equal(&ConsumerLayers{SpatialLayer: 2, TemporalLayer: 0}, layers)
+	case <-time.After(time.Second):
+		suite.Fail("coalesced layers not delivered")
+	}
+	suite.Empty(coalesced)
+
+	// The pending layers are flushed on close.
+	emit("layerschange", []byte(`{"spatialLayer": 1, "temporalLayer": 0}`))
+	videoConsumer.Close()
+	suite.Len(coalesced, 1)
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerRestoresIntendedPreferredLayers() {
+	videoConsumer, err := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      suite.videoProducer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+	})
+	suite.Require().NoError(err)
+	suite.Nil(videoConsumer.IntendedPreferredLayers())
+
+	intended := ConsumerLayers{SpatialLayer: 2, TemporalLayer: 0}
+	suite.NoError(videoConsumer.SetPreferredLayers(intended))
+	suite.Equal(&intended, videoConsumer.IntendedPreferredLayers())
+	suite.Equal(&intended, videoConsumer.PreferredLayers())
+
+	subscriber, _ := videoConsumer.channel.subscribers.Load(videoConsumer.Id())
+	emit := subscriber.(channelSubscriber)
+
+	// The spatial layer 2 is dropped by the producer and the preferred layers get clamped.
+	emit("score", []byte(`{"score": 10, "producerScore": 10, "producerScores": [10, 10, 0, 0]}`))
+	videoConsumer.layersLocker.Lock()
+	videoConsumer.preferredLayers = &ConsumerLayers{SpatialLayer: 1, TemporalLayer: 0}
+	videoConsumer.layersLocker.Unlock()
+
+	emit("score", []byte(`{"score": 10, "producerScore": 10, "producerScores": [10, 10, 0, 0]}`))
+	suite.Equal(&ConsumerLayers{SpatialLayer: 1, TemporalLayer: 0}, videoConsumer.PreferredLayers())
+
+	// The layer is back.
+	emit("score", []byte(`{"score": 10, "producerScore": 10, "producerScores": [10, 10, 10, 0]}`))
+	suite.Eventually(func() bool {
+		layers := videoConsumer.PreferredLayers()
+		return layers != nil && *layers == intended
+	}, time.Second, 10*time.Millisecond)
+	suite.Equal(&intended, videoConsumer.IntendedPreferredLayers())
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerStatsStream() {
+	audioConsumer := suite.audioConsumer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := audioConsumer.StatsStream(ctx, 10*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case stats, ok := <-stream:
+			suite.Require().True(ok)
+			suite.Require().NotEmpty(stats)
+			suite.Equal(StatType_OutboundRtp, stats[0].StatType())
+		case <-time.After(time.Second):
+			suite.FailNow("stats not received")
+		}
+	}
+
+	// The stream is closed once the consumer is closed.
+	audioConsumer.Close()
+	suite.Eventually(func() bool {
+		select {
+		case _, ok := <-stream:
+			return !ok
+		default:
+			return false
+		}
+	}, time.Second, 5*time.Millisecond)
+
+	// Or once the context is done.
+	stream = suite.audioConsumer().StatsStream(ctx, 10*time.Millisecond)
+	cancel()
+	suite.Eventually(func() bool {
+		select {
+		case _, ok := <-stream:
+			return !ok
+		default:
+			return false
+		}
+	}, time.Second, 5*time.Millisecond)
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerResumeAndWaitForMedia() {
+	videoConsumer, err := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      suite.videoProducer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+		Paused:          true,
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(videoConsumer.EnableTraceEvent(ConsumerTraceEventType_Pli))
+
+	onTrace := NewMockFunc(suite.T())
+	videoConsumer.OnTrace(func(trace *ConsumerTraceEventData) { onTrace.Fn()(trace.Type) })
+
+	subscriber, _ := videoConsumer.channel.subscribers.Load(videoConsumer.Id())
+	emit := subscriber.(channelSubscriber)
+
+	go func() {
+		for videoConsumer.Paused() {
+			time.Sleep(time.Millisecond)
+		}
+		emit("trace", []byte(`{"type": "pli", "timestamp": 1000, "direction": "in"}`))
+		emit("trace", []byte(`{"type": "keyframe", "timestamp": 1010, "direction": "out"}`))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	suite.NoError(videoConsumer.ResumeAndWaitForMedia(ctx))
+	suite.False(videoConsumer.Paused())
+
+	// The keyframe trace enabled while waiting is not emitted.
+	onTrace.ExpectCalledTimes(1)
+	onTrace.ExpectCalledWith(ConsumerTraceEventType_Pli)
+
+	// The trace event types enabled by the application are restored.
+	suite.Equal([]ConsumerTraceEventType{ConsumerTraceEventType_Pli}, videoConsumer.TraceEventTypes())
+	dump, err := videoConsumer.Dump()
+	suite.Require().NoError(err)
+	suite.Equal("pli", dump.TraceEventTypes)
+
+	// Without media flowing.
+	suite.NoError(videoConsumer.Pause())
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = videoConsumer.ResumeAndWaitForMedia(ctx)
+	suite.True(errors.Is(err, context.DeadlineExceeded))
+	suite.Contains(err.Error(), "no media received")
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerClose() {
+	audioConsumer := suite.audioConsumer()
+	videoConsumer := suite.videoConsumer(true)
+
+	onObserverClose := NewMockFunc(suite.T())
+
+	audioConsumer.Observer().Once("close", onObserverClose.Fn())
+	audioConsumer.Close()
+
+	onObserverClose.ExpectCalledTimes(1)
+	suite.True(audioConsumer.Closed())
+
+	routerDump, _ := suite.router.Dump()
+
+	suite.Empty(routerDump.MapProducerIdConsumerIds[suite.audioProducer.Id()])
+	suite.Equal(suite.videoProducer.Id(), routerDump.MapConsumerIdProducerId[videoConsumer.Id()])
+
+	videoPipeConsumer, _ := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      suite.videoProducer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+		Pipe:            true,
+	})
+
+	transportDump, _ := suite.transport2.Dump()
+
+	suite.Equal(suite.transport2.Id(), transportDump.Id)
+	suite.Empty(transportDump.ProducerIds)
+	suite.ElementsMatch([]string{videoConsumer.Id(), videoPipeConsumer.Id()}, transportDump.ConsumerIds)
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerRequestKeyFrameTriggered() {
+	audioConsumer := suite.audioConsumer()
+	triggered, err := audioConsumer.RequestKeyFrame()
+	suite.NoError(err)
+	suite.False(triggered)
+
+	// The video producer is paused.
+	videoConsumer := suite.videoConsumer(false)
+	suite.True(videoConsumer.ProducerPaused())
+	triggered, err = videoConsumer.RequestKeyFrame()
+	suite.NoError(err)
+	suite.False(triggered)
+
+	suite.Require().NoError(suite.videoProducer.Resume())
+	defer suite.videoProducer.Pause()
+	suite.Eventually(func() bool {
+		return !videoConsumer.ProducerPaused()
+	}, time.Second, 10*time.Millisecond)
+
+	triggered, err = videoConsumer.RequestKeyFrame()
+	suite.NoError(err)
+	suite.True(triggered)
+
+	suite.Require().NoError(videoConsumer.Pause())
+	triggered, err = videoConsumer.RequestKeyFrame()
+	suite.NoError(err)
+	suite.False(triggered)
+}
+
+func (suite *ConsumerTestingSuite) TestConsumeForceCodec() {
+	producer, err := suite.transport1.Produce(ProducerOptions{
+		Kind: MediaKind_Video,
+		RtpParameters: RtpParameters{
+			Mid: "VIDEO2",
+			Codecs: []*RtpCodecParameters{
+				{MimeType: "video/VP8", PayloadType: 96, ClockRate: 90000},
+				{MimeType: "video/rtx", PayloadType: 97, ClockRate: 90000, Parameters: RtpCodecSpecificParameters{Apt: 96}},
+				{
+					MimeType:    "video/H264",
+					PayloadType: 112,
+					ClockRate:   90000,
+					Parameters: RtpCodecSpecificParameters{
+						RtpParameter: h264.RtpParameter{
+							PacketizationMode: 1,
+							ProfileLevelId:    "4d0032",
+						},
+					},
+				},
+				{MimeType: "video/rtx", PayloadType: 113, ClockRate: 90000, Parameters: RtpCodecSpecificParameters{Apt: 112}},
+			},
+			Encodings: []RtpEncodingParameters{{Ssrc: 44444444, Rtx: &RtpEncodingRtx{Ssrc: 44444445}}},
+		},
+	})
+	suite.Require().NoError(err)
+
+	rtpCapabilities := suite.consumerDeviceCapabilities
+	rtpCapabilities.Codecs = append([]*RtpCodecCapability{
+		{MimeType: "video/VP8", Kind: "video", PreferredPayloadType: 103, ClockRate: 90000},
+		{MimeType: "video/rtx", Kind: "video", PreferredPayloadType: 104, ClockRate: 90000, Parameters: RtpCodecSpecificParameters{Apt: 103}},
+	}, rtpCapabilities.Codecs...)
+
+	consumer, err := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: rtpCapabilities,
+		ForceCodec:      &ForcedCodec{MimeType: "video/h264"},
+	})
+	suite.Require().NoError(err)
+
+	codecs := consumer.RtpParameters().Codecs
+	suite.Require().Len(codecs, 2)
+	suite.Equal("video/H264", codecs[0].MimeType)
+	suite.Equal("video/rtx", codecs[1].MimeType)
+	suite.Equal(codecs[0].PayloadType, codecs[1].Parameters.Apt)
+	suite.NotNil(consumer.RtpParameters().Encodings[0].Rtx)
+
+	// VP8 is offered by the producer but not supported by the consuming endpoint.
+	_, err = suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+		ForceCodec:      &ForcedCodec{MimeType: "video/VP8"},
+	})
+	suite.IsType(UnsupportedError{}, err)
+	suite.True(errors.Is(err, ErrCodecNotConsumable))
+}
+
+func (suite *ConsumerTestingSuite) TestConsumeReducedSizeRtcp() {
+	consumer, err := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      suite.audioProducer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+	})
+	suite.Require().NoError(err)
+	suite.True(consumer.RtpParameters().Rtcp.ReducedSize)
+
+	reducedSize := false
+	consumer, err = suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      suite.audioProducer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+		ReducedSizeRtcp: &reducedSize,
+	})
+	suite.Require().NoError(err)
+	suite.False(consumer.RtpParameters().Rtcp.ReducedSize)
+
+	_, err = suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      suite.audioProducer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+		Pipe:            true,
+		ReducedSizeRtcp: &reducedSize,
+	})
+	suite.IsType(TypeError{}, err)
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerSsrcsAndCname() {
+	videoConsumer := suite.videoConsumer(false)
+	rtpParameters := videoConsumer.RtpParameters()
+
+	suite.NotEmpty(videoConsumer.Cname())
+	suite.Equal(rtpParameters.Rtcp.Cname, videoConsumer.Cname())
+
+	encoding := rtpParameters.Encodings[0]
+	suite.Require().NotNil(encoding.Rtx)
+	suite.Equal([]ConsumerSsrc{{Ssrc: encoding.Ssrc, RtxSsrc: encoding.Rtx.Ssrc}}, videoConsumer.Ssrcs())
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerLatestProducerScore() {
+	videoConsumer := suite.videoConsumer(false)
+
+	subscriber, _ := videoConsumer.channel.subscribers.Load(videoConsumer.Id())
+	emit := subscriber.(channelSubscriber)
+
+	emit("score", []byte(`{"producerScore": 7, "score": 9, "producerScores": [7]}`))
+	suite.EqualValues(7, videoConsumer.LatestProducerScore())
+	suite.EqualValues(9, videoConsumer.Score().Score)
+
+	emit("score", []byte(`{"producerScore": 3, "score": 9, "producerScores": [3]}`))
+	suite.EqualValues(3, videoConsumer.LatestProducerScore())
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerRejectIfClosed() {
+	audioConsumer := suite.audioConsumer()
+	audioConsumer.Close()
+
+	_, err := audioConsumer.Dump()
+	suite.Error(err)
+
+	_, err = audioConsumer.GetStats()
+
+	suite.Error(err)
+	suite.Error(audioConsumer.Pause())
+	suite.Error(audioConsumer.Resume())
+	suite.Error(audioConsumer.SetPreferredLayers(ConsumerLayers{}))
+	_, err = audioConsumer.RequestKeyFrame()
+	suite.Error(err)
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerEmitsProducerClosed() {
+	audioConsumer := suite.audioConsumer()
+
+	onObserverClose := NewMockFunc(suite.T())
+	audioConsumer.Observer().Once("close", onObserverClose.Fn())
+
+	observer := NewMockFunc(suite.T())
+
+	audioConsumer.On("producerclose", observer.Fn())
+
+	suite.audioProducer.Close()
+
+	observer.ExpectCalledTimes(1)
+	onObserverClose.ExpectCalledTimes(1)
+	suite.True(audioConsumer.Closed())
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerOnProducerCloseCalledOnce() {
+	audioConsumer := suite.audioConsumer()
+
+	var called uint32
+	audioConsumer.OnProducerClose(func() {
+		atomic.AddUint32(&called, 1)
+	})
+	audioConsumer.RemoveAllListeners()
+	audioConsumer.On("@producerclose", func() {
+		panic("listener failure")
+	})
+
+	subscriber, _ := audioConsumer.channel.subscribers.Load(audioConsumer.Id())
+	emit := subscriber.(channelSubscriber)
+
+	suite.audioProducer.Close()
+	suite.Eventually(func() bool {
+		return atomic.LoadUint32(&called) == 1
+	}, time.Second, 10*time.Millisecond)
+	suite.True(audioConsumer.Closed())
+
+	// A duplicated notification does not call it again.
+	emit("producerclose", nil)
+	suite.EqualValues(1, atomic.LoadUint32(&called))
+}
+
+func (suite *ConsumerTestingSuite) TestProducerCloseCascadesToConsumers() {
+	producer := CreateAudioProducer(suite.transport1)
+
+	var producerClosed []string
+	var locker sync.Mutex
+	consumers := make([]*Consumer, 2)
+	for i := range consumers {
+		consumer, err := suite.transport2.Consume(ConsumerOptions{
+			ProducerId:      producer.Id(),
+			RtpCapabilities: suite.consumerDeviceCapabilities,
+		})
+		suite.Require().NoError(err)
+		consumer.OnProducerClose(func() {
+			locker.Lock()
+			producerClosed = append(producerClosed, consumer.Id())
+			locker.Unlock()
+		})
+		consumers[i] = consumer
+	}
+
+	var closed int
+	producer.OnClose(func() {
+		closed++
+	})
+
+	suite.NoError(producer.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	suite.NoError(producer.WaitClosed(ctx))
+
+	suite.Equal(1, closed)
+	for _, consumer := range consumers {
+		suite.True(consumer.Closed())
+		suite.Contains(producerClosed, consumer.Id())
+	}
+	suite.Len(producerClosed, 2)
+	suite.Empty(suite.router.producerConsumersOf(producer.Id()))
+}
+
+func (suite *ConsumerTestingSuite) TestConsumerEmitsTransportClosed() {
+	videoConsumer := suite.videoConsumer(false)
+
+	onObserverClose := NewMockFunc(suite.T())
+	videoConsumer.Observer().Once("close", onObserverClose.Fn())
+
+	observer := NewMockFunc(suite.T())
+	videoConsumer.On("transportclose", observer.Fn())
+
+	suite.transport2.Close()
+
+	observer.ExpectCalledTimes(1)
+	onObserverClose.ExpectCalledTimes(1)
+	suite.True(videoConsumer.Closed())
+
+	routerDump, _ := suite.router.Dump()
+
+	suite.Empty(routerDump.MapProducerIdConsumerIds[suite.audioProducer.Id()])
+	suite.Empty(routerDump.MapConsumerIdProducerId)
+}
+
+func (suite *ConsumerTestingSuite) audioConsumer() *Consumer {
+	audioConsumer, err := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      suite.audioProducer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+		AppData:         H{"baz": "LOL"},
+	})
+	suite.Require().NoError(err)
+
+	return audioConsumer
+}
+
+func (suite *ConsumerTestingSuite) videoConsumer(paused bool) *Consumer {
+	videoConsumer, _ := suite.transport2.Consume(ConsumerOptions{
+		ProducerId:      suite.videoProducer.Id(),
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+		Paused:          paused,
+		AppData:         H{"baz": "LOL"},
+	})
+
+	return videoConsumer
+}
+
+func (suite *ConsumerTestingSuite) TestFanOutToDirectTransports() {
+	var transports []ITransport
+	for i := 0; i < 3; i++ {
+		transport, err := suite.router.CreateDirectTransport()
+		suite.Require().NoError(err)
+		transports = append(transports, transport)
+	}
+
+	consumers, err := FanOut(suite.audioProducer.Id(), transports, ConsumerOptions{
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+		Paused:          true,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(consumers, 3)
+
+	for i, consumer := range consumers {
+		suite.Equal(suite.audioProducer.Id(), consumer.ProducerId())
+		suite.True(consumer.Paused())
+		suite.Equal([]*Consumer{consumer}, transports[i].Consumers())
+	}
+	suite.Equal(consumers[0].RtpParameters().Codecs, consumers[2].RtpParameters().Codecs)
+
+	// Failing on the closed transport closes the Consumers created on the first ones.
+	transports[2].Close()
+	_, err = FanOut(suite.audioProducer.Id(), transports, ConsumerOptions{
+		RtpCapabilities: suite.consumerDeviceCapabilities,
+	})
+	suite.Error(err)
+	suite.Len(transports[0].Consumers(), 1)
+	suite.Len(transports[1].Consumers(), 1)
+}
+
+func TestConsumerTestingSuite(t *testing.T) {
+	suite.Run(t, new(ConsumerTestingSuite))
+}
+
+func TestConsumerStatUnmarshal(t *testing.T) {
+	data := []byte(`[
+		{"type": "outbound-rtp", "kind": "video", "mimeType": "video/VP8", "ssrc": 1},
+		{"type": "inbound-rtp", "kind": "video", "mimeType": "video/VP8", "ssrc": 2},
+		{"type": "remote-inbound-rtp", "kind": "audio"}
+	]`)
+
+	var stats []ConsumerStat
+	require.NoError(t, json.Unmarshal(data, &stats))
+	require.Len(t, stats, 3)
+
+	assert.Equal(t, "outbound-rtp", stats[0].Type)
+	assert.Equal(t, "video", stats[0].Kind)
+	assert.Equal(t, StatType_OutboundRtp, stats[0].StatType())
+	assert.Equal(t, MediaKind_Video, stats[0].MediaKind())
+	assert.Equal(t, StatType_InboundRtp, stats[1].StatType())
+	assert.Equal(t, StatType("remote-inbound-rtp"), stats[2].StatType())
+	assert.Equal(t, MediaKind_Audio, stats[2].MediaKind())
+}
+
+func TestConsumerSpatialAndTemporalLayers(t *testing.T) {
+	newConsumerWithEncodings := func(encodings ...RtpEncodingParameters) *Consumer {
+		return &Consumer{
+			data: consumerData{
+				RtpParameters: RtpParameters{Encodings: encodings},
+			},
+		}
+	}
+
+	simple := newConsumerWithEncodings(RtpEncodingParameters{Ssrc: 1})
+	assert.EqualValues(t, 1, simple.SpatialLayers())
+	assert.EqualValues(t, 1, simple.TemporalLayers())
+
+	simulcast := newConsumerWithEncodings(RtpEncodingParameters{Ssrc: 1, ScalabilityMode: "S3T3"})
+	assert.EqualValues(t, 3, simulcast.SpatialLayers())
+	assert.EqualValues(t, 3, simulcast.TemporalLayers())
+
+	svc := newConsumerWithEncodings(RtpEncodingParameters{Ssrc: 1, ScalabilityMode: "L3T2_KEY"})
+	assert.EqualValues(t, 3, svc.SpatialLayers())
+	assert.EqualValues(t, 2, svc.TemporalLayers())
+
+	pipe := newConsumerWithEncodings(
+		RtpEncodingParameters{Ssrc: 1, ScalabilityMode: "L1T3"},
+		RtpEncodingParameters{Ssrc: 2, ScalabilityMode: "L1T3"},
+	)
+	assert.EqualValues(t, 2, pipe.SpatialLayers())
+	assert.EqualValues(t, 3, pipe.TemporalLayers())
+
+	none := newConsumerWithEncodings()
+	assert.EqualValues(t, 1, none.SpatialLayers())
+	assert.EqualValues(t, 1, none.TemporalLayers())
+}
+
+func TestConsumerEstimateLayerBitrates(t *testing.T) {
+	simulcast := &Consumer{producerMaxBitrates: []int{100000, 300000, 900000}}
+	assert.Equal(t, []int{100000, 300000, 900000}, simulcast.estimateLayerBitrates(3))
+
+	svc := &Consumer{producerMaxBitrates: []int{1600000}}
+	assert.Equal(t, []int{100000, 400000, 1600000}, svc.estimateLayerBitrates(3))
+
+	assert.Nil(t, (&Consumer{producerMaxBitrates: []int{0}}).estimateLayerBitrates(3))
+	assert.Nil(t, (&Consumer{producerMaxBitrates: []int{100000, 0}}).estimateLayerBitrates(2))
+	assert.Nil(t, (&Consumer{}).estimateLayerBitrates(2))
+}
+
+func TestConsumerClampLayers(t *testing.T) {
+	layers, ok := clampLayers(ConsumerLayers{SpatialLayer: 1, TemporalLayer: 2}, 3, 3)
+	assert.True(t, ok)
+	assert.Equal(t, ConsumerLayers{SpatialLayer: 1, TemporalLayer: 2}, layers)
+
+	layers, ok = clampLayers(ConsumerLayers{SpatialLayer: 3, TemporalLayer: 1}, 3, 3)
+	assert.False(t, ok)
+	assert.Equal(t, ConsumerLayers{SpatialLayer: 2, TemporalLayer: 1}, layers)
+
+	layers, ok = clampLayers(ConsumerLayers{SpatialLayer: 0, TemporalLayer: 5}, 3, 2)
+	assert.False(t, ok)
+	assert.Equal(t, ConsumerLayers{SpatialLayer: 0, TemporalLayer: 1}, layers)
+}
+
+func TestConsumerStatsHistory(t *testing.T) {
+	// Answer each "consumer.getStats" request with a growing packet count.
+	packetCount := 0
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		packetCount++
+		return fmt.Sprintf(`[{"type":"outbound-rtp","packetCount":%d}]`, packetCount), nil
+	})
+
+	consumer := newFakeConsumer(t, channel, nil)
+	consumer.statsHistorySize = 3
+	assert.Empty(t, consumer.StatsHistory())
+
+	for i := 0; i < 5; i++ {
+		_, err := consumer.GetStats()
+		require.NoError(t, err)
+	}
+
+	history := consumer.StatsHistory()
+	require.Len(t, history, 3)
+	for i, snapshot := range history {
+		assert.EqualValues(t, i+3, snapshot.Stats[0].PacketCount)
+		if i > 0 {
+			assert.False(t, snapshot.Time.Before(history[i-1].Time))
+		}
+	}
+
+	// Without StatsHistorySize, no history is kept.
+	consumer.statsHistorySize = 0
+	_, err := consumer.GetStats()
+	require.NoError(t, err)
+	assert.Len(t, consumer.StatsHistory(), 3)
+}
+
+func TestConsumerSkipsRedundantPauseResume(t *testing.T) {
+	var requests []string
+	var requestsLocker sync.Mutex
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		requestsLocker.Lock()
+		requests = append(requests, req.method)
+		requestsLocker.Unlock()
+		return "", nil
+	})
+	sentRequests := func() []string {
+		requestsLocker.Lock()
+		defer requestsLocker.Unlock()
+		return append([]string(nil), requests...)
+	}
+
+	consumer := newFakeConsumer(t, channel, nil)
+	pauses := 0
+	consumer.OnPause(func() { pauses++ })
+
+	require.NoError(t, consumer.Resume())
+	assert.Empty(t, sentRequests())
+
+	require.NoError(t, consumer.Pause())
+	require.NoError(t, consumer.Pause())
+	assert.Equal(t, []string{"consumer.pause"}, sentRequests())
+	assert.Equal(t, 1, pauses)
+
+	require.NoError(t, consumer.Resume())
+	require.NoError(t, consumer.Resume())
+	assert.Equal(t, []string{"consumer.pause", "consumer.resume"}, sentRequests())
+}
+
+// waitingContext closes waiting the first time Done() is called, i.e. once the function it is
+// passed to starts waiting.
+type waitingContext struct {
+	context.Context
+	once    sync.Once
+	waiting chan struct{}
+}
+
+func (ctx *waitingContext) Done() <-chan struct{} {
+	ctx.once.Do(func() { close(ctx.waiting) })
+	return ctx.Context.Done()
+}
+
+func TestConsumerWaitUntilFlowing(t *testing.T) {
+	consumer := newFakeConsumer(t, newFakeWorkerChannel(t, nil), nil)
+
+	for _, paused := range []bool{false, true} {
+		for _, producerPaused := range []bool{false, true} {
+			if paused {
+				require.NoError(t, consumer.Pause())
+			} else {
+				require.NoError(t, consumer.Resume())
+			}
+			consumer.setProducerPaused(producerPaused)
+
+			assert.Equal(t, paused || producerPaused, consumer.EffectivelyPaused(),
+				"paused: %t, producerPaused: %t", paused, producerPaused)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+			err := consumer.WaitUntilFlowing(ctx)
+			cancel()
+			if paused || producerPaused {
+				assert.Equal(t, context.DeadlineExceeded, err, "paused: %t, producerPaused: %t", paused, producerPaused)
+			} else {
+				assert.NoError(t, err)
+			}
+		}
+	}
+
+	// Paused by both sides: resuming the Consumer alone does not make media flow.
+	waitCtx := &waitingContext{Context: context.Background(), waiting: make(chan struct{})}
+	flowing := make(chan error, 1)
+	go func() { flowing <- consumer.WaitUntilFlowing(waitCtx) }()
+	<-waitCtx.waiting
+
+	require.NoError(t, consumer.Resume())
+	assert.True(t, consumer.EffectivelyPaused())
+	select {
+	case <-flowing:
+		t.Fatal("WaitUntilFlowing() returned while the Producer is paused")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	consumer.setProducerPaused(false)
+	select {
+	case err := <-flowing:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("WaitUntilFlowing() did not return once flowing")
+	}
+
+	// Closing the Consumer releases the waiters.
+	consumer.setProducerPaused(true)
+	waitCtx = &waitingContext{Context: context.Background(), waiting: make(chan struct{})}
+	go func() { flowing <- consumer.WaitUntilFlowing(waitCtx) }()
+	<-waitCtx.waiting
+	consumer.cancel()
+	assert.IsType(t, InvalidStateError{}, <-flowing)
+}
+
+func TestConsumerEmitInitialStateWithoutScore(t *testing.T) {
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newConsumer(consumerParams{
+		internal:       internalData{ConsumerId: "consumer"},
+		channel:        newFakeWorkerChannel(t, nil),
+		payloadChannel: payloadChannel,
+		paused:         true,
+	})
+	defer consumer.cancel()
+
+	var pauses, scores int
+	consumer.OnPause(func() { pauses++ })
+	consumer.OnScore(func(*ConsumerScore) { scores++ })
+	consumer.emitInitialState()
+
+	// The default score is not emitted since the worker did not send any.
+	assert.Equal(t, 1, pauses)
+	assert.Zero(t, scores)
+	assert.Nil(t, consumer.InitialState().Score)
+	assert.EqualValues(t, 10, consumer.Score().Score)
+}
+
+func TestConsumerEffectivelyPausedConcurrent(t *testing.T) {
+	consumer := newFakeConsumer(t, newFakeWorkerChannel(t, nil), nil)
+
+	// Producer pause notifications come from the channel goroutine while the user reads the
+	// state, which is checked by the race detector.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			consumer.setProducerPaused(i%2 == 0)
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		consumer.EffectivelyPaused()
+		consumer.ProducerPaused()
+		require.NoError(t, consumer.Pause())
+		require.NoError(t, consumer.Resume())
+	}
+	<-done
+
+	assert.False(t, consumer.Paused())
+	assert.False(t, consumer.EffectivelyPaused())
+}
+
+func TestConsumerDumpWatch(t *testing.T) {
+	// The Consumer gets paused at the third dump, then nothing changes.
+	var dumps int32
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		paused := atomic.AddInt32(&dumps, 1) >= 3
+		return fmt.Sprintf(`{"id":"consumer","paused":%t}`, paused), nil
+	})
+
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newConsumer(consumerParams{
+		internal:          internalData{ConsumerId: "consumer"},
+		channel:           channel,
+		payloadChannel:    payloadChannel,
+		dumpWatchInterval: time.Millisecond,
+	})
+	defer consumer.cancel()
+
+	changes := make(chan []string, 10)
+	consumer.On("dumpchange", func(dump *ConsumerDump, diff []string) {
+		changes <- diff
+	})
+
+	select {
+	case diff := <-changes:
+		assert.Equal(t, []string{"Paused: false -> true"}, diff)
+	case <-time.After(time.Second):
+		t.Fatal("no dumpchange event")
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&dumps) >= 6 }, time.Second, time.Millisecond)
+	assert.Empty(t, changes)
+	assert.True(t, consumer.LastDump().Paused)
+
+	// The periodic dump stops once the Consumer is closed.
+	consumer.cancel()
+	time.Sleep(5 * time.Millisecond)
+	count := atomic.LoadInt32(&dumps)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, count, atomic.LoadInt32(&dumps))
+}
+
+func TestConsumerReplayLatestOnSubscribe(t *testing.T) {
+	channel := newFakeWorkerChannel(t, nil)
+	payloadChannel, _ := newFakePayloadChannel(t)
+	newTestConsumer := func(replayLatest bool) *Consumer {
+		return newConsumer(consumerParams{
+			internal:       internalData{ConsumerId: fmt.Sprintf("consumer-%t", replayLatest)},
+			data:           consumerData{Kind: MediaKind_Video, Type: ConsumerType_Simulcast},
+			channel:        channel,
+			payloadChannel: payloadChannel,
+			producerPaused: true,
+			replayLatest:   replayLatest,
+		})
+	}
+
+	consumer := newTestConsumer(true)
+	defer consumer.cancel()
+
+	subscriber, _ := channel.subscribers.Load(consumer.Id())
+	emit := subscriber.(channelSubscriber)
+	emit("score", []byte(`{"score":7,"producerScore":9,"producerScores":[9]}`))
+	emit("layerschange", []byte(`{"spatialLayer":1,"temporalLayer":2}`))
+
+	var scores []*ConsumerScore
+	consumer.OnScore(func(score *ConsumerScore) { scores = append(scores, score) })
+	assert.Equal(t, []*ConsumerScore{{Score: 7, ProducerScore: 9, ProducerScores: []uint16{9}}}, scores)
+
+	// The handler then gets the following scores as usual.
+	emit("score", []byte(`{"score":8,"producerScore":9,"producerScores":[9]}`))
+	require.Len(t, scores, 2)
+	assert.EqualValues(t, 8, scores[1].Score)
+
+	var ctxScores []*ConsumerScore
+	consumer.OnScoreCtx(func(ctx context.Context, score *ConsumerScore) {
+		assert.Equal(t, consumer.Context(), ctx)
+		ctxScores = append(ctxScores, score)
+	})
+	assert.Equal(t, scores[1:], ctxScores)
+
+	var layers []*ConsumerLayers
+	consumer.OnLayersChange(func(l *ConsumerLayers) { layers = append(layers, l) })
+	assert.Equal(t, []*ConsumerLayers{{SpatialLayer: 1, TemporalLayer: 2}}, layers)
+
+	var pauses, producerPauses int
+	consumer.OnPause(func() { pauses++ })
+	consumer.OnProducerPause(func() { producerPauses++ })
+	assert.Equal(t, 1, pauses)
+	assert.Equal(t, 1, producerPauses)
+
+	// Nothing is replayed unless enabled.
+	consumer = newTestConsumer(false)
+	defer consumer.cancel()
+
+	consumer.OnScore(func(score *ConsumerScore) { t.Error("score replayed") })
+	consumer.OnPause(func() { t.Error("pause replayed") })
+	consumer.OnProducerPause(func() { t.Error("producerpause replayed") })
+}
+
+func TestGetConsumerRtpParametersCannotConsume(t *testing.T) {
+	consumableParams := RtpParameters{
+		Codecs: []*RtpCodecParameters{
+			{
+				MimeType:    "video/H264",
+				PayloadType: 101,
+				ClockRate:   90000,
+				Parameters: RtpCodecSpecificParameters{
+					RtpParameter: h264.RtpParameter{
+						PacketizationMode: 1,
+						ProfileLevelId:    "4d0032",
+					},
+				},
+			},
+			{
+				MimeType:    "video/rtx",
+				PayloadType: 102,
+				ClockRate:   90000,
+				Parameters:  RtpCodecSpecificParameters{Apt: 101},
+			},
+		},
+		Encodings: []RtpEncodingParameters{{Ssrc: 1}},
+	}
+	caps := RtpCapabilities{
+		Codecs: []*RtpCodecCapability{
+			{
+				Kind:                 MediaKind_Video,
+				MimeType:             "video/VP8",
+				PreferredPayloadType: 101,
+				ClockRate:            90000,
+			},
+		},
+	}
+
+	_, err := getConsumerRtpParameters(consumableParams, caps, 0, false)
+	assert.IsType(t, UnsupportedError{}, err)
+	assert.True(t, errors.Is(err, ErrCannotConsume))
+	assert.Contains(t, err.Error(), "[video/H264/90000 profile-level-id=4d0032 packetization-mode=1]")
+}
+
+func TestForceConsumerCodec(t *testing.T) {
+	newParams := func() RtpParameters {
+		return RtpParameters{
+			Codecs: []*RtpCodecParameters{
+				{MimeType: "video/VP8", PayloadType: 101, ClockRate: 90000},
+				{MimeType: "video/rtx", PayloadType: 102, ClockRate: 90000, Parameters: RtpCodecSpecificParameters{Apt: 101}},
+				{MimeType: "video/H264", PayloadType: 103, ClockRate: 90000},
+				{MimeType: "video/H264", PayloadType: 104, ClockRate: 90000},
+				{MimeType: "video/rtx", PayloadType: 105, ClockRate: 90000, Parameters: RtpCodecSpecificParameters{Apt: 104}},
+			},
+			Encodings: []RtpEncodingParameters{{Ssrc: 1, Rtx: &RtpEncodingRtx{Ssrc: 2}}},
+		}
+	}
+
+	params := newParams()
+	require.NoError(t, forceConsumerCodec(&params, ForcedCodec{MimeType: "video/vp8"}))
+	assert.Equal(t, []byte{101, 102}, codecPayloadTypes(params.Codecs))
+	assert.NotNil(t, params.Encodings[0].Rtx)
+
+	// The first H264 codec has no RTX codec.
+	params = newParams()
+	require.NoError(t, forceConsumerCodec(&params, ForcedCodec{MimeType: "video/H264"}))
+	assert.Equal(t, []byte{103}, codecPayloadTypes(params.Codecs))
+	assert.Nil(t, params.Encodings[0].Rtx)
+
+	params = newParams()
+	require.NoError(t, forceConsumerCodec(&params, ForcedCodec{MimeType: "video/H264", PayloadType: 104}))
+	assert.Equal(t, []byte{104, 105}, codecPayloadTypes(params.Codecs))
+
+	for _, forced := range []ForcedCodec{
+		{MimeType: "video/AV1"},
+		{MimeType: "video/VP8", PayloadType: 103},
+		{MimeType: "video/rtx"},
+	} {
+		params = newParams()
+		err := forceConsumerCodec(&params, forced)
+		assert.IsType(t, UnsupportedError{}, err)
+		assert.True(t, errors.Is(err, ErrCodecNotConsumable))
+		assert.Len(t, params.Codecs, 5)
+	}
+}
+
+func codecPayloadTypes(codecs []*RtpCodecParameters) (payloadTypes []byte) {
+	for _, codec := range codecs {
+		payloadTypes = append(payloadTypes, codec.PayloadType)
+	}
+	return
+}
+
+func TestConsumerDisableObserver(t *testing.T) {
+	newTestConsumer := func(disableObserver bool) *Consumer {
+		return &Consumer{
+			IEventEmitter:   NewEventEmitter(),
+			observer:        NewEventEmitter(),
+			disableObserver: disableObserver,
+		}
+	}
+	score := &ConsumerScore{Score: 10, ProducerScore: 10}
+
+	consumer := newTestConsumer(false)
+	var observed, handled int
+	consumer.Observer().On("score", func(*ConsumerScore) { observed++ })
+	consumer.OnScore(func(*ConsumerScore) { handled++ })
+	consumer.emitScore(score)
+	assert.Equal(t, 1, observed)
+	assert.Equal(t, 1, handled)
+
+	consumer = newTestConsumer(true)
+	observed, handled = 0, 0
+	consumer.Observer().On("score", func(*ConsumerScore) { observed++ })
+	consumer.OnScore(func(*ConsumerScore) { handled++ })
+	consumer.emitScore(score)
+	assert.Zero(t, observed)
+	assert.Equal(t, 1, handled)
+}
+
+func BenchmarkConsumerEmitScore(b *testing.B) {
+	for _, disableObserver := range []bool{false, true} {
+		b.Run(fmt.Sprintf("disableObserver=%t", disableObserver), func(b *testing.B) {
+			consumer := &Consumer{
+				IEventEmitter:   NewEventEmitter(),
+				observer:        NewEventEmitter(),
+				disableObserver: disableObserver,
+			}
+			consumer.Observer().On("score", func(*ConsumerScore) {})
+			consumer.OnScore(func(*ConsumerScore) {})
+			score := &ConsumerScore{Score: 10, ProducerScore: 10}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				consumer.emitScore(score)
+			}
+		})
+	}
+}
+
+func TestConsumerLatestProducerScoreDefaultsToZero(t *testing.T) {
+	consumer := &Consumer{}
+	assert.EqualValues(t, 0, consumer.LatestProducerScore())
+
+	consumer.setScore(&ConsumerScore{Score: 10, ProducerScore: 8})
+	assert.EqualValues(t, 8, consumer.LatestProducerScore())
+	assert.EqualValues(t, 10, consumer.Score().Score)
+}
+
+func TestConsumerLabels(t *testing.T) {
+	consumer := &Consumer{}
+	assert.Empty(t, consumer.Labels())
+	assert.False(t, consumer.hasLabel("room", "a"))
+
+	labels := map[string]string{"room": "a", "tier": "hd"}
+	consumer.SetLabels(labels)
+	labels["room"] = "b"
+	assert.Equal(t, map[string]string{"room": "a", "tier": "hd"}, consumer.Labels())
+	assert.True(t, consumer.hasLabel("room", "a"))
+	assert.False(t, consumer.hasLabel("room", "b"))
+
+	consumer.Labels()["tier"] = "sd"
+	assert.True(t, consumer.hasLabel("tier", "hd"))
+
+	consumer.SetLabels(nil)
+	assert.Empty(t, consumer.Labels())
+}
+
+func TestConsumerNoRtpHandlerAfterClose(t *testing.T) {
+	// The Producer of the Consumer gets closed while its stats are requested.
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		if req.method == "consumer.getStats" {
+			req.notify(req.handlerId, "producerclose", "")
+		}
+		return "", nil
+	})
+
+	// Fake PayloadChannel feeding "rtp" notifications to the current target.
+	payloadChannel, payloadWorker := newFakePayloadChannel(t)
+
+	var target atomic.Value
+	target.Store("")
+	go func() {
+		for {
+			notification := fmt.Sprintf(`{"targetId":%q,"event":"rtp"}`, target.Load().(string))
+			if payloadWorker.WritePayload([]byte(notification)) != nil ||
+				payloadWorker.WritePayload([]byte{0x80}) != nil {
+				return
+			}
+		}
+	}()
+
+	newConsumer := func(id string, onRtp func(consumer *Consumer)) *Consumer {
+		consumer := newFakeConsumer(t, channel, payloadChannel)
+		consumer.internal.ConsumerId = id
+		consumer.OnRtp(func([]byte) { onRtp(consumer) })
+		consumer.handleWorkerNotifications()
+		target.Store(id)
+		return consumer
+	}
+
+	for i := 0; i < 50; i++ {
+		var received, late, waited uint32
+		consumer := newConsumer(fmt.Sprintf("consumer-%d", i), func(*Consumer) {
+			atomic.AddUint32(&received, 1)
+			runtime.Gosched()
+			if atomic.LoadUint32(&waited) == 1 {
+				atomic.AddUint32(&late, 1)
+			}
+		})
+		require.Eventually(t, func() bool { return atomic.LoadUint32(&received) > 0 }, time.Second, time.Millisecond)
+
+		require.NoError(t, consumer.Close())
+		require.NoError(t, consumer.WaitDeliveries(context.Background()))
+		atomic.StoreUint32(&waited, 1)
+		time.Sleep(time.Millisecond)
+		require.Zero(t, atomic.LoadUint32(&late), "rtp handler ran after WaitDeliveries() returned")
+	}
+
+	// The Consumer is closed by the Channel goroutine while a "rtp" handler waits for a response
+	// of the worker, which the Channel goroutine must still read.
+	statsDone := make(chan error, 1)
+	var once sync.Once
+	consumer := newConsumer("consumer-stats", func(consumer *Consumer) {
+		once.Do(func() {
+			_, err := consumer.GetStats()
+			statsDone <- err
+		})
+	})
+	select {
+	case err := <-statsDone:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("rtp handler blocked while the Consumer was closed")
+	}
+	assert.True(t, consumer.Closed())
+
+	// A handler closing its Consumer does not wait for itself.
+	closed := make(chan struct{})
+	newConsumer("consumer-closing", func(consumer *Consumer) {
+		if !consumer.Closed() {
+			consumer.Close()
+			close(closed)
+		}
+	})
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close() called by a rtp handler did not return")
+	}
+
+	// Waiting is bounded by ctx.
+	blocked, release := make(chan struct{}), make(chan struct{})
+	consumer = newConsumer("consumer-blocked", func(*Consumer) {
+		select {
+		case blocked <- struct{}{}:
+			<-release
+		default:
+		}
+	})
+	<-blocked
+	require.NoError(t, consumer.Close())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, consumer.WaitDeliveries(ctx))
+	close(release)
+	assert.NoError(t, consumer.WaitDeliveries(context.Background()))
+}
+
+func TestConsumerOnTraceType(t *testing.T) {
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newFakeConsumer(t, newFakeWorkerChannel(t, nil), payloadChannel)
+	consumer.handleWorkerNotifications()
+
+	var all, plis, keyframes []ConsumerTraceEventType
+	consumer.OnTrace(func(trace *ConsumerTraceEventData) { all = append(all, trace.Type) })
+	consumer.OnTraceType(ConsumerTraceEventType_Pli, func(trace *ConsumerTraceEventData) {
+		plis = append(plis, trace.Type)
+	})
+	consumer.OnTraceType(ConsumerTraceEventType_Keyframe, func(trace *ConsumerTraceEventData) {
+		keyframes = append(keyframes, trace.Type)
+	})
+	require.NoError(t, consumer.EnableTraceEvent("pli", "rtp", "keyframe", "nack"))
+
+	subscriber, _ := consumer.channel.subscribers.Load(consumer.Id())
+	emit := subscriber.(channelSubscriber)
+	for _, typ := range []string{"pli", "rtp", "keyframe", "pli", "nack"} {
+		emit("trace", []byte(fmt.Sprintf(`{"type": %q, "timestamp": 1, "direction": "in"}`, typ)))
+	}
+
+	assert.Equal(t, []ConsumerTraceEventType{"pli", "rtp", "keyframe", "pli", "nack"}, all)
+	assert.Equal(t, []ConsumerTraceEventType{"pli", "pli"}, plis)
+	assert.Equal(t, []ConsumerTraceEventType{"keyframe"}, keyframes)
+
+	// A nil handler removes the one of the type.
+	consumer.OnTraceType(ConsumerTraceEventType_Pli, nil)
+	emit("trace", []byte(`{"type": "pli", "timestamp": 2, "direction": "in"}`))
+	assert.Len(t, plis, 2)
+	assert.Len(t, all, 6)
+}
+
+func TestConsumerSsrcsAndCname(t *testing.T) {
+	consumer := &Consumer{
+		data: consumerData{
+			RtpParameters: RtpParameters{
+				Encodings: []RtpEncodingParameters{
+					{Ssrc: 1111, Rtx: &RtpEncodingRtx{Ssrc: 1112}},
+					{Ssrc: 2222},
+				},
+				Rtcp: RtcpParameters{Cname: "wB4Ql4lrsxYLjzuN"},
+			},
+		},
+	}
+	assert.Equal(t, "wB4Ql4lrsxYLjzuN", consumer.Cname())
+	assert.Equal(t, []ConsumerSsrc{{Ssrc: 1111, RtxSsrc: 1112}, {Ssrc: 2222}}, consumer.Ssrcs())
+
+	assert.Empty(t, (&Consumer{}).Ssrcs())
+}
+
+func TestConsumerResumeAndWaitForMediaConcurrent(t *testing.T) {
+	var requests []string
+	var requestsLocker sync.Mutex
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		if req.method == "consumer.enableTraceEvent" {
+			requestsLocker.Lock()
+			requests = append(requests, req.data)
+			requestsLocker.Unlock()
+		}
+		return "", nil
+	})
+	sentTypes := func() []string {
+		requestsLocker.Lock()
+		defer requestsLocker.Unlock()
+		return append([]string(nil), requests...)
+	}
+
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newConsumer(consumerParams{
+		internal:       internalData{ConsumerId: "consumer"},
+		data:           consumerData{Kind: MediaKind_Video},
+		channel:        channel,
+		payloadChannel: payloadChannel,
+		paused:         true,
+	})
+	defer consumer.cancel()
+
+	var traces []ConsumerTraceEventType
+	var tracesLocker sync.Mutex
+	consumer.OnTrace(func(trace *ConsumerTraceEventData) {
+		tracesLocker.Lock()
+		traces = append(traces, trace.Type)
+		tracesLocker.Unlock()
+	})
+	observed := 0
+	consumer.Observer().On("trace", func(*ConsumerTraceEventData) { observed++ })
+
+	subscriber, _ := channel.subscribers.Load(consumer.Id())
+	emit := subscriber.(channelSubscriber)
+
+	waiting := func() int {
+		consumer.traceLocker.Lock()
+		defer consumer.traceLocker.Unlock()
+		return len(consumer.traceWaiters[ConsumerTraceEventType_Keyframe])
+	}
+
+	// Two concurrent waits enable the "keyframe" trace event once, and disable it once both are
+	// done, keeping the types enabled by the application meanwhile.
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			errs <- consumer.ResumeAndWaitForMedia(ctx)
+		}()
+	}
+	require.Eventually(t, func() bool {
+		return waiting() == 2 && len(sentTypes()) == 1
+	}, time.Second, time.Millisecond)
+	require.NoError(t, consumer.EnableTraceEvent(ConsumerTraceEventType_Pli))
+
+	emit("trace", []byte(`{"type": "pli", "timestamp": 1000, "direction": "in"}`))
+	emit("trace", []byte(`{"type": "keyframe", "timestamp": 1010, "direction": "out"}`))
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+
+	assert.False(t, consumer.Paused())
+	assert.Equal(t, []ConsumerTraceEventType{"pli"}, consumer.TraceEventTypes())
+	assert.Equal(t, []string{
+		`{"types":["keyframe"]}`,
+		`{"types":["pli","keyframe"]}`,
+		`{"types":["pli"]}`,
+	}, sentTypes())
+
+	// Only the trace event type enabled by the application is emitted.
+	tracesLocker.Lock()
+	assert.Equal(t, []ConsumerTraceEventType{"pli"}, traces)
+	tracesLocker.Unlock()
+	assert.Equal(t, 1, observed)
+	assert.Zero(t, consumer.KeyFrameCount())
+}
+
+func TestConsumerResumeAndWaitForMediaRtp(t *testing.T) {
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newConsumer(consumerParams{
+		internal:       internalData{ConsumerId: "consumer"},
+		data:           consumerData{Kind: MediaKind_Audio},
+		channel:        newFakeWorkerChannel(t, nil),
+		payloadChannel: payloadChannel,
+		paused:         true,
+		rtpEnabled:     true,
+	})
+	defer consumer.cancel()
+
+	subscriber, _ := payloadChannel.subscribers.Load(consumer.Id())
+	emit := subscriber.(payloadChannelSubscriber)
+
+	go func() {
+		for consumer.Paused() {
+			time.Sleep(time.Millisecond)
+		}
+		emit("rtp", nil, []byte{0x80})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, consumer.ResumeAndWaitForMedia(ctx))
+	_, ok := consumer.TimeToFirstRtp()
+	assert.True(t, ok)
+
+	// Media already flows.
+	require.NoError(t, consumer.ResumeAndWaitForMedia(ctx))
+
+	// Without media flowing after a new resume.
+	require.NoError(t, consumer.Pause())
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := consumer.ResumeAndWaitForMedia(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Contains(t, err.Error(), "no media received")
+}
+
+func TestConsumerEnableTraceEventFor(t *testing.T) {
+	var requests []string
+	var requestsLocker sync.Mutex
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		requestsLocker.Lock()
+		requests = append(requests, req.method+" "+req.data)
+		requestsLocker.Unlock()
+		return "", nil
+	})
+	sentRequests := func() []string {
+		requestsLocker.Lock()
+		defer requestsLocker.Unlock()
+		return append([]string(nil), requests...)
+	}
+
+	// Fake clock: timers only fire when the test calls them.
+	type fakeTimer struct {
+		d     time.Duration
+		f     func()
+		timer *time.Timer
+	}
+	var timers []*fakeTimer
+	timeAfterFunc = func(d time.Duration, f func()) *time.Timer {
+		timer := &fakeTimer{d: d, f: f, timer: time.AfterFunc(time.Hour, func() {})}
+		timers = append(timers, timer)
+		return timer.timer
+	}
+	defer func() { timeAfterFunc = time.AfterFunc }()
+
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newFakeConsumer(t, channel, payloadChannel)
+
+	require.NoError(t, consumer.EnableTraceEventFor(time.Minute, ConsumerTraceEventType_Pli))
+	require.Len(t, timers, 1)
+	assert.Equal(t, time.Minute, timers[0].d)
+	assert.Equal(t, []ConsumerTraceEventType{"pli"}, consumer.TraceEventTypes())
+
+	// The duration elapses.
+	timers[0].f()
+	assert.Empty(t, consumer.TraceEventTypes())
+	assert.Equal(t, []string{
+		`consumer.enableTraceEvent {"types":["pli"]}`,
+		`consumer.enableTraceEvent {"types":[]}`,
+	}, sentRequests())
+
+	// Enabling again cancels the pending expiry, which then does nothing if fired anyway.
+	require.NoError(t, consumer.EnableTraceEventFor(time.Minute, ConsumerTraceEventType_Keyframe))
+	require.NoError(t, consumer.EnableTraceEvent(ConsumerTraceEventType_Rtp))
+	assert.False(t, timers[1].timer.Stop())
+	timers[1].f()
+	assert.Equal(t, []ConsumerTraceEventType{"rtp"}, consumer.TraceEventTypes())
+	assert.Len(t, sentRequests(), 4)
+
+	// Closing the Consumer cancels the pending expiry.
+	require.NoError(t, consumer.EnableTraceEventFor(time.Minute, ConsumerTraceEventType_Pli))
+	require.NoError(t, consumer.Close())
+	assert.False(t, timers[2].timer.Stop())
+
+	assert.IsType(t, InvalidStateError{}, consumer.EnableTraceEventFor(time.Minute, ConsumerTraceEventType_Pli))
+}
+
+func TestConsumerKeyFrameCountConcurrent(t *testing.T) {
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newConsumer(consumerParams{
+		internal:       internalData{ConsumerId: "consumer"},
+		channel:        newFakeWorkerChannel(t, nil),
+		payloadChannel: payloadChannel,
+	})
+	defer consumer.cancel()
+
+	subscriber, _ := consumer.channel.subscribers.Load(consumer.Id())
+	emit := subscriber.(channelSubscriber)
+	keyframe := []byte(`{"type":"keyframe","timestamp":1,"direction":"out"}`)
+
+	// Trace events come from the channel goroutine while the user enables the types and reads the
+	// count, which is checked by the race detector.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			emit("trace", keyframe)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, consumer.EnableTraceEvent(ConsumerTraceEventType_Keyframe))
+		consumer.KeyFrameCount()
+		require.NoError(t, consumer.EnableTraceEvent())
+	}
+	<-done
+
+	assert.Zero(t, consumer.KeyFrameCount())
+	require.NoError(t, consumer.EnableTraceEvent(ConsumerTraceEventType_Keyframe))
+	assert.Zero(t, consumer.KeyFrameCount())
+	emit("trace", keyframe)
+	assert.EqualValues(t, 1, consumer.KeyFrameCount())
+}
+
+func TestConsumerSetMaxBitrateClampsPreferredLayers(t *testing.T) {
+	// Answer "consumer.setPreferredLayers" with the requested layers.
+	requested := make(chan ConsumerLayers, 10)
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		var layers ConsumerLayers
+		json.Unmarshal([]byte(req.data), &layers)
+		requested <- layers
+		return req.data, nil
+	})
+
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newConsumer(consumerParams{
+		internal: internalData{ConsumerId: "consumer"},
+		data: consumerData{
+			Kind: MediaKind_Video,
+			Type: ConsumerType_Simulcast,
+			RtpParameters: RtpParameters{
+				Encodings: []RtpEncodingParameters{{ScalabilityMode: "L3T3"}},
+			},
+		},
+		channel:             channel,
+		payloadChannel:      payloadChannel,
+		producerMaxBitrates: []int{150000, 500000, 1200000},
+	})
+	defer consumer.cancel()
+
+	require.NoError(t, consumer.SetPreferredLayers(ConsumerLayers{SpatialLayer: 2, TemporalLayer: 1}))
+	<-requested
+
+	// The cap clamps the intended layers, keeping their temporal layer.
+	require.NoError(t, consumer.SetMaxBitrate(600000))
+	assert.Equal(t, ConsumerLayers{SpatialLayer: 1, TemporalLayer: 1}, <-requested)
+	assert.Equal(t, &ConsumerLayers{SpatialLayer: 2, TemporalLayer: 1}, consumer.IntendedPreferredLayers())
+
+	// Layers set meanwhile are clamped too.
+	require.NoError(t, consumer.SetPreferredLayers(ConsumerLayers{SpatialLayer: 2, TemporalLayer: 2}))
+	assert.Equal(t, ConsumerLayers{SpatialLayer: 1, TemporalLayer: 2}, <-requested)
+	require.NoError(t, consumer.SetPreferredLayers(ConsumerLayers{SpatialLayer: 0, TemporalLayer: 2}))
+	assert.Equal(t, ConsumerLayers{SpatialLayer: 0, TemporalLayer: 2}, <-requested)
+
+	// Removing the cap sets the intended layers again.
+	require.NoError(t, consumer.SetPreferredLayers(ConsumerLayers{SpatialLayer: 2, TemporalLayer: 0}))
+	<-requested
+	require.NoError(t, consumer.SetMaxBitrate(0))
+	assert.Equal(t, ConsumerLayers{SpatialLayer: 2, TemporalLayer: 0}, <-requested)
+	assert.Equal(t, &ConsumerLayers{SpatialLayer: 2, TemporalLayer: 0}, consumer.PreferredLayers())
+	assert.Zero(t, consumer.MaxBitrate())
+
+	// Without cap, removing it sends nothing.
+	require.NoError(t, consumer.SetMaxBitrate(0))
+	select {
+	case layers := <-requested:
+		t.Fatalf("unexpected request %+v", layers)
+	default:
+	}
+}
+
+func TestConsumerRestoreIntendedLayers(t *testing.T) {
+	// Answer "consumer.setPreferredLayers" with the requested layers, clamping the spatial layer
+	// to 1 while the Producer does not send the layer 2, and failing for spatial layer 5.
+	var clamp int32
+	requested := make(chan ConsumerLayers, 10)
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		var layers ConsumerLayers
+		json.Unmarshal([]byte(req.data), &layers)
+		requested <- layers
+
+		if layers.SpatialLayer == 5 {
+			return "", errors.New("boom")
+		}
+		if atomic.LoadInt32(&clamp) == 1 && layers.SpatialLayer > 1 {
+			layers.SpatialLayer = 1
+		}
+		data, _ := json.Marshal(layers)
+		return string(data), nil
+	})
+
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newConsumer(consumerParams{
+		internal:       internalData{ConsumerId: "consumer"},
+		data:           consumerData{Kind: MediaKind_Video},
+		channel:        channel,
+		payloadChannel: payloadChannel,
+	})
+	defer consumer.cancel()
+
+	subscriber, _ := channel.subscribers.Load(consumer.Id())
+	emit := subscriber.(channelSubscriber)
+
+	intended := ConsumerLayers{SpatialLayer: 2, TemporalLayer: 1}
+	require.NoError(t, consumer.SetPreferredLayers(intended))
+	assert.Equal(t, intended, <-requested)
+
+	// A failed request is not intended.
+	assert.Error(t, consumer.SetPreferredLayers(ConsumerLayers{SpatialLayer: 5}))
+	<-requested
+	assert.Equal(t, &intended, consumer.IntendedPreferredLayers())
+
+	// The layer 2 is dropped, then the application sets the intended layers again while the worker
+	// clamps them.
+	emit("score", []byte(`{"score": 10, "producerScore": 10, "producerScores": [10, 10, 0]}`))
+	atomic.StoreInt32(&clamp, 1)
+	require.NoError(t, consumer.SetPreferredLayers(intended))
+	<-requested
+	assert.Equal(t, &ConsumerLayers{SpatialLayer: 1, TemporalLayer: 1}, consumer.PreferredLayers())
+
+	// The layer comes back: the intended layers are set again.
+	atomic.StoreInt32(&clamp, 0)
+	emit("score", []byte(`{"score": 10, "producerScore": 10, "producerScores": [10, 10, 10]}`))
+	assert.Equal(t, intended, <-requested)
+	assert.Eventually(t, func() bool {
+		return equalLayers(&intended, consumer.PreferredLayers())
+	}, time.Second, time.Millisecond)
+
+	// A restore decided before the application set other layers does not send the old ones.
+	consumer.layersLocker.RLock()
+	generation := consumer.intendedGeneration
+	consumer.layersLocker.RUnlock()
+
+	other := ConsumerLayers{SpatialLayer: 0, TemporalLayer: 0}
+	require.NoError(t, consumer.SetPreferredLayers(other))
+	<-requested
+	require.NoError(t, consumer.restorePreferredLayers(intended, generation))
+	select {
+	case layers := <-requested:
+		t.Fatalf("stale intended layers %+v restored", layers)
+	default:
+	}
+	assert.Equal(t, &other, consumer.PreferredLayers())
+	assert.Equal(t, &other, consumer.IntendedPreferredLayers())
+}
+
+func TestConsumerSetPreferredLayersAsync(t *testing.T) {
+	// Answer "consumer.setPreferredLayers" once released, applying temporal layer 0 and failing
+	// for spatial layer 3.
+	requested := make(chan ConsumerLayers, 10)
+	release := make(chan struct{})
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		var layers ConsumerLayers
+		json.Unmarshal([]byte(req.data), &layers)
+		requested <- layers
+		<-release
+
+		if layers.SpatialLayer == 3 {
+			return "", errors.New("boom")
+		}
+		return fmt.Sprintf(`{"spatialLayer":%d,"temporalLayer":0}`, layers.SpatialLayer), nil
+	})
+
+	consumer := newFakeConsumer(t, channel, nil)
+
+	// The requested layers are cached at once, then reconciled with the applied ones.
+	require.NoError(t, consumer.SetPreferredLayersAsync(ConsumerLayers{SpatialLayer: 1, TemporalLayer: 2}, nil))
+	assert.Equal(t, &ConsumerLayers{SpatialLayer: 1, TemporalLayer: 2}, consumer.PreferredLayers())
+	assert.Equal(t, ConsumerLayers{SpatialLayer: 1, TemporalLayer: 2}, <-requested)
+
+	// While a request is in flight, only the latest layers requested meanwhile are sent next.
+	superseded := make(chan error, 1)
+	require.NoError(t, consumer.SetPreferredLayersAsync(ConsumerLayers{SpatialLayer: 2, TemporalLayer: 2}, func(err error) { superseded <- err }))
+	require.NoError(t, consumer.SetPreferredLayersAsync(ConsumerLayers{SpatialLayer: 2, TemporalLayer: 1}, nil))
+	assert.Equal(t, &ConsumerLayers{SpatialLayer: 2, TemporalLayer: 1}, consumer.PreferredLayers())
+	select {
+	case layers := <-requested:
+		t.Fatalf("request %+v sent before the previous one was answered", layers)
+	case <-time.After(10 * time.Millisecond):
+	}
+	release <- struct{}{}
+	assert.Equal(t, ConsumerLayers{SpatialLayer: 2, TemporalLayer: 1}, <-requested)
+	release <- struct{}{}
+	assert.Eventually(t, func() bool {
+		return equalLayers(&ConsumerLayers{SpatialLayer: 2}, consumer.PreferredLayers())
+	}, time.Second, time.Millisecond)
+
+	// A failed request rolls back to the applied layers.
+	errs := make(chan error, 1)
+	require.NoError(t, consumer.SetPreferredLayersAsync(ConsumerLayers{SpatialLayer: 3}, func(err error) { errs <- err }))
+	assert.Equal(t, &ConsumerLayers{SpatialLayer: 3}, consumer.PreferredLayers())
+	<-requested
+	release <- struct{}{}
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("onError not called")
+	}
+	assert.Equal(t, &ConsumerLayers{SpatialLayer: 2}, consumer.PreferredLayers())
+	// Only layers accepted by the worker are intended.
+	assert.Equal(t, &ConsumerLayers{SpatialLayer: 2, TemporalLayer: 1}, consumer.IntendedPreferredLayers())
+	assert.Empty(t, requested)
+	assert.Empty(t, superseded)
+}
+
+func TestConsumerSetPreferredLayersAndWait(t *testing.T) {
+	// Answer "consumer.setPreferredLayers" with the requested layers.
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		return req.data, nil
+	})
+
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newFakeConsumer(t, channel, payloadChannel)
+	consumer.handleWorkerNotifications()
+
+	subscriber, _ := consumer.channel.subscribers.Load(consumer.Id())
+	emit := subscriber.(channelSubscriber)
+	emit("layerschange", []byte(`{"spatialLayer": 1, "temporalLayer": 1}`))
+
+	// Setting the current layers is no effective change, without waiting.
+	start := time.Now()
+	changed, err := consumer.SetPreferredLayersAndWait(context.Background(), ConsumerLayers{SpatialLayer: 1, TemporalLayer: 1})
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Equal(t, &ConsumerLayers{SpatialLayer: 1, TemporalLayer: 1}, consumer.PreferredLayers())
+
+	// The worker switches to the new layers.
+	go func() {
+		assert.Eventually(t, func() bool {
+			return consumer.PreferredLayers().SpatialLayer == 2
+		}, time.Second, time.Millisecond)
+		emit("layerschange", []byte(`{"spatialLayer": 2, "temporalLayer": 1}`))
+	}()
+	changed, err = consumer.SetPreferredLayersAndWait(context.Background(), ConsumerLayers{SpatialLayer: 2, TemporalLayer: 1})
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	// No "layerschange" before the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	changed, err = consumer.SetPreferredLayersAndWait(ctx, ConsumerLayers{SpatialLayer: 0, TemporalLayer: 0})
+	require.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestConsumerReplaceProducerRestoresOnFailure(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		consumes []string
+	)
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		if req.method != "transport.consume" {
+			return "", nil
+		}
+		mu.Lock()
+		consumes = append(consumes, req.data)
+		mu.Unlock()
+
+		if strings.Contains(req.data, `"producerId":"producer2"`) {
+			return "", errors.New("consume failed")
+		}
+		return `{"paused":true}`, nil
+	})
+	payloadChannel, _ := newFakePayloadChannel(t)
+
+	newAudioProducer := func(id string, ssrc uint32) *Producer {
+		return &Producer{
+			internal: internalData{ProducerId: id},
+			data: producerData{
+				Kind: MediaKind_Audio,
+				Type: ProducerType_Simple,
+				ConsumableRtpParameters: RtpParameters{
+					Codecs: []*RtpCodecParameters{
+						{MimeType: "audio/opus", PayloadType: 100, ClockRate: 48000, Channels: 2},
+					},
+					Encodings: []RtpEncodingParameters{{Ssrc: ssrc}},
+				},
+			},
+		}
+	}
+	producers := map[string]*Producer{
+		"producer1": newAudioProducer("producer1", 1111),
+		"producer2": newAudioProducer("producer2", 2222),
+	}
+	transport := newDirectTransport(transportParams{
+		internal:        internalData{RouterId: "router", TransportId: "transport"},
+		channel:         channel,
+		payloadChannel:  payloadChannel,
+		getProducerById: func(id string) *Producer { return producers[id] },
+	})
+
+	rtpCapabilities := RtpCapabilities{
+		Codecs: []*RtpCodecCapability{
+			{Kind: MediaKind_Audio, MimeType: "audio/opus", PreferredPayloadType: 100, ClockRate: 48000, Channels: 2},
+		},
+	}
+	consumer, err := transport.Consume(ConsumerOptions{
+		ProducerId:      "producer1",
+		RtpCapabilities: rtpCapabilities,
+		Paused:          true,
+		IgnoreDtx:       true,
+		AppData:         H{"foo": "bar"},
+	})
+	require.NoError(t, err)
+	defer consumer.cancel()
+
+	restored, err := consumer.ReplaceProducer("producer2", rtpCapabilities)
+	require.EqualError(t, err, "consume failed")
+	require.NotNil(t, restored)
+	defer restored.cancel()
+
+	assert.True(t, consumer.Closed())
+	assert.False(t, restored.Closed())
+	assert.Equal(t, consumer.Id(), restored.Id())
+	assert.Equal(t, "producer1", restored.ProducerId())
+	assert.Equal(t, consumer.RtpParameters(), restored.RtpParameters())
+	assert.True(t, restored.Paused())
+	assert.Equal(t, H{"foo": "bar"}, restored.AppData())
+
+	// The options of the Consumer are carried to the new Consumer, and to the restored one.
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, consumes, 3)
+	for _, data := range consumes[1:] {
+		assert.Contains(t, data, `"ignoreDtx":true`)
+		assert.Contains(t, data, `"paused":true`)
+	}
+	assert.Contains(t, consumes[2], fmt.Sprintf(`"consumerId":%q`, consumer.Id()))
+}
+
+func TestConsumerRtpParametersChangeConcurrent(t *testing.T) {
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newConsumer(consumerParams{
+		internal:       internalData{ConsumerId: "consumer"},
+		channel:        newFakeWorkerChannel(t, nil),
+		payloadChannel: payloadChannel,
+		data: consumerData{
+			Kind: MediaKind_Video,
+			RtpParameters: RtpParameters{
+				Encodings: []RtpEncodingParameters{{Ssrc: 1111}},
+				Rtcp:      RtcpParameters{Cname: "cname"},
+			},
+		},
+	})
+	defer consumer.cancel()
+
+	subscriber, _ := consumer.channel.subscribers.Load(consumer.Id())
+	emit := subscriber.(channelSubscriber)
+
+	// The RTP parameters change from the channel goroutine while the user reads them, which is
+	// checked by the race detector.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			emit("rtpparameterschange", []byte(fmt.Sprintf(
+				`{"encodings":[{"ssrc":%d}],"rtcp":{"cname":"cname"}}`, 2222+i)))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		consumer.RtpParameters()
+		consumer.Ssrcs()
+		consumer.Cname()
+		consumer.SpatialLayers()
+	}
+	<-done
+
+	assert.EqualValues(t, 2321, consumer.RtpParameters().Encodings[0].Ssrc)
+}
+
+func TestConsumerListen(t *testing.T) {
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newConsumer(consumerParams{
+		internal:       internalData{ConsumerId: "consumer"},
+		channel:        newFakeWorkerChannel(t, nil),
+		payloadChannel: payloadChannel,
+		rtpEnabled:     true,
+	})
+	defer consumer.cancel()
+
+	subscriber, _ := consumer.payloadChannel.subscribers.Load(consumer.Id())
+	emit := subscriber.(payloadChannelSubscriber)
+
+	// Two handlers are added, and only one of them is removed.
+	var recorder, player int
+	removeRecorder := consumer.Listen("rtp", func(data []byte) { recorder++ })
+	consumer.Listen("rtp", func(data []byte) { player++ })
+
+	emit("rtp", nil, []byte{0x80})
+	removeRecorder()
+	emit("rtp", nil, []byte{0x80})
+	removeRecorder()
+
+	assert.Equal(t, 1, recorder)
+	assert.Equal(t, 2, player)
+}
+
+func TestConsumerTraceEventTypesCopy(t *testing.T) {
+	payloadChannel, _ := newFakePayloadChannel(t)
+	consumer := newConsumer(consumerParams{
+		internal:       internalData{ConsumerId: "consumer"},
+		channel:        newFakeWorkerChannel(t, nil),
+		payloadChannel: payloadChannel,
+	})
+	defer consumer.cancel()
+
+	require.NoError(t, consumer.EnableTraceEvent("rtp", "pli"))
+
+	types := consumer.TraceEventTypes()
+	types[0] = "fir"
+	_ = append(types[:1], "nack")
+
+	assert.Equal(t, []ConsumerTraceEventType{"rtp", "pli"}, consumer.TraceEventTypes())
 }
@@ -2,6 +2,7 @@ package mediasoup
 
 import (
 	"encoding/json"
+	"errors"
 	"sync/atomic"
 
 	"github.com/go-logr/logr"
@@ -34,6 +35,23 @@ type DataConsumerOptions struct {
 	AppData interface{} `json:"appData,omitempty"`
 }
 
+// ErrInvalidSctpParameters is wrapped by the TypeError returned when DataConsumerOptions contain
+// an invalid combination of SCTP reliability parameters.
+var ErrInvalidSctpParameters = errors.New("invalid SCTP parameters")
+
+// validateDataConsumerOptions validates the SCTP reliability parameters of DataConsumerOptions.
+func validateDataConsumerOptions(options DataConsumerOptions) error {
+	if options.MaxPacketLifeTime > 0 && options.MaxRetransmits > 0 {
+		return NewTypeError("%w: cannot provide both maxPacketLifeTime and maxRetransmits",
+			ErrInvalidSctpParameters)
+	}
+	if options.Ordered && (options.MaxPacketLifeTime > 0 || options.MaxRetransmits > 0) {
+		return NewTypeError("%w: cannot be ordered with maxPacketLifeTime or maxRetransmits",
+			ErrInvalidSctpParameters)
+	}
+	return nil
+}
+
 // DataConsumerStat define the statistic info for DataConsumer.
 type DataConsumerStat struct {
 	Type           string `json:"type,omitempty"`
@@ -338,11 +356,31 @@ func (c *DataConsumer) OnBufferedAmountLow(handler func(bufferAmount uint32)) {
 	c.onBufferedAmountLow = handler
 }
 
-// OnMessage set handler on "message" event
+// OnMessage set handler on "message" event, emitted for every message received by a
+// DataConsumer created on a DirectTransport. The payload is delivered as sent by the worker: an
+// empty message (PPID 56 or 57) carries a single placeholder byte, use IsEmptyPpid() to detect it
+// and IsStringPpid() to tell text messages from binary ones.
 func (c *DataConsumer) OnMessage(handler func(payload []byte, ppid int)) {
 	c.onMessage = handler
 }
 
+// IsStringPpid returns whether ppid is the SCTP payload protocol identifier of a WebRTC text
+// message (51, 54 or 56) rather than a binary one (53, 52 or 57).
+func IsStringPpid(ppid int) bool {
+	switch ppid {
+	case 51, 54, 56:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsEmptyPpid returns whether ppid is the SCTP payload protocol identifier of an empty WebRTC
+// message (56 or 57), whose payload is a single placeholder byte.
+func IsEmptyPpid(ppid int) bool {
+	return ppid == 56 || ppid == 57
+}
+
 func (c *DataConsumer) handleWorkerNotifications() {
 	c.channel.Subscribe(c.Id(), func(event string, data []byte) {
 		switch event {
@@ -401,7 +439,6 @@ func (c *DataConsumer) handleWorkerNotifications() {
 				c.logger.Error(err, "failed to unmarshal message", "data", json.RawMessage(data))
 				return
 			}
-
 			c.SafeEmit("message", payload, result.Ppid)
 
 			if handler := c.onMessage; handler != nil {
@@ -1,8 +1,10 @@
 package mediasoup
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -280,3 +282,87 @@ func (suite *DataConsumerTestingSuite) TestDataConsumerEmitsDataproducercloseIfT
 		suite.dataProducer.Id(): {},
 	}, routerDump.MapDataProducerIdDataConsumerIds)
 }
+
+func (suite *DataConsumerTestingSuite) TestDataConsumerInvalidSctpParameters() {
+	_, err := suite.transport1.ConsumeData(DataConsumerOptions{
+		DataProducerId:    suite.dataProducer.Id(),
+		MaxPacketLifeTime: 4000,
+		MaxRetransmits:    3,
+	})
+	suite.IsType(TypeError{}, err)
+	suite.True(errors.Is(err, ErrInvalidSctpParameters))
+
+	// Reliability parameters are ignored on a DirectTransport.
+	_, err = suite.transport3.ConsumeData(DataConsumerOptions{
+		DataProducerId:    suite.dataProducer.Id(),
+		MaxPacketLifeTime: 4000,
+		MaxRetransmits:    3,
+	})
+	suite.NoError(err)
+}
+
+func TestValidateDataConsumerOptions(t *testing.T) {
+	invalidOptions := []DataConsumerOptions{
+		{MaxPacketLifeTime: 4000, MaxRetransmits: 3},
+		{Ordered: true, MaxPacketLifeTime: 4000},
+		{Ordered: true, MaxRetransmits: 3},
+		{Ordered: true, MaxPacketLifeTime: 4000, MaxRetransmits: 3},
+	}
+	for _, options := range invalidOptions {
+		err := validateDataConsumerOptions(options)
+		assert.IsType(t, TypeError{}, err, "%+v", options)
+		assert.True(t, errors.Is(err, ErrInvalidSctpParameters), "%+v", options)
+	}
+
+	validOptions := []DataConsumerOptions{
+		{},
+		{Ordered: true},
+		{MaxPacketLifeTime: 4000},
+		{MaxRetransmits: 3},
+	}
+	for _, options := range validOptions {
+		assert.NoError(t, validateDataConsumerOptions(options), "%+v", options)
+	}
+}
+
+func TestDataConsumerOnMessage(t *testing.T) {
+	payloadChannel, _ := newFakePayloadChannel(t)
+	dataConsumer := newDataConsumer(dataConsumerParams{
+		internal:       internalData{DataConsumerId: "dataConsumer"},
+		data:           dataConsumerData{DataProducerId: "dataProducer", Type: DataConsumerType_Direct},
+		channel:        newFakeWorkerChannel(t, nil),
+		payloadChannel: payloadChannel,
+	})
+
+	type message struct {
+		text    bool
+		empty   bool
+		payload string
+	}
+	var messages []message
+	dataConsumer.OnMessage(func(payload []byte, ppid int) {
+		messages = append(messages, message{text: IsStringPpid(ppid), empty: IsEmptyPpid(ppid), payload: string(payload)})
+	})
+
+	subscriber, ok := dataConsumer.payloadChannel.subscribers.Load(dataConsumer.Id())
+	if !assert.True(t, ok) {
+		return
+	}
+	emit := subscriber.(payloadChannelSubscriber)
+	emit("message", []byte(`{"ppid":51}`), []byte("hello"))
+	emit("message", []byte(`{"ppid":53}`), []byte{1, 2, 3})
+	emit("message", []byte(`{"ppid":56}`), []byte{' '})
+	emit("message", []byte(`{"ppid":57}`), []byte{0})
+
+	assert.Equal(t, []message{
+		{text: true, payload: "hello"},
+		{text: false, payload: "\x01\x02\x03"},
+		{text: true, empty: true, payload: " "},
+		{text: false, empty: true, payload: "\x00"},
+	}, messages)
+
+	// No message is delivered once closed.
+	dataConsumer.closed = 1
+	emit("message", []byte(`{"ppid":51}`), []byte("bye"))
+	assert.Len(t, messages, 4)
+}
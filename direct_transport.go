@@ -83,6 +83,11 @@ func (transport *DirectTransport) SetMaxIncomingBitrate(bitrate int) error {
 	return NewUnsupportedError("SetMaxIncomingBitrate() not implemented in DirectTransport")
 }
 
+// SetMaxOutgoingBitrate always returns error.
+func (transport *DirectTransport) SetMaxOutgoingBitrate(bitrate int) error {
+	return NewUnsupportedError("SetMaxOutgoingBitrate() not implemented in DirectTransport")
+}
+
 // SendRtcp send RTCP packet.
 func (transport *DirectTransport) SendRtcp(rtcpPacket []byte) error {
 	return transport.payloadChannel.Notify("transport.sendRtcp", transport.internal, "", rtcpPacket)
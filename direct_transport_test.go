@@ -1,8 +1,10 @@
 package mediasoup
 
 import (
+	"context"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -140,6 +142,306 @@ func (suite *DirectTransportTestingSuite) TestDataProducerSendSucceeds() {
 	}, dataConumserStats[0])
 }
 
+func (suite *DirectTransportTestingSuite) TestProducerSendRtpSucceeds() {
+	producer := CreateAudioProducer(suite.transport)
+	consumer, err := suite.transport.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: consumerDeviceCapabilities,
+	})
+	suite.Require().NoError(err)
+
+	received := make(chan []byte, 1)
+	consumer.OnRtp(func(packet []byte) {
+		select {
+		case received <- packet:
+		default:
+		}
+	})
+
+	// RTP header: version 2, payload type 111, sequence number 1, timestamp 1, SSRC 11111111.
+	payload := []byte("hello")
+	packet := append([]byte{
+		0x80, 111, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x01,
+		0x00, 0xa9, 0x8a, 0xc7,
+	}, payload...)
+	suite.NoError(producer.Send(packet))
+
+	select {
+	case rtpPacket := <-received:
+		ssrc := consumer.RtpParameters().Encodings[0].Ssrc
+		suite.Equal([]byte{byte(ssrc >> 24), byte(ssrc >> 16), byte(ssrc >> 8), byte(ssrc)}, rtpPacket[8:12])
+		suite.Equal(payload, rtpPacket[len(rtpPacket)-len(payload):])
+	case <-time.After(time.Second):
+		suite.Fail("rtp packet not received")
+	}
+}
+
+func (suite *DirectTransportTestingSuite) TestConsumePrewarmed() {
+	producer := CreateVP8Producer(suite.transport)
+
+	onTrace := NewMockFunc(suite.T())
+	producer.On("trace", onTrace.Fn())
+
+	type result struct {
+		consumer *Consumer
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		consumer, err := suite.transport.ConsumePrewarmed(ctx, ConsumerOptions{
+			ProducerId:      producer.Id(),
+			RtpCapabilities: consumerDeviceCapabilities,
+		})
+		done <- result{consumer, err}
+	}()
+
+	// Wait for the "keyframe" trace event to be enabled before sending the key frame.
+	suite.Eventually(func() bool {
+		dump, err := producer.Dump()
+		return err == nil && strings.Contains(dump.TraceEventTypes, "keyframe")
+	}, time.Second, 10*time.Millisecond)
+
+	// RTP header: version 2, payload type 112, sequence number 1, timestamp 1, SSRC 22222222,
+	// then a VP8 payload descriptor starting a partition and the header of a 320x240 key frame.
+	packet := []byte{
+		0x80, 112, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x01,
+		0x01, 0x53, 0x15, 0x8e,
+		0x10,
+		0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x40, 0x01, 0xf0, 0x00,
+	}
+	suite.NoError(producer.Send(packet))
+
+	select {
+	case res := <-done:
+		suite.Require().NoError(res.err)
+		suite.True(res.consumer.Paused())
+	case <-time.After(5 * time.Second):
+		suite.FailNow("key frame not received")
+	}
+
+	// The keyframe trace enabled while waiting is disabled and not emitted.
+	dump, _ := producer.Dump()
+	suite.Empty(dump.TraceEventTypes)
+	onTrace.ExpectCalledTimes(0)
+
+	// No key frame received: the Consumer is closed.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := suite.transport.ConsumePrewarmed(ctx, ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: consumerDeviceCapabilities,
+	})
+	suite.Equal(context.DeadlineExceeded, err)
+	suite.Len(suite.transport.Consumers(), 1)
+}
+
+func (suite *DirectTransportTestingSuite) TestConsumerRequestKeyFrameForLayer() {
+	producer, err := suite.transport.Produce(ProducerOptions{
+		Kind: MediaKind_Video,
+		RtpParameters: RtpParameters{
+			Mid: "VIDEO",
+			Codecs: []*RtpCodecParameters{
+				{
+					MimeType:    "video/VP8",
+					PayloadType: 112,
+					ClockRate:   90000,
+					RtcpFeedback: []RtcpFeedback{
+						{Type: "nack"},
+						{Type: "nack", Parameter: "pli"},
+					},
+				},
+			},
+			Encodings: []RtpEncodingParameters{{Ssrc: 33333333}},
+			Rtcp:      RtcpParameters{Cname: "FOOBAR"},
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(producer.EnableTraceEvent(ProducerTraceEventType_Pli))
+
+	plis := make(chan *ProducerTraceEventData, 10)
+	producer.OnTrace(func(trace *ProducerTraceEventData) {
+		plis <- trace
+	})
+
+	consumer, err := suite.transport.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: consumerDeviceCapabilities,
+	})
+	suite.Require().NoError(err)
+
+	// RTP header: version 2, payload type 112, sequence number 1, timestamp 1, SSRC 33333333,
+	// then a VP8 payload descriptor starting a partition and the header of a 320x240 key frame.
+	packet := []byte{
+		0x80, 112, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x01,
+		0x01, 0xfc, 0xa0, 0x55,
+		0x10,
+		0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x40, 0x01, 0xf0, 0x00,
+	}
+	suite.NoError(producer.Send(packet))
+
+	// Wait for the worker to create the RTP stream of the Producer.
+	suite.Eventually(func() bool {
+		stats, err := producer.GetStats()
+		return err == nil && len(stats) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	suite.IsType(TypeError{}, consumer.RequestKeyFrameForLayer(1))
+	suite.NoError(consumer.RequestKeyFrameForLayer(0))
+
+	// The worker requests a key frame of the stream to the endpoint.
+	select {
+	case trace := <-plis:
+		suite.Equal(ProducerTraceEventType_Pli, trace.Type)
+		suite.Equal("out", trace.Direction)
+	case <-time.After(time.Second):
+		suite.Fail("pli trace not received")
+	}
+}
+
+func (suite *DirectTransportTestingSuite) TestConsumerTimeToFirstRtp() {
+	producer := CreateAudioProducer(suite.transport)
+	consumer, err := suite.transport.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: consumerDeviceCapabilities,
+		Paused:          true,
+	})
+	suite.Require().NoError(err)
+
+	subscriber, _ := consumer.payloadChannel.subscribers.Load(consumer.Id())
+	emit := subscriber.(payloadChannelSubscriber)
+
+	_, ok := consumer.TimeToFirstRtp()
+	suite.False(ok)
+
+	suite.NoError(consumer.Resume())
+	_, ok = consumer.TimeToFirstRtp()
+	suite.False(ok)
+
+	time.Sleep(10 * time.Millisecond)
+	emit("rtp", nil, []byte{0x80})
+	first, ok := consumer.TimeToFirstRtp()
+	suite.True(ok)
+	suite.GreaterOrEqual(int64(first), int64(10*time.Millisecond))
+
+	// Later packets do not change the measurement.
+	emit("rtp", nil, []byte{0x80})
+	second, _ := consumer.TimeToFirstRtp()
+	suite.Equal(first, second)
+
+	// It is reset on resume.
+	suite.NoError(consumer.Pause())
+	suite.NoError(consumer.Resume())
+	_, ok = consumer.TimeToFirstRtp()
+	suite.False(ok)
+}
+
+func (suite *DirectTransportTestingSuite) TestConsumerEmitsRtpGap() {
+	producer := CreateAudioProducer(suite.transport)
+	consumer, err := suite.transport.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: consumerDeviceCapabilities,
+	})
+	suite.Require().NoError(err)
+
+	var gaps [][3]uint16
+	consumer.OnRtpGap(func(missing, from, to uint16) {
+		gaps = append(gaps, [3]uint16{missing, from, to})
+	})
+
+	subscriber, _ := consumer.payloadChannel.subscribers.Load(consumer.Id())
+	emit := subscriber.(payloadChannelSubscriber)
+
+	for _, seq := range []uint16{65534, 65535, 1, 2} {
+		emit("rtp", nil, []byte{0x80, 111, byte(seq >> 8), byte(seq), 0, 0, 0, 1, 0, 0, 0, 1})
+	}
+
+	suite.Equal([][3]uint16{{1, 65535, 1}}, gaps)
+}
+
+func (suite *DirectTransportTestingSuite) TestConsumerSuppressRtpWhilePaused() {
+	producer := CreateAudioProducer(suite.transport)
+	consumer, err := suite.transport.Consume(ConsumerOptions{
+		ProducerId:             producer.Id(),
+		RtpCapabilities:        consumerDeviceCapabilities,
+		SuppressRtpWhilePaused: true,
+	})
+	suite.Require().NoError(err)
+
+	var packets int
+	consumer.OnRtp(func(packet []byte) {
+		packets++
+	})
+
+	subscriber, _ := consumer.payloadChannel.subscribers.Load(consumer.Id())
+	emit := subscriber.(payloadChannelSubscriber)
+
+	emit("rtp", nil, []byte{0x80})
+	suite.Equal(1, packets)
+
+	suite.NoError(consumer.Pause())
+	emit("rtp", nil, []byte{0x80})
+	emit("rtp", nil, []byte{0x80})
+	suite.Equal(1, packets)
+
+	suite.NoError(consumer.Resume())
+	emit("rtp", nil, []byte{0x80})
+	suite.Equal(2, packets)
+}
+
+func (suite *DirectTransportTestingSuite) TestDirectTransportEnumeratesEntities() {
+	transport := suite.transport
+	suite.Empty(transport.Producers())
+	suite.Empty(transport.Consumers())
+
+	audioProducer := CreateAudioProducer(transport)
+	videoProducer := CreateVP8Producer(transport)
+	suite.ElementsMatch([]*Producer{audioProducer, videoProducer}, transport.Producers())
+
+	audioConsumer, err := transport.Consume(ConsumerOptions{
+		ProducerId:      audioProducer.Id(),
+		RtpCapabilities: consumerDeviceCapabilities,
+	})
+	suite.Require().NoError(err)
+	videoConsumer, err := transport.Consume(ConsumerOptions{
+		ProducerId:      videoProducer.Id(),
+		RtpCapabilities: consumerDeviceCapabilities,
+	})
+	suite.Require().NoError(err)
+	suite.ElementsMatch([]*Consumer{audioConsumer, videoConsumer}, transport.Consumers())
+
+	dataProducer, err := transport.ProduceData(DataProducerOptions{Label: "foo"})
+	suite.Require().NoError(err)
+	suite.Equal([]*DataProducer{dataProducer}, transport.DataProducers())
+
+	dataConsumer, err := transport.ConsumeData(DataConsumerOptions{DataProducerId: dataProducer.Id()})
+	suite.Require().NoError(err)
+	suite.Equal([]*DataConsumer{dataConsumer}, transport.DataConsumers())
+
+	audioConsumer.Close()
+	suite.Equal([]*Consumer{videoConsumer}, transport.Consumers())
+
+	// Closing the producer closes its consumer.
+	videoProducer.Close()
+	suite.Equal([]*Producer{audioProducer}, transport.Producers())
+	suite.Eventually(func() bool {
+		return len(transport.Consumers()) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	dataConsumer.Close()
+	suite.Empty(transport.DataConsumers())
+
+	transport.Close()
+	suite.Empty(transport.Producers())
+	suite.Empty(transport.DataProducers())
+}
+
 func (suite *DirectTransportTestingSuite) TestDirectTransportMethodRejectIfclosed() {
 	onObserverClose := NewMockFunc(suite.T())
 	suite.transport.Observer().Once("close", onObserverClose.Fn())
@@ -169,3 +471,47 @@ func (suite *DirectTransportTestingSuite) TestDirectTransportEmitRouterClosedIfW
 	onObserverClose.ExpectCalledTimes(1)
 	suite.True(suite.transport.Closed())
 }
+
+func (suite *DirectTransportTestingSuite) TestConsumerEventStats() {
+	producer := CreateAudioProducer(suite.transport)
+	consumer, err := suite.transport.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: consumerDeviceCapabilities,
+		RtpQueue: &RtpQueueOptions{
+			Size:       1,
+			DropPolicy: RtpQueueDropPolicy_DropNewest,
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Zero(consumer.EventStats())
+
+	release := make(chan struct{})
+	consumer.OnRtp(func(packet []byte) {
+		<-release
+	})
+
+	subscriber, _ := consumer.channel.subscribers.Load(consumer.Id())
+	emit := subscriber.(channelSubscriber)
+	emit("score", []byte(`{"score": 9, "producerScore": 10, "producerScores": [10]}`))
+	emit("score", []byte(`{"score": 8, "producerScore": 10, "producerScores": [10]}`))
+	emit("trace", []byte(`{"type": "rtp", "timestamp": 1, "direction": "out"}`))
+
+	payloadSubscriber, _ := consumer.payloadChannel.subscribers.Load(consumer.Id())
+	emitPayload := payloadSubscriber.(payloadChannelSubscriber)
+	for i := 0; i < 3; i++ {
+		emitPayload("rtp", nil, []byte{0x80})
+	}
+	// At most one packet is blocked in the handler and one is queued.
+	suite.GreaterOrEqual(consumer.EventStats().DroppedRtp, uint64(1))
+	close(release)
+
+	suite.Eventually(func() bool {
+		stats := consumer.EventStats()
+		return stats.Rtp+stats.DroppedRtp == 3
+	}, time.Second, 10*time.Millisecond)
+
+	stats := consumer.EventStats()
+	suite.EqualValues(2, stats.Score)
+	suite.EqualValues(0, stats.Layers)
+	suite.EqualValues(1, stats.Trace)
+}
@@ -0,0 +1,86 @@
+package mediasoup
+
+import (
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"fmt"
+	"strings"
+)
+
+// dtlsFingerprintHashes are the hash functions of the fingerprint algorithms supported by
+// mediasoup-worker, by "Hash function Textual Name".
+var dtlsFingerprintHashes = map[string]crypto.Hash{
+	"sha-1":   crypto.SHA1,
+	"sha-224": crypto.SHA224,
+	"sha-256": crypto.SHA256,
+	"sha-384": crypto.SHA384,
+	"sha-512": crypto.SHA512,
+}
+
+// NewDtlsFingerprint returns the fingerprint of the DER encoded certificate (such as the Raw
+// field of a x509.Certificate) of a remote endpoint, computed with the given algorithm: "sha-1",
+// "sha-224", "sha-256", "sha-384" or "sha-512". The value is in uppercase hex, as in SDP.
+func NewDtlsFingerprint(algorithm string, certificate []byte) (DtlsFingerprint, error) {
+	hash, ok := dtlsFingerprintHashes[algorithm]
+	if !ok {
+		return DtlsFingerprint{}, NewTypeError("unsupported DTLS fingerprint algorithm: %q", algorithm)
+	}
+	if len(certificate) == 0 {
+		return DtlsFingerprint{}, NewTypeError("missing DTLS certificate")
+	}
+
+	h := hash.New()
+	h.Write(certificate)
+
+	value := make([]string, 0, hash.Size())
+	for _, b := range h.Sum(nil) {
+		value = append(value, fmt.Sprintf("%02X", b))
+	}
+
+	return DtlsFingerprint{
+		Algorithm: algorithm,
+		Value:     strings.Join(value, ":"),
+	}, nil
+}
+
+// NewDtlsParameters returns the DTLS parameters of a remote endpoint, such as a non-browser
+// WebRTC peer, taking the given role with the certificate, to be given to
+// WebRtcTransport.Connect().
+func NewDtlsParameters(role DtlsRole, algorithm string, certificate []byte) (DtlsParameters, error) {
+	if !role.valid() {
+		return DtlsParameters{}, NewTypeError("invalid DTLS role: %q", role)
+	}
+
+	fingerprint, err := NewDtlsFingerprint(algorithm, certificate)
+	if err != nil {
+		return DtlsParameters{}, err
+	}
+
+	return DtlsParameters{
+		Role:         role,
+		Fingerprints: []DtlsFingerprint{fingerprint},
+	}, nil
+}
+
+func (role DtlsRole) valid() bool {
+	switch role {
+	case DtlsRole_Auto, DtlsRole_Client, DtlsRole_Server:
+		return true
+	default:
+		return false
+	}
+}
+
+// opposite returns the role the other endpoint must take, auto for auto.
+func (role DtlsRole) opposite() DtlsRole {
+	switch role {
+	case DtlsRole_Client:
+		return DtlsRole_Server
+	case DtlsRole_Server:
+		return DtlsRole_Client
+	default:
+		return DtlsRole_Auto
+	}
+}
@@ -0,0 +1,44 @@
+package mediasoup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDtlsFingerprint(t *testing.T) {
+	certificate := []byte("not really a DER certificate")
+
+	fingerprint, err := NewDtlsFingerprint("sha-256", certificate)
+	require.NoError(t, err)
+	assert.Equal(t, DtlsFingerprint{
+		Algorithm: "sha-256",
+		Value:     "8D:BE:48:9B:8D:99:91:83:87:EB:AC:80:15:80:D9:E5:74:E6:73:9E:12:62:C4:28:61:2F:AC:77:F9:F4:AB:64",
+	}, fingerprint)
+
+	for algorithm, size := range map[string]int{"sha-1": 20, "sha-224": 28, "sha-384": 48, "sha-512": 64} {
+		fingerprint, err := NewDtlsFingerprint(algorithm, certificate)
+		require.NoError(t, err)
+		assert.Len(t, fingerprint.Value, 3*size-1, algorithm)
+	}
+
+	_, err = NewDtlsFingerprint("md5", certificate)
+	assert.IsType(t, TypeError{}, err)
+	_, err = NewDtlsFingerprint("sha-256", nil)
+	assert.IsType(t, TypeError{}, err)
+}
+
+func TestNewDtlsParameters(t *testing.T) {
+	params, err := NewDtlsParameters(DtlsRole_Server, "sha-1", []byte{1, 2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, DtlsParameters{
+		Role: DtlsRole_Server,
+		Fingerprints: []DtlsFingerprint{
+			{Algorithm: "sha-1", Value: "70:37:80:71:98:C2:2A:7D:2B:08:07:37:1D:76:37:79:A8:4F:DF:CF"},
+		},
+	}, params)
+
+	_, err = NewDtlsParameters("actpass", "sha-1", []byte{1, 2, 3})
+	assert.IsType(t, TypeError{}, err)
+}
@@ -0,0 +1,135 @@
+package mediasoup
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// DumpDiff returns human-readable differences between two Consumer dumps, such as
+// "RtpStreams[0].Score: 10 -> 7". Nested structures are walked field by field, and nil
+// pointers, missing slice items and missing map keys are reported as "<nil>" or "<none>".
+func DumpDiff(a, b *ConsumerDump) []string {
+	var diffs []string
+
+	if a == nil || b == nil {
+		if a != b {
+			diffs = append(diffs, fmt.Sprintf("ConsumerDump: %s -> %s",
+				formatDiffValue(reflect.ValueOf(a)), formatDiffValue(reflect.ValueOf(b))))
+		}
+		return diffs
+	}
+
+	diffValues("", reflect.ValueOf(*a), reflect.ValueOf(*b), &diffs)
+
+	return diffs
+}
+
+func diffValues(path string, a, b reflect.Value, diffs *[]string) {
+	report := func() {
+		*diffs = append(*diffs, fmt.Sprintf("%s: %s -> %s", path, formatDiffValue(a), formatDiffValue(b)))
+	}
+
+	if !a.IsValid() || !b.IsValid() {
+		if a.IsValid() != b.IsValid() {
+			report()
+		}
+		return
+	}
+	if a.Type() != b.Type() {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			report()
+		}
+		return
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				report()
+			}
+			return
+		}
+		diffValues(path, a.Elem(), b.Elem(), diffs)
+
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+
+			// ignore unexported fields
+			if len(field.PkgPath) > 0 {
+				continue
+			}
+			fieldA, fieldB := a.Field(i), b.Field(i)
+			fieldPath := joinDiffPath(path, field.Name)
+
+			// fields of embedded structs are reported as if they were declared in the
+			// outer struct, unless the embedded pointer itself is added or removed.
+			if field.Anonymous && !(fieldA.Kind() == reflect.Ptr && fieldA.IsNil() != fieldB.IsNil()) {
+				fieldPath = path
+			}
+			diffValues(fieldPath, fieldA, fieldB, diffs)
+		}
+
+	case reflect.Slice, reflect.Array:
+		length := a.Len()
+		if b.Len() > length {
+			length = b.Len()
+		}
+		for i := 0; i < length; i++ {
+			var itemA, itemB reflect.Value
+			if i < a.Len() {
+				itemA = a.Index(i)
+			}
+			if i < b.Len() {
+				itemB = b.Index(i)
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), itemA, itemB, diffs)
+		}
+
+	case reflect.Map:
+		keys := map[string]reflect.Value{}
+		for _, key := range append(a.MapKeys(), b.MapKeys()...) {
+			keys[fmt.Sprint(key.Interface())] = key
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			key := keys[name]
+			diffValues(fmt.Sprintf("%s[%s]", path, name), a.MapIndex(key), b.MapIndex(key), diffs)
+		}
+
+	default:
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			report()
+		}
+	}
+}
+
+func joinDiffPath(path, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return path + "." + name
+}
+
+func formatDiffValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return "<none>"
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return "<nil>"
+		}
+	}
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	return fmt.Sprintf("%+v", v.Interface())
+}
@@ -0,0 +1,50 @@
+package mediasoup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpDiff(t *testing.T) {
+	a := &ConsumerDump{
+		Id:     "c1",
+		Kind:   "video",
+		Paused: false,
+		RtpStreams: []RtpStream{
+			{Params: RtpStreamParams{Ssrc: 1111}, Score: 10},
+		},
+		SimulcastConsumerDump: &SimulcastConsumerDump{
+			CurrentSpatialLayer: 2,
+		},
+	}
+	b := &ConsumerDump{
+		Id:     "c1",
+		Kind:   "video",
+		Paused: true,
+		RtpStreams: []RtpStream{
+			{Params: RtpStreamParams{Ssrc: 1111}, Score: 7, RtxStream: &RtpStream{Score: 10}},
+			{Params: RtpStreamParams{Ssrc: 2222}},
+		},
+		SimulcastConsumerDump: &SimulcastConsumerDump{
+			CurrentSpatialLayer: 0,
+		},
+	}
+
+	assert.Empty(t, DumpDiff(a, a))
+
+	diffs := DumpDiff(a, b)
+
+	assert.Len(t, diffs, 5)
+	assert.Equal(t, "Paused: false -> true", diffs[0])
+	assert.Equal(t, "RtpStreams[0].Score: 10 -> 7", diffs[1])
+	assert.Regexp(t, `^RtpStreams\[0\]\.RtxStream: <nil> -> \{.*Score:10.*\}$`, diffs[2])
+	assert.Regexp(t, `^RtpStreams\[1\]: <none> -> \{Params:\{.*Ssrc:2222.*\}$`, diffs[3])
+	assert.Equal(t, "CurrentSpatialLayer: 2 -> 0", diffs[4])
+
+	b.SimulcastConsumerDump = nil
+
+	assert.Contains(t, DumpDiff(a, b), `SimulcastConsumerDump: {"currentSpatialLayer":2} -> <nil>`)
+	assert.Empty(t, DumpDiff(nil, nil))
+	assert.Len(t, DumpDiff(a, nil), 1)
+}
@@ -1,6 +1,9 @@
 package mediasoup
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"strings"
+)
 
 type WorkerDump struct {
 	Pid             int      `json:"pid,omitempty"`
@@ -81,11 +84,26 @@ type TransportDump struct {
 	*WebRtcTransportDump
 }
 
+// String returns the JSON of the redacted dump, so printing it does not leak secrets.
 func (d TransportDump) String() string {
-	data, _ := json.Marshal(d)
+	data, _ := json.Marshal(d.Redacted())
 	return string(data)
 }
 
+// Redacted returns a copy of the dump with the SRTP keying material, the ICE password and the
+// remote DTLS certificate masked, to be logged safely.
+func (d TransportDump) Redacted() TransportDump {
+	if d.PlainTransportDump != nil {
+		plain := d.PlainTransportDump.Redacted()
+		d.PlainTransportDump = &plain
+	}
+	if d.WebRtcTransportDump != nil {
+		webrtc := d.WebRtcTransportDump.Redacted()
+		d.WebRtcTransportDump = &webrtc
+	}
+	return d
+}
+
 type PlainTransportDump struct {
 	RtcpMux        bool            `json:"rtcpMux,omitempty"`
 	Comedia        bool            `json:"comedia,omitempty"`
@@ -95,12 +113,18 @@ type PlainTransportDump struct {
 }
 
 func (d PlainTransportDump) String() string {
-	data, _ := json.Marshal(d)
+	data, _ := json.Marshal(d.Redacted())
 	return string(data)
 }
 
+// Redacted returns a copy of the dump with the SRTP keying material masked.
+func (d PlainTransportDump) Redacted() PlainTransportDump {
+	d.SrtpParameters = d.SrtpParameters.Redacted()
+	return d
+}
+
 type WebRtcTransportDump struct {
-	IceRole          string          `json:"iceRole,omitempty"`
+	IceRole          IceRole         `json:"iceRole,omitempty"`
 	IceParameters    IceParameters   `json:"iceParameters,omitempty"`
 	IceCandidates    []IceCandidate  `json:"iceCandidates,omitempty"`
 	IceState         IceState        `json:"iceState,omitempty"`
@@ -111,10 +135,25 @@ type WebRtcTransportDump struct {
 }
 
 func (d WebRtcTransportDump) String() string {
-	data, _ := json.Marshal(d)
+	data, _ := json.Marshal(d.Redacted())
 	return string(data)
 }
 
+// Redacted returns a copy of the dump with the ICE password and the remote DTLS certificate
+// masked.
+func (d WebRtcTransportDump) Redacted() WebRtcTransportDump {
+	if len(d.IceParameters.Password) > 0 {
+		d.IceParameters.Password = RedactedValue
+	}
+	if len(d.DtlsRemoteCert) > 0 {
+		d.DtlsRemoteCert = RedactedValue
+	}
+	return d
+}
+
+// ConsumerDump is the dump of a Consumer by mediasoup-worker. Simple and SVC Consumers dump their
+// stream in RtpStream, pipe Consumers dump theirs in RtpStreams, and simulcast and SVC Consumers
+// dump their layers in SimulcastConsumerDump.
 type ConsumerDump struct {
 	Id                         string               `json:"id,omitempty"`
 	ProducerId                 string               `json:"producerId,omitempty"`
@@ -137,6 +176,39 @@ func (d ConsumerDump) String() string {
 	return string(data)
 }
 
+// Streams returns the RTP streams of the Consumer, whatever its type.
+func (d ConsumerDump) Streams() []RtpStream {
+	if d.RtpStream != nil {
+		return append([]RtpStream{*d.RtpStream}, d.RtpStreams...)
+	}
+	return d.RtpStreams
+}
+
+// EnabledTraceEventTypes returns the trace event types enabled on the Consumer, parsed from
+// TraceEventTypes which mediasoup-worker dumps as a comma separated string. Unlike
+// Consumer.TraceEventTypes(), it does not include the types unknown to the worker.
+func (d ConsumerDump) EnabledTraceEventTypes() []ConsumerTraceEventType {
+	var types []ConsumerTraceEventType
+	for _, typ := range strings.Split(d.TraceEventTypes, ",") {
+		if typ = strings.TrimSpace(typ); len(typ) > 0 {
+			types = append(types, ConsumerTraceEventType(typ))
+		}
+	}
+	return types
+}
+
+// CurrentLayers returns the layers currently sent by a simulcast or SVC Consumer, nil if none.
+func (d ConsumerDump) CurrentLayers() *ConsumerLayers {
+	if d.SimulcastConsumerDump == nil || d.CurrentSpatialLayer < 0 || d.CurrentTemporalLayer < 0 {
+		return nil
+	}
+	return &ConsumerLayers{
+		SpatialLayer:  uint8(d.CurrentSpatialLayer),
+		TemporalLayer: uint8(d.CurrentTemporalLayer),
+	}
+}
+
+// RtpStream is the dump of a RTP stream, its Score being from 0 to 10.
 type RtpStream struct {
 	Params    RtpStreamParams `json:"params,omitempty"`
 	Score     uint8           `json:"score,omitempty"`
@@ -163,6 +235,7 @@ type RtpStreamParams struct {
 	TemporalLayers uint8  `json:"temporalLayers,omitempty"`
 }
 
+// SimulcastConsumerDump holds the layers of a simulcast or SVC Consumer, -1 meaning none.
 type SimulcastConsumerDump struct {
 	PreferredSpatialLayer  int16 `json:"preferredSpatialLayer,omitempty"`
 	TargetSpatialLayer     int16 `json:"targetSpatialLayer,omitempty"`
@@ -0,0 +1,108 @@
+package mediasoup
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerDumpUnmarshal(t *testing.T) {
+	fixture := `{
+		"id": "consumer-id",
+		"producerId": "producer-id",
+		"kind": "video",
+		"type": "simulcast",
+		"rtpParameters": {
+			"codecs": [{"mimeType": "video/VP8", "payloadType": 101, "clockRate": 90000}],
+			"encodings": [{"ssrc": 1111, "rtx": {"ssrc": 1112}, "scalabilityMode": "S3T3"}]
+		},
+		"consumableRtpEncodings": [{"ssrc": 2221}, {"ssrc": 2222}, {"ssrc": 2223}],
+		"supportedCodecPayloadTypes": [101],
+		"traceEventTypes": "keyframe,rtp",
+		"paused": false,
+		"producerPaused": false,
+		"priority": 1,
+		"rtpStream": {
+			"params": {
+				"encodingIdx": 0,
+				"ssrc": 1111,
+				"payloadType": 101,
+				"mimeType": "video/VP8",
+				"clockRate": 90000,
+				"cname": "video-1",
+				"rtxSsrc": 1112,
+				"rtxPayloadType": 102,
+				"useNack": true,
+				"usePli": true,
+				"spatialLayers": 3,
+				"temporalLayers": 3
+			},
+			"score": 8,
+			"rtxStream": {
+				"params": {"ssrc": 1112, "payloadType": 102, "mimeType": "video/rtx", "clockRate": 90000},
+				"score": 10
+			}
+		},
+		"preferredSpatialLayer": 2,
+		"targetSpatialLayer": 1,
+		"currentSpatialLayer": 1,
+		"preferredTemporalLayer": 2,
+		"targetTemporalLayer": 2,
+		"currentTemporalLayer": 0
+	}`
+
+	var dump ConsumerDump
+	require.NoError(t, json.Unmarshal([]byte(fixture), &dump))
+
+	assert.Equal(t, "consumer-id", dump.Id)
+	assert.Equal(t, "simulcast", dump.Type)
+	assert.EqualValues(t, 1, dump.Priority)
+	assert.Len(t, dump.ConsumableRtpEncodings, 3)
+	assert.Equal(t, []ConsumerTraceEventType{ConsumerTraceEventType_Keyframe, ConsumerTraceEventType_Rtp},
+		dump.EnabledTraceEventTypes())
+
+	streams := dump.Streams()
+	require.Len(t, streams, 1)
+	assert.EqualValues(t, 1111, streams[0].Params.Ssrc)
+	assert.EqualValues(t, 8, streams[0].Score)
+	assert.True(t, streams[0].Params.UseNack)
+	assert.EqualValues(t, 3, streams[0].Params.SpatialLayers)
+	require.NotNil(t, streams[0].RtxStream)
+	assert.EqualValues(t, 10, streams[0].RtxStream.Score)
+
+	require.NotNil(t, dump.SimulcastConsumerDump)
+	assert.EqualValues(t, 2, dump.PreferredSpatialLayer)
+	assert.EqualValues(t, 1, dump.TargetSpatialLayer)
+	assert.Equal(t, &ConsumerLayers{SpatialLayer: 1, TemporalLayer: 0}, dump.CurrentLayers())
+
+	dump.CurrentSpatialLayer = -1
+	assert.Nil(t, dump.CurrentLayers())
+}
+
+func TestPipeConsumerDumpUnmarshal(t *testing.T) {
+	fixture := `{
+		"id": "consumer-id",
+		"kind": "video",
+		"type": "pipe",
+		"traceEventTypes": "",
+		"rtpStreams": [
+			{"params": {"encodingIdx": 0, "ssrc": 1111}, "score": 10},
+			{"params": {"encodingIdx": 1, "ssrc": 2222}, "score": 9}
+		]
+	}`
+
+	var dump ConsumerDump
+	require.NoError(t, json.Unmarshal([]byte(fixture), &dump))
+
+	assert.Empty(t, dump.EnabledTraceEventTypes())
+	assert.Nil(t, dump.SimulcastConsumerDump)
+	assert.Nil(t, dump.CurrentLayers())
+
+	streams := dump.Streams()
+	require.Len(t, streams, 2)
+	assert.EqualValues(t, 1, streams[1].Params.EncodingIdx)
+	assert.EqualValues(t, 2222, streams[1].Params.Ssrc)
+	assert.EqualValues(t, 9, streams[1].Score)
+}
@@ -1,6 +1,7 @@
 package mediasoup
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -18,16 +19,24 @@ func (e TypeError) Error() string {
 	return e.err.Error()
 }
 
+func (e TypeError) Unwrap() error {
+	return errors.Unwrap(e.err)
+}
+
 // UnsupportedError indicating not support for something.
 type UnsupportedError struct {
 	name    string
 	message string
+	err     error // Error wrapped with %w, if any.
 }
 
 func NewUnsupportedError(format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+
 	return UnsupportedError{
 		name:    "UnsupportedError",
-		message: fmt.Sprintf(format, args...),
+		message: err.Error(),
+		err:     errors.Unwrap(err),
 	}
 }
 
@@ -35,6 +44,10 @@ func (e UnsupportedError) Error() string {
 	return fmt.Sprintf("%s:%s", e.name, e.message)
 }
 
+func (e UnsupportedError) Unwrap() error {
+	return e.err
+}
+
 // InvalidStateError produced when calling a method in an invalid state.
 type InvalidStateError struct {
 	name    string
@@ -1,10 +1,12 @@
 package mediasoup
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
 
 	"github.com/go-logr/logr"
 )
@@ -66,6 +68,26 @@ func (e *EventEmitter) On(event string, listener interface{}) {
 	e.listeners[event] = append(e.listeners[event], newInternalListener(listener, false))
 }
 
+// Listen is like On, but returns a function removing this very listener, even if the same
+// function was added several times or shares its code with other closures, which Off can not tell
+// apart. The listener is not called anymore once remove returns, unless a call is already in
+// progress. Calling remove several times is harmless.
+func (e *EventEmitter) Listen(event string, listener interface{}) (remove func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.listeners == nil {
+		e.listeners = make(map[string][]*intervalListener)
+	}
+	l := newInternalListener(listener, false)
+	e.listeners[event] = append(e.listeners[event], l)
+
+	return func() {
+		l.remove()
+		e.removeListener(event, l)
+	}
+}
+
 func (e *EventEmitter) Once(event string, listener interface{}) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -87,7 +109,7 @@ func (e *EventEmitter) Emit(event string, args ...interface{}) bool {
 
 	for _, listener := range listeners {
 		if listener.once != nil {
-			e.Off(event, listener.listenerValue.Interface())
+			e.removeListener(event, listener)
 		}
 		// may panic
 		listener.Call(args...)
@@ -96,6 +118,41 @@ func (e *EventEmitter) Emit(event string, args ...interface{}) bool {
 }
 
 func (e *EventEmitter) SafeEmit(event string, args ...interface{}) bool {
+	return e.safeEmit(nil, event, args...)
+}
+
+// SafeEmitCtx is like SafeEmit, but listeners whose first parameter is a context.Context are called
+// with ctx prepended to the arguments, so they can continue a tracing span.
+func (e *EventEmitter) SafeEmitCtx(ctx context.Context, event string, args ...interface{}) bool {
+	return e.safeEmit(ctx, event, args...)
+}
+
+// listen calls Listen() on the emitter if it is an *EventEmitter, else the listener is added with
+// On() and removed with Off().
+func listen(emitter IEventEmitter, event string, listener interface{}) (remove func()) {
+	if e, ok := emitter.(interface {
+		Listen(string, interface{}) func()
+	}); ok {
+		return e.Listen(event, listener)
+	}
+
+	emitter.On(event, listener)
+	return func() {
+		emitter.Off(event, listener)
+	}
+}
+
+// safeEmitCtx calls SafeEmitCtx() on the emitter if it is an *EventEmitter, SafeEmit() otherwise.
+func safeEmitCtx(emitter IEventEmitter, ctx context.Context, event string, args ...interface{}) bool {
+	if e, ok := emitter.(interface {
+		SafeEmitCtx(context.Context, string, ...interface{}) bool
+	}); ok {
+		return e.SafeEmitCtx(ctx, event, args...)
+	}
+	return emitter.SafeEmit(event, args...)
+}
+
+func (e *EventEmitter) safeEmit(ctx context.Context, event string, args ...interface{}) bool {
 	e.mu.Lock()
 	if e.listeners == nil {
 		e.mu.Unlock()
@@ -111,12 +168,16 @@ func (e *EventEmitter) SafeEmit(event string, args ...interface{}) bool {
 			}
 		}()
 		// may panic
-		listener.Call(args...)
+		if ctx != nil && listener.acceptsContext() {
+			listener.Call(append([]interface{}{ctx}, args...)...)
+		} else {
+			listener.Call(args...)
+		}
 	}
 
 	for _, listener := range listeners {
 		if listener.once != nil {
-			e.Off(event, listener.listenerValue.Interface())
+			e.removeListener(event, listener)
 		}
 		call(listener)
 	}
@@ -135,12 +196,36 @@ func (e *EventEmitter) Off(event string, listener interface{}) {
 
 	for i, internalListener := range listeners {
 		if internalListener.listenerValue.Pointer() == handlerPtr {
-			e.listeners[event] = append(listeners[0:i], listeners[i+1:]...)
+			internalListener.remove()
+			e.listeners[event] = removeListenerAt(listeners, i)
 			break
 		}
 	}
 }
 
+// removeListener removes the listener l of the event.
+func (e *EventEmitter) removeListener(event string, l *intervalListener) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	listeners := e.listeners[event]
+
+	for i, internalListener := range listeners {
+		if internalListener == l {
+			e.listeners[event] = removeListenerAt(listeners, i)
+			break
+		}
+	}
+}
+
+// removeListenerAt returns a copy of listeners without the one at index i, leaving listeners
+// unchanged since it may be iterated by an emit in progress.
+func removeListenerAt(listeners []*intervalListener, i int) []*intervalListener {
+	result := make([]*intervalListener, 0, len(listeners)-1)
+	result = append(result, listeners[:i]...)
+	return append(result, listeners[i+1:]...)
+}
+
 func (e *EventEmitter) RemoveAllListeners(events ...string) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -174,6 +259,7 @@ type intervalListener struct {
 	listenerValue reflect.Value
 	argTypes      []reflect.Type
 	once          *sync.Once
+	removed       uint32
 }
 
 func newInternalListener(listener interface{}, once bool) *intervalListener {
@@ -196,7 +282,23 @@ func newInternalListener(listener interface{}, once bool) *intervalListener {
 	return l
 }
 
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// acceptsContext returns whether the first parameter of the listener is a context.Context.
+func (l *intervalListener) acceptsContext() bool {
+	return len(l.argTypes) > 0 && l.argTypes[0] == contextType
+}
+
+// remove marks the listener as removed, so an emit in progress does not call it anymore.
+func (l *intervalListener) remove() {
+	atomic.StoreUint32(&l.removed, 1)
+}
+
 func (l *intervalListener) Call(args ...interface{}) {
+	if atomic.LoadUint32(&l.removed) > 0 {
+		return
+	}
+
 	call := func() {
 		argValues := make([]reflect.Value, len(args))
 		for i, arg := range args {
@@ -218,7 +320,7 @@ func (l *intervalListener) Call(args ...interface{}) {
 	}
 }
 
-func (l intervalListener) convertArguments(args []reflect.Value) []reflect.Value {
+func (l *intervalListener) convertArguments(args []reflect.Value) []reflect.Value {
 	if len(args) != len(l.argTypes) {
 		return args
 	}
@@ -242,7 +344,7 @@ func (l intervalListener) convertArguments(args []reflect.Value) []reflect.Value
 	return actualArgs
 }
 
-func (l intervalListener) alignArguments(args []reflect.Value) (actualArgs []reflect.Value) {
+func (l *intervalListener) alignArguments(args []reflect.Value) (actualArgs []reflect.Value) {
 	// delete unwanted arguments
 	if argLen := len(l.argTypes); len(args) >= argLen {
 		actualArgs = args[0:argLen]
@@ -1,7 +1,9 @@
 package mediasoup
 
 import (
+	"context"
 	"encoding/json"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -70,3 +72,95 @@ func TestEventEmitter(t *testing.T) {
 	emitter.RemoveAllListeners()
 	assert.Equal(t, 0, emitter.ListenerCount())
 }
+
+func TestEventEmitterSafeEmitCtx(t *testing.T) {
+	type ctxKey struct{}
+
+	emitter := NewEventEmitter().(*EventEmitter)
+	ctx := context.WithValue(context.Background(), ctxKey{}, "span")
+
+	var values []interface{}
+
+	emitter.On("event", func(ctx context.Context, i int) {
+		values = append(values, ctx.Value(ctxKey{}), i)
+	})
+	emitter.On("event", func(i int) {
+		values = append(values, i)
+	})
+
+	emitter.SafeEmitCtx(ctx, "event", 1)
+	assert.Equal(t, []interface{}{"span", 1, 1}, values)
+
+	// SafeEmit and Emit pass the arguments as is.
+	values = nil
+	emitter.On("event2", func(ctx context.Context, i int) {
+		values = append(values, ctx.Value(ctxKey{}), i)
+	})
+	emitter.SafeEmit("event2", ctx, 2)
+	emitter.Emit("event2", ctx, 3)
+	assert.Equal(t, []interface{}{"span", 2, "span", 3}, values)
+}
+
+func TestEventEmitterListen(t *testing.T) {
+	emitter := NewEventEmitter().(*EventEmitter)
+
+	var calls []string
+	newListener := func(name string) func() {
+		return func() {
+			calls = append(calls, name)
+		}
+	}
+
+	// The closures share their code, so Off can not tell them apart.
+	removeRecorder := emitter.Listen("rtp", newListener("recorder"))
+	emitter.Listen("rtp", newListener("forwarder"))
+
+	emitter.Emit("rtp")
+	assert.Equal(t, []string{"recorder", "forwarder"}, calls)
+
+	calls = nil
+	removeRecorder()
+	removeRecorder()
+	emitter.SafeEmit("rtp")
+	assert.Equal(t, []string{"forwarder"}, calls)
+	assert.Equal(t, 1, emitter.ListenerCount("rtp"))
+
+	// A listener removed by a previous listener of the same emit is not called.
+	var removeSecond func()
+	calls = nil
+	emitter.Listen("event", func() {
+		calls = append(calls, "first")
+		removeSecond()
+	})
+	removeSecond = emitter.Listen("event", newListener("second"))
+	emitter.Emit("event")
+	assert.Equal(t, []string{"first"}, calls)
+}
+
+func TestEventEmitterListenConcurrentRemove(t *testing.T) {
+	emitter := NewEventEmitter().(*EventEmitter)
+
+	var called, kept uint32
+	remove := emitter.Listen("event", func() {
+		atomic.AddUint32(&called, 1)
+	})
+	emitter.Listen("event", func() {
+		atomic.AddUint32(&kept, 1)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			emitter.SafeEmit("event")
+		}
+	}()
+
+	remove()
+	calledAfterRemove := atomic.LoadUint32(&called)
+	<-done
+
+	// Only a call in progress when remove returned may have completed after it.
+	assert.LessOrEqual(t, atomic.LoadUint32(&called), calledAfterRemove+1)
+	assert.EqualValues(t, 1000, atomic.LoadUint32(&kept))
+}
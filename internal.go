@@ -3,6 +3,7 @@ package mediasoup
 import (
 	"encoding/json"
 	"strings"
+	"time"
 )
 
 type internalData struct {
@@ -47,6 +48,37 @@ func (i internalData) HandlerID(method string) string {
 	}
 }
 
+// RequestMetrics is called after each Channel and PayloadChannel request completes, with the
+// request method, the id of the target entity ("" for worker requests), the time spent waiting
+// for the response and the resulting error. It is called without holding any lock, and must be
+// set before creating workers.
+var RequestMetrics func(method, entityId string, dur time.Duration, err error)
+
+// reportRequestMetrics calls RequestMetrics, if set, for a request started at start.
+func reportRequestMetrics(method string, internal internalData, start time.Time, err error) {
+	hook := RequestMetrics
+	if hook == nil {
+		return
+	}
+	entityId := internal.HandlerID(method)
+	if entityId == "undefined" {
+		entityId = ""
+	}
+	hook(method, entityId, time.Since(start), err)
+}
+
+// DeprecatedUsage is called each time the application uses a deprecated API, such as
+// Consumer.Observer(), with its name. Set it to log or panic in order to find the remaining usages
+// before migrating. It must be set before creating workers.
+var DeprecatedUsage func(api string)
+
+// reportDeprecatedUsage calls DeprecatedUsage, if set.
+func reportDeprecatedUsage(api string) {
+	if hook := DeprecatedUsage; hook != nil {
+		hook(api)
+	}
+}
+
 const (
 	NS_MESSAGE_MAX_LEN = 4194308
 	NS_PAYLOAD_MAX_LEN = 4194304
@@ -92,6 +124,18 @@ type sentInfo struct {
 	respCh  chan workerResponse // channel to hold response
 }
 
+// newSentInfo returns the sentInfo of a request. The response channel is buffered so that the
+// read and write loops never block on a requester which stopped waiting, e.g. because its
+// context is done, between receiving the response and removing the request.
+func newSentInfo(method string, request, payload []byte) sentInfo {
+	return sentInfo{
+		method:  method,
+		request: request,
+		payload: payload,
+		respCh:  make(chan workerResponse, 1),
+	}
+}
+
 // workerNotification is the notification meta info sent to worker
 type workerNotification struct {
 	Event    string       `json:"event,omitempty"`
@@ -0,0 +1,79 @@
+package mediasoup
+
+import (
+	"sync"
+	"time"
+)
+
+// layersCoalescer coalesces layers events, calling handler with the latest layers once the window
+// started by the first pending layers elapsed.
+type layersCoalescer struct {
+	locker     sync.Mutex
+	window     time.Duration
+	handler    func(*ConsumerLayers)
+	timer      *time.Timer
+	pending    *ConsumerLayers // nil layers are valid, hence hasPending.
+	hasPending bool
+	closed     bool
+}
+
+func newLayersCoalescer(window time.Duration, handler func(*ConsumerLayers)) *layersCoalescer {
+	return &layersCoalescer{
+		window:  window,
+		handler: handler,
+	}
+}
+
+// push keeps the layers and schedules a call at the end of the window if none is scheduled.
+func (c *layersCoalescer) push(layers *ConsumerLayers) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	c.pending, c.hasPending = layers, true
+
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.window, c.flush)
+	}
+}
+
+func (c *layersCoalescer) flush() {
+	c.locker.Lock()
+
+	layers, hasPending := c.pending, c.hasPending
+	c.pending, c.hasPending = nil, false
+	c.timer = nil
+
+	c.locker.Unlock()
+
+	if hasPending {
+		c.handler(layers)
+	}
+}
+
+// close stops the timer and calls handler with the pending layers, if any.
+func (c *layersCoalescer) close() {
+	c.locker.Lock()
+
+	if c.closed {
+		c.locker.Unlock()
+		return
+	}
+	c.closed = true
+
+	layers, hasPending := c.pending, c.hasPending
+	c.pending, c.hasPending = nil, false
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+
+	c.locker.Unlock()
+
+	if hasPending {
+		c.handler(layers)
+	}
+}
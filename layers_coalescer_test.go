@@ -0,0 +1,55 @@
+package mediasoup
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayersCoalescer(t *testing.T) {
+	var (
+		locker sync.Mutex
+		called []*ConsumerLayers
+	)
+	calledLayers := func() []*ConsumerLayers {
+		locker.Lock()
+		defer locker.Unlock()
+		return append([]*ConsumerLayers{}, called...)
+	}
+
+	coalescer := newLayersCoalescer(30*time.Millisecond, func(layers *ConsumerLayers) {
+		locker.Lock()
+		defer locker.Unlock()
+		called = append(called, layers)
+	})
+
+	// Rapid changes are coalesced to the last one at the end of the window.
+	coalescer.push(&ConsumerLayers{SpatialLayer: 0})
+	coalescer.push(&ConsumerLayers{SpatialLayer: 1})
+	coalescer.push(&ConsumerLayers{SpatialLayer: 2})
+	assert.Empty(t, calledLayers())
+
+	assert.Eventually(t, func() bool {
+		return len(calledLayers()) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []*ConsumerLayers{{SpatialLayer: 2}}, calledLayers())
+
+	// nil layers are delivered too.
+	coalescer.push(&ConsumerLayers{SpatialLayer: 1})
+	coalescer.push(nil)
+	assert.Eventually(t, func() bool {
+		return len(calledLayers()) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Nil(t, calledLayers()[1])
+
+	// The pending layers are flushed on close.
+	coalescer.push(&ConsumerLayers{SpatialLayer: 0, TemporalLayer: 1})
+	coalescer.close()
+	assert.Equal(t, &ConsumerLayers{SpatialLayer: 0, TemporalLayer: 1}, calledLayers()[2])
+
+	coalescer.push(&ConsumerLayers{SpatialLayer: 2})
+	time.Sleep(40 * time.Millisecond)
+	assert.Len(t, calledLayers(), 3)
+}
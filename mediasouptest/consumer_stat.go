@@ -0,0 +1,93 @@
+// Package mediasouptest provides utilities for testing applications built on mediasoup-go.
+package mediasouptest
+
+import (
+	"time"
+
+	"github.com/anjingxw/mediasoup-go"
+)
+
+// ConsumerStatBuilder builds fake mediasoup.ConsumerStat values with realistic defaults.
+type ConsumerStatBuilder struct {
+	stat mediasoup.ConsumerStat
+}
+
+// NewConsumerStat returns a builder of an "outbound-rtp" video stat with a full score.
+func NewConsumerStat() *ConsumerStatBuilder {
+	return &ConsumerStatBuilder{
+		stat: mediasoup.ConsumerStat{
+			Type:      string(mediasoup.StatType_OutboundRtp),
+			Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+			Ssrc:      11111111,
+			Kind:      string(mediasoup.MediaKind_Video),
+			MimeType:  "video/VP8",
+			Score:     10,
+		},
+	}
+}
+
+// WithType sets the stat type.
+func (b *ConsumerStatBuilder) WithType(typ mediasoup.StatType) *ConsumerStatBuilder {
+	b.stat.Type = string(typ)
+	return b
+}
+
+// WithKind sets the media kind and mime type.
+func (b *ConsumerStatBuilder) WithKind(kind mediasoup.MediaKind, mimeType string) *ConsumerStatBuilder {
+	b.stat.Kind = string(kind)
+	b.stat.MimeType = mimeType
+	return b
+}
+
+// WithSsrc sets the SSRC and RTX SSRC.
+func (b *ConsumerStatBuilder) WithSsrc(ssrc, rtxSsrc uint32) *ConsumerStatBuilder {
+	b.stat.Ssrc = ssrc
+	b.stat.RtxSsrc = rtxSsrc
+	return b
+}
+
+// WithBitrate sets the bitrate in bps.
+func (b *ConsumerStatBuilder) WithBitrate(bitrate uint32) *ConsumerStatBuilder {
+	b.stat.Bitrate = bitrate
+	return b
+}
+
+// WithPacketCount sets the packet and byte counts.
+func (b *ConsumerStatBuilder) WithPacketCount(packetCount, byteCount int64) *ConsumerStatBuilder {
+	b.stat.PacketCount = packetCount
+	b.stat.ByteCount = byteCount
+	return b
+}
+
+// WithPacketLoss sets the lost packets and the fraction lost (0-255, as in RTCP reports).
+func (b *ConsumerStatBuilder) WithPacketLoss(packetsLost, fractionLost uint32) *ConsumerStatBuilder {
+	b.stat.PacketsLost = packetsLost
+	b.stat.FractionLost = fractionLost
+	return b
+}
+
+// WithScore sets the score (0-10).
+func (b *ConsumerStatBuilder) WithScore(score uint32) *ConsumerStatBuilder {
+	b.stat.Score = score
+	return b
+}
+
+// WithRoundTripTime sets the round trip time in milliseconds.
+func (b *ConsumerStatBuilder) WithRoundTripTime(rtt float32) *ConsumerStatBuilder {
+	b.stat.RoundTripTime = rtt
+	return b
+}
+
+// WithFeedback sets the NACK, PLI and FIR counts.
+func (b *ConsumerStatBuilder) WithFeedback(nackCount, pliCount, firCount uint32) *ConsumerStatBuilder {
+	b.stat.NackCount = nackCount
+	b.stat.PliCount = pliCount
+	b.stat.FirCount = firCount
+	return b
+}
+
+// Build returns the stat.
+func (b *ConsumerStatBuilder) Build() *mediasoup.ConsumerStat {
+	stat := b.stat
+	return &stat
+}
@@ -0,0 +1,53 @@
+package mediasouptest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/anjingxw/mediasoup-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerStatBuilder(t *testing.T) {
+	stat := NewConsumerStat().
+		WithKind(mediasoup.MediaKind_Audio, "audio/opus").
+		WithBitrate(64000).
+		WithPacketLoss(3, 12).
+		WithPacketCount(0, 0).
+		Build()
+
+	assert.Equal(t, mediasoup.StatType_OutboundRtp, stat.StatType())
+	assert.Equal(t, mediasoup.MediaKind_Audio, stat.MediaKind())
+	assert.Equal(t, "audio/opus", stat.MimeType)
+	assert.EqualValues(t, 64000, stat.Bitrate)
+	assert.EqualValues(t, 3, stat.PacketsLost)
+	assert.EqualValues(t, 12, stat.FractionLost)
+	assert.EqualValues(t, 10, stat.Score)
+}
+
+func TestConsumerStatJsonRoundTrip(t *testing.T) {
+	stat := NewConsumerStat().
+		WithSsrc(1234, 5678).
+		WithBitrate(1000000).
+		WithPacketCount(0, 0).
+		WithScore(0).
+		WithRoundTripTime(12.5).
+		WithFeedback(1, 2, 3).
+		Build()
+
+	data, err := json.Marshal(stat)
+	require.NoError(t, err)
+
+	var raw map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &raw))
+
+	// Zero counters are kept.
+	assert.Contains(t, raw, "packetCount")
+	assert.Contains(t, raw, "score")
+	assert.Contains(t, raw, "packetsLost")
+
+	var decoded *mediasoup.ConsumerStat
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, stat, decoded)
+}
@@ -1,10 +1,16 @@
 package mediasoup
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/anjingxw/mediasoup-go/netcodec"
 	"github.com/stretchr/testify/require"
 )
 
@@ -166,3 +172,115 @@ func (w *asyncResult) mayWait() {
 
 	w.waited = true
 }
+
+// fakeWorkerRequest is a request received by the fake mediasoup-worker of newFakeWorkerChannel().
+type fakeWorkerRequest struct {
+	method    string
+	handlerId string
+	data      string
+	worker    netcodec.Codec
+}
+
+// notify sends a notification of the fake worker, before the response to the request.
+func (r fakeWorkerRequest) notify(targetId, event, data string) {
+	if len(data) > 0 {
+		data = `,"data":` + data
+	}
+	r.worker.WritePayload([]byte(fmt.Sprintf(`{"targetId":%q,"event":%q%s}`, targetId, event, data)))
+}
+
+// errFakeWorkerNoResponse is returned by the respond function of newFakeWorkerChannel() to leave a
+// request unanswered, as a hung worker would.
+var errFakeWorkerNoResponse = errors.New("no response")
+
+// newFakeWorkerChannel returns a started Channel whose requests are answered in order by a fake
+// mediasoup-worker: respond returns the data of the response, if any, or the error to reject the
+// request with. A nil respond accepts every request. The Channel is closed at the end of the test.
+func newFakeWorkerChannel(t *testing.T, respond func(req fakeWorkerRequest) (string, error)) *Channel {
+	channelReader, workerWriter := io.Pipe()
+	workerReader, channelWriter := io.Pipe()
+
+	worker := netcodec.NewNetLVCodec(workerWriter, workerReader)
+	channel := newChannel(netcodec.NewNetLVCodec(channelWriter, channelReader), NewJsonChannelCodec(true), 0, true)
+	channel.Start()
+	t.Cleanup(func() {
+		channel.Close()
+		worker.Close()
+	})
+
+	go func() {
+		for {
+			payload, err := worker.ReadPayload()
+			if err != nil {
+				return
+			}
+			parts := strings.SplitN(string(payload), ":", 4)
+			for len(parts) < 4 {
+				parts = append(parts, "")
+			}
+			var data string
+			if respond != nil {
+				data, err = respond(fakeWorkerRequest{
+					method:    parts[1],
+					handlerId: parts[2],
+					data:      parts[3],
+					worker:    worker,
+				})
+			}
+			switch {
+			case err == errFakeWorkerNoResponse:
+			case err != nil:
+				worker.WritePayload([]byte(fmt.Sprintf(`{"id":%s,"error":"Error","reason":%q}`, parts[0], err.Error())))
+			case len(data) > 0:
+				worker.WritePayload([]byte(fmt.Sprintf(`{"id":%s,"accepted":true,"data":%s}`, parts[0], data)))
+			default:
+				worker.WritePayload([]byte(fmt.Sprintf(`{"id":%s,"accepted":true}`, parts[0])))
+			}
+		}
+	}()
+
+	return channel
+}
+
+// newFakePayloadChannel returns a started PayloadChannel and the codec of its fake
+// mediasoup-worker end, to write notifications with. What is sent to the worker is discarded. The
+// PayloadChannel is closed at the end of the test.
+func newFakePayloadChannel(t *testing.T) (*PayloadChannel, netcodec.Codec) {
+	channelReader, workerWriter := io.Pipe()
+	workerReader, channelWriter := io.Pipe()
+
+	worker := netcodec.NewNetLVCodec(workerWriter, workerReader)
+	payloadChannel := newPayloadChannel(netcodec.NewNetLVCodec(channelWriter, channelReader), true)
+	payloadChannel.Start()
+	t.Cleanup(func() {
+		payloadChannel.Close()
+		worker.Close()
+	})
+
+	go func() {
+		for {
+			if _, err := worker.ReadPayload(); err != nil {
+				return
+			}
+		}
+	}()
+
+	return payloadChannel, worker
+}
+
+// newFakeConsumer returns a Consumer of id "consumer" using the given channels, without handling
+// their notifications. Its context is canceled at the end of the test.
+func newFakeConsumer(t *testing.T, channel *Channel, payloadChannel *PayloadChannel) *Consumer {
+	consumer := &Consumer{
+		IEventEmitter:  NewEventEmitter(),
+		logger:         NewLogger("Consumer"),
+		internal:       internalData{ConsumerId: "consumer"},
+		channel:        channel,
+		payloadChannel: payloadChannel,
+		observer:       NewEventEmitter(),
+	}
+	consumer.ctx, consumer.cancel = context.WithCancel(context.Background())
+	t.Cleanup(consumer.cancel)
+
+	return consumer
+}
@@ -562,6 +562,29 @@ func canConsume(consumableParams RtpParameters, caps RtpCapabilities) (ok bool,
 	return true, nil
 }
 
+// describeMediaCodecs returns the mime type, clock rate, channels and H264 profile of the media
+// codecs, for error messages.
+func describeMediaCodecs(codecs []*RtpCodecParameters) []string {
+	descriptions := make([]string, 0, len(codecs))
+
+	for _, codec := range codecs {
+		if codec.isRtxCodec() {
+			continue
+		}
+		description := fmt.Sprintf("%s/%d", codec.MimeType, codec.ClockRate)
+		if codec.Channels > 1 {
+			description += fmt.Sprintf("/%d", codec.Channels)
+		}
+		if len(codec.Parameters.ProfileLevelId) > 0 {
+			description += fmt.Sprintf(" profile-level-id=%s packetization-mode=%d",
+				codec.Parameters.ProfileLevelId, codec.Parameters.PacketizationMode)
+		}
+		descriptions = append(descriptions, description)
+	}
+
+	return descriptions
+}
+
 // getConsumerRtpParameters generate RTP parameters for a specific Consumer.
 //
 // It reduces encodings to just one and takes into account given RTP capabilities
@@ -613,7 +636,8 @@ func getConsumerRtpParameters(consumableParams RtpParameters, caps RtpCapabiliti
 
 	// Ensure there is at least one media codec.
 	if len(consumerParams.Codecs) == 0 || consumerParams.Codecs[0].isRtxCodec() {
-		err = NewUnsupportedError("no compatible media codecs")
+		err = NewUnsupportedError("%w: no compatible media codecs, producer codecs [%s] not in rtpCapabilities",
+			ErrCannotConsume, strings.Join(describeMediaCodecs(consumableParams.Codecs), ", "))
 		return
 	}
 
@@ -740,6 +764,44 @@ func getConsumerRtpParameters(consumableParams RtpParameters, caps RtpCapabiliti
 	return
 }
 
+// forceConsumerCodec keeps the forced media codec, and its RTX codec, as the only codecs of the
+// consumer RTP parameters. RTX is removed from the encodings if the forced codec has no RTX codec.
+func forceConsumerCodec(consumerParams *RtpParameters, forced ForcedCodec) error {
+	var mediaCodec *RtpCodecParameters
+
+	for _, codec := range consumerParams.Codecs {
+		if codec.isRtxCodec() || !strings.EqualFold(codec.MimeType, forced.MimeType) {
+			continue
+		}
+		if forced.PayloadType == 0 || codec.PayloadType == forced.PayloadType {
+			mediaCodec = codec
+			break
+		}
+	}
+	if mediaCodec == nil {
+		return NewUnsupportedError("%w: %s (payloadType %d) not in consumer codecs [%s]",
+			ErrCodecNotConsumable, forced.MimeType, forced.PayloadType,
+			strings.Join(describeMediaCodecs(consumerParams.Codecs), ", "))
+	}
+
+	codecs := []*RtpCodecParameters{mediaCodec}
+
+	for _, codec := range consumerParams.Codecs {
+		if codec.isRtxCodec() && codec.Parameters.Apt == mediaCodec.PayloadType {
+			codecs = append(codecs, codec)
+			break
+		}
+	}
+	if len(codecs) == 1 {
+		for i := range consumerParams.Encodings {
+			consumerParams.Encodings[i].Rtx = nil
+		}
+	}
+	consumerParams.Codecs = codecs
+
+	return nil
+}
+
 // getPipeConsumerRtpParameters generate RTP parameters for a pipe Consumer.
 //
 // It keeps all original consumable encodings and removes support for BWE. If
@@ -32,6 +32,7 @@ type PayloadChannel struct {
 	closeCh             chan struct{}
 	useHandlerID        bool
 	subscribers         sync.Map
+	requestTimeout      time.Duration
 }
 
 func newPayloadChannel(codec netcodec.Codec, useHandlerID bool) *PayloadChannel {
@@ -40,11 +41,12 @@ func newPayloadChannel(codec netcodec.Codec, useHandlerID bool) *PayloadChannel
 	logger.V(1).Info("constructor()", "useHandlerID", useHandlerID)
 
 	channel := &PayloadChannel{
-		logger:       logger,
-		codec:        codec,
-		sentChan:     make(chan sentInfo),
-		closeCh:      make(chan struct{}),
-		useHandlerID: useHandlerID,
+		logger:         logger,
+		codec:          codec,
+		sentChan:       make(chan sentInfo),
+		closeCh:        make(chan struct{}),
+		useHandlerID:   useHandlerID,
+		requestTimeout: DefaultRequestTimeout,
 	}
 
 	return channel
@@ -98,6 +100,12 @@ func (c *PayloadChannel) Notify(event string, internal internalData, data string
 }
 
 func (c *PayloadChannel) Request(method string, internal internalData, data string, payload []byte) (rsp workerResponse) {
+	if RequestMetrics != nil {
+		defer func(method string, start time.Time) {
+			reportRequestMetrics(method, internal, start, rsp.err)
+		}(method, time.Now())
+	}
+
 	if c.Closed() {
 		rsp.err = NewInvalidStateError("PayloadChannel closed")
 		return
@@ -129,23 +137,18 @@ func (c *PayloadChannel) Request(method string, internal internalData, data stri
 		return workerResponse{err: errors.New("PayloadChannel payload too big")}
 	}
 
-	sent := sentInfo{
-		method:  method,
-		request: request,
-		payload: payload,
-		respCh:  make(chan workerResponse),
-	}
+	sent := newSentInfo(method, request, payload)
 	c.sents.Store(id, sent)
 	defer c.sents.Delete(id)
 
-	timer := time.NewTimer(3 * time.Second)
+	timer := time.NewTimer(c.requestTimeout)
 	defer timer.Stop()
 
 	// send request
 	select {
 	case c.sentChan <- sent:
 	case <-timer.C:
-		rsp.err = fmt.Errorf("PayloadChannel request timeout, id: %d, method: %s", id, method)
+		rsp.err = fmt.Errorf("PayloadChannel %w before being sent, id: %d, method: %s", ErrRequestTimeout, id, method)
 	case <-c.closeCh:
 		rsp.err = NewInvalidStateError("PayloadChannel closed, id: %d, method: %s", id, method)
 	}
@@ -157,7 +160,7 @@ func (c *PayloadChannel) Request(method string, internal internalData, data stri
 	select {
 	case rsp = <-sent.respCh:
 	case <-timer.C:
-		rsp.err = fmt.Errorf("PayloadChannel response timeout, id: %d, method: %s", id, method)
+		rsp.err = fmt.Errorf("PayloadChannel %w waiting for the response, id: %d, method: %s", ErrRequestTimeout, id, method)
 	case <-c.closeCh:
 		rsp.err = NewInvalidStateError("PayloadChannel closed, id: %d, method: %s", id, method)
 	}
@@ -3,6 +3,8 @@ package mediasoup
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
@@ -13,6 +15,10 @@ type PipeTransportOptions struct {
 	// ListenIp define Listening IP address.
 	ListenIp TransportListenIp `json:"listenIp,omitempty"`
 
+	// Port define a fixed listening port. If unset, a random port in the worker RTC port range
+	// is used. Pipe transports always multiplex RTP and RTCP in the same port.
+	Port uint16 `json:"port,omitempty"`
+
 	// EnableSctp define whether create a SCTP association. Default false.
 	EnableSctp bool `json:"enableSctp,omitempty"`
 
@@ -63,6 +69,13 @@ type PipeTransport struct {
 	payloadChannel    *PayloadChannel
 	getProducerById   func(string) *Producer
 	onSctpStateChange func(sctpState SctpState)
+	ssrcs             *ssrcAllocator
+}
+
+// SsrcRange define a range of SSRCs, from First to Last included.
+type SsrcRange struct {
+	First uint32 `json:"first"`
+	Last  uint32 `json:"last"`
 }
 
 func newPipeTransport(params transportParams) ITransport {
@@ -82,6 +95,7 @@ func newPipeTransport(params transportParams) ITransport {
 		channel:         params.channel,
 		payloadChannel:  params.payloadChannel,
 		getProducerById: params.getProducerById,
+		ssrcs:           newSsrcAllocator(),
 	}
 
 	transport.handleWorkerNotifications()
@@ -151,6 +165,7 @@ func (transport *PipeTransport) routerClosed() {
 // Connect provide the PlainTransport remote parameters.
 func (transport *PipeTransport) Connect(options TransportConnectOptions) (err error) {
 	transport.logger.V(1).Info("connect()")
+	transport.logger.V(2).Info("connect()", "options", options.Redacted())
 
 	reqData := TransportConnectOptions{
 		Ip:             options.Ip,
@@ -176,6 +191,8 @@ func (transport *PipeTransport) Connect(options TransportConnectOptions) (err er
 func (transport *PipeTransport) Consume(options ConsumerOptions) (consumer *Consumer, err error) {
 	transport.logger.V(1).Info("consume()")
 
+	started := time.Now()
+
 	producerId := options.ProducerId
 	appData := options.AppData
 
@@ -190,6 +207,26 @@ func (transport *PipeTransport) Consume(options ConsumerOptions) (consumer *Cons
 	internal := transport.internal
 	internal.ConsumerId = uuid.NewString()
 
+	if err = transport.ssrcs.assign(internal.ConsumerId, rtpParameters.Encodings, options.PipeSsrcRange); err != nil {
+		return
+	}
+	releaseSsrcs := func() {
+		transport.ssrcs.release(internal.ConsumerId)
+	}
+	defer func() {
+		if err != nil {
+			releaseSsrcs()
+		}
+	}()
+
+	ssrcMapping := make(map[uint32]uint32)
+	for i, encoding := range producer.ConsumableRtpParameters().Encodings {
+		ssrcMapping[encoding.Ssrc] = rtpParameters.Encodings[i].Ssrc
+		if encoding.Rtx != nil && rtpParameters.Encodings[i].Rtx != nil {
+			ssrcMapping[encoding.Rtx.Ssrc] = rtpParameters.Encodings[i].Rtx.Ssrc
+		}
+	}
+
 	data := consumerData{
 		ProducerId:    producerId,
 		Kind:          producer.Kind(),
@@ -207,6 +244,7 @@ func (transport *PipeTransport) Consume(options ConsumerOptions) (consumer *Cons
 		ConsumableRtpEncodings: producer.ConsumableRtpParameters().Encodings,
 	}
 
+	setupTimings := ConsumerSetupTimings{Started: started, RequestSent: time.Now()}
 	resp := transport.channel.Request("transport.consume", internal, reqData)
 
 	var status struct {
@@ -216,15 +254,25 @@ func (transport *PipeTransport) Consume(options ConsumerOptions) (consumer *Cons
 	if err = resp.Unmarshal(&status); err != nil {
 		return
 	}
+	setupTimings.Responded = time.Now()
 
 	consumer = newConsumer(consumerParams{
-		internal:       internal,
-		data:           data,
-		channel:        transport.channel,
-		payloadChannel: transport.payloadChannel,
-		appData:        appData,
-		paused:         status.Paused,
-		producerPaused: status.ProducerPaused,
+		internal:          internal,
+		data:              data,
+		channel:           transport.channel,
+		payloadChannel:    transport.payloadChannel,
+		appData:           appData,
+		paused:            status.Paused,
+		producerPaused:    status.ProducerPaused,
+		rtpQueue:          options.RtpQueue,
+		suppressPausedRtp: options.SuppressRtpWhilePaused,
+		statsHistorySize:  options.StatsHistorySize,
+		dumpWatchInterval: options.DumpWatchInterval,
+		disableObserver:   options.DisableObserver,
+		replayLatest:      options.ReplayLatestOnSubscribe,
+		ssrcMapping:       ssrcMapping,
+		setupTimings:      setupTimings,
+		ctx:               options.Context,
 	})
 
 	baseTransport := transport.ITransport.(*Transport)
@@ -232,14 +280,23 @@ func (transport *PipeTransport) Consume(options ConsumerOptions) (consumer *Cons
 	baseTransport.consumers.Store(consumer.Id(), consumer)
 	consumer.On("@close", func() {
 		baseTransport.consumers.Delete(consumer.Id())
+		releaseSsrcs()
 	})
 	consumer.On("@producerclose", func() {
 		baseTransport.consumers.Delete(consumer.Id())
+		releaseSsrcs()
 	})
+	consumer.On("transportclose", releaseSsrcs)
+
+	baseTransport.Emit("@newconsumer", consumer)
 
 	// Emit observer event.
 	transport.Observer().SafeEmit("newconsumer", consumer)
 
+	if options.EmitInitialState {
+		consumer.emitInitialState()
+	}
+
 	return
 }
 
@@ -279,3 +336,87 @@ func (transport *PipeTransport) handleWorkerNotifications() {
 		}
 	})
 }
+
+// ssrcAllocator keeps the SSRCs sent by the Consumers of a PipeTransport, so they do not collide.
+type ssrcAllocator struct {
+	locker sync.Mutex
+	ssrcs  map[uint32]string // ssrc:consumerId
+}
+
+func newSsrcAllocator() *ssrcAllocator {
+	return &ssrcAllocator{
+		ssrcs: make(map[uint32]string),
+	}
+}
+
+// assign sets the SSRCs of the encodings and of their RTX streams to SSRCs not sent by other
+// Consumers, taken in order from ssrcRange if given, or consecutive from a random base otherwise.
+func (a *ssrcAllocator) assign(consumerId string, encodings []RtpEncodingParameters, ssrcRange *SsrcRange) error {
+	count := 0
+	for _, encoding := range encodings {
+		count++
+		if encoding.Rtx != nil {
+			count++
+		}
+	}
+
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	var ssrcs []uint32
+
+	if ssrcRange != nil {
+		if ssrcRange.First > ssrcRange.Last {
+			return NewTypeError("invalid pipeSsrcRange [%d, %d]", ssrcRange.First, ssrcRange.Last)
+		}
+		for ssrc := uint64(ssrcRange.First); ssrc <= uint64(ssrcRange.Last) && len(ssrcs) < count; ssrc++ {
+			if _, ok := a.ssrcs[uint32(ssrc)]; !ok {
+				ssrcs = append(ssrcs, uint32(ssrc))
+			}
+		}
+		if len(ssrcs) < count {
+			return NewTypeError("not enough free SSRCs in pipeSsrcRange [%d, %d], %d required",
+				ssrcRange.First, ssrcRange.Last, count)
+		}
+	} else {
+		for len(ssrcs) < count {
+			ssrcs = ssrcs[:0]
+			base := generateRandomNumber()
+			for i := 0; i < count; i++ {
+				if _, ok := a.ssrcs[base+uint32(i)]; ok {
+					break
+				}
+				ssrcs = append(ssrcs, base+uint32(i))
+			}
+		}
+	}
+
+	for i := range encodings {
+		encodings[i].Ssrc, ssrcs = ssrcs[0], ssrcs[1:]
+	}
+	for i := range encodings {
+		if encodings[i].Rtx != nil {
+			encodings[i].Rtx.Ssrc, ssrcs = ssrcs[0], ssrcs[1:]
+		}
+	}
+	for _, encoding := range encodings {
+		a.ssrcs[encoding.Ssrc] = consumerId
+		if encoding.Rtx != nil {
+			a.ssrcs[encoding.Rtx.Ssrc] = consumerId
+		}
+	}
+
+	return nil
+}
+
+// release makes the SSRCs of the Consumer available again.
+func (a *ssrcAllocator) release(consumerId string) {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	for ssrc, id := range a.ssrcs {
+		if id == consumerId {
+			delete(a.ssrcs, ssrc)
+		}
+	}
+}
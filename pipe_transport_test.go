@@ -1,10 +1,14 @@
 package mediasoup
 
 import (
+	"context"
+	"encoding/json"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"golang.org/x/sync/errgroup"
 )
@@ -414,6 +418,52 @@ func (suite *PipeTransportTestingSuite) TestRouterCreatePipeTransport_WithEnable
 	pipeTransport.Close()
 }
 
+func (suite *PipeTransportTestingSuite) TestRouterCreatePipeTransport_ManualPipingSucceeds() {
+	pipeTransport1, err := suite.router1.CreatePipeTransport(PipeTransportOptions{
+		ListenIp: TransportListenIp{Ip: "127.0.0.1"},
+		Port:     49999,
+	})
+	suite.Require().NoError(err)
+	suite.EqualValues(49999, pipeTransport1.Tuple().LocalPort)
+
+	pipeTransport2, err := suite.router2.CreatePipeTransport(PipeTransportOptions{
+		ListenIp: TransportListenIp{Ip: "127.0.0.1"},
+	})
+	suite.Require().NoError(err)
+
+	suite.NoError(pipeTransport1.Connect(TransportConnectOptions{
+		Ip:   pipeTransport2.Tuple().LocalIp,
+		Port: pipeTransport2.Tuple().LocalPort,
+	}))
+	suite.NoError(pipeTransport2.Connect(TransportConnectOptions{
+		Ip:   pipeTransport1.Tuple().LocalIp,
+		Port: pipeTransport1.Tuple().LocalPort,
+	}))
+	suite.EqualValues(pipeTransport2.Tuple().LocalPort, pipeTransport1.Tuple().RemotePort)
+
+	pipeConsumer, err := pipeTransport1.Consume(ConsumerOptions{
+		ProducerId: suite.audioProducer.Id(),
+	})
+	suite.Require().NoError(err)
+	suite.Equal(ConsumerType_Pipe, pipeConsumer.Type())
+
+	pipeProducer, err := pipeTransport2.Produce(ProducerOptions{
+		Id:            suite.audioProducer.Id(),
+		Kind:          pipeConsumer.Kind(),
+		RtpParameters: pipeConsumer.RtpParameters(),
+	})
+	suite.Require().NoError(err)
+	suite.Equal(MediaKind_Audio, pipeProducer.Kind())
+
+	dump, err := pipeTransport2.Dump()
+	suite.NoError(err)
+	suite.Equal([]string{pipeProducer.Id()}, dump.ProducerIds)
+
+	stats, err := pipeTransport1.GetStats()
+	suite.NoError(err)
+	suite.Equal("pipe-transport", stats[0].Type)
+}
+
 func (suite *PipeTransportTestingSuite) TestTransportConsume_ForAPipeProducerSucceeds() {
 	_, err := suite.router1.PipeToRouter(PipeToRouterOptions{
 		ProducerId: suite.videoProducer.Id(),
@@ -739,3 +789,180 @@ func (suite *PipeTransportTestingSuite) TestPipeToRouter() {
 		suite.EqualValues(0, syncMapLen(pipeTransportsB))
 	})
 }
+
+func (suite *PipeTransportTestingSuite) TestPipeTransportConsume_AssignsSsrcsFromRange() {
+	pipeTransport, err := suite.router1.CreatePipeTransport(PipeTransportOptions{
+		ListenIp:  TransportListenIp{Ip: "127.0.0.1"},
+		EnableRtx: true,
+	})
+	suite.Require().NoError(err)
+
+	ssrcRange := &SsrcRange{First: 1000, Last: 1999}
+	used := map[uint32]bool{}
+
+	for _, producer := range []*Producer{suite.audioProducer, suite.videoProducer} {
+		consumer, err := pipeTransport.Consume(ConsumerOptions{
+			ProducerId:    producer.Id(),
+			PipeSsrcRange: ssrcRange,
+		})
+		suite.Require().NoError(err)
+
+		mapping := consumer.SsrcMapping()
+		for _, encoding := range producer.ConsumableRtpParameters().Encodings {
+			suite.Contains(mapping, encoding.Ssrc)
+		}
+		for _, encoding := range consumer.RtpParameters().Encodings {
+			ssrcs := []uint32{encoding.Ssrc}
+			if encoding.Rtx != nil {
+				ssrcs = append(ssrcs, encoding.Rtx.Ssrc)
+			}
+			for _, ssrc := range ssrcs {
+				suite.GreaterOrEqual(ssrc, ssrcRange.First)
+				suite.LessOrEqual(ssrc, ssrcRange.Last)
+				suite.False(used[ssrc], "SSRC %d assigned twice", ssrc)
+				used[ssrc] = true
+			}
+		}
+	}
+
+	_, err = pipeTransport.Consume(ConsumerOptions{
+		ProducerId:    suite.videoProducer.Id(),
+		PipeSsrcRange: &SsrcRange{First: 1000, Last: 1001},
+	})
+	suite.IsType(TypeError{}, err)
+}
+
+func TestSsrcAllocator(t *testing.T) {
+	allocator := newSsrcAllocator()
+
+	encodings := []RtpEncodingParameters{{Rtx: &RtpEncodingRtx{}}, {Rtx: &RtpEncodingRtx{}}}
+	require.NoError(t, allocator.assign("c1", encodings, &SsrcRange{First: 10, Last: 20}))
+	assert.EqualValues(t, 10, encodings[0].Ssrc)
+	assert.EqualValues(t, 11, encodings[1].Ssrc)
+	assert.EqualValues(t, 12, encodings[0].Rtx.Ssrc)
+	assert.EqualValues(t, 13, encodings[1].Rtx.Ssrc)
+
+	// The SSRCs of c1 are skipped.
+	encodings = []RtpEncodingParameters{{}, {}}
+	require.NoError(t, allocator.assign("c2", encodings, &SsrcRange{First: 12, Last: 20}))
+	assert.EqualValues(t, 14, encodings[0].Ssrc)
+	assert.EqualValues(t, 15, encodings[1].Ssrc)
+
+	err := allocator.assign("c3", []RtpEncodingParameters{{}, {}}, &SsrcRange{First: 10, Last: 14})
+	assert.IsType(t, TypeError{}, err)
+	err = allocator.assign("c3", []RtpEncodingParameters{{}}, &SsrcRange{First: 10, Last: 9})
+	assert.IsType(t, TypeError{}, err)
+
+	// The SSRCs of released Consumers are available again.
+	allocator.release("c1")
+	encodings = []RtpEncodingParameters{{}, {}}
+	require.NoError(t, allocator.assign("c3", encodings, &SsrcRange{First: 10, Last: 14}))
+	assert.EqualValues(t, 10, encodings[0].Ssrc)
+	assert.EqualValues(t, 11, encodings[1].Ssrc)
+
+	// Random SSRCs do not collide either.
+	encodings = []RtpEncodingParameters{{}, {Rtx: &RtpEncodingRtx{}}}
+	require.NoError(t, allocator.assign("c4", encodings, nil))
+	assert.Equal(t, encodings[0].Ssrc+1, encodings[1].Ssrc)
+	assert.Equal(t, encodings[0].Ssrc+2, encodings[1].Rtx.Ssrc)
+	assert.Len(t, allocator.ssrcs, 7)
+}
+
+func TestPipeTransportStatUnmarshal(t *testing.T) {
+	fixture := `[{
+		"type": "pipe-transport",
+		"transportId": "transport-id",
+		"timestamp": 1000,
+		"bytesReceived": 1200,
+		"recvBitrate": 9600,
+		"bytesSent": 3400,
+		"sendBitrate": 27200,
+		"rtxBytesSent": 100,
+		"tuple": {
+			"localIp": "127.0.0.1",
+			"localPort": 40000,
+			"remoteIp": "127.0.0.1",
+			"remotePort": 50000,
+			"protocol": "udp"
+		}
+	}]`
+
+	var stats []*TransportStat
+	require.NoError(t, json.Unmarshal([]byte(fixture), &stats))
+	require.Len(t, stats, 1)
+
+	stat := stats[0]
+	assert.Equal(t, "pipe-transport", stat.Type)
+	assert.EqualValues(t, 9600, stat.RecvBitrate)
+	assert.EqualValues(t, 3400, stat.BytesSent)
+	assert.EqualValues(t, 100, stat.RtxBytesSent)
+	assert.Nil(t, stat.WebRtcTransportSpecificStat)
+	require.NotNil(t, stat.PlainTransportSpecificStat)
+	assert.Equal(t, TransportTuple{
+		LocalIp:    "127.0.0.1",
+		LocalPort:  40000,
+		RemoteIp:   "127.0.0.1",
+		RemotePort: 50000,
+		Protocol:   "udp",
+	}, stat.Tuple)
+}
+
+func TestPipeTransportConsumeOptions(t *testing.T) {
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		if req.method == "transport.consume" {
+			return `{"paused":false,"producerPaused":true}`, nil
+		}
+		return "", nil
+	})
+	payloadChannel, _ := newFakePayloadChannel(t)
+
+	producer := &Producer{
+		internal: internalData{ProducerId: "producer"},
+		data: producerData{
+			Kind: MediaKind_Audio,
+			Type: ProducerType_Simple,
+			ConsumableRtpParameters: RtpParameters{
+				Codecs: []*RtpCodecParameters{
+					{MimeType: "audio/opus", PayloadType: 100, ClockRate: 48000, Channels: 2},
+				},
+				Encodings: []RtpEncodingParameters{{Ssrc: 1111}},
+			},
+		},
+	}
+	transport := newPipeTransport(transportParams{
+		internal:        internalData{RouterId: "router", TransportId: "transport"},
+		data:            &pipeTransortData{},
+		channel:         channel,
+		payloadChannel:  payloadChannel,
+		getProducerById: func(string) *Producer { return producer },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	onProducerPause := NewMockFunc(t)
+	consumer, err := transport.Consume(ConsumerOptions{
+		ProducerId:              "producer",
+		Context:                 ctx,
+		StatsHistorySize:        5,
+		DisableObserver:         true,
+		ReplayLatestOnSubscribe: true,
+		EmitInitialState:        true,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 5, consumer.statsHistorySize)
+	assert.True(t, consumer.disableObserver)
+
+	// The latest state is replayed to a handler set late.
+	consumer.OnProducerPause(func() { onProducerPause.Fn()() })
+	onProducerPause.ExpectCalledTimes(1)
+
+	// The Consumer is bound to the context.
+	cancel()
+	select {
+	case <-consumer.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("consumer context not done")
+	}
+}
@@ -35,7 +35,7 @@ type PlainTransportOptions struct {
 	SctpSendBufferSize int `json:"sctpSendBufferSize,omitempty"`
 
 	// EnableSrtp enable SRTP. For this to work, connect() must be called
-	// with remote SRTP parameters. Default false.
+	// with remote SRTP parameters, which GenerateSrtpParameters() can create. Default false.
 	EnableSrtp bool `json:"enableSrtp,omitempty"`
 
 	// SrtpCryptoSuite define the SRTP crypto suite to be used if enableSrtp is set. Default
@@ -50,7 +50,7 @@ type PlainTransportOptions struct {
 
 // PlainTransportSpecificStat define the stat info for PlainTransport
 type PlainTransportSpecificStat struct {
-	RtcpMux   bool            `json:"rtcp_mux"`
+	RtcpMux   bool            `json:"rtcpMux"`
 	Comedia   bool            `json:"comedia"`
 	Tuple     TransportTuple  `json:"tuple"`
 	RtcpTuple *TransportTuple `json:"rtcpTuple,omitempty"`
@@ -175,6 +175,7 @@ func (transport *PlainTransport) routerClosed() {
 // Connect provide the PlainTransport remote parameters.
 func (transport *PlainTransport) Connect(options TransportConnectOptions) (err error) {
 	transport.logger.V(1).Info("connect()")
+	transport.logger.V(2).Info("connect()", "options", options.Redacted())
 
 	reqData := TransportConnectOptions{
 		Ip:             options.Ip,
@@ -0,0 +1,231 @@
+package mediasoup
+
+import (
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ConnectFromSdp provides the PlainTransport remote parameters taken from the SDP of a remote
+// endpoint, such as a SIP gateway, as parsed by ParseSdpConnectOptions(). If the PlainTransport
+// uses comedia, only the SRTP parameters are given to Connect().
+func (transport *PlainTransport) ConnectFromSdp(remoteSdp string) error {
+	transport.logger.V(1).Info("connectFromSdp()")
+
+	options, err := ParseSdpConnectOptions(remoteSdp)
+	if err != nil {
+		return err
+	}
+	if transport.data.Comedia {
+		options = TransportConnectOptions{SrtpParameters: options.SrtpParameters}
+	}
+
+	return transport.Connect(options)
+}
+
+// ParseSdpConnectOptions returns the options to connect a PlainTransport to the endpoint
+// described by an SDP, from its first media section whose port is not zero:
+//
+//   - Ip is the address of the "c=" line of the media section, or of the session.
+//   - Port is the port of the "m=" line.
+//   - RtcpPort is the port of the "a=rtcp" attribute. Without it nor "a=rtcp-mux", it is the
+//     next port, as defined by RFC 3605.
+//   - SrtpParameters are taken from the first "a=crypto" attribute (RFC 4568) whose crypto suite
+//     is supported, if the media section uses a secure RTP profile (RTP/SAVP or RTP/SAVPF).
+//
+// A TypeError describing the missing or invalid field is returned if the SDP can not be used.
+func ParseSdpConnectOptions(sdp string) (options TransportConnectOptions, err error) {
+	var (
+		sessionIp string
+		inMedia   bool
+		media     *sdpMediaSection
+	)
+
+	for i, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) < 2 || line[1] != '=' {
+			return options, NewTypeError("invalid SDP line %d: %q", i+1, line)
+		}
+		typ, value := line[0], line[2:]
+
+		if typ == 'm' {
+			// The first usable media section is complete.
+			if media != nil {
+				break
+			}
+			inMedia = true
+			if media, err = parseSdpMediaLine(value); err != nil {
+				return
+			}
+			// A zero port disables the media section.
+			if media.port == 0 {
+				media = nil
+			}
+			continue
+		}
+
+		if typ == 'c' {
+			ip, err := parseSdpConnectionLine(value)
+			if err != nil {
+				return options, err
+			}
+			if media != nil {
+				media.ip = ip
+			} else if !inMedia {
+				sessionIp = ip
+			}
+			continue
+		}
+
+		// Attributes of the session, or of disabled media sections, are not used.
+		if typ != 'a' || media == nil {
+			continue
+		}
+
+		name, attrValue := value, ""
+		if i := strings.IndexByte(value, ':'); i >= 0 {
+			name, attrValue = value[:i], value[i+1:]
+		}
+
+		switch name {
+		case "rtcp":
+			fields := strings.Fields(attrValue)
+			if len(fields) == 0 {
+				return options, NewTypeError("invalid SDP rtcp attribute: %q", attrValue)
+			}
+			port, err := strconv.ParseUint(fields[0], 10, 16)
+			if err != nil || port == 0 {
+				return options, NewTypeError("invalid SDP rtcp attribute: %q", attrValue)
+			}
+			media.rtcpPort = uint16(port)
+
+		case "rtcp-mux":
+			media.rtcpMux = true
+
+		case "crypto":
+			if media.srtpParameters != nil {
+				continue
+			}
+			if media.srtpParameters, err = parseSdpCryptoAttribute(attrValue); err != nil {
+				return
+			}
+		}
+	}
+
+	if media == nil {
+		return options, NewTypeError("no active media section in SDP")
+	}
+	if len(media.ip) == 0 {
+		media.ip = sessionIp
+	}
+	if len(media.ip) == 0 {
+		return options, NewTypeError("no connection address in SDP")
+	}
+
+	options.Ip = media.ip
+	options.Port = media.port
+
+	if media.rtcpPort > 0 {
+		options.RtcpPort = media.rtcpPort
+	} else if !media.rtcpMux {
+		if media.port == 65535 {
+			return options, NewTypeError("no RTCP port for SDP media port %d", media.port)
+		}
+		options.RtcpPort = media.port + 1
+	}
+
+	if media.secure {
+		if media.srtpParameters == nil {
+			return options, NewTypeError("no supported crypto attribute in SDP for %s profile", media.proto)
+		}
+		options.SrtpParameters = media.srtpParameters
+	}
+
+	return options, nil
+}
+
+type sdpMediaSection struct {
+	port           uint16
+	proto          string
+	secure         bool
+	ip             string
+	rtcpPort       uint16
+	rtcpMux        bool
+	srtpParameters *SrtpParameters
+}
+
+// parseSdpMediaLine parses the value of a "m=" line: <media> <port>[/<number>] <proto> <fmt>...
+func parseSdpMediaLine(value string) (*sdpMediaSection, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return nil, NewTypeError("invalid SDP media line: %q", value)
+	}
+
+	port, err := strconv.ParseUint(strings.SplitN(fields[1], "/", 2)[0], 10, 16)
+	if err != nil {
+		return nil, NewTypeError("invalid SDP media port: %q", fields[1])
+	}
+
+	proto := fields[2]
+	switch proto {
+	case "RTP/AVP", "RTP/AVPF":
+	case "RTP/SAVP", "RTP/SAVPF":
+	default:
+		if port > 0 {
+			return nil, NewTypeError("unsupported SDP media profile: %q", proto)
+		}
+	}
+
+	return &sdpMediaSection{
+		port:   uint16(port),
+		proto:  proto,
+		secure: strings.HasPrefix(proto, "RTP/SAVP"),
+	}, nil
+}
+
+// parseSdpConnectionLine parses the value of a "c=" line: IN IP4|IP6 <address>[/<ttl>].
+func parseSdpConnectionLine(value string) (string, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 || fields[0] != "IN" || (fields[1] != "IP4" && fields[1] != "IP6") {
+		return "", NewTypeError("invalid SDP connection line: %q", value)
+	}
+
+	ip := strings.SplitN(fields[2], "/", 2)[0]
+	if net.ParseIP(ip) == nil {
+		return "", NewTypeError("invalid SDP connection address: %q", ip)
+	}
+	return ip, nil
+}
+
+// parseSdpCryptoAttribute parses the value of a "a=crypto" attribute:
+// <tag> <crypto-suite> inline:<key||salt>[|<lifetime>][|<MKI>:<length>] [<session-params>].
+// It returns nil if the crypto suite is not supported.
+func parseSdpCryptoAttribute(value string) (*SrtpParameters, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "inline:") {
+		return nil, NewTypeError("invalid SDP crypto attribute: %q", value)
+	}
+
+	cryptoSuite := SrtpCryptoSuite(fields[1])
+	if cryptoSuite.MasterLength() == 0 {
+		return nil, nil
+	}
+
+	keyBase64 := strings.SplitN(strings.TrimPrefix(fields[2], "inline:"), "|", 2)[0]
+	key, err := base64.StdEncoding.DecodeString(keyBase64)
+	if err != nil {
+		key, err = base64.RawStdEncoding.DecodeString(keyBase64)
+	}
+	if err != nil || len(key) != cryptoSuite.MasterLength() {
+		return nil, NewTypeError("invalid SDP crypto key for %s", cryptoSuite)
+	}
+
+	return &SrtpParameters{
+		CryptoSuite: cryptoSuite,
+		KeyBase64:   base64.StdEncoding.EncodeToString(key),
+	}, nil
+}
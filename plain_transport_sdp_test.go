@@ -0,0 +1,115 @@
+package mediasoup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const plainRtpSdp = "v=0\r\n" +
+	"o=- 1 1 IN IP4 192.0.2.1\r\n" +
+	"s=-\r\n" +
+	"c=IN IP4 192.0.2.1\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 40000 RTP/AVP 0 8 101\r\n" +
+	"a=rtpmap:0 PCMU/8000\r\n" +
+	"a=rtpmap:101 telephone-event/8000\r\n" +
+	"a=sendrecv\r\n"
+
+const srtpSdp = "v=0\r\n" +
+	"o=- 1 1 IN IP4 192.0.2.1\r\n" +
+	"s=-\r\n" +
+	"c=IN IP4 192.0.2.1\r\n" +
+	"t=0 0\r\n" +
+	"m=video 0 RTP/SAVP 96\r\n" +
+	"c=IN IP4 192.0.2.9\r\n" +
+	"m=audio 40002 RTP/SAVP 111\r\n" +
+	"c=IN IP6 2001:db8::2\r\n" +
+	"a=rtcp:40010 IN IP6 2001:db8::2\r\n" +
+	"a=crypto:1 AES_CM_256_HMAC_SHA1_80 inline:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\r\n" +
+	"a=crypto:2 AES_CM_128_HMAC_SHA1_80 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz|2^20|1:32\r\n" +
+	"a=crypto:3 AES_CM_128_HMAC_SHA1_32 inline:d0RmdmcmVCspeEc3QGZiNWpVLFJhQX1cfHAwJSoj\r\n" +
+	"m=video 40004 RTP/SAVP 96\r\n" +
+	"a=rtcp-mux\r\n"
+
+func TestParseSdpConnectOptions(t *testing.T) {
+	options, err := ParseSdpConnectOptions(plainRtpSdp)
+	require.NoError(t, err)
+	assert.Equal(t, TransportConnectOptions{
+		Ip:       "192.0.2.1",
+		Port:     40000,
+		RtcpPort: 40001,
+	}, options)
+
+	options, err = ParseSdpConnectOptions(srtpSdp)
+	require.NoError(t, err)
+	assert.Equal(t, TransportConnectOptions{
+		Ip:       "2001:db8::2",
+		Port:     40002,
+		RtcpPort: 40010,
+		SrtpParameters: &SrtpParameters{
+			CryptoSuite: AES_CM_128_HMAC_SHA1_80,
+			KeyBase64:   "WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz",
+		},
+	}, options)
+
+	options, err = ParseSdpConnectOptions(strings.Replace(plainRtpSdp, "a=sendrecv", "a=rtcp-mux", 1))
+	require.NoError(t, err)
+	assert.Zero(t, options.RtcpPort)
+}
+
+func TestParseSdpConnectOptionsErrors(t *testing.T) {
+	for sdp, message := range map[string]string{
+		"v=0\r\nc=IN IP4 192.0.2.1\r\n":                                           "no active media section",
+		"v=0\r\nm=audio 0 RTP/AVP 0\r\nc=IN IP4 192.0.2.1\r\n":                    "no active media section",
+		"v=0\r\nm=audio 40000 RTP/AVP 0\r\n":                                      "no connection address",
+		"v=0\r\nc=IN IP4 192.0.2.1\r\nm=audio 40000 RTP/SAVP 0\r\n":               "no supported crypto attribute",
+		"v=0\r\nc=IN IP4 192.0.2.1\r\nm=audio 40000 UDP/TLS/RTP/SAVPF 0\r\n":      "unsupported SDP media profile",
+		"v=0\r\nc=IN IP4 192.0.2.1\r\nm=audio port RTP/AVP 0\r\n":                 "invalid SDP media port",
+		"v=0\r\nc=IN IP4 192.0.2.1\r\nm=audio 40000 RTP/AVP\r\n":                  "invalid SDP media line",
+		"v=0\r\nc=IN IP4 example.com\r\nm=audio 40000 RTP/AVP 0\r\n":              "invalid SDP connection address",
+		"v=0\r\nc=IN IP4\r\nm=audio 40000 RTP/AVP 0\r\n":                          "invalid SDP connection line",
+		"v=0\r\nc=IN IP4 192.0.2.1\r\nm=audio 40000 RTP/AVP 0\r\na=rtcp:x\r\n":    "invalid SDP rtcp attribute",
+		"v=0\r\nc=IN IP4 192.0.2.1\r\nm=audio 40000 RTP/AVP 0\r\na=rtcp:\r\n":     "invalid SDP rtcp attribute",
+		"v=0\r\nc=IN IP4 192.0.2.1\r\nm=audio 40000 RTP/AVP 0\r\na=rtcp\r\n":      "invalid SDP rtcp attribute",
+		"v=0\r\nc=IN IP4 192.0.2.1\r\nm=audio 40000 RTP/AVP 0\r\na=rtcp: \r\n":    "invalid SDP rtcp attribute",
+		"v=0\r\nc=IN IP4 192.0.2.1\r\nm=audio 40000 RTP/SAVP 0\r\na=crypto:1\r\n": "invalid SDP crypto attribute",
+		"v=0\r\nc=IN IP4 192.0.2.1\r\nm=audio 40000 RTP/SAVP 0\r\n" +
+			"a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:c2hvcnQ=\r\n": "invalid SDP crypto key for AES_CM_128_HMAC_SHA1_80",
+		"v=0\r\nbogus\r\n": "invalid SDP line 2",
+	} {
+		_, err := ParseSdpConnectOptions(sdp)
+		if assert.IsType(t, TypeError{}, err, sdp) {
+			assert.Contains(t, err.Error(), message, sdp)
+		}
+	}
+}
+
+func TestPlainTransportConnectFromSdp(t *testing.T) {
+	requests := make(chan string, 2)
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		requests <- req.method + " " + req.data
+		return "{}", nil
+	})
+
+	transport := &PlainTransport{
+		logger:   NewLogger("PlainTransport"),
+		internal: internalData{TransportId: "transport"},
+		data:     &plainTransportData{},
+		channel:  channel,
+	}
+	require.NoError(t, transport.ConnectFromSdp(srtpSdp))
+	assert.Equal(t, `transport.connect {"ip":"2001:db8::2","port":40002,`+
+		`"srtpParameters":{"cryptoSuite":"AES_CM_128_HMAC_SHA1_80","keyBase64":"WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz"},`+
+		`"rtcpPort":40010}`, <-requests)
+
+	// With comedia, the remote address is detected from the first packets received.
+	transport.data.Comedia = true
+	require.NoError(t, transport.ConnectFromSdp(srtpSdp))
+	assert.Equal(t, `transport.connect {"srtpParameters":{"cryptoSuite":"AES_CM_128_HMAC_SHA1_80","keyBase64":"WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz"}}`, <-requests)
+
+	assert.IsType(t, TypeError{}, transport.ConnectFromSdp(plainRtpSdp[:20]))
+	assert.Empty(t, requests)
+}
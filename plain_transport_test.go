@@ -1,8 +1,11 @@
 package mediasoup
 
 import (
+	"encoding/json"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -341,3 +344,85 @@ func (suite *PlainTransportTestingSuite) TestEmitsRoutercloseIfWorkerIsClosed()
 	onObserverClose.ExpectCalled()
 	suite.True(transport.Closed())
 }
+
+func TestTransportDumpRedacted(t *testing.T) {
+	const key = "ZnQ3eWJraDg0d3ZoYzM5cXN1Y2pnaHU5NWxrZTVv"
+
+	dump := TransportDump{
+		Id: "transport-id",
+		PlainTransportDump: &PlainTransportDump{
+			SrtpParameters: &SrtpParameters{
+				CryptoSuite: AES_CM_128_HMAC_SHA1_80,
+				KeyBase64:   key,
+			},
+		},
+		WebRtcTransportDump: &WebRtcTransportDump{
+			IceParameters:  IceParameters{UsernameFragment: "ufrag", Password: "ice-password"},
+			DtlsRemoteCert: "remote-cert",
+		},
+	}
+
+	redacted := dump.Redacted()
+	assert.Equal(t, "transport-id", redacted.Id)
+	assert.Equal(t, AES_CM_128_HMAC_SHA1_80, redacted.SrtpParameters.CryptoSuite)
+	assert.Equal(t, RedactedValue, redacted.SrtpParameters.KeyBase64)
+	assert.Equal(t, "ufrag", redacted.IceParameters.UsernameFragment)
+	assert.Equal(t, RedactedValue, redacted.IceParameters.Password)
+	assert.Equal(t, RedactedValue, redacted.DtlsRemoteCert)
+
+	// The original dump is left untouched.
+	assert.Equal(t, key, dump.SrtpParameters.KeyBase64)
+	assert.Equal(t, "ice-password", dump.IceParameters.Password)
+
+	assert.NotContains(t, dump.String(), key)
+	assert.NotContains(t, dump.String(), "ice-password")
+
+	options := TransportConnectOptions{Ip: "127.0.0.1", SrtpParameters: dump.SrtpParameters}
+	assert.Equal(t, RedactedValue, options.Redacted().SrtpParameters.KeyBase64)
+	assert.Equal(t, key, options.SrtpParameters.KeyBase64)
+	assert.Nil(t, TransportConnectOptions{}.Redacted().SrtpParameters)
+}
+
+func TestPlainTransportStatUnmarshal(t *testing.T) {
+	fixture := `[{
+		"type": "plain-rtp-transport",
+		"transportId": "transport-id",
+		"timestamp": 1000,
+		"bytesReceived": 1200,
+		"recvBitrate": 9600,
+		"bytesSent": 3400,
+		"sendBitrate": 27200,
+		"rtcpMux": false,
+		"comedia": true,
+		"tuple": {
+			"localIp": "127.0.0.1",
+			"localPort": 40000,
+			"remoteIp": "127.0.0.1",
+			"remotePort": 50000,
+			"protocol": "udp"
+		},
+		"rtcpTuple": {
+			"localIp": "127.0.0.1",
+			"localPort": 40001,
+			"remoteIp": "127.0.0.1",
+			"remotePort": 50001,
+			"protocol": "udp"
+		}
+	}]`
+
+	var stats []*TransportStat
+	require.NoError(t, json.Unmarshal([]byte(fixture), &stats))
+	require.Len(t, stats, 1)
+
+	stat := stats[0]
+	assert.Equal(t, "plain-rtp-transport", stat.Type)
+	assert.EqualValues(t, 1200, stat.BytesReceived)
+	assert.EqualValues(t, 27200, stat.SendBitrate)
+	assert.Nil(t, stat.WebRtcTransportSpecificStat)
+	require.NotNil(t, stat.PlainTransportSpecificStat)
+	assert.False(t, stat.RtcpMux)
+	assert.True(t, stat.Comedia)
+	assert.EqualValues(t, 40000, stat.Tuple.LocalPort)
+	require.NotNil(t, stat.RtcpTuple)
+	assert.EqualValues(t, 50001, stat.RtcpTuple.RemotePort)
+}
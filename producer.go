@@ -1,6 +1,7 @@
 package mediasoup
 
 import (
+	"context"
 	"encoding/json"
 	"sync"
 	"sync/atomic"
@@ -58,10 +59,13 @@ type ProducerTraceEventData struct {
 
 // ProducerScore define "score" event data
 type ProducerScore struct {
+	// EncodingIdx is the index of the RTP encoding in the producer's RtpParameters.
+	EncodingIdx uint32 `json:"encodingIdx"`
+
 	// Ssrc of the RTP stream.
 	Ssrc uint32 `json:"ssrc,omitempty"`
 
-	// Rid of the RTP stream.
+	// Rid of the RTP stream. It's only set for simulcast producers using RID.
 	Rid string `json:"rid,omitempty"`
 
 	// Score of the RTP stream.
@@ -84,7 +88,7 @@ type ProducerVideoOrientation struct {
 type ProducerStat struct {
 	ConsumerStat
 	// Jitter is the jitter buffer.
-	Jitter uint32 `json:"jitter,omitempty"`
+	Jitter uint32 `json:"jitter"`
 	// BitrateByLayer is a map of bitrate of each layer (such as {"0.0": 100, "1.0": 500})
 	BitrateByLayer map[string]uint32 `json:"bitrateByLayer,omitempty"`
 }
@@ -113,6 +117,7 @@ type producerParams struct {
 	payloadChannel *PayloadChannel
 	appData        interface{}
 	paused         bool
+	getConsumers   func() []*Consumer
 }
 
 // Producer represents an audio or video source being injected into a mediasoup router.
@@ -143,6 +148,13 @@ type Producer struct {
 	onScore                  func([]ProducerScore)
 	onVideoOrientationChange func(*ProducerVideoOrientation)
 	onTrace                  func(*ProducerTraceEventData)
+	traceLocker              sync.Mutex               // Guards traceEventTypes and keyFrameWaiters.
+	traceUpdateLocker        sync.Mutex               // Serializes the "producer.enableTraceEvent" requests.
+	traceEventTypes          []ProducerTraceEventType // Types enabled by EnableTraceEvent().
+	keyFrameWaiters          map[chan struct{}]struct{}
+	getConsumers             func() []*Consumer
+	closedConsumers          []*Consumer // Consumers closed by Close(), set before closedCh is closed.
+	closedCh                 chan struct{}
 }
 
 func newProducer(params producerParams) *Producer {
@@ -159,6 +171,8 @@ func newProducer(params producerParams) *Producer {
 		payloadChannel: params.payloadChannel,
 		appData:        params.appData,
 		paused:         params.paused,
+		getConsumers:   params.getConsumers,
+		closedCh:       make(chan struct{}),
 		observer:       NewEventEmitter(),
 	}
 
@@ -227,7 +241,9 @@ func (producer *Producer) Observer() IEventEmitter {
 	return producer.observer
 }
 
-// Close the producer.
+// Close the producer. Its Consumers are closed before Close() returns, their OnProducerClose
+// handlers being called, rather than when the "producerclose" notifications of mediasoup-worker
+// are received.
 func (producer *Producer) Close() (err error) {
 	if atomic.CompareAndSwapUint32(&producer.closed, 0, 1) {
 		producer.logger.V(1).Info("close()")
@@ -246,12 +262,47 @@ func (producer *Producer) Close() (err error) {
 		producer.Emit("@close")
 		producer.RemoveAllListeners()
 
+		producer.closeConsumers()
 		producer.close()
 	}
 
 	return
 }
 
+// closeConsumers closes the Consumers of the Producer, keeping them for WaitClosed().
+func (producer *Producer) closeConsumers() {
+	if producer.getConsumers == nil {
+		return
+	}
+
+	producer.closedConsumers = producer.getConsumers()
+
+	for _, consumer := range producer.closedConsumers {
+		consumer.producerClosed()
+	}
+}
+
+// WaitClosed waits until the Producer is closed and, if closed by Close(), until its Consumers are
+// closed too, including those closed concurrently when the "producerclose" notifications were
+// received. It returns the error of ctx if it is done before.
+func (producer *Producer) WaitClosed(ctx context.Context) error {
+	select {
+	case <-producer.closedCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, consumer := range producer.closedConsumers {
+		select {
+		case <-consumer.Context().Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
 // close send "close" event.
 func (producer *Producer) close() {
 	// Emit observer event.
@@ -261,6 +312,8 @@ func (producer *Producer) close() {
 	if handler := producer.onClose; handler != nil {
 		handler()
 	}
+
+	close(producer.closedCh)
 }
 
 // transportClosed is called when transport was closed.
@@ -369,11 +422,123 @@ func (producer *Producer) EnableTraceEvent(types ...ProducerTraceEventType) erro
 		types = []ProducerTraceEventType{}
 	}
 
+	producer.traceLocker.Lock()
+	producer.traceEventTypes = append([]ProducerTraceEventType{}, types...)
+	producer.traceLocker.Unlock()
+
+	return producer.updateTraceEvent()
+}
+
+// TraceEventTypes returns a copy of the trace event types enabled by EnableTraceEvent().
+func (producer *Producer) TraceEventTypes() []ProducerTraceEventType {
+	producer.traceLocker.Lock()
+	defer producer.traceLocker.Unlock()
+
+	return append([]ProducerTraceEventType(nil), producer.traceEventTypes...)
+}
+
+// WaitForKeyFrame waits until the Producer receives a key frame, or ctx is done. The "keyframe"
+// trace event is enabled while waiting, in addition to the types enabled by EnableTraceEvent().
+// It does not request a key frame to the endpoint, see Consumer.RequestKeyFrame().
+func (producer *Producer) WaitForKeyFrame(ctx context.Context) error {
+	producer.logger.V(1).Info("waitForKeyFrame()")
+
+	return producer.waitForKeyFrame(ctx, nil)
+}
+
+// waitForKeyFrame is WaitForKeyFrame() calling waiting, if not nil, once the "keyframe" trace
+// event is enabled, so a key frame requested by waiting is not missed.
+func (producer *Producer) waitForKeyFrame(ctx context.Context, waiting func()) error {
+	if producer.Kind() != MediaKind_Video {
+		return NewTypeError("not a video Producer")
+	}
+
+	received := make(chan struct{}, 1)
+
+	producer.traceLocker.Lock()
+	if producer.keyFrameWaiters == nil {
+		producer.keyFrameWaiters = make(map[chan struct{}]struct{})
+	}
+	producer.keyFrameWaiters[received] = struct{}{}
+	first := len(producer.keyFrameWaiters) == 1
+	producer.traceLocker.Unlock()
+
+	defer func() {
+		producer.traceLocker.Lock()
+		delete(producer.keyFrameWaiters, received)
+		last := len(producer.keyFrameWaiters) == 0
+		producer.traceLocker.Unlock()
+
+		if last && !producer.Closed() {
+			producer.updateTraceEvent()
+		}
+	}()
+
+	if first {
+		if err := producer.updateTraceEvent(); err != nil {
+			return err
+		}
+	}
+
+	if waiting != nil {
+		waiting()
+	}
+
+	select {
+	case <-received:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requestKeyFrame requests a key frame to the endpoint through a Consumer of the Producer whose
+// request is not ignored by mediasoup-worker, i.e. a video Consumer which is not paused. It
+// returns false if there is none.
+func (producer *Producer) requestKeyFrame() bool {
+	if producer.getConsumers == nil {
+		return false
+	}
+	for _, consumer := range producer.getConsumers() {
+		if consumer.Closed() || consumer.Paused() || consumer.ProducerPaused() {
+			continue
+		}
+		if triggered, err := consumer.RequestKeyFrame(); err == nil && triggered {
+			return true
+		}
+	}
+	return false
+}
+
+// updateTraceEvent enables the trace event types set by EnableTraceEvent() plus "keyframe" if
+// WaitForKeyFrame() is waiting. The requests are serialized by traceUpdateLocker, so the last one
+// sent matches the latest types. traceLocker is not held during the request since trace events
+// are delivered by the goroutine reading the response.
+func (producer *Producer) updateTraceEvent() error {
+	producer.traceUpdateLocker.Lock()
+	defer producer.traceUpdateLocker.Unlock()
+
+	producer.traceLocker.Lock()
+	types := append([]ProducerTraceEventType{}, producer.traceEventTypes...)
+	if len(producer.keyFrameWaiters) > 0 && !containsTraceEventType(types, ProducerTraceEventType_Keyframe) {
+		types = append(types, ProducerTraceEventType_Keyframe)
+	}
+	producer.traceLocker.Unlock()
+
 	result := producer.channel.Request("producer.enableTraceEvent", producer.internal, H{"types": types})
 
 	return result.Err()
 }
 
+func containsTraceEventType(types []ProducerTraceEventType, typ ProducerTraceEventType) bool {
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
 // Send RTP packet (just valid for Producers created on a DirectTransport).
 func (producer *Producer) Send(rtpPacket []byte) error {
 	return producer.payloadChannel.Notify("producer.send", producer.internal, "", rtpPacket)
@@ -427,6 +592,7 @@ func (producer *Producer) handleWorkerNotifications() {
 				return
 			}
 
+			producer.fillScoreRids(score)
 			producer.score = score
 
 			producer.SafeEmit("score", score)
@@ -463,6 +629,23 @@ func (producer *Producer) handleWorkerNotifications() {
 				return
 			}
 
+			if trace.Type == ProducerTraceEventType_Keyframe {
+				producer.traceLocker.Lock()
+				for waiter := range producer.keyFrameWaiters {
+					select {
+					case waiter <- struct{}{}:
+					default:
+					}
+				}
+				enabled := containsTraceEventType(producer.traceEventTypes, trace.Type)
+				producer.traceLocker.Unlock()
+
+				// Only enabled for WaitForKeyFrame().
+				if !enabled {
+					return
+				}
+			}
+
 			producer.SafeEmit("trace", trace)
 
 			// Emit observer event.
@@ -477,3 +660,19 @@ func (producer *Producer) handleWorkerNotifications() {
 		}
 	})
 }
+
+// fillScoreRids sets the RID of score entries the worker sent without it, looking up the
+// encoding by SSRC.
+func (producer *Producer) fillScoreRids(scores []ProducerScore) {
+	for i, score := range scores {
+		if len(score.Rid) > 0 {
+			continue
+		}
+		for _, encoding := range producer.data.RtpParameters.Encodings {
+			if encoding.Ssrc == score.Ssrc && encoding.Ssrc > 0 {
+				scores[i].Rid = encoding.Rid
+				break
+			}
+		}
+	}
+}
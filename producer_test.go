@@ -1,10 +1,14 @@
 package mediasoup
 
 import (
+	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/anjingxw/mediasoup-go/h264"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -469,6 +473,23 @@ func (suite *ProducerTestingSuite) TestProducerEnableTraceEventSucceed() {
 	suite.Zero(data.TraceEventTypes)
 }
 
+func (suite *ProducerTestingSuite) TestProducerWaitForKeyFrame() {
+	audioProducer := suite.audioProducer()
+	suite.IsType(TypeError{}, audioProducer.WaitForKeyFrame(context.Background()))
+
+	videoProducer := suite.videoProducer()
+	suite.NoError(videoProducer.EnableTraceEvent("rtp"))
+	suite.Equal([]ProducerTraceEventType{"rtp"}, videoProducer.TraceEventTypes())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	suite.Equal(context.DeadlineExceeded, videoProducer.WaitForKeyFrame(ctx))
+
+	// The types enabled by EnableTraceEvent() are restored.
+	data, _ := videoProducer.Dump()
+	suite.EqualValues("rtp", data.TraceEventTypes)
+}
+
 func (suite *ProducerTestingSuite) TestProducerEmitsScore() {
 	videoProducer := suite.videoProducer()
 	channel := videoProducer.channel
@@ -490,6 +511,39 @@ func (suite *ProducerTestingSuite) TestProducerEmitsScore() {
 	}, videoProducer.Score())
 }
 
+func (suite *ProducerTestingSuite) TestSimulcastProducerScoreContainsRid() {
+	videoProducer, err := suite.transport1.Produce(ProducerOptions{
+		Kind: MediaKind_Video,
+		RtpParameters: RtpParameters{
+			Mid: "VIDEO2",
+			Codecs: []*RtpCodecParameters{
+				{
+					MimeType:    "video/VP8",
+					PayloadType: 112,
+					ClockRate:   90000,
+				},
+			},
+			Encodings: []RtpEncodingParameters{
+				{Ssrc: 33333330, Rid: "r0"},
+				{Ssrc: 33333331, Rid: "r1"},
+			},
+		},
+	})
+	suite.NoError(err)
+	suite.Equal(ProducerType_Simulcast, videoProducer.Type())
+
+	channel := videoProducer.channel
+	subscriber, _ := channel.subscribers.Load(videoProducer.Id())
+	emit := subscriber.(channelSubscriber)
+
+	emit("score", []byte(`[ { "encodingIdx": 0, "ssrc": 33333330, "rid": "r0", "score": 10 }, { "encodingIdx": 1, "ssrc": 33333331, "score": 7 } ]`))
+
+	suite.Equal([]ProducerScore{
+		{EncodingIdx: 0, Ssrc: 33333330, Rid: "r0", Score: 10},
+		{EncodingIdx: 1, Ssrc: 33333331, Rid: "r1", Score: 7},
+	}, videoProducer.Score())
+}
+
 func (suite *ProducerTestingSuite) TestProduceClose_Succeeds() {
 	onObserverClose := NewMockFunc(suite.T())
 
@@ -553,3 +607,46 @@ func (suite *ProducerTestingSuite) videoProducer() *Producer {
 func TestProducerTestingSuite(t *testing.T) {
 	suite.Run(t, new(ProducerTestingSuite))
 }
+
+func TestProducerRequestKeyFrame(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		requested []string
+	)
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		if req.method == "consumer.requestKeyFrame" {
+			mu.Lock()
+			requested = append(requested, req.handlerId)
+			mu.Unlock()
+		}
+		return "", nil
+	})
+	payloadChannel, _ := newFakePayloadChannel(t)
+
+	newVideoConsumer := func(id string, paused bool) *Consumer {
+		consumer := newFakeConsumer(t, channel, payloadChannel)
+		consumer.internal.ConsumerId = id
+		consumer.data.Kind = MediaKind_Video
+		consumer.paused = paused
+		return consumer
+	}
+	consumers := []*Consumer{newVideoConsumer("paused", true)}
+
+	producer := newProducer(producerParams{
+		internal:       internalData{ProducerId: "producer"},
+		data:           producerData{Kind: MediaKind_Video},
+		channel:        channel,
+		payloadChannel: payloadChannel,
+		getConsumers:   func() []*Consumer { return consumers },
+	})
+
+	// The requests of paused Consumers are ignored by the worker.
+	assert.False(t, producer.requestKeyFrame())
+
+	consumers = append(consumers, newVideoConsumer("active1", false), newVideoConsumer("active2", false))
+	assert.True(t, producer.requestKeyFrame())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"active1"}, requested)
+}
@@ -0,0 +1,240 @@
+package mediasoup
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RecordingSink receives the RTP packets of a Consumer, see Consumer.AttachSink().
+type RecordingSink interface {
+	// Write is called with every RTP packet, from a single goroutine.
+	Write(rtp []byte) error
+
+	// Close is called once, after the last Write().
+	Close() error
+}
+
+// recordingSinkQueueSize is the number of packets buffered for a slow RecordingSink before
+// packets are dropped.
+const recordingSinkQueueSize = 256
+
+// recordingSinkAttachment forwards the "rtp" events of a Consumer to a RecordingSink on its own
+// goroutine.
+type recordingSinkAttachment struct {
+	consumer       *Consumer
+	sink           RecordingSink
+	packets        chan []byte
+	locker         sync.Mutex
+	closed         bool
+	dropped        uint64
+	done           chan struct{}
+	err            error
+	removeListener func()
+	detachOnce     sync.Once
+}
+
+// AttachSink forwards the RTP packets of the Consumer to sink until the returned detach function
+// is called or the Consumer is closed. Packets are buffered for a slow sink and dropped once the
+// buffer is full, so the sink never stalls the PayloadChannel. A sink failing to write a packet
+// receives no more packets. Detaching waits for the buffered packets to be written, closes the
+// sink and returns the first error met.
+func (consumer *Consumer) AttachSink(sink RecordingSink) (detach func() error) {
+	consumer.logger.V(1).Info("attachSink()")
+
+	a := &recordingSinkAttachment{
+		consumer: consumer,
+		sink:     sink,
+		packets:  make(chan []byte, recordingSinkQueueSize),
+		done:     make(chan struct{}),
+	}
+	a.removeListener = listen(consumer.IEventEmitter, "rtp", a.push)
+
+	go a.run()
+	go func() {
+		select {
+		case <-consumer.Context().Done():
+			a.detach()
+		case <-a.done:
+		}
+	}()
+
+	return a.detach
+}
+
+func (a *recordingSinkAttachment) push(packet []byte) {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	if a.closed {
+		return
+	}
+	select {
+	case a.packets <- packet:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+}
+
+func (a *recordingSinkAttachment) run() {
+	defer close(a.done)
+
+	for packet := range a.packets {
+		if a.err != nil {
+			continue
+		}
+		if err := a.sink.Write(packet); err != nil {
+			a.consumer.logger.Error(err, "recording sink write failed, dropping next packets")
+			a.err = err
+		}
+	}
+	if err := a.sink.Close(); err != nil && a.err == nil {
+		a.err = err
+	}
+}
+
+func (a *recordingSinkAttachment) detach() error {
+	a.detachOnce.Do(func() {
+		a.removeListener()
+
+		a.locker.Lock()
+		a.closed = true
+		close(a.packets)
+		a.locker.Unlock()
+
+		if dropped := atomic.LoadUint64(&a.dropped); dropped > 0 {
+			a.consumer.logger.Info("recording sink was too slow", "dropped", dropped)
+		}
+	})
+	<-a.done
+
+	return a.err
+}
+
+// PipeRtpTo writes the RTP packets of the Consumer to w until the returned stop function is
+// called or the Consumer is closed, so they can be piped to an external process or socket. Each
+// packet is preceded by its length as a 16-bit big-endian integer, the framing of RFC 4571.
+// Packets are buffered as by AttachSink(). If a write fails, piping stops and onError, if not nil,
+// is called with the error. w is not closed.
+func (consumer *Consumer) PipeRtpTo(w io.Writer, onError func(err error)) (stop func()) {
+	consumer.logger.V(1).Info("pipeRtpTo()")
+
+	failed := make(chan error, 1)
+	detach := consumer.AttachSink(&rtpWriterSink{writer: w, failed: failed})
+
+	var stopOnce sync.Once
+	stopped := make(chan struct{})
+	stop = func() {
+		stopOnce.Do(func() {
+			detach()
+			close(stopped)
+		})
+	}
+
+	go func() {
+		select {
+		case err := <-failed:
+			stop()
+			if onError != nil {
+				onError(err)
+			}
+		case <-consumer.Context().Done():
+			stop()
+		case <-stopped:
+		}
+	}()
+
+	return stop
+}
+
+// rtpWriterSink is the RecordingSink of PipeRtpTo().
+type rtpWriterSink struct {
+	writer io.Writer
+	failed chan<- error
+}
+
+func (sink *rtpWriterSink) Write(rtp []byte) error {
+	frame := make([]byte, 2+len(rtp))
+	binary.BigEndian.PutUint16(frame, uint16(len(rtp)))
+	copy(frame[2:], rtp)
+
+	if _, err := sink.writer.Write(frame); err != nil {
+		sink.failed <- err
+		return err
+	}
+	return nil
+}
+
+func (sink *rtpWriterSink) Close() error {
+	return nil
+}
+
+// FileRecordingSink is a RecordingSink writing the packets to a file in the rtpdump format of
+// rtptools, which Wireshark can also read. It is meant for debugging.
+type FileRecordingSink struct {
+	locker sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	start  time.Time
+}
+
+// NewFileRecordingSink creates the file at path, truncating it, and writes the rtpdump header.
+func NewFileRecordingSink(path string) (*FileRecordingSink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	sink := &FileRecordingSink{
+		file:   file,
+		writer: bufio.NewWriter(file),
+		start:  time.Now(),
+	}
+
+	// "#!rtpplay1.0 address/port\n" followed by the binary file header: start time (seconds and
+	// microseconds), source address and port, and padding.
+	header := make([]byte, 16)
+	binary.BigEndian.PutUint32(header[0:], uint32(sink.start.Unix()))
+	binary.BigEndian.PutUint32(header[4:], uint32(sink.start.Nanosecond()/1000))
+
+	sink.writer.WriteString("#!rtpplay1.0 0.0.0.0/0\n")
+	if _, err = sink.writer.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// Write writes the packet preceded by its rtpdump header: the length of the record, the length
+// of the packet and the milliseconds elapsed since the file creation.
+func (sink *FileRecordingSink) Write(rtp []byte) error {
+	sink.locker.Lock()
+	defer sink.locker.Unlock()
+
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint16(header[0:], uint16(len(rtp)+len(header)))
+	binary.BigEndian.PutUint16(header[2:], uint16(len(rtp)))
+	binary.BigEndian.PutUint32(header[4:], uint32(time.Since(sink.start)/time.Millisecond))
+
+	if _, err := sink.writer.Write(header); err != nil {
+		return err
+	}
+	_, err := sink.writer.Write(rtp)
+	return err
+}
+
+// Close flushes and closes the file.
+func (sink *FileRecordingSink) Close() error {
+	sink.locker.Lock()
+	defer sink.locker.Unlock()
+
+	if err := sink.writer.Flush(); err != nil {
+		sink.file.Close()
+		return err
+	}
+	return sink.file.Close()
+}
@@ -0,0 +1,179 @@
+package mediasoup
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryRecordingSink struct {
+	locker   sync.Mutex
+	packets  [][]byte
+	closed   int
+	writeErr error
+}
+
+func (sink *memoryRecordingSink) Write(rtp []byte) error {
+	sink.locker.Lock()
+	defer sink.locker.Unlock()
+
+	if sink.writeErr != nil {
+		return sink.writeErr
+	}
+	sink.packets = append(sink.packets, rtp)
+	return nil
+}
+
+func (sink *memoryRecordingSink) Close() error {
+	sink.locker.Lock()
+	defer sink.locker.Unlock()
+
+	sink.closed++
+	return nil
+}
+
+func (sink *memoryRecordingSink) count() (packets, closed int) {
+	sink.locker.Lock()
+	defer sink.locker.Unlock()
+
+	return len(sink.packets), sink.closed
+}
+
+func newRecordingTestConsumer() *Consumer {
+	consumer := &Consumer{
+		IEventEmitter: NewEventEmitter(),
+		logger:        NewLogger("Consumer"),
+	}
+	consumer.ctx, consumer.cancel = context.WithCancel(context.Background())
+	return consumer
+}
+
+func TestConsumerAttachSink(t *testing.T) {
+	consumer := newRecordingTestConsumer()
+	defer consumer.cancel()
+
+	sink := &memoryRecordingSink{}
+	detach := consumer.AttachSink(sink)
+
+	for i := 0; i < 10; i++ {
+		consumer.emitRtp([]byte{0x80, 0x60, 0, byte(i)})
+	}
+
+	// Detaching flushes the buffered packets then closes the sink.
+	require.NoError(t, detach())
+	packets, closed := sink.count()
+	assert.Equal(t, 10, packets)
+	assert.Equal(t, 1, closed)
+
+	// Packets after detach are not forwarded and detaching again does nothing.
+	consumer.emitRtp([]byte{0x80, 0x60, 0, 10})
+	require.NoError(t, detach())
+	packets, closed = sink.count()
+	assert.Equal(t, 10, packets)
+	assert.Equal(t, 1, closed)
+}
+
+func TestConsumerAttachSinkStopsOnConsumerClose(t *testing.T) {
+	consumer := newRecordingTestConsumer()
+
+	sink := &memoryRecordingSink{}
+	detach := consumer.AttachSink(sink)
+	consumer.emitRtp([]byte{0x80, 0x60, 0, 1})
+	consumer.cancel()
+
+	assert.Eventually(t, func() bool {
+		_, closed := sink.count()
+		return closed == 1
+	}, time.Second, time.Millisecond)
+	require.NoError(t, detach())
+}
+
+func TestConsumerAttachSinkWriteError(t *testing.T) {
+	consumer := newRecordingTestConsumer()
+	defer consumer.cancel()
+
+	writeErr := errors.New("disk full")
+	sink := &memoryRecordingSink{writeErr: writeErr}
+	detach := consumer.AttachSink(sink)
+	consumer.emitRtp([]byte{0x80, 0x60, 0, 1})
+
+	assert.Equal(t, writeErr, detach())
+	_, closed := sink.count()
+	assert.Equal(t, 1, closed)
+}
+
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write(p []byte) (int, error) { return 0, w.err }
+
+func TestConsumerPipeRtpTo(t *testing.T) {
+	consumer := newRecordingTestConsumer()
+	defer consumer.cancel()
+
+	var buffer bytes.Buffer
+	stop := consumer.PipeRtpTo(&buffer, func(err error) { t.Error(err) })
+	consumer.emitRtp([]byte{0x80, 0x60, 0, 1})
+	consumer.emitRtp([]byte{0x80, 0x60, 0, 2, 0xff})
+	stop()
+	consumer.emitRtp([]byte{0x80, 0x60, 0, 3})
+	stop()
+
+	assert.Equal(t, []byte{0, 4, 0x80, 0x60, 0, 1, 0, 5, 0x80, 0x60, 0, 2, 0xff}, buffer.Bytes())
+}
+
+func TestConsumerPipeRtpToWriteError(t *testing.T) {
+	consumer := newRecordingTestConsumer()
+	defer consumer.cancel()
+
+	writeErr := errors.New("broken pipe")
+	errs := make(chan error, 2)
+	stop := consumer.PipeRtpTo(failingWriter{err: writeErr}, func(err error) { errs <- err })
+	consumer.emitRtp([]byte{0x80, 0x60, 0, 1})
+	consumer.emitRtp([]byte{0x80, 0x60, 0, 2})
+
+	select {
+	case err := <-errs:
+		assert.Equal(t, writeErr, err)
+	case <-time.After(time.Second):
+		t.Fatal("onError not called")
+	}
+	stop()
+	assert.Empty(t, errs)
+	assert.Zero(t, consumer.ListenerCount("rtp"))
+}
+
+func TestFileRecordingSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "consumer.rtpdump")
+
+	sink, err := NewFileRecordingSink(path)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write([]byte{0x80, 0x60, 0, 1}))
+	require.NoError(t, sink.Write([]byte{0x80, 0x60, 0, 2, 0xff}))
+	require.NoError(t, sink.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	header := "#!rtpplay1.0 0.0.0.0/0\n"
+	require.True(t, len(data) > len(header)+16)
+	assert.Equal(t, header, string(data[:len(header)]))
+	data = data[len(header)+16:]
+
+	for _, packet := range [][]byte{{0x80, 0x60, 0, 1}, {0x80, 0x60, 0, 2, 0xff}} {
+		require.True(t, len(data) >= 8+len(packet))
+		assert.EqualValues(t, 8+len(packet), binary.BigEndian.Uint16(data[0:]))
+		assert.EqualValues(t, len(packet), binary.BigEndian.Uint16(data[2:]))
+		assert.Equal(t, packet, data[8:8+len(packet)])
+		data = data[8+len(packet):]
+	}
+	assert.Empty(t, data)
+}
@@ -0,0 +1,283 @@
+package mediasoup
+
+import (
+	"sync"
+
+	"github.com/go-logr/logr"
+)
+
+// RoomPeer define a peer joining a RoomManager.
+type RoomPeer struct {
+	// Id of the peer. It must be unique within the RoomManager.
+	Id string
+
+	// Transport used to consume the Producers of the other peers.
+	Transport ITransport
+
+	// RtpCapabilities of the peer's device.
+	RtpCapabilities RtpCapabilities
+
+	// Paused define whether Consumers are created paused. Default false.
+	Paused bool
+}
+
+type roomPeer struct {
+	RoomPeer
+	producers map[string]*Producer // producerId:*Producer
+	consumers map[string]*Consumer // producerId:*Consumer
+}
+
+// RoomManager is a thin helper doing the usual SFU bookkeeping on top of a Router: every Producer
+// added by a peer is consumed by every other peer able to consume it, and Consumers are removed
+// when their Producer or peer leaves. It is built only on the public Router, Transport, Producer
+// and Consumer APIs, so applications needing finer control can still use those directly.
+//
+//   - @emits consumercreated - (peerId string, consumer *Consumer)
+//   - @emits consumerclosed - (peerId string, consumer *Consumer)
+type RoomManager struct {
+	IEventEmitter
+	logger            logr.Logger
+	router            *Router
+	locker            sync.Mutex
+	peers             map[string]*roomPeer
+	producerPeers     map[string]string // producerId:peerId
+	onConsumerCreated func(peerId string, consumer *Consumer)
+	onConsumerClosed  func(peerId string, consumer *Consumer)
+}
+
+// NewRoomManager creates a RoomManager on top of the given Router.
+func NewRoomManager(router *Router) *RoomManager {
+	logger := NewLogger("RoomManager")
+
+	logger.V(1).Info("constructor()", "routerId", router.Id())
+
+	return &RoomManager{
+		IEventEmitter: NewEventEmitter(),
+		logger:        logger,
+		router:        router,
+		peers:         make(map[string]*roomPeer),
+		producerPeers: make(map[string]string),
+	}
+}
+
+// AddPeer adds a peer and consumes every Producer of the other peers it can consume.
+func (m *RoomManager) AddPeer(peer RoomPeer) error {
+	m.logger.V(1).Info("addPeer()", "peerId", peer.Id)
+
+	if len(peer.Id) == 0 {
+		return NewTypeError("missing peer id")
+	}
+	if peer.Transport == nil {
+		return NewTypeError("missing peer transport")
+	}
+
+	m.locker.Lock()
+
+	if _, ok := m.peers[peer.Id]; ok {
+		m.locker.Unlock()
+		return NewTypeError("peer with id %q already exists", peer.Id)
+	}
+	newPeer := &roomPeer{
+		RoomPeer:  peer,
+		producers: make(map[string]*Producer),
+		consumers: make(map[string]*Consumer),
+	}
+	m.peers[peer.Id] = newPeer
+
+	var producers []*Producer
+	for _, other := range m.peers {
+		for _, producer := range other.producers {
+			producers = append(producers, producer)
+		}
+	}
+
+	m.locker.Unlock()
+
+	for _, producer := range producers {
+		m.consume(newPeer, producer)
+	}
+
+	return nil
+}
+
+// RemovePeer removes a peer, closing its Producers and Consumers.
+func (m *RoomManager) RemovePeer(peerId string) {
+	m.logger.V(1).Info("removePeer()", "peerId", peerId)
+
+	m.locker.Lock()
+
+	peer, ok := m.peers[peerId]
+	if !ok {
+		m.locker.Unlock()
+		return
+	}
+	delete(m.peers, peerId)
+
+	producers := make([]*Producer, 0, len(peer.producers))
+	for producerId, producer := range peer.producers {
+		delete(m.producerPeers, producerId)
+		producers = append(producers, producer)
+	}
+	consumers := make([]*Consumer, 0, len(peer.consumers))
+	for _, consumer := range peer.consumers {
+		consumers = append(consumers, consumer)
+	}
+
+	m.locker.Unlock()
+
+	// Closing a Producer makes the worker close its Consumers in other peers.
+	for _, producer := range producers {
+		producer.Close()
+	}
+	for _, consumer := range consumers {
+		consumer.Close()
+	}
+}
+
+// AddProducer registers a Producer of the given peer and consumes it in every other peer able to
+// consume it.
+func (m *RoomManager) AddProducer(peerId string, producer *Producer) error {
+	m.logger.V(1).Info("addProducer()", "peerId", peerId, "producerId", producer.Id())
+
+	m.locker.Lock()
+
+	peer, ok := m.peers[peerId]
+	if !ok {
+		m.locker.Unlock()
+		return NewTypeError("peer with id %q not found", peerId)
+	}
+	if producer.Closed() {
+		m.locker.Unlock()
+		return NewInvalidStateError("producer closed")
+	}
+	peer.producers[producer.Id()] = producer
+	m.producerPeers[producer.Id()] = peerId
+
+	others := make([]*roomPeer, 0, len(m.peers))
+	for _, other := range m.peers {
+		if other != peer {
+			others = append(others, other)
+		}
+	}
+
+	m.locker.Unlock()
+
+	producerClosed := func() {
+		m.removeProducer(peer, producer)
+	}
+	producer.On("@close", producerClosed)
+	producer.On("transportclose", producerClosed)
+
+	for _, other := range others {
+		m.consume(other, producer)
+	}
+
+	return nil
+}
+
+// PeerIdOfProducer returns the id of the peer owning the given Producer.
+func (m *RoomManager) PeerIdOfProducer(producerId string) (peerId string, ok bool) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	peerId, ok = m.producerPeers[producerId]
+	return
+}
+
+// Consumers returns the Consumers created for the given peer.
+func (m *RoomManager) Consumers(peerId string) []*Consumer {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	peer, ok := m.peers[peerId]
+	if !ok {
+		return nil
+	}
+	consumers := make([]*Consumer, 0, len(peer.consumers))
+	for _, consumer := range peer.consumers {
+		consumers = append(consumers, consumer)
+	}
+	return consumers
+}
+
+// OnConsumerCreated set handler on "consumercreated" event
+func (m *RoomManager) OnConsumerCreated(handler func(peerId string, consumer *Consumer)) {
+	m.onConsumerCreated = handler
+}
+
+// OnConsumerClosed set handler on "consumerclosed" event
+func (m *RoomManager) OnConsumerClosed(handler func(peerId string, consumer *Consumer)) {
+	m.onConsumerClosed = handler
+}
+
+// consume creates a Consumer of the producer in the peer's transport. It must be called without
+// holding the lock since the worker response is delivered by the same goroutine which emits the
+// close events handled here.
+func (m *RoomManager) consume(peer *roomPeer, producer *Producer) {
+	if !m.router.CanConsume(producer.Id(), peer.RtpCapabilities) {
+		return
+	}
+
+	consumer, err := peer.Transport.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: peer.RtpCapabilities,
+		Paused:          peer.Paused,
+	})
+	if err != nil {
+		m.logger.Error(err, "consume failed", "peerId", peer.Id, "producerId", producer.Id())
+		return
+	}
+
+	consumerClosed := func() {
+		m.removeConsumer(peer, producer.Id(), consumer)
+	}
+	consumer.On("@close", consumerClosed)
+	consumer.On("@producerclose", consumerClosed)
+	consumer.On("transportclose", consumerClosed)
+
+	m.locker.Lock()
+
+	// The peer or the producer may have left meanwhile.
+	if m.peers[peer.Id] != peer || producer.Closed() || consumer.Closed() {
+		m.locker.Unlock()
+		consumer.Close()
+		return
+	}
+	peer.consumers[producer.Id()] = consumer
+
+	m.locker.Unlock()
+
+	m.SafeEmit("consumercreated", peer.Id, consumer)
+
+	if handler := m.onConsumerCreated; handler != nil {
+		handler(peer.Id, consumer)
+	}
+}
+
+func (m *RoomManager) removeConsumer(peer *roomPeer, producerId string, consumer *Consumer) {
+	m.locker.Lock()
+
+	if peer.consumers[producerId] != consumer {
+		m.locker.Unlock()
+		return
+	}
+	delete(peer.consumers, producerId)
+
+	m.locker.Unlock()
+
+	m.SafeEmit("consumerclosed", peer.Id, consumer)
+
+	if handler := m.onConsumerClosed; handler != nil {
+		handler(peer.Id, consumer)
+	}
+}
+
+func (m *RoomManager) removeProducer(peer *roomPeer, producer *Producer) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	if peer.producers[producer.Id()] == producer {
+		delete(peer.producers, producer.Id())
+		delete(m.producerPeers, producer.Id())
+	}
+}
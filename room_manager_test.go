@@ -0,0 +1,91 @@
+package mediasoup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomManager(t *testing.T) {
+	router := CreateRouter()
+	defer router.Close()
+
+	createTransport := func() ITransport {
+		transport, err := router.CreateWebRtcTransport(WebRtcTransportOptions{
+			ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+		})
+		require.NoError(t, err)
+		return transport
+	}
+
+	manager := NewRoomManager(router)
+
+	createdCh := make(chan *Consumer, 10)
+	closedCh := make(chan *Consumer, 10)
+	manager.OnConsumerCreated(func(peerId string, consumer *Consumer) {
+		assert.Equal(t, "b", peerId)
+		createdCh <- consumer
+	})
+	manager.OnConsumerClosed(func(peerId string, consumer *Consumer) {
+		assert.Equal(t, "b", peerId)
+		closedCh <- consumer
+	})
+	expectConsumer := func(ch chan *Consumer) *Consumer {
+		select {
+		case consumer := <-ch:
+			return consumer
+		case <-time.After(time.Second):
+			require.FailNow(t, "consumer event not emitted")
+			return nil
+		}
+	}
+
+	transportA := createTransport()
+	require.NoError(t, manager.AddPeer(RoomPeer{
+		Id:              "a",
+		Transport:       transportA,
+		RtpCapabilities: consumerDeviceCapabilities,
+	}))
+	audioProducer := CreateAudioProducer(transportA)
+	require.NoError(t, manager.AddProducer("a", audioProducer))
+
+	// Peer "b" joins after the producer was added.
+	transportB := createTransport()
+	require.NoError(t, manager.AddPeer(RoomPeer{
+		Id:              "b",
+		Transport:       transportB,
+		RtpCapabilities: consumerDeviceCapabilities,
+	}))
+	audioConsumer := expectConsumer(createdCh)
+	assert.Equal(t, audioProducer.Id(), audioConsumer.ProducerId())
+	assert.Equal(t, []*Consumer{audioConsumer}, manager.Consumers("b"))
+	assert.Empty(t, manager.Consumers("a"))
+
+	peerId, ok := manager.PeerIdOfProducer(audioProducer.Id())
+	assert.True(t, ok)
+	assert.Equal(t, "a", peerId)
+
+	// Producer added after peer "b" joined.
+	videoProducer := CreateVP8Producer(transportA)
+	require.NoError(t, manager.AddProducer("a", videoProducer))
+	videoConsumer := expectConsumer(createdCh)
+	assert.Equal(t, videoProducer.Id(), videoConsumer.ProducerId())
+	assert.Len(t, manager.Consumers("b"), 2)
+
+	videoProducer.Close()
+	assert.Equal(t, videoConsumer, expectConsumer(closedCh))
+	assert.Equal(t, []*Consumer{audioConsumer}, manager.Consumers("b"))
+
+	_, ok = manager.PeerIdOfProducer(videoProducer.Id())
+	assert.False(t, ok)
+
+	manager.RemovePeer("a")
+	assert.Equal(t, audioConsumer, expectConsumer(closedCh))
+	assert.True(t, audioProducer.Closed())
+	assert.Empty(t, manager.Consumers("b"))
+
+	assert.IsType(t, TypeError{}, manager.AddProducer("a", CreateAudioProducer(transportB)))
+	assert.IsType(t, TypeError{}, manager.AddPeer(RoomPeer{Id: "b", Transport: transportB}))
+}
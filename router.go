@@ -1,6 +1,7 @@
 package mediasoup
 
 import (
+	"context"
 	"sort"
 	"strings"
 	"sync"
@@ -23,6 +24,13 @@ type RouterOptions struct {
 
 	// AppData is custom application data.
 	AppData interface{} `json:"appData,omitempty"`
+
+	// PauseProducerWhenNoConsumers is called when the last Consumer of a Producer of the Router is
+	// closed, unless the Producer is closed or paused. The Producer is then paused if it returns
+	// true. Pausing the Producer just stops the worker forwarding its media, so the application
+	// should also signal the producing endpoint to stop sending it, saving the ingest bandwidth.
+	// It is called on its own goroutine, and not if a Consumer was created meanwhile.
+	PauseProducerWhenNoConsumers func(producer *Producer) bool `json:"-"`
 }
 
 // PipeToRouterOptions define options to pipe an another router.
@@ -75,17 +83,20 @@ type routerParams struct {
 	// {
 	// 	routerId: string;
 	// };
-	internal       internalData
-	data           routerData
-	channel        *Channel
-	payloadChannel *PayloadChannel
-	appData        interface{}
+	internal          internalData
+	data              routerData
+	channel           *Channel
+	payloadChannel    *PayloadChannel
+	appData           interface{}
+	noConsumersPolicy func(producer *Producer) bool // RouterOptions.PauseProducerWhenNoConsumers
 }
 
 // Router enables injection, selection and forwarding of media streams through
 // Transport instances created on it.
 //
 //   - @emits workerclose
+//   - @emits newproducer - (producer *Producer)
+//   - @emits newconsumer - (consumer *Consumer)
 //   - @emits @close
 type Router struct {
 	IEventEmitter
@@ -101,9 +112,19 @@ type Router struct {
 	rtpObservers            sync.Map
 	dataProducers           sync.Map
 	mapRouterPipeTransports sync.Map
+	producerWaiters         map[string][]chan *Producer
+	producerWaitersLocker   sync.Mutex
+	producerConsumers       map[string]map[string]*Consumer // producerId:consumerId:*Consumer
+	producerConsumersLocker sync.Mutex
+	noConsumersPolicy       func(producer *Producer) bool // RouterOptions.PauseProducerWhenNoConsumers
+	codecOrderLocker        sync.RWMutex
+	codecOrder              []string
 	observer                IEventEmitter
+	onClose                 func()
 	onNewRtpObserver        func(observer IRtpObserver)
 	onNewTransport          func(transport ITransport)
+	onNewProducer           func(producer *Producer)
+	onNewConsumer           func(consumer *Consumer)
 }
 
 func newRouter(params routerParams) *Router {
@@ -111,14 +132,15 @@ func newRouter(params routerParams) *Router {
 	logger.V(1).Info("constructor()", "internal", params.internal)
 
 	return &Router{
-		IEventEmitter:  NewEventEmitter(),
-		logger:         logger,
-		internal:       params.internal,
-		data:           params.data,
-		channel:        params.channel,
-		payloadChannel: params.payloadChannel,
-		appData:        params.appData,
-		observer:       NewEventEmitter(),
+		IEventEmitter:     NewEventEmitter(),
+		logger:            logger,
+		internal:          params.internal,
+		data:              params.data,
+		channel:           params.channel,
+		payloadChannel:    params.payloadChannel,
+		appData:           params.appData,
+		observer:          NewEventEmitter(),
+		noConsumersPolicy: params.noConsumersPolicy,
 	}
 }
 
@@ -137,6 +159,80 @@ func (router *Router) RtpCapabilities() RtpCapabilities {
 	return router.data.RtpCapabilities
 }
 
+// SetPreferredCodecOrder sets the MIME types (e.g. "video/H264") of the codecs to advertise first
+// by PreferredCodecOrder(), since some clients pick the first offered codec. Every MIME type
+// must match a media codec of the Router. Calling it without MIME types restores the order of
+// RouterOptions.MediaCodecs.
+func (router *Router) SetPreferredCodecOrder(mimeTypes ...string) error {
+	router.logger.V(1).Info("setPreferredCodecOrder()", "mimeTypes", mimeTypes)
+
+	for _, mimeType := range mimeTypes {
+		found := false
+		for _, codec := range router.data.RtpCapabilities.Codecs {
+			if !codec.isRtxCodec() && strings.EqualFold(codec.MimeType, mimeType) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return NewTypeError("codec %q not supported by the router", mimeType)
+		}
+	}
+
+	router.codecOrderLocker.Lock()
+	defer router.codecOrderLocker.Unlock()
+
+	router.codecOrder = append([]string(nil), mimeTypes...)
+
+	return nil
+}
+
+// PreferredCodecOrder returns the RTP capabilities of the Router to advertise in the signaling,
+// with the codecs given to SetPreferredCodecOrder() first and each RTX codec following the codec
+// it is associated with. The order of RtpCapabilities() used to create Consumers is left
+// unchanged.
+func (router *Router) PreferredCodecOrder() RtpCapabilities {
+	router.codecOrderLocker.RLock()
+	defer router.codecOrderLocker.RUnlock()
+
+	caps := router.data.RtpCapabilities
+	codecs := caps.Codecs
+	if len(router.codecOrder) == 0 {
+		return caps
+	}
+
+	rank := func(codec *RtpCodecCapability) int {
+		for i, mimeType := range router.codecOrder {
+			if strings.EqualFold(codec.MimeType, mimeType) {
+				return i
+			}
+		}
+		return len(router.codecOrder)
+	}
+
+	var mediaCodecs []*RtpCodecCapability
+	for _, codec := range codecs {
+		if !codec.isRtxCodec() {
+			mediaCodecs = append(mediaCodecs, codec)
+		}
+	}
+	sort.SliceStable(mediaCodecs, func(i, j int) bool {
+		return rank(mediaCodecs[i]) < rank(mediaCodecs[j])
+	})
+
+	caps.Codecs = make([]*RtpCodecCapability, 0, len(codecs))
+	for _, codec := range mediaCodecs {
+		caps.Codecs = append(caps.Codecs, codec)
+		for _, rtxCodec := range codecs {
+			if rtxCodec.isRtxCodec() && rtxCodec.Parameters.Apt == codec.PreferredPayloadType {
+				caps.Codecs = append(caps.Codecs, rtxCodec)
+			}
+		}
+	}
+
+	return caps
+}
+
 // AppData returns App custom data.
 func (router *Router) AppData() interface{} {
 	return router.appData
@@ -213,8 +309,22 @@ func (router *Router) close() {
 	// Clear map of Router/PipeTransports.
 	router.mapRouterPipeTransports = sync.Map{}
 
+	// Release every pending ConsumeWhenAvailable() call.
+	router.producerWaitersLocker.Lock()
+	for _, waiters := range router.producerWaiters {
+		for _, waiter := range waiters {
+			close(waiter)
+		}
+	}
+	router.producerWaiters = nil
+	router.producerWaitersLocker.Unlock()
+
 	// Emit observer event.
 	router.observer.SafeEmit("close")
+
+	if handler := router.onClose; handler != nil {
+		handler()
+	}
 }
 
 // Dump Router.
@@ -286,6 +396,10 @@ func (router *Router) CreateWebRtcTransport(option WebRtcTransportOptions) (tran
 		err = NewTypeError("missing webRtcServer and listenIps (one of them is mandatory)")
 		return
 	}
+	if options.WebRtcServer != nil && options.WebRtcServer.Closed() {
+		err = NewInvalidStateError("webRtcServer closed")
+		return
+	}
 
 	router.logger.V(1).Info("createWebRtcTransport()")
 
@@ -394,6 +508,7 @@ func (router *Router) CreatePipeTransport(option PipeTransportOptions) (transpor
 	reqData := H{
 		"transportId":        internal.TransportId,
 		"listenIp":           options.ListenIp,
+		"port":               options.Port,
 		"enableSctp":         options.EnableSctp,
 		"numSctpStreams":     options.NumSctpStreams,
 		"maxSctpMessageSize": options.MaxSctpMessageSize,
@@ -634,9 +749,9 @@ func (router *Router) PipeToRouter(option PipeToRouterOptions) (result *PipeToRo
 		}
 
 		// Pipe events from the pipe Consumer to the pipe Producer.
-		pipeConsumer.Observer().On("close", func() { pipeProducer.Close() })
-		pipeConsumer.Observer().On("pause", func() { pipeProducer.Pause() })
-		pipeConsumer.Observer().On("resume", func() { pipeProducer.Resume() })
+		pipeConsumer.observer.On("close", func() { pipeProducer.Close() })
+		pipeConsumer.observer.On("pause", func() { pipeProducer.Pause() })
+		pipeConsumer.observer.On("resume", func() { pipeProducer.Resume() })
 
 		// Pipe events from the pipe Producer to the pipe Consumer.
 		pipeProducer.Observer().On("close", func() { pipeConsumer.Close() })
@@ -849,6 +964,174 @@ func (router *Router) CanConsume(producerId string, rtpCapabilities RtpCapabilit
 	return ok
 }
 
+// ConsumeWhenAvailable waits for the Producer with the given id to be created in the Router
+// and then consumes it on the given transport. It avoids races in the signaling where the
+// consume request arrives before the produce one. The wait is bounded by ctx.
+func (router *Router) ConsumeWhenAvailable(ctx context.Context, transport ITransport,
+	producerId string, rtpCapabilities RtpCapabilities) (consumer *Consumer, err error) {
+	router.logger.V(1).Info("consumeWhenAvailable()", "producerId", producerId)
+
+	if _, err = router.waitForProducer(ctx, producerId); err != nil {
+		return
+	}
+
+	return transport.Consume(ConsumerOptions{
+		ProducerId:      producerId,
+		RtpCapabilities: rtpCapabilities,
+	})
+}
+
+// waitForProducer returns the Producer with the given id, waiting for it to be created
+// if needed.
+func (router *Router) waitForProducer(ctx context.Context, producerId string) (*Producer, error) {
+	router.producerWaitersLocker.Lock()
+
+	if router.Closed() {
+		router.producerWaitersLocker.Unlock()
+		return nil, NewInvalidStateError("Router closed")
+	}
+	if value, ok := router.producers.Load(producerId); ok {
+		router.producerWaitersLocker.Unlock()
+		return value.(*Producer), nil
+	}
+	if router.producerWaiters == nil {
+		router.producerWaiters = make(map[string][]chan *Producer)
+	}
+	waiter := make(chan *Producer, 1)
+	router.producerWaiters[producerId] = append(router.producerWaiters[producerId], waiter)
+
+	router.producerWaitersLocker.Unlock()
+
+	select {
+	case producer, ok := <-waiter:
+		if !ok {
+			return nil, NewInvalidStateError("Router closed")
+		}
+		return producer, nil
+
+	case <-ctx.Done():
+		router.producerWaitersLocker.Lock()
+		waiters := router.producerWaiters[producerId]
+		for i, w := range waiters {
+			if w == waiter {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) > 0 {
+			router.producerWaiters[producerId] = waiters
+		} else {
+			delete(router.producerWaiters, producerId)
+		}
+		router.producerWaitersLocker.Unlock()
+
+		return nil, ctx.Err()
+	}
+}
+
+// addProducer stores the Producer and wakes up the calls waiting for it.
+func (router *Router) addProducer(producer *Producer) {
+	router.producerWaitersLocker.Lock()
+	defer router.producerWaitersLocker.Unlock()
+
+	router.producers.Store(producer.Id(), producer)
+
+	for _, waiter := range router.producerWaiters[producer.Id()] {
+		waiter <- producer
+	}
+	delete(router.producerWaiters, producer.Id())
+}
+
+// addConsumer adds the consumer to the reverse index of the Consumers of each Producer, until it
+// is closed.
+func (router *Router) addConsumer(consumer *Consumer) {
+	producerId := consumer.ProducerId()
+
+	router.producerConsumersLocker.Lock()
+	if router.producerConsumers == nil {
+		router.producerConsumers = make(map[string]map[string]*Consumer)
+	}
+	consumers := router.producerConsumers[producerId]
+	if consumers == nil {
+		consumers = make(map[string]*Consumer)
+		router.producerConsumers[producerId] = consumers
+	}
+	consumers[consumer.Id()] = consumer
+	router.producerConsumersLocker.Unlock()
+
+	// removeConsumer returns whether the Consumer was the last one of the Producer.
+	removeConsumer := func() bool {
+		router.producerConsumersLocker.Lock()
+		defer router.producerConsumersLocker.Unlock()
+
+		consumers := router.producerConsumers[producerId]
+		if consumers[consumer.Id()] != consumer {
+			return false
+		}
+		delete(consumers, consumer.Id())
+		if len(consumers) == 0 {
+			delete(router.producerConsumers, producerId)
+			return true
+		}
+		return false
+	}
+	consumer.On("@producerclose", removeConsumer)
+	for _, event := range []string{"@close", "transportclose"} {
+		consumer.On(event, func() {
+			if removeConsumer() {
+				router.producerUnconsumed(producerId)
+			}
+		})
+	}
+}
+
+// producerUnconsumed applies the PauseProducerWhenNoConsumers policy to the Producer whose last
+// Consumer was closed. The consumer may be closed by a worker notification, so the Producer is
+// paused on another goroutine not to block the Channel waiting for the response.
+func (router *Router) producerUnconsumed(producerId string) {
+	policy := router.noConsumersPolicy
+	if policy == nil {
+		return
+	}
+	value, ok := router.producers.Load(producerId)
+	if !ok {
+		return
+	}
+	producer := value.(*Producer)
+
+	go func() {
+		if producer.Closed() || producer.Paused() || len(router.producerConsumersOf(producerId)) > 0 {
+			return
+		}
+		if !policy(producer) {
+			return
+		}
+		router.logger.V(1).Info("pausing producer with no consumers", "producerId", producerId)
+
+		if err := producer.Pause(); err != nil {
+			router.logger.Error(err, "failed to pause producer with no consumers", "producerId", producerId)
+		}
+	}()
+}
+
+// producerConsumersOf returns the open Consumers of the Producer.
+func (router *Router) producerConsumersOf(producerId string) []*Consumer {
+	router.producerConsumersLocker.Lock()
+	defer router.producerConsumersLocker.Unlock()
+
+	consumers := make([]*Consumer, 0, len(router.producerConsumers[producerId]))
+	for _, consumer := range router.producerConsumers[producerId] {
+		consumers = append(consumers, consumer)
+	}
+	return consumers
+}
+
+// OnClose set handler on "close" event, emitted once the Router is closed, either by Close() or
+// because its Worker was closed.
+func (router *Router) OnClose(handler func()) {
+	router.onClose = handler
+}
+
 // OnNewRtpObserver set handler on "newrtpobserver" event
 func (router *Router) OnNewRtpObserver(handler func(transport IRtpObserver)) {
 	router.onNewRtpObserver = handler
@@ -859,6 +1142,40 @@ func (router *Router) OnNewTransport(handler func(transport ITransport)) {
 	router.onNewTransport = handler
 }
 
+// OnNewProducer set handler on "newproducer" event, emitted when a Producer is created on any
+// Transport of the Router, once it can be consumed.
+func (router *Router) OnNewProducer(handler func(producer *Producer)) {
+	router.onNewProducer = handler
+}
+
+// OnNewConsumer set handler on "newconsumer" event, emitted when a Consumer is created on any
+// Transport of the Router, once it is registered in its Transport.
+func (router *Router) OnNewConsumer(handler func(consumer *Consumer)) {
+	router.onNewConsumer = handler
+}
+
+// Consumers returns the Consumers of all the Transports of the Router.
+func (router *Router) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0)
+	router.transports.Range(func(key, value interface{}) bool {
+		consumers = append(consumers, value.(ITransport).Consumers()...)
+		return true
+	})
+	return consumers
+}
+
+// ConsumersByLabel returns the Consumers of every Transport of the Router with the label key set
+// to value, see Consumer.SetLabels().
+func (router *Router) ConsumersByLabel(key, value string) []*Consumer {
+	consumers := make([]*Consumer, 0)
+	for _, consumer := range router.Consumers() {
+		if consumer.hasLabel(key, value) {
+			consumers = append(consumers, consumer)
+		}
+	}
+	return consumers
+}
+
 // createTransport create a Transport interface.
 func (router *Router) createTransport(internal internalData, data, appData interface{}) (transport ITransport) {
 	if appData == nil {
@@ -902,6 +1219,7 @@ func (router *Router) createTransport(internal internalData, data, appData inter
 			}
 			return nil
 		},
+		getProducerConsumers: router.producerConsumersOf,
 	})
 
 	router.transports.Store(transport.Id(), transport)
@@ -912,7 +1230,22 @@ func (router *Router) createTransport(internal internalData, data, appData inter
 		router.transports.Delete(transport.Id())
 	})
 	transport.On("@newproducer", func(producer *Producer) {
-		router.producers.Store(producer.Id(), producer)
+		router.addProducer(producer)
+
+		router.SafeEmit("newproducer", producer)
+
+		if handler := router.onNewProducer; handler != nil {
+			handler(producer)
+		}
+	})
+	transport.On("@newconsumer", func(consumer *Consumer) {
+		router.addConsumer(consumer)
+
+		router.SafeEmit("newconsumer", consumer)
+
+		if handler := router.onNewConsumer; handler != nil {
+			handler(consumer)
+		}
 	})
 	transport.On("@producerclose", func(producer *Producer) {
 		router.producers.Delete(producer.Id())
@@ -1,7 +1,11 @@
 package mediasoup
 
 import (
+	"context"
+	"encoding/json"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/anjingxw/mediasoup-go/h264"
 	"github.com/stretchr/testify/assert"
@@ -99,3 +103,506 @@ func TestRouterEmitsWorkCloseIfWorkerIsClosed(t *testing.T) {
 	onObserverClose.ExpectCalled()
 	assert.True(t, router.Closed())
 }
+
+func TestRouterConsumeWhenAvailable_Succeeds(t *testing.T) {
+	worker := CreateTestWorker()
+	defer worker.Close()
+
+	router := CreateRouter(worker)
+	transport1, _ := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+	transport2, _ := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+
+	producerId := "deferred-producer"
+
+	result := asyncRun(func() (*Consumer, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		return router.ConsumeWhenAvailable(ctx, transport2, producerId, consumerDeviceCapabilities)
+	}, withWaitTimeout(0))
+
+	producer, err := transport1.Produce(ProducerOptions{
+		Id:   producerId,
+		Kind: MediaKind_Audio,
+		RtpParameters: RtpParameters{
+			Mid: "AUDIO",
+			Codecs: []*RtpCodecParameters{
+				{
+					MimeType:    "audio/opus",
+					PayloadType: 111,
+					ClockRate:   48000,
+					Channels:    2,
+				},
+			},
+			Encodings: []RtpEncodingParameters{{Ssrc: 11111111}},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.True(t, result.Finished())
+	assert.Nil(t, result.Out(1))
+	consumer := result.Out(0).(*Consumer)
+	assert.Equal(t, producer.Id(), consumer.ProducerId())
+}
+
+func TestRouterOnNewProducerAndConsumer(t *testing.T) {
+	worker := CreateTestWorker()
+	defer worker.Close()
+
+	router := CreateRouter(worker)
+
+	var (
+		transportIds []string
+		producerIds  []string
+		consumerIds  []string
+	)
+	router.OnNewTransport(func(transport ITransport) {
+		transportIds = append(transportIds, transport.Id())
+	})
+	router.OnNewProducer(func(producer *Producer) {
+		// The producer can already be consumed.
+		assert.True(t, router.CanConsume(producer.Id(), consumerDeviceCapabilities))
+		producerIds = append(producerIds, producer.Id())
+	})
+	router.OnNewConsumer(func(consumer *Consumer) {
+		consumerIds = append(consumerIds, consumer.Id())
+	})
+	onNewConsumer := NewMockFunc(t)
+	router.On("newconsumer", onNewConsumer.Fn())
+
+	transport1, err := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+	assert.NoError(t, err)
+	transport2, err := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{transport1.Id(), transport2.Id()}, transportIds)
+
+	producer := CreateAudioProducer(transport1)
+	assert.Equal(t, []string{producer.Id()}, producerIds)
+
+	consumer, err := transport2.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: consumerDeviceCapabilities,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{consumer.Id()}, consumerIds)
+	onNewConsumer.ExpectCalledWith(consumer)
+	assert.Equal(t, []*Consumer{consumer}, router.Consumers())
+
+	consumer.Close()
+	assert.Empty(t, router.Consumers())
+}
+
+func TestRouterConsumersByLabel(t *testing.T) {
+	worker := CreateTestWorker()
+	defer worker.Close()
+
+	router := CreateRouter(worker)
+
+	transport1, err := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+	assert.NoError(t, err)
+	transport2, err := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+	assert.NoError(t, err)
+
+	producer := CreateAudioProducer(transport1)
+
+	consume := func(labels map[string]string) *Consumer {
+		consumer, err := transport2.Consume(ConsumerOptions{
+			ProducerId:      producer.Id(),
+			RtpCapabilities: consumerDeviceCapabilities,
+		})
+		assert.NoError(t, err)
+		consumer.SetLabels(labels)
+		return consumer
+	}
+	consumer1 := consume(map[string]string{"room": "a", "tier": "hd"})
+	consumer2 := consume(map[string]string{"room": "a", "tier": "sd"})
+	consumer3 := consume(map[string]string{"room": "b"})
+	consume(nil)
+
+	assert.ElementsMatch(t, []*Consumer{consumer1, consumer2}, router.ConsumersByLabel("room", "a"))
+	assert.Equal(t, []*Consumer{consumer3}, router.ConsumersByLabel("room", "b"))
+	assert.Equal(t, []*Consumer{consumer2}, router.ConsumersByLabel("tier", "sd"))
+	assert.Empty(t, router.ConsumersByLabel("room", "c"))
+
+	consumer1.Close()
+	assert.Equal(t, []*Consumer{consumer2}, router.ConsumersByLabel("room", "a"))
+}
+
+func TestRouterExportTopology(t *testing.T) {
+	worker := CreateTestWorker()
+	defer worker.Close()
+
+	router := CreateRouter(worker)
+
+	transport1, err := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+	assert.NoError(t, err)
+	transport2, err := router.CreateDirectTransport()
+	assert.NoError(t, err)
+
+	producer := CreateAudioProducer(transport1)
+	consumer, err := transport2.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: consumerDeviceCapabilities,
+	})
+	assert.NoError(t, err)
+
+	topology := router.ExportTopology()
+	assert.Equal(t, router.Id(), topology.RouterId)
+	assert.Len(t, topology.Transports, 2)
+
+	transports := map[string]TransportTopology{}
+	for _, transport := range topology.Transports {
+		transports[transport.Id] = transport
+	}
+	assert.Equal(t, TransportTopology{
+		Id:   transport1.Id(),
+		Type: "webrtc",
+		Producers: []ProducerTopology{{
+			Id:          producer.Id(),
+			Kind:        MediaKind_Audio,
+			Type:        producer.Type(),
+			ConsumerIds: []string{consumer.Id()},
+		}},
+		Consumers:     []ConsumerTopology{},
+		DataProducers: []DataProducerTopology{},
+		DataConsumers: []DataConsumerTopology{},
+	}, transports[transport1.Id()])
+	assert.Equal(t, TransportTopology{
+		Id:        transport2.Id(),
+		Type:      "direct",
+		Producers: []ProducerTopology{},
+		Consumers: []ConsumerTopology{{
+			Id:         consumer.Id(),
+			ProducerId: producer.Id(),
+			Kind:       MediaKind_Audio,
+			Type:       ConsumerType_Simple,
+		}},
+		DataProducers: []DataProducerTopology{},
+		DataConsumers: []DataConsumerTopology{},
+	}, transports[transport2.Id()])
+
+	// No secret is exported.
+	data, err := json.Marshal(topology)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "iceParameters")
+	assert.NotContains(t, string(data), "dtlsParameters")
+
+	consumer.Close()
+	topology = router.ExportTopology()
+	for _, transport := range topology.Transports {
+		for _, producer := range transport.Producers {
+			assert.Empty(t, producer.ConsumerIds)
+		}
+	}
+}
+
+func TestRouterObserverEvents(t *testing.T) {
+	worker := CreateTestWorker()
+	defer worker.Close()
+
+	router := CreateRouter(worker)
+
+	var (
+		observedTransports   []string
+		handledTransports    []string
+		observedRtpObservers []string
+		handledRtpObservers  []string
+	)
+	router.Observer().On("newtransport", func(transport ITransport) {
+		observedTransports = append(observedTransports, transport.Id())
+	})
+	router.OnNewTransport(func(transport ITransport) {
+		// The transport is wired into the router before the handler runs.
+		assert.Contains(t, router.transportsForTesting(), transport.Id())
+		handledTransports = append(handledTransports, transport.Id())
+	})
+	router.Observer().On("newrtpobserver", func(rtpObserver IRtpObserver) {
+		observedRtpObservers = append(observedRtpObservers, rtpObserver.Id())
+	})
+	router.OnNewRtpObserver(func(rtpObserver IRtpObserver) {
+		handledRtpObservers = append(handledRtpObservers, rtpObserver.Id())
+	})
+	onObserverClose := NewMockFunc(t)
+	router.Observer().Once("close", onObserverClose.Fn())
+	closed := 0
+	router.OnClose(func() { closed++ })
+
+	webRtcTransport, err := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+	assert.NoError(t, err)
+	plainTransport, err := router.CreatePlainTransport(PlainTransportOptions{
+		ListenIp: TransportListenIp{Ip: "127.0.0.1"},
+	})
+	assert.NoError(t, err)
+	pipeTransport, err := router.CreatePipeTransport(PipeTransportOptions{
+		ListenIp: TransportListenIp{Ip: "127.0.0.1"},
+	})
+	assert.NoError(t, err)
+	directTransport, err := router.CreateDirectTransport()
+	assert.NoError(t, err)
+
+	expectedTransports := []string{
+		webRtcTransport.Id(), plainTransport.Id(), pipeTransport.Id(), directTransport.Id(),
+	}
+	assert.Equal(t, expectedTransports, observedTransports)
+	assert.Equal(t, expectedTransports, handledTransports)
+
+	audioLevelObserver, err := router.CreateAudioLevelObserver()
+	assert.NoError(t, err)
+	activeSpeakerObserver, err := router.CreateActiveSpeakerObserver()
+	assert.NoError(t, err)
+
+	expectedRtpObservers := []string{audioLevelObserver.Id(), activeSpeakerObserver.Id()}
+	assert.Equal(t, expectedRtpObservers, observedRtpObservers)
+	assert.Equal(t, expectedRtpObservers, handledRtpObservers)
+
+	router.Close()
+	onObserverClose.ExpectCalledTimes(1)
+	assert.Equal(t, 1, closed)
+
+	// Closing again emits nothing.
+	router.Close()
+	assert.Equal(t, 1, closed)
+}
+
+func TestRouterConsumeWhenAvailable_Timeout(t *testing.T) {
+	worker := CreateTestWorker()
+	defer worker.Close()
+
+	router := CreateRouter(worker)
+	transport, _ := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := router.ConsumeWhenAvailable(ctx, transport, "unknown", consumerDeviceCapabilities)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Empty(t, router.producerWaiters)
+}
+
+func TestRequestMetrics(t *testing.T) {
+	type metric struct {
+		method   string
+		entityId string
+		err      error
+	}
+	var metrics []metric
+
+	RequestMetrics = func(method, entityId string, dur time.Duration, err error) {
+		assert.True(t, dur > 0)
+		metrics = append(metrics, metric{method: method, entityId: entityId, err: err})
+	}
+	defer func() { RequestMetrics = nil }()
+
+	router := CreateRouter()
+	router.Dump()
+	router.Close()
+
+	assert.Equal(t, []metric{
+		{method: "worker.createRouter"},
+		{method: "router.dump", entityId: router.Id()},
+		{method: "worker.closeRouter"},
+	}, metrics)
+}
+
+func TestRouterPreferredCodecOrder(t *testing.T) {
+	rtpCapabilities, err := generateRouterRtpCapabilities(testRouterMediaCodecs)
+	assert.NoError(t, err)
+
+	router := newRouter(routerParams{data: routerData{RtpCapabilities: rtpCapabilities}})
+
+	mimeTypes := func(caps RtpCapabilities) (mimeTypes []string) {
+		for _, codec := range caps.Codecs {
+			mimeTypes = append(mimeTypes, codec.MimeType)
+		}
+		return
+	}
+
+	// The order of RouterOptions.MediaCodecs is advertised by default.
+	expected := []string{"audio/opus", "video/VP8", "video/rtx", "video/H264", "video/rtx"}
+	assert.Equal(t, expected, mimeTypes(router.RtpCapabilities()))
+	assert.Equal(t, expected, mimeTypes(router.PreferredCodecOrder()))
+
+	assert.NoError(t, router.SetPreferredCodecOrder("video/h264"))
+	caps := router.PreferredCodecOrder()
+	assert.Equal(t, []string{"video/H264", "video/rtx", "audio/opus", "video/VP8", "video/rtx"}, mimeTypes(caps))
+	assert.Equal(t, caps.Codecs[0].PreferredPayloadType, caps.Codecs[1].Parameters.Apt)
+	assert.Equal(t, caps.Codecs[3].PreferredPayloadType, caps.Codecs[4].Parameters.Apt)
+	assert.Equal(t, rtpCapabilities.HeaderExtensions, caps.HeaderExtensions)
+
+	// RtpCapabilities() is left unchanged.
+	assert.Equal(t, expected, mimeTypes(router.RtpCapabilities()))
+
+	assert.IsType(t, TypeError{}, router.SetPreferredCodecOrder("video/VP9"))
+	assert.IsType(t, TypeError{}, router.SetPreferredCodecOrder("video/rtx"))
+
+	assert.NoError(t, router.SetPreferredCodecOrder())
+	assert.Equal(t, expected, mimeTypes(router.PreferredCodecOrder()))
+}
+
+func TestRouterPauseProducerWhenNoConsumers(t *testing.T) {
+	worker := CreateTestWorker()
+	defer worker.Close()
+
+	var unconsumed []*Producer
+	var unconsumedLocker sync.Mutex
+	router, err := worker.CreateRouter(RouterOptions{
+		MediaCodecs: testRouterMediaCodecs,
+		PauseProducerWhenNoConsumers: func(producer *Producer) bool {
+			unconsumedLocker.Lock()
+			defer unconsumedLocker.Unlock()
+			unconsumed = append(unconsumed, producer)
+			return true
+		},
+	})
+	assert.NoError(t, err)
+
+	transport1, err := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+	assert.NoError(t, err)
+	transport2, err := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+	assert.NoError(t, err)
+
+	producer := CreateAudioProducer(transport1)
+
+	consume := func() *Consumer {
+		consumer, err := transport2.Consume(ConsumerOptions{
+			ProducerId:      producer.Id(),
+			RtpCapabilities: consumerDeviceCapabilities,
+		})
+		assert.NoError(t, err)
+		return consumer
+	}
+	consumer1, consumer2 := consume(), consume()
+
+	consumer1.Close()
+	time.Sleep(10 * time.Millisecond)
+	assert.False(t, producer.Paused())
+
+	consumer2.Close()
+	assert.Eventually(t, producer.Paused, time.Second, time.Millisecond)
+	unconsumedLocker.Lock()
+	assert.Equal(t, []*Producer{producer}, unconsumed)
+	unconsumedLocker.Unlock()
+}
+
+func TestRouterNoConsumersPolicy(t *testing.T) {
+	channel := newFakeWorkerChannel(t, nil)
+
+	pause := make(chan bool, 1)
+	unconsumed := make(chan *Producer, 1)
+	router := newRouter(routerParams{
+		internal: internalData{RouterId: "router"},
+		channel:  channel,
+		noConsumersPolicy: func(producer *Producer) bool {
+			unconsumed <- producer
+			return <-pause
+		},
+	})
+
+	producer := &Producer{
+		IEventEmitter: NewEventEmitter(),
+		logger:        NewLogger("Producer"),
+		internal:      internalData{ProducerId: "producer"},
+		channel:       channel,
+		observer:      NewEventEmitter(),
+	}
+	router.addProducer(producer)
+
+	newTestConsumer := func(consumerId string) *Consumer {
+		consumer := &Consumer{
+			IEventEmitter: NewEventEmitter(),
+			internal:      internalData{ConsumerId: consumerId},
+			data:          consumerData{ProducerId: "producer"},
+		}
+		router.addConsumer(consumer)
+		return consumer
+	}
+	waitUnconsumed := func() {
+		select {
+		case p := <-unconsumed:
+			assert.Equal(t, producer, p)
+		case <-time.After(time.Second):
+			t.Fatal("policy not called")
+		}
+	}
+
+	// The policy is not called while a Consumer remains, and may decline pausing.
+	consumer1, consumer2 := newTestConsumer("c1"), newTestConsumer("c2")
+	consumer1.Emit("@close")
+	consumer2.Emit("transportclose")
+	waitUnconsumed()
+	pause <- false
+	assert.Empty(t, unconsumed)
+
+	// The Producer closing its Consumers does not call the policy.
+	newTestConsumer("c3").Emit("@producerclose")
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, unconsumed)
+
+	consumer4 := newTestConsumer("c4")
+	consumer4.Emit("@close")
+	waitUnconsumed()
+	pause <- true
+	assert.Eventually(t, producer.Paused, time.Second, time.Millisecond)
+}
+
+func TestRouterExportTopologyConsumerLinks(t *testing.T) {
+	channel := newFakeWorkerChannel(t, nil)
+	payloadChannel, _ := newFakePayloadChannel(t)
+
+	router := newRouter(routerParams{
+		internal: internalData{RouterId: "router"},
+		channel:  channel,
+	})
+	transport := newDirectTransport(transportParams{
+		internal:       internalData{RouterId: "router", TransportId: "transport"},
+		channel:        channel,
+		payloadChannel: payloadChannel,
+	})
+	router.transports.Store(transport.Id(), transport)
+	producer := &Producer{internal: internalData{ProducerId: "producer"}}
+	transport.(*DirectTransport).ITransport.(*Transport).producers.Store(producer.Id(), producer)
+
+	// The Consumers are only known to the index of the Router.
+	for _, consumerId := range []string{"c2", "c1"} {
+		router.addConsumer(&Consumer{
+			IEventEmitter: NewEventEmitter(),
+			internal:      internalData{TransportId: "transport", ConsumerId: consumerId},
+			data:          consumerData{ProducerId: "producer"},
+		})
+	}
+
+	topology := router.ExportTopology()
+	if assert.Len(t, topology.Transports, 1) {
+		producers := topology.Transports[0].Producers
+		if assert.Len(t, producers, 1) {
+			assert.Equal(t, []string{"c1", "c2"}, producers[0].ConsumerIds)
+		}
+		consumers := topology.Transports[0].Consumers
+		if assert.Len(t, consumers, 2) {
+			assert.Equal(t, "c1", consumers[0].Id)
+			assert.Equal(t, "c2", consumers[1].Id)
+			assert.Equal(t, "producer", consumers[0].ProducerId)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package mediasoup
+
+import (
+	"sort"
+)
+
+// RouterTopology is a serializable snapshot of the media routing of a Router: its Transports and
+// the Producers and Consumers they hold, linked by id. It holds no secret such as ICE, DTLS or
+// SRTP parameters, nor any AppData, so it can be served by a debugging endpoint.
+type RouterTopology struct {
+	RouterId   string              `json:"routerId"`
+	Transports []TransportTopology `json:"transports"`
+}
+
+// TransportTopology is a Transport of a RouterTopology.
+type TransportTopology struct {
+	Id            string                 `json:"id"`
+	Type          string                 `json:"type"` // "webrtc", "plain", "pipe" or "direct".
+	Producers     []ProducerTopology     `json:"producers"`
+	Consumers     []ConsumerTopology     `json:"consumers"`
+	DataProducers []DataProducerTopology `json:"dataProducers"`
+	DataConsumers []DataConsumerTopology `json:"dataConsumers"`
+}
+
+// ProducerTopology is a Producer of a RouterTopology.
+type ProducerTopology struct {
+	Id     string       `json:"id"`
+	Kind   MediaKind    `json:"kind"`
+	Type   ProducerType `json:"type"`
+	Paused bool         `json:"paused"`
+
+	// ConsumerIds are the ids of the open Consumers of the Producer, in any Transport.
+	ConsumerIds []string `json:"consumerIds"`
+}
+
+// ConsumerTopology is a Consumer of a RouterTopology.
+type ConsumerTopology struct {
+	Id             string       `json:"id"`
+	ProducerId     string       `json:"producerId"`
+	Kind           MediaKind    `json:"kind"`
+	Type           ConsumerType `json:"type"`
+	Paused         bool         `json:"paused"`
+	ProducerPaused bool         `json:"producerPaused"`
+}
+
+// DataProducerTopology is a DataProducer of a RouterTopology.
+type DataProducerTopology struct {
+	Id string `json:"id"`
+}
+
+// DataConsumerTopology is a DataConsumer of a RouterTopology.
+type DataConsumerTopology struct {
+	Id             string `json:"id"`
+	DataProducerId string `json:"dataProducerId"`
+}
+
+// ExportTopology returns a snapshot of the media routing of the Router, built from the state
+// cached by the Router without issuing any request. Entities are sorted by id. The Consumers and
+// the links from Producers to Consumers are taken at once from the index of the Router, so every
+// id in ConsumerIds names a listed Consumer, and every listed Consumer of a listed Producer is in
+// its ConsumerIds, even while Consumers are created or closed. The Transports, Producers, data
+// entities and paused states are read separately, so they can be stale: an entity created or
+// closed meanwhile can be missing or still listed, e.g. a listed Consumer can name a Producer
+// that is not listed anymore.
+func (router *Router) ExportTopology() RouterTopology {
+	topology := RouterTopology{
+		RouterId:   router.Id(),
+		Transports: []TransportTopology{},
+	}
+
+	consumerIds := make(map[string][]string)
+	transportConsumers := make(map[string][]*Consumer)
+
+	router.producerConsumersLocker.Lock()
+	for producerId, consumers := range router.producerConsumers {
+		for consumerId, consumer := range consumers {
+			consumerIds[producerId] = append(consumerIds[producerId], consumerId)
+			transportId := consumer.internal.TransportId
+			transportConsumers[transportId] = append(transportConsumers[transportId], consumer)
+		}
+	}
+	router.producerConsumersLocker.Unlock()
+
+	for _, transport := range router.Transports() {
+		transportTopology := TransportTopology{
+			Id:            transport.Id(),
+			Type:          transportTopologyType(transport),
+			Producers:     []ProducerTopology{},
+			Consumers:     []ConsumerTopology{},
+			DataProducers: []DataProducerTopology{},
+			DataConsumers: []DataConsumerTopology{},
+		}
+		for _, producer := range transport.Producers() {
+			transportTopology.Producers = append(transportTopology.Producers, ProducerTopology{
+				Id:          producer.Id(),
+				Kind:        producer.Kind(),
+				Type:        producer.Type(),
+				Paused:      producer.Paused(),
+				ConsumerIds: append([]string{}, consumerIds[producer.Id()]...),
+			})
+		}
+		for _, consumer := range transportConsumers[transport.Id()] {
+			transportTopology.Consumers = append(transportTopology.Consumers, ConsumerTopology{
+				Id:             consumer.Id(),
+				ProducerId:     consumer.ProducerId(),
+				Kind:           consumer.Kind(),
+				Type:           consumer.Type(),
+				Paused:         consumer.Paused(),
+				ProducerPaused: consumer.ProducerPaused(),
+			})
+		}
+		for _, dataProducer := range transport.DataProducers() {
+			transportTopology.DataProducers = append(transportTopology.DataProducers, DataProducerTopology{
+				Id: dataProducer.Id(),
+			})
+		}
+		for _, dataConsumer := range transport.DataConsumers() {
+			transportTopology.DataConsumers = append(transportTopology.DataConsumers, DataConsumerTopology{
+				Id:             dataConsumer.Id(),
+				DataProducerId: dataConsumer.DataProducerId(),
+			})
+		}
+
+		for _, producer := range transportTopology.Producers {
+			sort.Strings(producer.ConsumerIds)
+		}
+		sort.Slice(transportTopology.Producers, func(i, j int) bool {
+			return transportTopology.Producers[i].Id < transportTopology.Producers[j].Id
+		})
+		sort.Slice(transportTopology.Consumers, func(i, j int) bool {
+			return transportTopology.Consumers[i].Id < transportTopology.Consumers[j].Id
+		})
+		sort.Slice(transportTopology.DataProducers, func(i, j int) bool {
+			return transportTopology.DataProducers[i].Id < transportTopology.DataProducers[j].Id
+		})
+		sort.Slice(transportTopology.DataConsumers, func(i, j int) bool {
+			return transportTopology.DataConsumers[i].Id < transportTopology.DataConsumers[j].Id
+		})
+
+		topology.Transports = append(topology.Transports, transportTopology)
+	}
+
+	sort.Slice(topology.Transports, func(i, j int) bool {
+		return topology.Transports[i].Id < topology.Transports[j].Id
+	})
+
+	return topology
+}
+
+func transportTopologyType(transport ITransport) string {
+	switch transport.(type) {
+	case *WebRtcTransport:
+		return "webrtc"
+	case *PlainTransport:
+		return "plain"
+	case *PipeTransport:
+		return "pipe"
+	case *DirectTransport:
+		return "direct"
+	default:
+		return "unknown"
+	}
+}
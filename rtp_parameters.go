@@ -18,6 +18,40 @@ type RtpCapabilities struct {
 	FecMechanisms []string `json:"fecMechanisms,omitempty"`
 }
 
+// FilterCapabilitiesByKind returns a copy of caps holding only the codecs of the given kind, the
+// RTX codecs associated with them included, and the header extensions valid for that kind. The
+// codecs and header extensions are shared with caps.
+func FilterCapabilitiesByKind(caps RtpCapabilities, kind MediaKind) RtpCapabilities {
+	filtered := RtpCapabilities{
+		FecMechanisms: caps.FecMechanisms,
+	}
+	payloadTypes := make(map[byte]bool)
+
+	for _, codec := range caps.Codecs {
+		if codec.Kind == kind && !codec.isRtxCodec() {
+			payloadTypes[codec.PreferredPayloadType] = true
+		}
+	}
+	for _, codec := range caps.Codecs {
+		if codec.Kind != kind {
+			continue
+		}
+		// An RTX codec is kept only along with its media codec.
+		if codec.isRtxCodec() && !payloadTypes[codec.Parameters.Apt] {
+			continue
+		}
+		filtered.Codecs = append(filtered.Codecs, codec)
+	}
+
+	for _, ext := range caps.HeaderExtensions {
+		if len(ext.Kind) == 0 || ext.Kind == kind {
+			filtered.HeaderExtensions = append(filtered.HeaderExtensions, ext)
+		}
+	}
+
+	return filtered
+}
+
 // Media kind ("audio" or "video").
 type MediaKind string
 
@@ -0,0 +1,38 @@
+package mediasoup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterCapabilitiesByKind(t *testing.T) {
+	caps := RtpCapabilities{
+		Codecs: []*RtpCodecCapability{
+			{Kind: "audio", MimeType: "audio/opus", PreferredPayloadType: 100, ClockRate: 48000, Channels: 2},
+			{Kind: "video", MimeType: "video/VP8", PreferredPayloadType: 101, ClockRate: 90000},
+			{Kind: "video", MimeType: "video/rtx", PreferredPayloadType: 102, ClockRate: 90000, Parameters: RtpCodecSpecificParameters{Apt: 101}},
+			{Kind: "video", MimeType: "video/H264", PreferredPayloadType: 103, ClockRate: 90000},
+			{Kind: "video", MimeType: "video/rtx", PreferredPayloadType: 104, ClockRate: 90000, Parameters: RtpCodecSpecificParameters{Apt: 103}},
+			// Associated with no codec.
+			{Kind: "video", MimeType: "video/rtx", PreferredPayloadType: 105, ClockRate: 90000, Parameters: RtpCodecSpecificParameters{Apt: 99}},
+		},
+		HeaderExtensions: []*RtpHeaderExtension{
+			{Kind: "audio", Uri: "urn:ietf:params:rtp-hdrext:ssrc-audio-level", PreferredId: 1},
+			{Kind: "video", Uri: "urn:3gpp:video-orientation", PreferredId: 2},
+			{Uri: "urn:ietf:params:rtp-hdrext:sdes:mid", PreferredId: 3},
+		},
+	}
+
+	audio := FilterCapabilitiesByKind(caps, "audio")
+	assert.Equal(t, []*RtpCodecCapability{caps.Codecs[0]}, audio.Codecs)
+	assert.Equal(t, []*RtpHeaderExtension{caps.HeaderExtensions[0], caps.HeaderExtensions[2]}, audio.HeaderExtensions)
+
+	video := FilterCapabilitiesByKind(caps, "video")
+	assert.Equal(t, caps.Codecs[1:5], video.Codecs)
+	assert.Equal(t, []*RtpHeaderExtension{caps.HeaderExtensions[1], caps.HeaderExtensions[2]}, video.HeaderExtensions)
+
+	// caps is left untouched.
+	assert.Len(t, caps.Codecs, 6)
+	assert.Len(t, caps.HeaderExtensions, 3)
+}
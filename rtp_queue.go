@@ -0,0 +1,116 @@
+package mediasoup
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// RtpQueueDropPolicy define what to do with a RTP packet when the queue is full.
+type RtpQueueDropPolicy string
+
+const (
+	// RtpQueueDropPolicy_Block blocks the PayloadChannel until there is room in the queue.
+	RtpQueueDropPolicy_Block RtpQueueDropPolicy = "block"
+
+	// RtpQueueDropPolicy_DropOldest drops the oldest queued packet to make room.
+	RtpQueueDropPolicy_DropOldest RtpQueueDropPolicy = "drop-oldest"
+
+	// RtpQueueDropPolicy_DropNewest drops the incoming packet.
+	RtpQueueDropPolicy_DropNewest RtpQueueDropPolicy = "drop-newest"
+)
+
+// RtpQueueOptions define options to deliver "rtp" events on a dedicated goroutine, so a slow
+// handler can not stall the PayloadChannel shared by every entity of the worker.
+type RtpQueueOptions struct {
+	// Size is the maximum number of queued packets. It must be greater than 0.
+	Size int
+
+	// DropPolicy define what to do when the queue is full. Default "block".
+	DropPolicy RtpQueueDropPolicy
+}
+
+// rtpQueue is a bounded queue which calls handler on its own goroutine.
+type rtpQueue struct {
+	packets   chan []byte
+	policy    RtpQueueDropPolicy
+	dropped   uint64
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+func newRtpQueue(options RtpQueueOptions, handler func([]byte)) *rtpQueue {
+	if options.Size <= 0 {
+		options.Size = 1
+	}
+	if len(options.DropPolicy) == 0 {
+		options.DropPolicy = RtpQueueDropPolicy_Block
+	}
+
+	q := &rtpQueue{
+		packets: make(chan []byte, options.Size),
+		policy:  options.DropPolicy,
+		closeCh: make(chan struct{}),
+	}
+
+	go func() {
+		for {
+			select {
+			case packet := <-q.packets:
+				handler(packet)
+			case <-q.closeCh:
+				return
+			}
+		}
+	}()
+
+	return q
+}
+
+// push queues the packet according to the drop policy.
+func (q *rtpQueue) push(packet []byte) {
+	switch q.policy {
+	case RtpQueueDropPolicy_DropNewest:
+		select {
+		case q.packets <- packet:
+		default:
+			atomic.AddUint64(&q.dropped, 1)
+		}
+
+	case RtpQueueDropPolicy_DropOldest:
+		for {
+			select {
+			case q.packets <- packet:
+				return
+			default:
+			}
+			select {
+			case <-q.packets:
+				atomic.AddUint64(&q.dropped, 1)
+			default:
+			}
+		}
+
+	default:
+		select {
+		case q.packets <- packet:
+		case <-q.closeCh:
+		}
+	}
+}
+
+// droppedCount returns the number of dropped packets.
+func (q *rtpQueue) droppedCount() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
+
+// length returns the number of queued packets.
+func (q *rtpQueue) length() int {
+	return len(q.packets)
+}
+
+// close stops the goroutine, queued packets are discarded.
+func (q *rtpQueue) close() {
+	q.closeOnce.Do(func() {
+		close(q.closeCh)
+	})
+}
@@ -0,0 +1,77 @@
+package mediasoup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRtpQueue_DropNewest(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan []byte, 10)
+
+	q := newRtpQueue(RtpQueueOptions{Size: 2, DropPolicy: RtpQueueDropPolicy_DropNewest}, func(packet []byte) {
+		<-release
+		received <- packet
+	})
+	defer q.close()
+
+	q.push([]byte{1})
+	// wait for the handler to take the first packet
+	time.Sleep(10 * time.Millisecond)
+	q.push([]byte{2})
+	q.push([]byte{3})
+	q.push([]byte{4})
+
+	assert.EqualValues(t, 1, q.droppedCount())
+
+	close(release)
+
+	assert.Equal(t, []byte{1}, <-received)
+	assert.Equal(t, []byte{2}, <-received)
+	assert.Equal(t, []byte{3}, <-received)
+}
+
+func TestRtpQueue_DropOldest(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan []byte, 10)
+
+	q := newRtpQueue(RtpQueueOptions{Size: 2, DropPolicy: RtpQueueDropPolicy_DropOldest}, func(packet []byte) {
+		<-release
+		received <- packet
+	})
+	defer q.close()
+
+	q.push([]byte{1})
+	time.Sleep(10 * time.Millisecond)
+	q.push([]byte{2})
+	q.push([]byte{3})
+	q.push([]byte{4})
+
+	assert.EqualValues(t, 1, q.droppedCount())
+
+	close(release)
+
+	assert.Equal(t, []byte{1}, <-received)
+	assert.Equal(t, []byte{3}, <-received)
+	assert.Equal(t, []byte{4}, <-received)
+}
+
+func TestRtpQueue_BlockUnblocksOnClose(t *testing.T) {
+	q := newRtpQueue(RtpQueueOptions{Size: 1}, func(packet []byte) {
+		select {}
+	})
+
+	q.push([]byte{1})
+	time.Sleep(10 * time.Millisecond)
+	q.push([]byte{2})
+
+	result := asyncRun(func() { q.push([]byte{3}) })
+	assert.False(t, result.Finished())
+
+	q.close()
+
+	assert.True(t, asyncRun(func() { q.push([]byte{4}) }).Finished())
+	assert.Zero(t, q.droppedCount())
+}
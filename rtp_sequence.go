@@ -0,0 +1,41 @@
+package mediasoup
+
+import "encoding/binary"
+
+// rtpSequenceTracker tracks the sequence numbers of consecutive RTP packets to detect gaps.
+type rtpSequenceTracker struct {
+	started bool
+	lastSeq uint16
+}
+
+// push returns the number of missing packets between the last packet and the one with the given
+// sequence number, handling the 16-bit wraparound. Duplicated and late (reordered) packets are
+// not gaps and do not move the last sequence number.
+func (t *rtpSequenceTracker) push(seq uint16) (missing, from, to uint16) {
+	if !t.started {
+		t.started = true
+		t.lastSeq = seq
+		return
+	}
+
+	diff := seq - t.lastSeq
+
+	// Duplicated or older than the last one.
+	if diff == 0 || diff >= 0x8000 {
+		return
+	}
+
+	from, to = t.lastSeq, seq
+	t.lastSeq = seq
+
+	return diff - 1, from, to
+}
+
+// rtpSequenceNumber returns the sequence number of the given RTP packet.
+func rtpSequenceNumber(packet []byte) (seq uint16, ok bool) {
+	// RTP version 2 with a full fixed header.
+	if len(packet) < 12 || packet[0]>>6 != 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(packet[2:4]), true
+}
@@ -0,0 +1,57 @@
+package mediasoup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRtpSequenceTracker(t *testing.T) {
+	type gap struct {
+		missing, from, to uint16
+	}
+
+	var (
+		tracker rtpSequenceTracker
+		gaps    []gap
+	)
+
+	for _, seq := range []uint16{10, 11, 12, 15, 14, 15, 16, 20, 9} {
+		if missing, from, to := tracker.push(seq); missing > 0 {
+			gaps = append(gaps, gap{missing, from, to})
+		}
+	}
+
+	assert.Equal(t, []gap{
+		{2, 12, 15},
+		// 14 is late and the second 15 is duplicated.
+		{3, 16, 20},
+		// 9 is late.
+	}, gaps)
+}
+
+func TestRtpSequenceTrackerWraparound(t *testing.T) {
+	var tracker rtpSequenceTracker
+
+	tracker.push(65533)
+
+	missing, from, to := tracker.push(1)
+	assert.EqualValues(t, 3, missing)
+	assert.EqualValues(t, 65533, from)
+	assert.EqualValues(t, 1, to)
+
+	missing, _, _ = tracker.push(2)
+	assert.Zero(t, missing)
+}
+
+func TestRtpSequenceNumber(t *testing.T) {
+	seq, ok := rtpSequenceNumber([]byte{0x80, 111, 0x12, 0x34, 0, 0, 0, 1, 0, 0, 0, 1})
+	assert.True(t, ok)
+	assert.EqualValues(t, 0x1234, seq)
+
+	_, ok = rtpSequenceNumber([]byte{0x80, 111, 0x12, 0x34})
+	assert.False(t, ok)
+
+	_, ok = rtpSequenceNumber([]byte{0x00, 111, 0x12, 0x34, 0, 0, 0, 1, 0, 0, 0, 1})
+	assert.False(t, ok)
+}
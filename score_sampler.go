@@ -0,0 +1,92 @@
+package mediasoup
+
+import (
+	"sync"
+	"time"
+)
+
+// scoreSampler coalesces score events, calling handler at most once per interval with the
+// latest score.
+type scoreSampler struct {
+	locker   sync.Mutex
+	interval time.Duration
+	handler  func(*ConsumerScore)
+	timer    *time.Timer
+	last     time.Time
+	pending  *ConsumerScore
+	closed   bool
+}
+
+func newScoreSampler(interval time.Duration, handler func(*ConsumerScore)) *scoreSampler {
+	return &scoreSampler{
+		interval: interval,
+		handler:  handler,
+	}
+}
+
+// push calls handler at once if the interval elapsed since the last call, otherwise keeps the
+// score and schedules a call at the end of the interval.
+func (s *scoreSampler) push(score *ConsumerScore) {
+	s.locker.Lock()
+
+	if s.closed {
+		s.locker.Unlock()
+		return
+	}
+
+	elapsed := time.Since(s.last)
+
+	if s.timer == nil && elapsed >= s.interval {
+		s.last = time.Now()
+		s.locker.Unlock()
+		s.handler(score)
+		return
+	}
+
+	s.pending = score
+
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.interval-elapsed, s.flush)
+	}
+
+	s.locker.Unlock()
+}
+
+func (s *scoreSampler) flush() {
+	s.locker.Lock()
+
+	score := s.pending
+	s.pending = nil
+	s.timer = nil
+	s.last = time.Now()
+
+	s.locker.Unlock()
+
+	if score != nil {
+		s.handler(score)
+	}
+}
+
+// close stops the timer and calls handler with the pending score, if any.
+func (s *scoreSampler) close() {
+	s.locker.Lock()
+
+	if s.closed {
+		s.locker.Unlock()
+		return
+	}
+	s.closed = true
+
+	score := s.pending
+	s.pending = nil
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	s.locker.Unlock()
+
+	if score != nil {
+		s.handler(score)
+	}
+}
@@ -0,0 +1,50 @@
+package mediasoup
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScoreSampler(t *testing.T) {
+	var (
+		locker sync.Mutex
+		scores []uint16
+	)
+	calledScores := func() []uint16 {
+		locker.Lock()
+		defer locker.Unlock()
+		return append([]uint16{}, scores...)
+	}
+
+	sampler := newScoreSampler(50*time.Millisecond, func(score *ConsumerScore) {
+		locker.Lock()
+		defer locker.Unlock()
+		scores = append(scores, score.Score)
+	})
+
+	// The first score is delivered at once.
+	sampler.push(&ConsumerScore{Score: 10})
+	assert.Equal(t, []uint16{10}, calledScores())
+
+	// Following scores within the interval are coalesced to the latest one.
+	sampler.push(&ConsumerScore{Score: 9})
+	sampler.push(&ConsumerScore{Score: 8})
+	assert.Equal(t, []uint16{10}, calledScores())
+
+	assert.Eventually(t, func() bool {
+		return len(calledScores()) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []uint16{10, 8}, calledScores())
+
+	// The pending score is flushed on close.
+	sampler.push(&ConsumerScore{Score: 7})
+	sampler.close()
+	assert.Equal(t, []uint16{10, 8, 7}, calledScores())
+
+	sampler.push(&ConsumerScore{Score: 6})
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, []uint16{10, 8, 7}, calledScores())
+}
@@ -1,5 +1,10 @@
 package mediasoup
 
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
 // SrtpParameters defines SRTP parameters.
 type SrtpParameters struct {
 	//Encryption and authentication transforms to be used.
@@ -9,10 +14,62 @@ type SrtpParameters struct {
 	KeyBase64 string `json:"keyBase64"`
 }
 
+// RedactedValue replaces secrets, such as SRTP keys, in the output of the Redacted() methods.
+const RedactedValue = "[REDACTED]"
+
+// Redacted returns a copy of the SRTP parameters with the keying material masked, to be logged
+// safely. It returns nil if p is nil.
+func (p *SrtpParameters) Redacted() *SrtpParameters {
+	if p == nil {
+		return nil
+	}
+	redacted := *p
+	if len(redacted.KeyBase64) > 0 {
+		redacted.KeyBase64 = RedactedValue
+	}
+	return &redacted
+}
+
 // SrtpCryptoSuite defines SRTP crypto suite.
 type SrtpCryptoSuite string
 
 const (
 	AES_CM_128_HMAC_SHA1_80 SrtpCryptoSuite = "AES_CM_128_HMAC_SHA1_80"
 	AES_CM_128_HMAC_SHA1_32 SrtpCryptoSuite = "AES_CM_128_HMAC_SHA1_32"
+	AEAD_AES_256_GCM        SrtpCryptoSuite = "AEAD_AES_256_GCM"
+	AEAD_AES_128_GCM        SrtpCryptoSuite = "AEAD_AES_128_GCM"
 )
+
+// MasterLength returns the length in bytes of the keying material (master key and salt) of the
+// crypto suite, 0 if unknown.
+func (suite SrtpCryptoSuite) MasterLength() int {
+	switch suite {
+	case AES_CM_128_HMAC_SHA1_80, AES_CM_128_HMAC_SHA1_32:
+		return 16 + 14
+	case AEAD_AES_256_GCM:
+		return 32 + 12
+	case AEAD_AES_128_GCM:
+		return 16 + 12
+	default:
+		return 0
+	}
+}
+
+// GenerateSrtpParameters returns SRTP parameters with random keying material of the correct
+// length for the crypto suite, to be given to PlainTransport.Connect().
+func GenerateSrtpParameters(cryptoSuite SrtpCryptoSuite) (SrtpParameters, error) {
+	length := cryptoSuite.MasterLength()
+	if length == 0 {
+		return SrtpParameters{}, NewTypeError("unsupported SRTP crypto suite: %q", cryptoSuite)
+	}
+
+	key := make([]byte, length)
+	if _, err := rand.Read(key); err != nil {
+		return SrtpParameters{}, err
+	}
+
+	return SrtpParameters{
+		CryptoSuite: cryptoSuite,
+		KeyBase64:   base64.StdEncoding.EncodeToString(key),
+	}, nil
+}
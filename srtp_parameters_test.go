@@ -0,0 +1,33 @@
+package mediasoup
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateSrtpParameters(t *testing.T) {
+	for cryptoSuite, length := range map[SrtpCryptoSuite]int{
+		AES_CM_128_HMAC_SHA1_80: 30,
+		AES_CM_128_HMAC_SHA1_32: 30,
+		AEAD_AES_256_GCM:        44,
+		AEAD_AES_128_GCM:        28,
+	} {
+		params, err := GenerateSrtpParameters(cryptoSuite)
+		require.NoError(t, err)
+		assert.Equal(t, cryptoSuite, params.CryptoSuite)
+
+		key, err := base64.StdEncoding.DecodeString(params.KeyBase64)
+		require.NoError(t, err)
+		assert.Len(t, key, length, cryptoSuite)
+	}
+
+	first, _ := GenerateSrtpParameters(AEAD_AES_256_GCM)
+	second, _ := GenerateSrtpParameters(AEAD_AES_256_GCM)
+	assert.NotEqual(t, first.KeyBase64, second.KeyBase64)
+
+	_, err := GenerateSrtpParameters("AES_CM_256_HMAC_SHA1_80")
+	assert.IsType(t, TypeError{}, err)
+}
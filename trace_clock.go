@@ -0,0 +1,34 @@
+package mediasoup
+
+import "time"
+
+// TraceClock converts worker trace timestamps into wall-clock time.
+//
+// mediasoup-worker stamps "trace" events with its libuv monotonic clock expressed in
+// milliseconds (DepLibUV::GetTimeMs()). That clock starts at an arbitrary point, so the raw
+// value only makes sense relative to other trace timestamps of the same worker. A TraceClock
+// captures a base pair (worker milliseconds, wall-clock time) and maps any other worker
+// timestamp relative to it.
+type TraceClock struct {
+	baseMs   int64
+	baseWall time.Time
+}
+
+// NewTraceClock creates a TraceClock which maps the worker timestamp baseMs to baseWall.
+func NewTraceClock(baseMs int64, baseWall time.Time) *TraceClock {
+	return &TraceClock{
+		baseMs:   baseMs,
+		baseWall: baseWall,
+	}
+}
+
+// Time returns the wall-clock time of the given worker timestamp (in ms).
+func (c *TraceClock) Time(timestampMs int64) time.Time {
+	return c.baseWall.Add(time.Duration(timestampMs-c.baseMs) * time.Millisecond)
+}
+
+// Since returns the elapsed time between the base of the clock and the given worker
+// timestamp (in ms).
+func (c *TraceClock) Since(timestampMs int64) time.Duration {
+	return time.Duration(timestampMs-c.baseMs) * time.Millisecond
+}
@@ -0,0 +1,34 @@
+package mediasoup
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceClock(t *testing.T) {
+	baseWall := time.Date(2022, 12, 9, 10, 0, 0, 0, time.UTC)
+	clock := NewTraceClock(1000000, baseWall)
+
+	assert.Equal(t, baseWall, clock.Time(1000000))
+	assert.Equal(t, baseWall.Add(1500*time.Millisecond), clock.Time(1001500))
+	assert.Equal(t, baseWall.Add(-250*time.Millisecond), clock.Time(999750))
+	assert.Equal(t, 1500*time.Millisecond, clock.Since(1001500))
+}
+
+func TestConsumerTraceEventData_Time(t *testing.T) {
+	var trace *ConsumerTraceEventData
+
+	data := []byte(`{"type":"keyframe","timestamp":1001500,"direction":"out"}`)
+	assert.NoError(t, json.Unmarshal(data, &trace))
+
+	assert.Equal(t, 1001500*time.Millisecond, trace.Monotonic())
+	assert.True(t, trace.Time().IsZero())
+
+	baseWall := time.Date(2022, 12, 9, 10, 0, 0, 0, time.UTC)
+	trace.clock = NewTraceClock(1000000, baseWall)
+
+	assert.Equal(t, baseWall.Add(1500*time.Millisecond), trace.Time())
+}
@@ -1,11 +1,15 @@
 package mediasoup
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
@@ -20,14 +24,23 @@ type ITransport interface {
 	Close()
 	Dump() (*TransportDump, error)
 	GetStats() ([]*TransportStat, error)
+	Producers() []*Producer
+	Consumers() []*Consumer
+	DataProducers() []*DataProducer
+	DataConsumers() []*DataConsumer
 	Connect(TransportConnectOptions) error
 	SetMaxIncomingBitrate(bitrate int) error
+	SetMaxOutgoingBitrate(bitrate int) error
+	MaxIncomingBitrate() int
+	MaxOutgoingBitrate() int
 	Produce(ProducerOptions) (*Producer, error)
 	Consume(ConsumerOptions) (*Consumer, error)
+	ConsumePrewarmed(ctx context.Context, options ConsumerOptions) (*Consumer, error)
 	ProduceData(DataProducerOptions) (*DataProducer, error)
 	ConsumeData(DataConsumerOptions) (*DataConsumer, error)
 	EnableTraceEvent(types ...TransportTraceEventType) error
 	OnTrace(handler func(trace *TransportTraceEventData))
+	OnBwe(handler func(bwe TransportBweTraceInfo))
 	OnClose(handler func())
 
 	// internal methods
@@ -81,6 +94,54 @@ type TransportTraceEventData struct {
 	Info interface{} `json:"info,omitempty"`
 }
 
+// BweType is the bandwidth estimation algorithm in use.
+type BweType string
+
+const (
+	BweType_TransportCc BweType = "transport-cc"
+	BweType_Remb        BweType = "remb"
+)
+
+// TransportBweTraceInfo is the information of a "bwe" trace event.
+type TransportBweTraceInfo struct {
+	// Type is the bandwidth estimation algorithm.
+	Type BweType `json:"type,omitempty"`
+
+	// DesiredBitrate is the bitrate desired by the Consumers of the transport.
+	DesiredBitrate uint32 `json:"desiredBitrate"`
+
+	// EffectiveDesiredBitrate is the desired bitrate bounded by the min and max bitrates.
+	EffectiveDesiredBitrate uint32 `json:"effectiveDesiredBitrate"`
+
+	MinBitrate        uint32 `json:"minBitrate"`
+	MaxBitrate        uint32 `json:"maxBitrate"`
+	StartBitrate      uint32 `json:"startBitrate"`
+	MaxPaddingBitrate uint32 `json:"maxPaddingBitrate"`
+
+	// AvailableBitrate is the estimated available outgoing bitrate.
+	AvailableBitrate uint32 `json:"availableBitrate"`
+}
+
+// BweInfo decodes Info of a "bwe" trace event. It returns false for other trace types or if Info
+// can not be decoded.
+func (t TransportTraceEventData) BweInfo() (*TransportBweTraceInfo, bool) {
+	if t.Type != TransportTraceEventType_Bwe {
+		return nil, false
+	}
+
+	data, err := json.Marshal(t.Info)
+	if err != nil {
+		return nil, false
+	}
+
+	var info *TransportBweTraceInfo
+	if err = json.Unmarshal(data, &info); err != nil || info == nil {
+		return nil, false
+	}
+
+	return info, true
+}
+
 type SctpState string
 
 const (
@@ -134,6 +195,13 @@ type TransportConnectOptions struct {
 	DtlsParameters *DtlsParameters `json:"dtlsParameters,omitempty"`
 }
 
+// Redacted returns a copy of the options with the SRTP keying material masked, to be logged
+// safely. DTLS fingerprints are kept as they are advertised in the signaling anyway.
+func (o TransportConnectOptions) Redacted() TransportConnectOptions {
+	o.SrtpParameters = o.SrtpParameters.Redacted()
+	return o
+}
+
 type TransportType string
 
 const (
@@ -159,6 +227,7 @@ type transportParams struct {
 	getRouterRtpCapabilities func() RtpCapabilities
 	getProducerById          func(string) *Producer
 	getDataProducerById      func(string) *DataProducer
+	getProducerConsumers     func(string) []*Consumer
 	logger                   logr.Logger
 }
 
@@ -168,6 +237,7 @@ type transportParams struct {
 //   - @emits @close
 //   - @emits @newproducer - (producer *Producer)
 //   - @emits @producerclose - (producer *Producer)
+//   - @emits @newconsumer - (consumer *Consumer)
 //   - @emits @newdataproducer - (dataProducer *DataProducer)
 //   - @emits @dataproducerclose - (dataProducer *DataProducer)
 type Transport struct {
@@ -191,6 +261,8 @@ type Transport struct {
 	getProducerById func(string) *Producer
 	// Method to retrieve a DataProducer.
 	getDataProducerById func(string) *DataProducer
+	// Method to retrieve the Consumers of a Producer.
+	getProducerConsumers func(string) []*Consumer
 	// Producers map.
 	producers sync.Map
 	// Consumers map.
@@ -211,8 +283,12 @@ type Transport struct {
 	observer IEventEmitter
 	// locker instance
 	locker sync.Mutex
+	// Last maximum bitrates successfully set, 0 if unset.
+	maxIncomingBitrate int64
+	maxOutgoingBitrate int64
 
 	onTrace func(*TransportTraceEventData)
+	onBwe   func(TransportBweTraceInfo)
 	onClose func()
 }
 
@@ -229,6 +305,7 @@ func newTransport(params transportParams) ITransport {
 		appData:                  params.appData,
 		getRouterRtpCapabilities: params.getRouterRtpCapabilities,
 		getProducerById:          params.getProducerById,
+		getProducerConsumers:     params.getProducerConsumers,
 		getDataProducerById:      params.getDataProducerById,
 		observer:                 NewEventEmitter(),
 	}
@@ -251,6 +328,46 @@ func (transport *Transport) AppData() interface{} {
 	return transport.appData
 }
 
+// Producers returns a snapshot of the Producers of the Transport which are not closed.
+func (transport *Transport) Producers() []*Producer {
+	producers := make([]*Producer, 0)
+	transport.producers.Range(func(key, value interface{}) bool {
+		producers = append(producers, value.(*Producer))
+		return true
+	})
+	return producers
+}
+
+// Consumers returns a snapshot of the Consumers of the Transport which are not closed.
+func (transport *Transport) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0)
+	transport.consumers.Range(func(key, value interface{}) bool {
+		consumers = append(consumers, value.(*Consumer))
+		return true
+	})
+	return consumers
+}
+
+// DataProducers returns a snapshot of the DataProducers of the Transport which are not closed.
+func (transport *Transport) DataProducers() []*DataProducer {
+	dataProducers := make([]*DataProducer, 0)
+	transport.dataProducers.Range(func(key, value interface{}) bool {
+		dataProducers = append(dataProducers, value.(*DataProducer))
+		return true
+	})
+	return dataProducers
+}
+
+// DataConsumers returns a snapshot of the DataConsumers of the Transport which are not closed.
+func (transport *Transport) DataConsumers() []*DataConsumer {
+	dataConsumers := make([]*DataConsumer, 0)
+	transport.dataConsumers.Range(func(key, value interface{}) bool {
+		dataConsumers = append(dataConsumers, value.(*DataConsumer))
+		return true
+	})
+	return dataConsumers
+}
+
 // Deprecated
 //
 //   - @emits close
@@ -279,6 +396,7 @@ func (transport *Transport) Close() {
 			producer := value.(*Producer)
 
 			producer.transportClosed()
+			transport.producers.Delete(key)
 			transport.Emit("@producerclose", producer)
 
 			return true
@@ -286,6 +404,7 @@ func (transport *Transport) Close() {
 
 		transport.consumers.Range(func(key, value interface{}) bool {
 			value.(*Consumer).transportClosed()
+			transport.consumers.Delete(key)
 
 			return true
 		})
@@ -294,6 +413,7 @@ func (transport *Transport) Close() {
 			producer := value.(*DataProducer)
 
 			producer.transportClosed()
+			transport.dataProducers.Delete(key)
 			transport.Emit("@dataproducerclose", producer)
 
 			return true
@@ -301,6 +421,7 @@ func (transport *Transport) Close() {
 
 		transport.dataConsumers.Range(func(key, value interface{}) bool {
 			value.(*DataConsumer).transportClosed()
+			transport.dataConsumers.Delete(key)
 
 			return true
 		})
@@ -336,6 +457,7 @@ func (transport *Transport) routerClosed() {
 			producer := value.(*Producer)
 
 			producer.transportClosed()
+			transport.producers.Delete(key)
 			transport.Emit("@producerclose", producer)
 
 			return true
@@ -343,6 +465,7 @@ func (transport *Transport) routerClosed() {
 
 		transport.consumers.Range(func(key, value interface{}) bool {
 			value.(*Consumer).transportClosed()
+			transport.consumers.Delete(key)
 
 			return true
 		})
@@ -351,6 +474,7 @@ func (transport *Transport) routerClosed() {
 			producer := value.(*DataProducer)
 
 			producer.transportClosed()
+			transport.dataProducers.Delete(key)
 			transport.Emit("@dataproducerclose", producer)
 
 			return true
@@ -358,6 +482,7 @@ func (transport *Transport) routerClosed() {
 
 		transport.dataConsumers.Range(func(key, value interface{}) bool {
 			value.(*DataConsumer).transportClosed()
+			transport.dataConsumers.Delete(key)
 
 			return true
 		})
@@ -432,7 +557,9 @@ func (transport *Transport) Dump() (data *TransportDump, err error) {
 	transport.logger.V(1).Info("dump()")
 
 	resp := transport.channel.Request("transport.dump", transport.internal)
-	err = resp.Unmarshal(&data)
+	if err = resp.Unmarshal(&data); err == nil && data != nil {
+		transport.logger.V(2).Info("dump()", "dump", data.Redacted())
+	}
 
 	return
 }
@@ -456,10 +583,48 @@ func (transport *Transport) Connect(TransportConnectOptions) error {
 func (transport *Transport) SetMaxIncomingBitrate(bitrate int) error {
 	transport.logger.V(1).Info("SetMaxIncomingBitrate()", "bitrate", bitrate)
 
+	if bitrate < 0 {
+		return NewTypeError("negative bitrate")
+	}
+
 	resp := transport.channel.Request(
 		"transport.setMaxIncomingBitrate", transport.internal, H{"bitrate": bitrate})
 
-	return resp.Err()
+	if err := resp.Err(); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&transport.maxIncomingBitrate, int64(bitrate))
+
+	return nil
+}
+
+// SetMaxOutgoingBitrate set maximum outgoing bitrate for sending media.
+func (transport *Transport) SetMaxOutgoingBitrate(bitrate int) error {
+	transport.logger.V(1).Info("SetMaxOutgoingBitrate()", "bitrate", bitrate)
+
+	if bitrate < 0 {
+		return NewTypeError("negative bitrate")
+	}
+
+	resp := transport.channel.Request(
+		"transport.setMaxOutgoingBitrate", transport.internal, H{"bitrate": bitrate})
+
+	if err := resp.Err(); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&transport.maxOutgoingBitrate, int64(bitrate))
+
+	return nil
+}
+
+// MaxIncomingBitrate returns the last maximum incoming bitrate set, 0 if unset.
+func (transport *Transport) MaxIncomingBitrate() int {
+	return int(atomic.LoadInt64(&transport.maxIncomingBitrate))
+}
+
+// MaxOutgoingBitrate returns the last maximum outgoing bitrate set, 0 if unset.
+func (transport *Transport) MaxOutgoingBitrate() int {
+	return int(atomic.LoadInt64(&transport.maxOutgoingBitrate))
 }
 
 // Produce creates a Producer.
@@ -548,6 +713,13 @@ func (transport *Transport) Produce(options ProducerOptions) (producer *Producer
 		ConsumableRtpParameters: consumableRtpParameters,
 	}
 
+	var getConsumers func() []*Consumer
+	if transport.getProducerConsumers != nil {
+		getConsumers = func() []*Consumer {
+			return transport.getProducerConsumers(internal.ProducerId)
+		}
+	}
+
 	producer = newProducer(producerParams{
 		internal:       internal,
 		data:           producerData,
@@ -555,6 +727,7 @@ func (transport *Transport) Produce(options ProducerOptions) (producer *Producer
 		payloadChannel: transport.payloadChannel,
 		appData:        appData,
 		paused:         paused,
+		getConsumers:   getConsumers,
 	})
 
 	transport.producers.Store(producer.Id(), producer)
@@ -576,11 +749,10 @@ func (transport *Transport) Produce(options ProducerOptions) (producer *Producer
 func (transport *Transport) Consume(options ConsumerOptions) (consumer *Consumer, err error) {
 	transport.logger.V(1).Info("consume()")
 
+	started := time.Now()
+
 	producerId := options.ProducerId
 	rtpCapabilities := options.RtpCapabilities
-	paused := options.Paused
-	preferredLayers := options.PreferredLayers
-	appData := options.AppData
 
 	producer := transport.getProducerById(producerId)
 
@@ -589,10 +761,23 @@ func (transport *Transport) Consume(options ConsumerOptions) (consumer *Consumer
 		return
 	}
 
+	if options.ReducedSizeRtcp != nil && options.Pipe {
+		err = NewTypeError("reducedSizeRtcp is not valid for a pipe Consumer")
+		return
+	}
+
 	rtpParameters, err := getConsumerRtpParameters(producer.ConsumableRtpParameters(), rtpCapabilities, options.Ssrc, options.Pipe)
 	if err != nil {
 		return
 	}
+	if options.ReducedSizeRtcp != nil {
+		rtpParameters.Rtcp.ReducedSize = *options.ReducedSizeRtcp
+	}
+	if options.ForceCodec != nil && !options.Pipe {
+		if err = forceConsumerCodec(&rtpParameters, *options.ForceCodec); err != nil {
+			return
+		}
+	}
 
 	if !options.Pipe {
 		if len(options.Mid) > 0 {
@@ -614,6 +799,18 @@ func (transport *Transport) Consume(options ConsumerOptions) (consumer *Consumer
 		}
 	}
 
+	return transport.consume(options, producer, rtpParameters, started)
+}
+
+// consume creates a Consumer of the producer with the given consumer RTP parameters. started is
+// the time the creation was requested.
+func (transport *Transport) consume(options ConsumerOptions, producer *Producer,
+	rtpParameters RtpParameters, started time.Time) (consumer *Consumer, err error) {
+	producerId := producer.Id()
+	paused := options.Paused
+	preferredLayers := options.PreferredLayers
+	appData := options.AppData
+
 	internal := transport.internal
 	if len(options.ConsumerId) > 0 {
 		internal.ConsumerId = options.ConsumerId
@@ -650,27 +847,61 @@ func (transport *Transport) Consume(options ConsumerOptions) (consumer *Consumer
 		IgnoreDtx:              options.IgnoreDtx,
 	}
 
+	var (
+		producerRids        []string
+		producerMaxBitrates []int
+	)
+	for _, encoding := range producer.RtpParameters().Encodings {
+		if len(encoding.Rid) > 0 {
+			producerRids = append(producerRids, encoding.Rid)
+		}
+		producerMaxBitrates = append(producerMaxBitrates, encoding.MaxBitrate)
+	}
+
+	setupTimings := ConsumerSetupTimings{Started: started, RequestSent: time.Now()}
 	resp := transport.channel.Request("transport.consume", internal, reqData)
 
 	var status struct {
-		Paused         bool
-		ProducerPaused bool
-		Score          *ConsumerScore
+		Paused          bool
+		ProducerPaused  bool
+		Score           *ConsumerScore
+		PreferredLayers *ConsumerLayers
 	}
 	if err = resp.Unmarshal(&status); err != nil {
 		return
 	}
+	setupTimings.Responded = time.Now()
+
+	// Older workers do not return the preferred layers.
+	if status.PreferredLayers != nil {
+		preferredLayers = status.PreferredLayers
+	}
 
 	consumer = newConsumer(consumerParams{
-		internal:        internal,
-		data:            data,
-		channel:         transport.channel,
-		payloadChannel:  transport.payloadChannel,
-		appData:         appData,
-		paused:          status.Paused,
-		producerPaused:  status.ProducerPaused,
-		score:           status.Score,
-		preferredLayers: preferredLayers,
+		internal:            internal,
+		data:                data,
+		channel:             transport.channel,
+		payloadChannel:      transport.payloadChannel,
+		appData:             appData,
+		paused:              status.Paused,
+		producerPaused:      status.ProducerPaused,
+		score:               status.Score,
+		preferredLayers:     preferredLayers,
+		intendedLayers:      options.PreferredLayers,
+		rtpQueue:            options.RtpQueue,
+		producerRids:        producerRids,
+		producerMaxBitrates: producerMaxBitrates,
+		rtpEnabled:          transport.data.transportType == TransportType_Direct,
+		suppressPausedRtp:   options.SuppressRtpWhilePaused,
+		strictLayers:        options.StrictLayers,
+		statsHistorySize:    options.StatsHistorySize,
+		dumpWatchInterval:   options.DumpWatchInterval,
+		disableObserver:     options.DisableObserver,
+		setupTimings:        setupTimings,
+		replayLatest:        options.ReplayLatestOnSubscribe,
+		ctx:                 options.Context,
+		options:             options,
+		replaceProducer:     transport.replaceConsumerProducer,
 	})
 
 	transport.consumers.Store(consumer.Id(), consumer)
@@ -681,12 +912,185 @@ func (transport *Transport) Consume(options ConsumerOptions) (consumer *Consumer
 		transport.consumers.Delete(consumer.Id())
 	})
 
+	transport.Emit("@newconsumer", consumer)
+
 	// Emit observer event.
 	transport.observer.SafeEmit("newconsumer", consumer)
 
+	if options.EmitInitialState {
+		consumer.emitInitialState()
+	}
+
 	return
 }
 
+// ConsumePrewarmed creates a paused Consumer and, for video, requests a key frame to the endpoint
+// sending the Producer and waits until the Producer receives it, so the Consumer is "hot": once
+// resumed, it renders right away from the next key frame. If ctx is done before, the Consumer is
+// closed and ctx.Err() is returned.
+//
+// mediasoup-worker ignores the key frame requests of paused Consumers, so the key frame is
+// requested through another Consumer of the Producer which is not paused. If there is none, no
+// key frame can be requested and it waits for the next key frame sent by the endpoint.
+//
+// The prewarmed Consumer receives no media and costs no bandwidth until resumed. The requested
+// key frame is however sent to every Consumer of the Producer, and a key frame is several times
+// larger than other frames: prewarming many Consumers at once sends many key frames.
+func (transport *Transport) ConsumePrewarmed(ctx context.Context, options ConsumerOptions) (*Consumer, error) {
+	transport.logger.V(1).Info("consumePrewarmed()", "producerId", options.ProducerId)
+
+	options.Paused = true
+
+	consumer, err := transport.Consume(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if consumer.Kind() != MediaKind_Video {
+		return consumer, nil
+	}
+
+	producer := transport.getProducerById(options.ProducerId)
+	if producer == nil {
+		consumer.Close()
+		return nil, NewInvalidStateError("producer closed")
+	}
+
+	err = producer.waitForKeyFrame(ctx, func() {
+		producer.requestKeyFrame()
+	})
+	if err != nil {
+		consumer.Close()
+		return nil, err
+	}
+
+	return consumer, nil
+}
+
+// replaceConsumerProducer closes the consumer and creates a Consumer of another Producer reusing
+// its options, MID, SSRCs and RTCP CNAME, so the remote endpoint can keep the same transceiver.
+// If the new Consumer can not be created, a Consumer of the previous Producer is created again
+// with the same id and RTP parameters and returned along with the error.
+func (transport *Transport) replaceConsumerProducer(consumer *Consumer, producerId string,
+	rtpCapabilities RtpCapabilities) (newConsumer *Consumer, err error) {
+	transport.logger.V(1).Info("replaceConsumerProducer()", "consumerId", consumer.Id(), "producerId", producerId)
+
+	started := time.Now()
+
+	if consumer.Closed() {
+		err = NewInvalidStateError("consumer closed")
+		return
+	}
+
+	producer := transport.getProducerById(producerId)
+
+	if producer == nil {
+		err = fmt.Errorf(`Producer with id "%s" not found`, producerId)
+		return
+	}
+	if producer.Kind() != consumer.Kind() {
+		err = NewTypeError("%w: kind %q does not match %q", ErrIncompatibleReplacement, producer.Kind(), consumer.Kind())
+		return
+	}
+
+	oldProducer := transport.getProducerById(consumer.ProducerId())
+	oldRtpParameters := consumer.RtpParameters()
+
+	// Keep the options the Consumer was created with, and its current state.
+	options := consumer.options
+	options.ConsumerId = ""
+	options.ProducerId = producerId
+	options.RtpCapabilities = rtpCapabilities
+	options.Paused = consumer.Paused()
+	options.PreferredLayers = consumer.PreferredLayers()
+	options.AppData = consumer.AppData()
+	options.Context = consumer.parentCtx
+
+	rtpParameters, err := getConsumerRtpParameters(producer.ConsumableRtpParameters(), rtpCapabilities, 0, options.Pipe)
+	if err != nil {
+		return
+	}
+	if options.ForceCodec != nil && !options.Pipe {
+		if err = forceConsumerCodec(&rtpParameters, *options.ForceCodec); err != nil {
+			return
+		}
+	}
+	if err = checkReplacementRtpParameters(oldRtpParameters, rtpParameters); err != nil {
+		return
+	}
+
+	rtpParameters.Mid = oldRtpParameters.Mid
+	rtpParameters.Rtcp.Cname = oldRtpParameters.Rtcp.Cname
+	rtpParameters.Rtcp.ReducedSize = oldRtpParameters.Rtcp.ReducedSize
+
+	for i, encoding := range oldRtpParameters.Encodings {
+		rtpParameters.Encodings[i].Ssrc = encoding.Ssrc
+
+		if encoding.Rtx != nil {
+			rtpParameters.Encodings[i].Rtx = &RtpEncodingRtx{Ssrc: encoding.Rtx.Ssrc}
+		}
+	}
+
+	// The old Consumer must be closed first since the worker does not allow two Consumers with
+	// the same MID or SSRC in a transport.
+	consumer.Close()
+
+	newConsumer, err = transport.consume(options, producer, rtpParameters, started)
+	if err == nil || oldProducer == nil || oldProducer.Closed() {
+		return
+	}
+
+	transport.logger.Error(err, "replaceConsumerProducer() | restoring the previous Consumer",
+		"consumerId", consumer.Id())
+
+	options.ConsumerId = consumer.Id()
+	options.ProducerId = oldProducer.Id()
+	options.RtpCapabilities = consumer.options.RtpCapabilities
+
+	restored, restoreErr := transport.consume(options, oldProducer, oldRtpParameters, started)
+	if restoreErr != nil {
+		transport.logger.Error(restoreErr, "replaceConsumerProducer() | failed to restore the previous Consumer",
+			"consumerId", consumer.Id())
+		return nil, err
+	}
+
+	return restored, err
+}
+
+// checkReplacementRtpParameters checks whether a Consumer with newParams can replace a Consumer
+// with oldParams without renegotiation in the remote endpoint.
+func checkReplacementRtpParameters(oldParams, newParams RtpParameters) error {
+	if len(oldParams.Codecs) != len(newParams.Codecs) {
+		return NewTypeError("%w: codecs do not match", ErrIncompatibleReplacement)
+	}
+	for i, codec := range oldParams.Codecs {
+		newCodec := newParams.Codecs[i]
+
+		if !strings.EqualFold(codec.MimeType, newCodec.MimeType) ||
+			codec.PayloadType != newCodec.PayloadType ||
+			codec.ClockRate != newCodec.ClockRate ||
+			codec.Channels != newCodec.Channels {
+			return NewTypeError("%w: codec %s/%d does not match %s/%d", ErrIncompatibleReplacement,
+				newCodec.MimeType, newCodec.PayloadType, codec.MimeType, codec.PayloadType)
+		}
+	}
+
+	if len(oldParams.Encodings) != len(newParams.Encodings) {
+		return NewTypeError("%w: encodings do not match", ErrIncompatibleReplacement)
+	}
+	for i, encoding := range oldParams.Encodings {
+		if (encoding.Rtx == nil) != (newParams.Encodings[i].Rtx == nil) {
+			return NewTypeError("%w: RTX does not match", ErrIncompatibleReplacement)
+		}
+	}
+
+	if !reflect.DeepEqual(oldParams.HeaderExtensions, newParams.HeaderExtensions) {
+		return NewTypeError("%w: header extensions do not match", ErrIncompatibleReplacement)
+	}
+
+	return nil
+}
+
 // ProduceData creates a DataProducer.
 func (transport *Transport) ProduceData(options DataProducerOptions) (dataProducer *DataProducer, err error) {
 	transport.logger.V(1).Info("produceData()")
@@ -794,6 +1198,10 @@ func (transport *Transport) ConsumeData(options DataConsumerOptions) (dataConsum
 	} else {
 		typ = DataProducerType_Sctp
 
+		if err = validateDataConsumerOptions(options); err != nil {
+			return
+		}
+
 		sctpStreamParameters = dataProducer.SctpStreamParameters()
 		sctpStreamParameters.Ordered = ordered
 
@@ -807,6 +1215,7 @@ func (transport *Transport) ConsumeData(options DataConsumerOptions) (dataConsum
 		transport.locker.Lock()
 
 		if sctpStreamId, err = transport.getNextSctpStreamId(); err != nil {
+			transport.locker.Unlock()
 			return
 		}
 		transport.sctpStreamIds[sctpStreamId] = 1
@@ -912,6 +1321,12 @@ func (transport *Transport) OnTrace(handler func(trace *TransportTraceEventData)
 	transport.onTrace = handler
 }
 
+// OnBwe set handler called with the bandwidth estimation of "bwe" trace events, which must be
+// enabled with EnableTraceEvent().
+func (transport *Transport) OnBwe(handler func(bwe TransportBweTraceInfo)) {
+	transport.onBwe = handler
+}
+
 // OnClose set handler on "close" event
 func (transport *Transport) OnClose(handler func()) {
 	transport.onClose = handler
@@ -938,6 +1353,12 @@ func (transport *Transport) handleEvent(event string, data []byte) {
 			handler(result)
 		}
 
+		if handler := transport.onBwe; handler != nil {
+			if bwe, ok := result.BweInfo(); ok {
+				handler(*bwe)
+			}
+		}
+
 	default:
 		logger.Error(nil, "ignoring unknown event in channel listener", "event", event)
 	}
@@ -17,6 +17,9 @@ func init() {
 
 type H map[string]interface{}
 
+// timeAfterFunc is time.AfterFunc, replaced by tests to fire timers at will.
+var timeAfterFunc = time.AfterFunc
+
 func Bool(b bool) *bool {
 	return &b
 }
@@ -30,6 +30,7 @@ func TestWorkerCreateWebRtcServer(t *testing.T) {
 			AppData: H{"foo": 123},
 		})
 		require.NoError(t, err)
+		assert.NotEmpty(t, webRtcServer.Id())
 		assert.Equal(t, H{"foo": 123}, webRtcServer.AppData())
 
 		dump, err := worker.Dump()
@@ -98,6 +99,14 @@ func TestWorkerCreateWebRtcServer(t *testing.T) {
 		require.Error(t, err)
 	})
 
+	t.Run("worker.createWebRtcServer() with empty listenInfos rejects with TypeError", func(t *testing.T) {
+		worker := CreateTestWorker()
+		defer worker.Close()
+
+		_, err := worker.CreateWebRtcServer(WebRtcServerOptions{})
+		assert.IsType(t, TypeError{}, err)
+	})
+
 	t.Run("worker.createWebRtcServer() rejects with InvalidStateError if Worker is closed", func(t *testing.T) {
 		worker := CreateTestWorker()
 		worker.Close()
@@ -328,9 +337,16 @@ func TestRouterCreateWebRtcTransportWithWebRtcServer(t *testing.T) {
 		assert.Equal(t, 1, onObserverWebRtcTransportUnhandled.CalledTimes())
 		onObserverWebRtcTransportUnhandled.ExpectCalledWith(transport)
 		assert.True(t, transport.Closed())
+		assert.Equal(t, IceState_Closed, transport.IceState())
+		assert.Equal(t, DtlsState_Closed, transport.DtlsState())
 		assert.Len(t, webRtcServer.webRtcTransportsForTesting(), 0)
 		assert.Len(t, router.transportsForTesting(), 0)
 
+		_, err := router.CreateWebRtcTransport(WebRtcTransportOptions{
+			WebRtcServer: webRtcServer,
+		})
+		assert.IsType(t, InvalidStateError{}, err)
+
 		workerDump, _ := worker.Dump()
 		assert.JSONEq(t, WorkerDump{
 			Pid:             worker.Pid(),
@@ -2,6 +2,7 @@ package mediasoup
 
 import (
 	"encoding/json"
+	"sync"
 
 	"github.com/go-logr/logr"
 )
@@ -48,6 +49,14 @@ type WebRtcTransportOptions struct {
 	AppData interface{} `json:"appData,omitempty"`
 }
 
+// IceRole define the ICE role of the transport.
+type IceRole string
+
+const (
+	IceRole_Controlled  IceRole = "controlled"
+	IceRole_Controlling IceRole = "controlling"
+)
+
 type IceParameters struct {
 	UsernameFragment string `json:"usernameFragment"`
 	Password         string `json:"password"`
@@ -109,15 +118,15 @@ const (
 )
 
 type WebRtcTransportSpecificStat struct {
-	IceRole          string          `json:"iceRole"`
+	IceRole          IceRole         `json:"iceRole"`
 	IceState         IceState        `json:"iceState"`
-	DtlsState        DtlsRole        `json:"dtlsState"`
+	DtlsState        DtlsState       `json:"dtlsState"`
 	IceSelectedTuple *TransportTuple `json:"iceSelectedTuple,omitempty"`
 }
 
 type webrtcTransportData struct {
 	// alway be "controlled"
-	IceRole          string          `json:"iceRole,omitempty"`
+	IceRole          IceRole         `json:"iceRole,omitempty"`
 	IceParameters    IceParameters   `json:"iceParameters,omitempty"`
 	IceCandidates    []IceCandidate  `json:"iceCandidates,omitempty"`
 	IceState         IceState        `json:"iceState,omitempty"`
@@ -154,6 +163,15 @@ type WebRtcTransport struct {
 	onIceSelectedTupleChange func(tuple *TransportTuple)
 	onDtlsStateChange        func(dtlsState DtlsState)
 	onSctpStateChange        func(sctpState SctpState)
+	dtls                     *webRtcTransportDtls
+}
+
+// webRtcTransportDtls is the DTLS state of a WebRtcTransport guarded by locker, kept apart as
+// the WebRtcTransport getters have value receivers.
+type webRtcTransportDtls struct {
+	locker    sync.Mutex
+	role      DtlsRole // Local role set by SetDtlsRole(), empty if none.
+	connected bool
 }
 
 func newWebRtcTransport(params transportParams) ITransport {
@@ -172,6 +190,7 @@ func newWebRtcTransport(params transportParams) ITransport {
 		data:           data,
 		channel:        params.channel,
 		payloadChannel: params.payloadChannel,
+		dtls:           &webRtcTransportDtls{},
 	}
 
 	transport.handleWorkerNotifications()
@@ -179,8 +198,18 @@ func newWebRtcTransport(params transportParams) ITransport {
 	return transport
 }
 
+// AsWebRtcTransport returns the transport as a WebRtcTransport so its ICE and DTLS parameters
+// can be sent to the remote endpoint. It rejects with TypeError if it is another kind of transport.
+func AsWebRtcTransport(transport ITransport) (*WebRtcTransport, error) {
+	webRtcTransport, ok := transport.(*WebRtcTransport)
+	if !ok || webRtcTransport == nil {
+		return nil, NewTypeError("transport is not a WebRtcTransport")
+	}
+	return webRtcTransport, nil
+}
+
 // IceRole returns ICE role.
-func (t WebRtcTransport) IceRole() string {
+func (t WebRtcTransport) IceRole() IceRole {
 	return t.data.IceRole
 }
 
@@ -279,11 +308,12 @@ func (t *WebRtcTransport) routerClosed() {
 	t.ITransport.routerClosed()
 }
 
-// webRtcServerClosed called when closing the associated WebRtcServer.
-func (t *WebRtcTransport) webRtcServerClosed() {
+// listenServerClosed called when closing the associated WebRtcServer.
+func (t *WebRtcTransport) listenServerClosed() {
 	if t.Closed() {
 		return
 	}
+
 	t.data.IceState = IceState_Closed
 	t.data.IceSelectedTuple = nil
 	t.data.DtlsState = DtlsState_Closed
@@ -291,13 +321,55 @@ func (t *WebRtcTransport) webRtcServerClosed() {
 	if len(t.data.SctpState) > 0 {
 		t.data.SctpState = SctpState_Closed
 	}
+
+	t.ITransport.listenServerClosed()
+}
+
+// SetDtlsRole sets the DTLS role of mediasoup, such as DtlsRole_Client to connect to a peer
+// which can only act as DTLS server. The role of the DTLS parameters given to Connect() is then
+// set to the opposite one if unset or auto, and Connect() fails with a TypeError if it is the
+// same one. DtlsRole_Auto restores the default, mediasoup taking the role opposite to the one of
+// the remote endpoint. It fails with an InvalidStateError once Connect() succeeded.
+func (t *WebRtcTransport) SetDtlsRole(role DtlsRole) error {
+	t.logger.V(1).Info("setDtlsRole()", "role", role)
+
+	if !role.valid() {
+		return NewTypeError("invalid DTLS role: %q", role)
+	}
+
+	t.dtls.locker.Lock()
+	defer t.dtls.locker.Unlock()
+
+	if t.dtls.connected {
+		return NewInvalidStateError("WebRtcTransport already connected")
+	}
+	t.dtls.role = role
+
+	return nil
 }
 
 // Connect provides the WebRtcTransport remote parameters.
 func (t *WebRtcTransport) Connect(options TransportConnectOptions) (err error) {
 	t.logger.V(1).Info("connect()")
 
-	reqData := TransportConnectOptions{DtlsParameters: options.DtlsParameters}
+	t.dtls.locker.Lock()
+	defer t.dtls.locker.Unlock()
+
+	dtlsParameters := options.DtlsParameters
+	if role := t.dtls.role.opposite(); dtlsParameters != nil && role != DtlsRole_Auto {
+		switch dtlsParameters.Role {
+		case "", DtlsRole_Auto:
+			remote := *dtlsParameters
+			remote.Role = role
+			dtlsParameters = &remote
+		case role:
+		default:
+			return NewTypeError("DTLS role %q of the remote endpoint is incompatible with local role %q",
+				dtlsParameters.Role, t.dtls.role)
+		}
+	}
+
+	reqData := TransportConnectOptions{DtlsParameters: dtlsParameters}
 	resp := t.channel.Request("transport.connect", t.internal, reqData)
 
 	var result struct {
@@ -309,6 +381,7 @@ func (t *WebRtcTransport) Connect(options TransportConnectOptions) (err error) {
 
 	// Update data.
 	t.data.DtlsParameters.Role = result.DtlsLocalRole
+	t.dtls.connected = true
 
 	return
 }
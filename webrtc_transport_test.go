@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -164,6 +166,34 @@ func (suite *WebRtcTransportTestingSuite) TestCreateWebRtcTransport_NonBindableI
 	suite.Error(err)
 }
 
+func (suite *WebRtcTransportTestingSuite) TestAsWebRtcTransport() {
+	var transport ITransport = suite.transport
+
+	webRtcTransport, err := AsWebRtcTransport(transport)
+	suite.NoError(err)
+	suite.Equal(IceRole_Controlled, webRtcTransport.IceRole())
+	suite.NotEmpty(webRtcTransport.IceParameters().UsernameFragment)
+	suite.NotEmpty(webRtcTransport.IceParameters().Password)
+	suite.NotEmpty(webRtcTransport.DtlsParameters().Fingerprints)
+
+	iceCandidates := webRtcTransport.IceCandidates()
+	suite.NotEmpty(iceCandidates)
+	for _, candidate := range iceCandidates {
+		suite.NotEmpty(candidate.Foundation)
+		suite.NotZero(candidate.Priority)
+		suite.Equal("9.9.9.1", candidate.Ip)
+		suite.NotZero(candidate.Port)
+		suite.Equal(TransportProtocol_Udp, candidate.Protocol)
+		suite.Equal("host", candidate.Type)
+	}
+
+	plainTransport, _ := suite.router.CreatePlainTransport(PlainTransportOptions{
+		ListenIp: TransportListenIp{Ip: "127.0.0.1"},
+	})
+	_, err = AsWebRtcTransport(plainTransport)
+	suite.IsType(NewTypeError(""), err)
+}
+
 func (suite *WebRtcTransportTestingSuite) TestGetStats_Succeeds() {
 	data, _ := suite.transport.GetStats()
 
@@ -273,6 +303,22 @@ func (suite *WebRtcTransportTestingSuite) TestSetMaxIncomingBitrate_Succeeds() {
 	transport := suite.transport
 	err := transport.SetMaxIncomingBitrate(100000)
 	suite.NoError(err)
+	suite.Equal(100000, transport.MaxIncomingBitrate())
+
+	suite.IsType(TypeError{}, transport.SetMaxIncomingBitrate(-1))
+	suite.Equal(100000, transport.MaxIncomingBitrate())
+}
+
+func (suite *WebRtcTransportTestingSuite) TestSetMaxOutgoingBitrate_Succeeds() {
+	transport := suite.transport
+	suite.Zero(transport.MaxOutgoingBitrate())
+
+	err := transport.SetMaxOutgoingBitrate(200000)
+	suite.NoError(err)
+	suite.Equal(200000, transport.MaxOutgoingBitrate())
+
+	suite.IsType(TypeError{}, transport.SetMaxOutgoingBitrate(-1))
+	suite.Equal(200000, transport.MaxOutgoingBitrate())
 }
 
 func (suite *WebRtcTransportTestingSuite) TestRestartIce_Succeeds() {
@@ -312,6 +358,58 @@ func (suite *WebRtcTransportTestingSuite) TestEnableTraceEvent_Succeeds() {
 	suite.Zero(data.TraceEventTypes)
 }
 
+func (suite *WebRtcTransportTestingSuite) TestEmitsBweTrace() {
+	transport := suite.transport
+
+	suite.NoError(transport.EnableTraceEvent(TransportTraceEventType_Bwe))
+
+	var trace *TransportTraceEventData
+	transport.OnTrace(func(data *TransportTraceEventData) {
+		trace = data
+	})
+
+	var bwe TransportBweTraceInfo
+	transport.OnBwe(func(data TransportBweTraceInfo) {
+		bwe = data
+	})
+
+	subscriber, _ := transport.channel.subscribers.Load(transport.Id())
+	emit := subscriber.(channelSubscriber)
+	emit("trace", []byte(`{
+		"type": "bwe",
+		"timestamp": 1234,
+		"direction": "out",
+		"info": {
+			"type": "transport-cc",
+			"desiredBitrate": 1000000,
+			"effectiveDesiredBitrate": 900000,
+			"minBitrate": 30000,
+			"maxBitrate": 2000000,
+			"startBitrate": 600000,
+			"maxPaddingBitrate": 850000,
+			"availableBitrate": 700000
+		}
+	}`))
+
+	suite.Require().NotNil(trace)
+	info, ok := trace.BweInfo()
+	suite.True(ok)
+	suite.Equal(&TransportBweTraceInfo{
+		Type:                    BweType_TransportCc,
+		DesiredBitrate:          1000000,
+		EffectiveDesiredBitrate: 900000,
+		MinBitrate:              30000,
+		MaxBitrate:              2000000,
+		StartBitrate:            600000,
+		MaxPaddingBitrate:       850000,
+		AvailableBitrate:        700000,
+	}, info)
+	suite.Equal(*info, bwe)
+
+	_, ok = TransportTraceEventData{Type: TransportTraceEventType_Probation}.BweInfo()
+	suite.False(ok)
+}
+
 func (suite *WebRtcTransportTestingSuite) TestEvents_Succeeds() {
 	transport := suite.transport
 
@@ -390,6 +488,9 @@ func (suite *WebRtcTransportTestingSuite) TestMethodsRejectIfClosed() {
 	err = transport.SetMaxIncomingBitrate(100)
 	suite.Error(err)
 
+	err = transport.SetMaxOutgoingBitrate(100)
+	suite.Error(err)
+
 	_, err = transport.RestartIce()
 	suite.Error(err)
 }
@@ -436,3 +537,99 @@ func (suite *WebRtcTransportTestingSuite) TestEmitsRoutercloseIfWorkerIsClosed()
 
 
  */
+
+func TestWebRtcTransportStatUnmarshal(t *testing.T) {
+	fixture := `[{
+		"type": "webrtc-transport",
+		"transportId": "transport-id",
+		"timestamp": 1000,
+		"bytesReceived": 1200,
+		"recvBitrate": 9600,
+		"bytesSent": 3400,
+		"sendBitrate": 27200,
+		"rtpBytesSent": 3000,
+		"probationBytesSent": 400,
+		"iceRole": "controlled",
+		"iceState": "completed",
+		"dtlsState": "connected",
+		"iceSelectedTuple": {
+			"localIp": "127.0.0.1",
+			"localPort": 40000,
+			"remoteIp": "127.0.0.1",
+			"remotePort": 50000,
+			"protocol": "udp"
+		}
+	}]`
+
+	var stats []*TransportStat
+	require.NoError(t, json.Unmarshal([]byte(fixture), &stats))
+	require.Len(t, stats, 1)
+
+	stat := stats[0]
+	assert.Equal(t, "webrtc-transport", stat.Type)
+	assert.EqualValues(t, 1200, stat.BytesReceived)
+	assert.EqualValues(t, 9600, stat.RecvBitrate)
+	assert.EqualValues(t, 3400, stat.BytesSent)
+	assert.EqualValues(t, 27200, stat.SendBitrate)
+	assert.EqualValues(t, 3000, stat.RtpBytesSent)
+	assert.EqualValues(t, 400, stat.ProbationBytesSent)
+	require.NotNil(t, stat.WebRtcTransportSpecificStat)
+	assert.Nil(t, stat.PlainTransportSpecificStat)
+	assert.Equal(t, IceState_Completed, stat.IceState)
+	assert.Equal(t, DtlsState_Connected, stat.DtlsState)
+	assert.Equal(t, &TransportTuple{
+		LocalIp:    "127.0.0.1",
+		LocalPort:  40000,
+		RemoteIp:   "127.0.0.1",
+		RemotePort: 50000,
+		Protocol:   "udp",
+	}, stat.IceSelectedTuple)
+}
+
+func TestWebRtcTransportSetDtlsRole(t *testing.T) {
+	requests := make(chan string, 1)
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		requests <- req.data
+		return `{"dtlsLocalRole":"client"}`, nil
+	})
+
+	payloadChannel, _ := newFakePayloadChannel(t)
+	newTestTransport := func() *WebRtcTransport {
+		return newWebRtcTransport(transportParams{
+			internal:       internalData{RouterId: "router", TransportId: "transport"},
+			data:           &webrtcTransportData{},
+			channel:        channel,
+			payloadChannel: payloadChannel,
+		}).(*WebRtcTransport)
+	}
+	remote, err := NewDtlsParameters(DtlsRole_Auto, "sha-256", []byte{1, 2, 3})
+	require.NoError(t, err)
+
+	transport := newTestTransport()
+	assert.IsType(t, TypeError{}, transport.SetDtlsRole("actpass"))
+	require.NoError(t, transport.SetDtlsRole(DtlsRole_Client))
+
+	// The remote endpoint must be the DTLS server.
+	require.NoError(t, transport.Connect(TransportConnectOptions{DtlsParameters: &remote}))
+	var request struct{ DtlsParameters DtlsParameters }
+	require.NoError(t, json.Unmarshal([]byte(<-requests), &request))
+	assert.Equal(t, DtlsRole_Server, request.DtlsParameters.Role)
+	assert.Equal(t, remote.Fingerprints, request.DtlsParameters.Fingerprints)
+	assert.Equal(t, DtlsRole_Auto, remote.Role)
+	assert.Equal(t, DtlsRole_Client, transport.DtlsParameters().Role)
+
+	assert.IsType(t, InvalidStateError{}, transport.SetDtlsRole(DtlsRole_Server))
+
+	// A remote endpoint taking the same role is rejected without request.
+	transport = newTestTransport()
+	require.NoError(t, transport.SetDtlsRole(DtlsRole_Client))
+	remote.Role = DtlsRole_Client
+	assert.IsType(t, TypeError{}, transport.Connect(TransportConnectOptions{DtlsParameters: &remote}))
+	assert.Empty(t, requests)
+
+	// The remote role is kept as is by default.
+	transport = newTestTransport()
+	require.NoError(t, transport.Connect(TransportConnectOptions{DtlsParameters: &remote}))
+	require.NoError(t, json.Unmarshal([]byte(<-requests), &request))
+	assert.Equal(t, DtlsRole_Client, request.DtlsParameters.Role)
+}
@@ -2,7 +2,9 @@ package mediasoup
 
 import (
 	"bufio"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
@@ -127,6 +129,7 @@ type Option func(w *WorkerSettings)
 // instances.
 //
 //   - @emits died - (err error)
+//   - @emits unhealthy - (err error)
 type Worker struct {
 	IEventEmitter
 	// Worker logger.
@@ -151,12 +154,17 @@ type Worker struct {
 	diedErr error
 	// waitCh notify worker process stopped expectly or not
 	waitCh chan error
+	// closeCh is closed when the worker is closed.
+	closeCh chan struct{}
+	// exitCh is closed when the worker process has exited.
+	exitCh chan struct{}
 
 	// Deprecated
 	observer IEventEmitter
 
 	onNewWebRtcServer func(webRtcServer *WebRtcServer)
 	onNewRouter       func(router *Router)
+	onUnhealthy       func(err error)
 
 	OnLog func(int, string)
 }
@@ -180,6 +188,10 @@ func NewWorker(options ...Option) (worker *Worker, err error) {
 	logger := NewLogger(settings.WorkerName)
 	logger.V(1).Info("constructor()", "settings", settings)
 
+	if err = settings.Validate(); err != nil {
+		return nil, err
+	}
+
 	var (
 		useLVCodec    bool
 		useHandlerID  bool
@@ -283,8 +295,16 @@ func NewWorker(options ...Option) (worker *Worker, err error) {
 
 	// the worker process id
 	pid := child.Process.Pid
-	channel := newChannel(channelCodec, pid, useHandlerID)
+	messageCodec := NewJsonChannelCodec(useHandlerID)
+	if settings.NewChannelCodec != nil {
+		messageCodec = settings.NewChannelCodec(useHandlerID)
+	}
+	channel := newChannel(channelCodec, messageCodec, pid, useHandlerID)
 	payloadChannel := newPayloadChannel(payloadChannelCodec, useHandlerID)
+	if settings.RequestTimeout > 0 {
+		channel.requestTimeout = settings.RequestTimeout
+		payloadChannel.requestTimeout = settings.RequestTimeout
+	}
 
 	channel.Subscribe(strconv.Itoa(pid), func(event string, data []byte) {
 		if atomic.CompareAndSwapUint32(&spawnDone, 0, 1) && event == "running" {
@@ -308,6 +328,8 @@ func NewWorker(options ...Option) (worker *Worker, err error) {
 		appData:        settings.AppData,
 		child:          child,
 		waitCh:         make(chan error, 1),
+		closeCh:        make(chan struct{}),
+		exitCh:         make(chan struct{}),
 		observer:       NewEventEmitter(),
 	}
 
@@ -327,36 +349,52 @@ func NewWorker(options ...Option) (worker *Worker, err error) {
 		return nil, err
 	}
 
-	//workerLogger := NewLogger(fmt.Sprintf("worker[pid:%d]", pid))
+	if settings.HealthCheck != nil {
+		go worker.runHealthCheck(*settings.HealthCheck)
+	}
 
-	go func() {
-		r := bufio.NewReader(stderr)
-		for {
-			line, _, err := r.ReadLine()
-			if err != nil {
-				break
-			}
-			if worker.OnLog != nil {
-				worker.OnLog(0, string(line))
-			}
-			//workerLogger.Error(nil, "(stderr) "+)
-		}
-	}()
+	go worker.forwardLogs(stderr, 0, settings.ForwardWorkerLogs)
+	go worker.forwardLogs(stdout, 1, settings.ForwardWorkerLogs)
 
-	go func() {
-		r := bufio.NewReader(stdout)
-		for {
-			line, _, err := r.ReadLine()
-			if err != nil {
-				break
-			}
-			if worker.OnLog != nil {
-				worker.OnLog(1, string(line))
-			}
+	return worker, nil
+}
+
+// forwardLogs reads the lines written by the worker process on stderr (stream 0) or stdout
+// (stream 1) until r is closed, passing each of them to OnLog and, if forward is true, to the
+// logger of the Worker. Lines written on stdout are debug logs, logged at V(1), and lines written
+// on stderr are warnings and errors, logged as errors.
+func (w *Worker) forwardLogs(r io.Reader, stream int, forward bool) {
+	reader := bufio.NewReader(r)
+	for {
+		line, _, err := reader.ReadLine()
+		if err != nil {
+			return
 		}
-	}()
+		if w.OnLog != nil {
+			w.OnLog(stream, string(line))
+		}
+		if !forward {
+			continue
+		}
+		tag, message := parseWorkerLogLine(string(line))
+		if stream == 0 {
+			w.logger.Error(nil, message, "pid", w.pid, "tag", tag)
+		} else {
+			w.logger.V(1).Info(message, "pid", w.pid, "tag", tag)
+		}
+	}
+}
 
-	return worker, nil
+// parseWorkerLogLine splits a line written by the worker process such as
+// "RTC::Transport::HandleRequest() | unknown method" into the scope which wrote it and the
+// message. The tag is empty if the line has no scope.
+func parseWorkerLogLine(line string) (tag, message string) {
+	if i := strings.Index(line, " | "); i >= 0 {
+		tag, message = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+3:])
+		tag = strings.TrimPrefix(tag, "(ABORT) ")
+		return
+	}
+	return "", strings.TrimSpace(line)
 }
 
 func (w *Worker) wait(child *exec.Cmd, spawnDone *uint32, doneCh chan error) {
@@ -365,7 +403,10 @@ func (w *Worker) wait(child *exec.Cmd, spawnDone *uint32, doneCh chan error) {
 		signal = os.Interrupt
 	)
 
-	if exiterr, ok := child.Wait().(*exec.ExitError); ok {
+	err := child.Wait()
+	close(w.exitCh)
+
+	if exiterr, ok := err.(*exec.ExitError); ok {
 		// The worker has exited with an exit code != 0
 		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
 			if code = status.ExitStatus(); status.Signaled() {
@@ -436,16 +477,21 @@ func (w *Worker) webRtcServersForTesting() (servers []*WebRtcServer) {
 	return
 }
 
-// Just for testing purposes.
-func (w *Worker) routersForTesting() (routers []*Router) {
+// Routers returns the routers created on the worker.
+func (w *Worker) Routers() []*Router {
+	routers := make([]*Router, 0)
 	w.routers.Range(func(key, value interface{}) bool {
 		routers = append(routers, value.(*Router))
 		return true
 	})
-	return
+	return routers
 }
 
-// Close terminal the worker process and all allocated resouces
+// Close terminal the worker process and all allocated resouces. It is safe to call it many
+// times. Closing is synchronous and top-down: when it returns, every Router, Transport,
+// Producer, Consumer, DataProducer and DataConsumer of the worker is closed and their
+// "workerclose", "routerclose" and "transportclose" events have been emitted, and the worker
+// process has exited.
 func (w *Worker) Close() {
 	if !atomic.CompareAndSwapUint32(&w.closed, 0, 1) {
 		return
@@ -453,6 +499,8 @@ func (w *Worker) Close() {
 
 	w.logger.V(1).Info("close()")
 
+	close(w.closeCh)
+
 	// Kill the worker process.
 	if pid := w.Pid(); pid > 0 {
 		if process, err := os.FindProcess(pid); err == nil {
@@ -472,6 +520,9 @@ func (w *Worker) Close() {
 		file.Close()
 	}
 
+	// Wait for the worker process to exit, it has been killed above.
+	<-w.exitCh
+
 	// Close every Router.
 	w.routers.Range(func(key, value interface{}) bool {
 		router := value.(*Router)
@@ -514,6 +565,65 @@ func (w *Worker) GetResourceUsage() (usage WorkerResourceUsage, err error) {
 	return
 }
 
+// Ping checks that the worker process answers requests, with a lightweight
+// "worker.getResourceUsage" request. It returns an error wrapping the error of ctx if ctx is done
+// before, and the request is then given up.
+func (w *Worker) Ping(ctx context.Context) error {
+	w.logger.V(2).Info("ping()")
+
+	return w.channel.RequestCtx(ctx, "worker.getResourceUsage", internalData{}).Err()
+}
+
+// runHealthCheck pings the worker every interval until it is closed, emitting "unhealthy" when
+// the number of consecutive failed pings reaches the threshold. It is emitted again after a
+// successful ping followed by as many failed ones.
+func (w *Worker) runHealthCheck(healthCheck WorkerHealthCheck) {
+	if healthCheck.Timeout <= 0 {
+		healthCheck.Timeout = healthCheck.Interval
+	}
+	if healthCheck.FailureThreshold <= 0 {
+		healthCheck.FailureThreshold = 3
+	}
+
+	ticker := time.NewTicker(healthCheck.Interval)
+	defer ticker.Stop()
+
+	failures := 0
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.closeCh:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheck.Timeout)
+		err := w.Ping(ctx)
+		cancel()
+
+		if err == nil {
+			failures = 0
+			continue
+		}
+		if w.Closed() {
+			return
+		}
+
+		failures++
+		w.logger.Error(err, "health check ping failed", "failures", failures)
+
+		if failures == healthCheck.FailureThreshold {
+			err = fmt.Errorf("%d consecutive pings failed: %w", failures, err)
+
+			w.SafeEmit("unhealthy", err)
+
+			if handler := w.onUnhealthy; handler != nil {
+				handler(err)
+			}
+		}
+	}
+}
+
 // UpdateSettings updates settings.
 func (w *Worker) UpdateSettings(settings WorkerUpdatableSettings) error {
 	w.logger.V(1).Info("updateSettings()")
@@ -525,11 +635,14 @@ func (w *Worker) UpdateSettings(settings WorkerUpdatableSettings) error {
 func (w *Worker) CreateWebRtcServer(options WebRtcServerOptions) (webRtcServer *WebRtcServer, err error) {
 	w.logger.V(1).Info("createWebRtcServer()")
 
-	var serverId string
-	if len(options.WebRtcServerId) > 0 {
-		serverId = options.WebRtcServerId
-	} else {
-		uuid.NewString()
+	if len(options.ListenInfos) == 0 {
+		err = NewTypeError("empty listenInfos array provided")
+		return
+	}
+
+	serverId := options.WebRtcServerId
+	if len(serverId) == 0 {
+		serverId = uuid.NewString()
 	}
 
 	internal := internalData{WebRtcServerId: serverId}
@@ -581,11 +694,12 @@ func (w *Worker) CreateRouter(options RouterOptions) (router *Router, err error)
 	}
 	data := routerData{RtpCapabilities: rtpCapabilities}
 	router = newRouter(routerParams{
-		internal:       internal,
-		data:           data,
-		channel:        w.channel,
-		payloadChannel: w.payloadChannel,
-		appData:        options.AppData,
+		internal:          internal,
+		data:              data,
+		channel:           w.channel,
+		payloadChannel:    w.payloadChannel,
+		appData:           options.AppData,
+		noConsumersPolicy: options.PauseProducerWhenNoConsumers,
 	})
 
 	w.routers.Store(internal.RouterId, router)
@@ -608,6 +722,12 @@ func (w *Worker) OnNewWebRtcServer(handler func(webrtcServer *WebRtcServer)) {
 	w.onNewWebRtcServer = handler
 }
 
+// OnUnhealthy set handler on "unhealthy" event, emitted when the pings of
+// WorkerSettings.HealthCheck fail repeatedly, so the worker can be drained.
+func (w *Worker) OnUnhealthy(handler func(err error)) {
+	w.onUnhealthy = handler
+}
+
 // OnNewRouter set handler on "newrouter" event
 func (w *Worker) OnNewRouter(handler func(router *Router)) {
 	w.onNewRouter = handler
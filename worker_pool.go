@@ -0,0 +1,265 @@
+package mediasoup
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+)
+
+// WorkerPlacement selects the Worker a Router is created on among the live Workers of a
+// WorkerPool, which are never empty.
+type WorkerPlacement func(workers []*Worker) (*Worker, error)
+
+// RoundRobinPlacement returns a WorkerPlacement selecting the Workers in turn.
+func RoundRobinPlacement() WorkerPlacement {
+	var next uint64
+
+	return func(workers []*Worker) (*Worker, error) {
+		i := atomic.AddUint64(&next, 1) - 1
+		return workers[i%uint64(len(workers))], nil
+	}
+}
+
+// LeastRoutersPlacement is a WorkerPlacement selecting the Worker with the fewest Routers, the
+// first one on a tie.
+func LeastRoutersPlacement(workers []*Worker) (*Worker, error) {
+	selected, min := workers[0], len(workers[0].Routers())
+
+	for _, worker := range workers[1:] {
+		if count := len(worker.Routers()); count < min {
+			selected, min = worker, count
+		}
+	}
+	return selected, nil
+}
+
+// LeastCpuPlacement is a WorkerPlacement selecting the Worker whose process used the least CPU
+// time (user and system) so far, as reported by GetResourceUsage(). It issues a request to every
+// Worker.
+func LeastCpuPlacement(workers []*Worker) (*Worker, error) {
+	var (
+		selected *Worker
+		min      int64
+	)
+	for _, worker := range workers {
+		usage, err := worker.GetResourceUsage()
+		if err != nil {
+			return nil, err
+		}
+		if cpu := usage.Utime + usage.Stime; selected == nil || cpu < min {
+			selected, min = worker, cpu
+		}
+	}
+	return selected, nil
+}
+
+// WorkerPoolOptions define options to create a WorkerPool.
+type WorkerPoolOptions struct {
+	// Size is the number of Workers. Default runtime.NumCPU().
+	Size int
+
+	// WorkerOptions are the options every Worker is created with.
+	WorkerOptions []Option
+
+	// Placement selects the Worker of each Router. Default LeastRoutersPlacement.
+	Placement WorkerPlacement
+
+	// ReplaceDied define whether a Worker which died is replaced by a new one. Default false.
+	ReplaceDied bool
+}
+
+// WorkerPoolStats is a snapshot of a WorkerPool.
+type WorkerPoolStats struct {
+	// Workers is the number of live Workers.
+	Workers int
+
+	// Routers is the number of Routers of the live Workers.
+	Routers int
+
+	// Died is the number of Workers which died since the pool creation.
+	Died uint64
+
+	// Replaced is the number of Workers created to replace the ones which died.
+	Replaced uint64
+}
+
+// WorkerPool manages a set of Workers and places each new Router on one of them. Workers which
+// die or are closed are removed from the pool.
+//
+//   - @emits workerdied - (worker *Worker, err error)
+//   - @emits workerreplaced - (died, replacement *Worker)
+type WorkerPool struct {
+	IEventEmitter
+	logger    logr.Logger
+	options   WorkerPoolOptions
+	newWorker func(options ...Option) (*Worker, error)
+	locker    sync.Mutex
+	workers   []*Worker
+	closed    uint32
+	died      uint64
+	replaced  uint64
+}
+
+// NewWorkerPool creates a WorkerPool and its Workers. If a Worker can not be created, the ones
+// already created are closed.
+func NewWorkerPool(options WorkerPoolOptions) (*WorkerPool, error) {
+	return newWorkerPool(options, NewWorker)
+}
+
+func newWorkerPool(options WorkerPoolOptions, newWorker func(options ...Option) (*Worker, error)) (*WorkerPool, error) {
+	logger := NewLogger("WorkerPool")
+
+	logger.V(1).Info("constructor()", "size", options.Size)
+
+	if options.Size < 0 {
+		return nil, NewTypeError("invalid pool size %d", options.Size)
+	}
+	if options.Size == 0 {
+		options.Size = runtime.NumCPU()
+	}
+	if options.Placement == nil {
+		options.Placement = LeastRoutersPlacement
+	}
+
+	pool := &WorkerPool{
+		IEventEmitter: NewEventEmitter(),
+		logger:        logger,
+		options:       options,
+		newWorker:     newWorker,
+	}
+
+	for i := 0; i < options.Size; i++ {
+		worker, err := newWorker(options.WorkerOptions...)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		pool.addWorker(worker)
+	}
+
+	return pool, nil
+}
+
+// Workers returns the live Workers of the pool.
+func (pool *WorkerPool) Workers() []*Worker {
+	pool.locker.Lock()
+	defer pool.locker.Unlock()
+
+	return append([]*Worker(nil), pool.workers...)
+}
+
+// CreateRouter creates a Router on the Worker selected by the placement of the pool.
+func (pool *WorkerPool) CreateRouter(options RouterOptions) (*Router, error) {
+	pool.logger.V(1).Info("createRouter()")
+
+	if pool.Closed() {
+		return nil, NewInvalidStateError("WorkerPool closed")
+	}
+
+	workers := pool.Workers()
+	if len(workers) == 0 {
+		return nil, NewInvalidStateError("no live worker in pool")
+	}
+	worker, err := pool.options.Placement(workers)
+	if err != nil {
+		return nil, err
+	}
+
+	return worker.CreateRouter(options)
+}
+
+// Stats returns a snapshot of the pool.
+func (pool *WorkerPool) Stats() WorkerPoolStats {
+	stats := WorkerPoolStats{
+		Died:     atomic.LoadUint64(&pool.died),
+		Replaced: atomic.LoadUint64(&pool.replaced),
+	}
+	for _, worker := range pool.Workers() {
+		stats.Workers++
+		stats.Routers += len(worker.Routers())
+	}
+	return stats
+}
+
+// ResourceUsage returns the resource usage of every live Worker, by pid.
+func (pool *WorkerPool) ResourceUsage() (map[int]WorkerResourceUsage, error) {
+	usages := make(map[int]WorkerResourceUsage)
+
+	for _, worker := range pool.Workers() {
+		usage, err := worker.GetResourceUsage()
+		if err != nil {
+			return nil, err
+		}
+		usages[worker.Pid()] = usage
+	}
+	return usages, nil
+}
+
+// Closed returns whether the pool is closed.
+func (pool *WorkerPool) Closed() bool {
+	return atomic.LoadUint32(&pool.closed) > 0
+}
+
+// Close closes the pool and all its Workers.
+func (pool *WorkerPool) Close() {
+	if !atomic.CompareAndSwapUint32(&pool.closed, 0, 1) {
+		return
+	}
+	pool.logger.V(1).Info("close()")
+
+	for _, worker := range pool.Workers() {
+		worker.Close()
+	}
+}
+
+func (pool *WorkerPool) addWorker(worker *Worker) {
+	pool.locker.Lock()
+	pool.workers = append(pool.workers, worker)
+	pool.locker.Unlock()
+
+	worker.On("died", func(err error) {
+		pool.removeWorker(worker)
+		atomic.AddUint64(&pool.died, 1)
+		pool.SafeEmit("workerdied", worker, err)
+
+		if pool.options.ReplaceDied && !pool.Closed() {
+			// "died" is emitted by Worker.Close(), do not spawn the replacement there.
+			go pool.replaceWorker(worker)
+		}
+	})
+	worker.observer.On("close", func() {
+		pool.removeWorker(worker)
+	})
+}
+
+func (pool *WorkerPool) removeWorker(worker *Worker) {
+	pool.locker.Lock()
+	defer pool.locker.Unlock()
+
+	for i, w := range pool.workers {
+		if w == worker {
+			pool.workers = append(pool.workers[:i], pool.workers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (pool *WorkerPool) replaceWorker(died *Worker) {
+	replacement, err := pool.newWorker(pool.options.WorkerOptions...)
+	if err != nil {
+		pool.logger.Error(err, "failed to replace died worker", "pid", died.Pid())
+		return
+	}
+	pool.addWorker(replacement)
+
+	// The pool may have been closed meanwhile.
+	if pool.Closed() {
+		replacement.Close()
+		return
+	}
+
+	atomic.AddUint64(&pool.replaced, 1)
+	pool.SafeEmit("workerreplaced", died, replacement)
+}
@@ -0,0 +1,99 @@
+package mediasoup
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundRobinPlacement(t *testing.T) {
+	workers := []*Worker{{pid: 1}, {pid: 2}, {pid: 3}}
+	placement := RoundRobinPlacement()
+
+	var pids []int
+	for i := 0; i < 5; i++ {
+		worker, err := placement(workers)
+		require.NoError(t, err)
+		pids = append(pids, worker.Pid())
+	}
+	assert.Equal(t, []int{1, 2, 3, 1, 2}, pids)
+}
+
+func TestLeastRoutersPlacement(t *testing.T) {
+	workers := []*Worker{{pid: 1}, {pid: 2}, {pid: 3}}
+	workers[0].routers.Store("r1", &Router{})
+	workers[0].routers.Store("r2", &Router{})
+	workers[1].routers.Store("r3", &Router{})
+	workers[2].routers.Store("r4", &Router{})
+
+	worker, err := LeastRoutersPlacement(workers)
+	require.NoError(t, err)
+	assert.Equal(t, 2, worker.Pid())
+
+	workers[1].routers.Store("r5", &Router{})
+	worker, err = LeastRoutersPlacement(workers)
+	require.NoError(t, err)
+	assert.Equal(t, 3, worker.Pid())
+}
+
+func TestWorkerPool(t *testing.T) {
+	channel := newFakeWorkerChannel(t, nil)
+
+	// Fake workers are marked closed so closing the pool does not kill any process.
+	var pid int
+	newFakeWorker := func(...Option) (*Worker, error) {
+		pid++
+		return &Worker{
+			IEventEmitter: NewEventEmitter(),
+			logger:        NewLogger("Worker"),
+			pid:           pid,
+			channel:       channel,
+			closed:        1,
+			observer:      NewEventEmitter(),
+		}, nil
+	}
+
+	pool, err := newWorkerPool(WorkerPoolOptions{Size: 2, ReplaceDied: true}, newFakeWorker)
+	require.NoError(t, err)
+	defer pool.Close()
+	require.Len(t, pool.Workers(), 2)
+
+	for i := 0; i < 4; i++ {
+		_, err := pool.CreateRouter(RouterOptions{})
+		require.NoError(t, err)
+	}
+	for _, worker := range pool.Workers() {
+		assert.Len(t, worker.Routers(), 2)
+	}
+	assert.Equal(t, WorkerPoolStats{Workers: 2, Routers: 4}, pool.Stats())
+
+	died := pool.Workers()[0]
+	onWorkerReplaced := NewMockFunc(t)
+	pool.On("workerreplaced", onWorkerReplaced.Fn())
+	died.SafeEmit("died", errors.New("worker process died unexpectedly"))
+
+	onWorkerReplaced.ExpectCalled()
+	assert.Eventually(t, func() bool { return pool.Stats().Replaced == 1 }, time.Second, time.Millisecond)
+	workers := pool.Workers()
+	require.Len(t, workers, 2)
+	assert.NotContains(t, workers, died)
+	assert.Equal(t, 3, workers[1].Pid())
+	assert.EqualValues(t, 1, pool.Stats().Died)
+
+	// The replacement has no router yet, so it gets the next one.
+	router, err := pool.CreateRouter(RouterOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []*Router{router}, workers[1].Routers())
+
+	pool.Close()
+	_, err = pool.CreateRouter(RouterOptions{})
+	assert.IsType(t, InvalidStateError{}, err)
+}
+
+func TestWorkerPoolInvalidSize(t *testing.T) {
+	_, err := NewWorkerPool(WorkerPoolOptions{Size: -1})
+	assert.IsType(t, TypeError{}, err)
+}
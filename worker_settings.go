@@ -2,6 +2,7 @@ package mediasoup
 
 import (
 	"fmt"
+	"time"
 )
 
 type WorkerSettings struct {
@@ -11,6 +12,8 @@ type WorkerSettings struct {
 	// /usr/local/lib/node_modules/mediasoup/worker/out/Release/mediasoup-worker.
 	// To facilitate testing, it allows the use of the following pattern:
 	// valgrind --tool=memcheck --leak-check=full ./mediasoup-worker
+	// The same pattern pins the worker to CPUs, mediasoup-worker having no such option:
+	// taskset -c 2 ./mediasoup-worker
 	WorkerBin string
 
 	//自定义的workname,用户日志打印区分
@@ -30,7 +33,8 @@ type WorkerSettings struct {
 	// Debugging documentation.
 	LogTags []WorkerLogTag `json:"logTags,omitempty"`
 
-	// RtcMinPort is the minimum RTC port for ICE, DTLS, RTP, etc. Default 10000.
+	// RtcMinPort is the minimum RTC port for ICE, DTLS, RTP, etc. It must be in 1..65535 and not
+	// greater than RtcMaxPort, which is checked before spawning the worker. Default 10000.
 	RtcMinPort uint16 `json:"rtcMinPort,omitempty"`
 
 	// RtcMaxPort is maximum RTC port for ICE, DTLS, RTP, etc. Default 59999.
@@ -44,12 +48,48 @@ type WorkerSettings struct {
 	// If unset, a certificate is dynamically created.
 	DtlsPrivateKeyFile string `json:"dtlsPrivateKeyFile,omitempty"`
 
+	// DisableLiburing disables io_uring in mediasoup-worker >= 3.12, falling back to libuv for
+	// the network I/O. Default false.
+	DisableLiburing bool `json:"disableLiburing,omitempty"`
+
 	// AppData is custom application data.
 	AppData interface{} `json:"appData,omitempty"`
 
 	// CustomOptions will be passed to mediasoup-worker command line such as
 	// --key1=value1 --key2=value2.
 	CustomOptions map[string]interface{}
+
+	// NewChannelCodec creates the ChannelCodec encoding the Channel messages exchanged with
+	// mediasoup-worker. useHandlerID is true for workers >= 3.10.6. Default
+	// NewJsonChannelCodec.
+	NewChannelCodec func(useHandlerID bool) ChannelCodec `json:"-"`
+
+	// HealthCheck define whether the worker is pinged periodically, emitting "unhealthy" when
+	// the pings fail repeatedly. Default nil, meaning no health check.
+	HealthCheck *WorkerHealthCheck `json:"-"`
+
+	// ForwardWorkerLogs define whether the lines written by mediasoup-worker on stdout and
+	// stderr are logged by the logger of the Worker, stdout at V(1) and stderr as errors, with
+	// the C++ scope which wrote them as "tag". Default false.
+	ForwardWorkerLogs bool `json:"-"`
+
+	// RequestTimeout is the time every request to mediasoup-worker is given to be answered before
+	// failing with an error wrapping ErrRequestTimeout, so a wedged worker does not hang the
+	// callers. Default DefaultRequestTimeout.
+	RequestTimeout time.Duration `json:"-"`
+}
+
+// WorkerHealthCheck define the periodic pings of the worker by Worker.Ping().
+type WorkerHealthCheck struct {
+	// Interval between pings. It must be greater than 0.
+	Interval time.Duration
+
+	// Timeout of each ping. Default Interval.
+	Timeout time.Duration
+
+	// FailureThreshold is the number of consecutive failed pings after which the worker is
+	// unhealthy. Default 3.
+	FailureThreshold int
 }
 
 // args returns the arguments passed to mediasoup-worker command line.
@@ -63,6 +103,10 @@ func (w WorkerSettings) Args() []string {
 	args = append(args, fmt.Sprintf("--rtcMinPort=%d", w.RtcMinPort))
 	args = append(args, fmt.Sprintf("--rtcMaxPort=%d", w.RtcMaxPort))
 
+	if w.DisableLiburing {
+		args = append(args, "--disableLiburing=true")
+	}
+
 	if len(w.DtlsCertificateFile) > 0 && len(w.DtlsPrivateKeyFile) > 0 {
 		args = append(args,
 			"--dtlsCertificateFile="+w.DtlsCertificateFile,
@@ -77,6 +121,25 @@ func (w WorkerSettings) Args() []string {
 	return args
 }
 
+// Validate returns a TypeError if the settings can not be used to spawn mediasoup-worker.
+func (w WorkerSettings) Validate() error {
+	if w.RtcMinPort == 0 || w.RtcMaxPort == 0 {
+		return NewTypeError("invalid RTC port range [%d, %d], ports must be in 1..65535",
+			w.RtcMinPort, w.RtcMaxPort)
+	}
+	if w.RtcMinPort > w.RtcMaxPort {
+		return NewTypeError("invalid RTC port range [%d, %d], rtcMinPort is greater than rtcMaxPort",
+			w.RtcMinPort, w.RtcMaxPort)
+	}
+	if w.RequestTimeout < 0 {
+		return NewTypeError("invalid request timeout %s", w.RequestTimeout)
+	}
+	if w.HealthCheck != nil && w.HealthCheck.Interval <= 0 {
+		return NewTypeError("invalid health check interval %s", w.HealthCheck.Interval)
+	}
+	return nil
+}
+
 // WorkerUpdatableSettings is an object with fields which can be updated during
 // mediasoup-worker is running.
 type WorkerUpdatableSettings struct {
@@ -132,6 +195,12 @@ func WithRtcMaxPort(rtcMaxPort uint16) Option {
 	}
 }
 
+func WithDisableLiburing(disableLiburing bool) Option {
+	return func(o *WorkerSettings) {
+		o.DisableLiburing = disableLiburing
+	}
+}
+
 func WithDtlsCert(dtlsCertificateFile, dtlsPrivateKeyFile string) Option {
 	return func(o *WorkerSettings) {
 		o.DtlsCertificateFile = dtlsCertificateFile
@@ -147,3 +216,27 @@ func WithCustomOption(key string, value interface{}) Option {
 		o.CustomOptions[key] = value
 	}
 }
+
+func WithHealthCheck(healthCheck WorkerHealthCheck) Option {
+	return func(o *WorkerSettings) {
+		o.HealthCheck = &healthCheck
+	}
+}
+
+func WithForwardWorkerLogs(forwardWorkerLogs bool) Option {
+	return func(o *WorkerSettings) {
+		o.ForwardWorkerLogs = forwardWorkerLogs
+	}
+}
+
+func WithRequestTimeout(requestTimeout time.Duration) Option {
+	return func(o *WorkerSettings) {
+		o.RequestTimeout = requestTimeout
+	}
+}
+
+func WithChannelCodec(newChannelCodec func(useHandlerID bool) ChannelCodec) Option {
+	return func(o *WorkerSettings) {
+		o.NewChannelCodec = newChannelCodec
+	}
+}
@@ -0,0 +1,192 @@
+package mediasoup
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// shutdownDrainInterval is the interval at which Shutdown() checks whether the RTP queues of the
+// Consumers are drained.
+const shutdownDrainInterval = 10 * time.Millisecond
+
+// shutdownStep is an operation of a stage of Shutdown() on the entity of the given id.
+type shutdownStep struct {
+	id  string
+	run func()
+}
+
+// Shutdown gracefully closes the worker for rolling deploys. It pauses every Producer, waits for
+// the RTP packets queued for the "rtp" handlers of the Consumers to be delivered, then closes the
+// entities in dependency order: Consumers and DataConsumers, Producers and DataProducers,
+// Transports, Routers and WebRtcServers. The entities of a stage are closed concurrently, the next
+// stage starting once they are all closed. If ctx is done before, the ids of the entities whose
+// closure was not completed are returned, with an error wrapping ctx.Err(). The worker is closed
+// in any case, which closes the remaining entities without waiting for mediasoup-worker.
+func (w *Worker) Shutdown(ctx context.Context) (unclosed []string, err error) {
+	w.logger.V(1).Info("shutdown()")
+
+	defer w.Close()
+
+	var (
+		producers     []*Producer
+		consumers     []*Consumer
+		dataProducers []*DataProducer
+		dataConsumers []*DataConsumer
+		transports    []ITransport
+		webRtcServers []*WebRtcServer
+		routers       = w.Routers()
+	)
+	w.webRtcServers.Range(func(key, value interface{}) bool {
+		webRtcServers = append(webRtcServers, value.(*WebRtcServer))
+		return true
+	})
+	for _, router := range routers {
+		for _, transport := range router.Transports() {
+			transports = append(transports, transport)
+			producers = append(producers, transport.Producers()...)
+			consumers = append(consumers, transport.Consumers()...)
+			dataProducers = append(dataProducers, transport.DataProducers()...)
+			dataConsumers = append(dataConsumers, transport.DataConsumers()...)
+		}
+	}
+
+	var pauseSteps, drainSteps []shutdownStep
+	for _, producer := range producers {
+		producer := producer
+		pauseSteps = append(pauseSteps, shutdownStep{id: producer.Id(), run: func() {
+			if err := producer.Pause(); err != nil {
+				w.logger.Error(err, "shutdown() | failed to pause producer", "producerId", producer.Id())
+			}
+		}})
+	}
+	for _, consumer := range consumers {
+		consumer := consumer
+		drainSteps = append(drainSteps, shutdownStep{id: consumer.Id(), run: func() {
+			consumer.drainRtp(ctx)
+		}})
+	}
+
+	closeStages := [][]shutdownStep{nil, nil, nil, nil, nil}
+	for _, consumer := range consumers {
+		consumer := consumer
+		closeStages[0] = append(closeStages[0], shutdownStep{id: consumer.Id(), run: func() { consumer.Close() }})
+	}
+	for _, dataConsumer := range dataConsumers {
+		dataConsumer := dataConsumer
+		closeStages[0] = append(closeStages[0], shutdownStep{id: dataConsumer.Id(), run: func() { dataConsumer.Close() }})
+	}
+	for _, producer := range producers {
+		producer := producer
+		closeStages[1] = append(closeStages[1], shutdownStep{id: producer.Id(), run: func() { producer.Close() }})
+	}
+	for _, dataProducer := range dataProducers {
+		dataProducer := dataProducer
+		closeStages[1] = append(closeStages[1], shutdownStep{id: dataProducer.Id(), run: func() { dataProducer.Close() }})
+	}
+	for _, transport := range transports {
+		closeStages[2] = append(closeStages[2], shutdownStep{id: transport.Id(), run: transport.Close})
+	}
+	for _, router := range routers {
+		router := router
+		closeStages[3] = append(closeStages[3], shutdownStep{id: router.Id(), run: func() { router.Close() }})
+	}
+	for _, webRtcServer := range webRtcServers {
+		closeStages[4] = append(closeStages[4], shutdownStep{id: webRtcServer.Id(), run: webRtcServer.Close})
+	}
+
+	// Pausing and draining are best effort, the closure is what is reported.
+	if runShutdownStage(ctx, pauseSteps) == nil {
+		runShutdownStage(ctx, drainSteps)
+	}
+
+	return runShutdownStages(ctx, closeStages)
+}
+
+// runShutdownStages runs the stages in order and returns the ids of the steps not completed when
+// ctx is done, those of the following stages included, with an error wrapping ctx.Err().
+func runShutdownStages(ctx context.Context, stages [][]shutdownStep) (unclosed []string, err error) {
+	for i, steps := range stages {
+		if unclosed = runShutdownStage(ctx, steps); unclosed != nil {
+			for _, steps := range stages[i+1:] {
+				for _, step := range steps {
+					unclosed = append(unclosed, step.id)
+				}
+			}
+			return unclosed, fmt.Errorf("shutdown not completed: %w", ctx.Err())
+		}
+	}
+	return nil, nil
+}
+
+// runShutdownStage runs the steps concurrently and waits for them to complete. If ctx is done
+// before, it returns the ids of the steps not completed yet, in order, without waiting for them.
+func runShutdownStage(ctx context.Context, steps []shutdownStep) (pending []string) {
+	if ctx.Err() != nil {
+		for _, step := range steps {
+			pending = append(pending, step.id)
+		}
+		return
+	}
+
+	var (
+		locker sync.Mutex
+		done   = make([]bool, len(steps))
+		wg     sync.WaitGroup
+	)
+	for i, step := range steps {
+		wg.Add(1)
+		go func(i int, step shutdownStep) {
+			defer wg.Done()
+			step.run()
+
+			locker.Lock()
+			done[i] = true
+			locker.Unlock()
+		}(i, step)
+	}
+
+	allDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(allDone)
+	}()
+
+	select {
+	case <-allDone:
+		return nil
+	case <-ctx.Done():
+	}
+
+	locker.Lock()
+	defer locker.Unlock()
+
+	for i, step := range steps {
+		if !done[i] {
+			pending = append(pending, step.id)
+		}
+	}
+	return
+}
+
+// drainRtp waits until the RTP packets queued for the "rtp" handler are delivered, ctx is done or
+// the Consumer is closed. It returns at once if the Consumer has no RtpQueue.
+func (consumer *Consumer) drainRtp(ctx context.Context) {
+	if consumer.rtpQueue == nil {
+		return
+	}
+
+	ticker := time.NewTicker(shutdownDrainInterval)
+	defer ticker.Stop()
+
+	for consumer.rtpQueue.length() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		case <-consumer.ctx.Done():
+			return
+		}
+	}
+}
@@ -1,13 +1,18 @@
 package mediasoup
 
 import (
+	"context"
 	"errors"
 	"os"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -66,6 +71,96 @@ func TestCreateWorker_TypeError(t *testing.T) {
 	assert.IsType(t, TypeError{}, err)
 }
 
+func TestWorkerSettingsValidate(t *testing.T) {
+	settings := WorkerSettings{RtcMinPort: 10000, RtcMaxPort: 59999}
+	assert.NoError(t, settings.Validate())
+
+	settings.RtcMinPort, settings.RtcMaxPort = 40000, 40000
+	assert.NoError(t, settings.Validate())
+
+	settings.RtcMinPort, settings.RtcMaxPort = 1, 65535
+	assert.NoError(t, settings.Validate())
+
+	settings.RtcMinPort, settings.RtcMaxPort = 40001, 40000
+	assert.IsType(t, TypeError{}, settings.Validate())
+
+	settings.RtcMinPort, settings.RtcMaxPort = 0, 40000
+	assert.IsType(t, TypeError{}, settings.Validate())
+
+	settings.RtcMinPort, settings.RtcMaxPort = 10000, 0
+	assert.IsType(t, TypeError{}, settings.Validate())
+
+	settings.RtcMinPort, settings.RtcMaxPort = 10000, 59999
+	settings.HealthCheck = &WorkerHealthCheck{}
+	assert.IsType(t, TypeError{}, settings.Validate())
+	settings.HealthCheck.Interval = time.Second
+	assert.NoError(t, settings.Validate())
+
+	settings.RequestTimeout = -time.Second
+	assert.IsType(t, TypeError{}, settings.Validate())
+
+	// The settings are validated before spawning the worker.
+	_, err := NewWorker(WithWorkerBin("/notfound/mediasoup-worker"), WithRtcMinPort(2000), WithRtcMaxPort(1000))
+	assert.IsType(t, TypeError{}, err)
+}
+
+func TestWorkerSettingsArgs(t *testing.T) {
+	settings := WorkerSettings{LogLevel: WorkerLogLevel_Warn, RtcMinPort: 10000, RtcMaxPort: 59999}
+	assert.Equal(t, []string{"--logLevel=warn", "--rtcMinPort=10000", "--rtcMaxPort=59999"}, settings.Args())
+
+	settings.DisableLiburing = true
+	assert.Contains(t, settings.Args(), "--disableLiburing=true")
+}
+
+func TestWorkerHealthCheck(t *testing.T) {
+	// The fake worker process answers the requests until it hangs.
+	var hung uint32
+	channel := newFakeWorkerChannel(t, func(req fakeWorkerRequest) (string, error) {
+		if atomic.LoadUint32(&hung) == 1 {
+			return "", errFakeWorkerNoResponse
+		}
+		return "{}", nil
+	})
+
+	w := &Worker{
+		IEventEmitter: NewEventEmitter(),
+		logger:        NewLogger("Worker"),
+		channel:       channel,
+		closeCh:       make(chan struct{}),
+	}
+	defer close(w.closeCh)
+
+	assert.NoError(t, w.Ping(context.Background()))
+
+	unhealthy := make(chan error, 1)
+	w.OnUnhealthy(func(err error) {
+		unhealthy <- err
+	})
+	go w.runHealthCheck(WorkerHealthCheck{
+		Interval:         10 * time.Millisecond,
+		FailureThreshold: 2,
+	})
+
+	select {
+	case err := <-unhealthy:
+		t.Fatalf("unhealthy while answering: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	atomic.StoreUint32(&hung, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(w.Ping(ctx), context.DeadlineExceeded))
+
+	select {
+	case err := <-unhealthy:
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	case <-time.After(time.Second):
+		t.Fatal("unhealthy not emitted")
+	}
+}
+
 func TestWorkerUpdateSettings_Succeeds(t *testing.T) {
 	worker := CreateTestWorker()
 	err := worker.UpdateSettings(WorkerUpdatableSettings{LogLevel: "debug", LogTags: []WorkerLogTag{"ice"}})
@@ -121,6 +216,48 @@ func TestWorkerClose_Succeeds(t *testing.T) {
 
 	assert.True(t, fn.Finished())
 	assert.True(t, worker.Closed())
+	// The worker process has exited when Close returns.
+	assert.NotNil(t, worker.child.ProcessState)
+}
+
+func TestWorkerClose_ClosesChildren(t *testing.T) {
+	worker := CreateTestWorker()
+	router := CreateRouter(worker)
+	assert.Equal(t, []*Router{router}, worker.Routers())
+
+	transport1, _ := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+	transport2, _ := router.CreateWebRtcTransport(WebRtcTransportOptions{
+		ListenIps: []TransportListenIp{{Ip: "127.0.0.1"}},
+	})
+	producer := CreateAudioProducer(transport1)
+	consumer, err := transport2.Consume(ConsumerOptions{
+		ProducerId:      producer.Id(),
+		RtpCapabilities: consumerDeviceCapabilities,
+	})
+	assert.NoError(t, err)
+
+	onRouterWorkerClose := NewMockFunc(t)
+	router.On("workerclose", onRouterWorkerClose.Fn())
+	onTransportRouterClose := NewMockFunc(t)
+	transport2.On("routerclose", onTransportRouterClose.Fn())
+	onConsumerTransportClose := NewMockFunc(t)
+	consumer.On("transportclose", onConsumerTransportClose.Fn())
+
+	worker.Close()
+	worker.Close()
+
+	assert.True(t, router.Closed())
+	assert.True(t, transport1.Closed())
+	assert.True(t, transport2.Closed())
+	assert.True(t, producer.Closed())
+	assert.True(t, consumer.Closed())
+	assert.Empty(t, worker.Routers())
+
+	onRouterWorkerClose.ExpectCalledTimes(1)
+	onTransportRouterClose.ExpectCalledTimes(1)
+	onConsumerTransportClose.ExpectCalledTimes(1)
 }
 
 func TestWorkerEmitsDied(t *testing.T) {
@@ -161,3 +298,109 @@ func TestWorkerProcessIgnoreSignals(t *testing.T) {
 	assert.False(t, worker.Closed())
 	worker.Close()
 }
+
+// recordedLog is a log recorded by recordingLogSink, level -1 standing for an error.
+type recordedLog struct {
+	level   int
+	message string
+	tag     interface{}
+}
+
+type recordingLogSink struct {
+	logs *[]recordedLog
+}
+
+func (s recordingLogSink) Init(logr.RuntimeInfo) {}
+
+func (s recordingLogSink) Enabled(level int) bool { return true }
+
+func (s recordingLogSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	*s.logs = append(*s.logs, recordedLog{level: level, message: msg, tag: recordedTag(keysAndValues)})
+}
+
+func (s recordingLogSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	*s.logs = append(*s.logs, recordedLog{level: -1, message: msg, tag: recordedTag(keysAndValues)})
+}
+
+func (s recordingLogSink) WithValues(keysAndValues ...interface{}) logr.LogSink { return s }
+
+func (s recordingLogSink) WithName(name string) logr.LogSink { return s }
+
+func recordedTag(keysAndValues []interface{}) interface{} {
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if keysAndValues[i] == "tag" {
+			return keysAndValues[i+1]
+		}
+	}
+	return nil
+}
+
+func TestWorkerForwardLogs(t *testing.T) {
+	var logs []recordedLog
+	w := &Worker{logger: logr.New(recordingLogSink{logs: &logs}), pid: 1}
+
+	var raw []string
+	w.OnLog = func(stream int, line string) { raw = append(raw, line) }
+
+	w.forwardLogs(strings.NewReader("  RTC::Router::HandleRequest() | unknown method\nplain line\n"), 1, true)
+	w.forwardLogs(strings.NewReader("(ABORT) RTC::Transport::Foo() | failed assertion `x': bar\n"), 0, true)
+
+	assert.Equal(t, []recordedLog{
+		{level: 1, message: "unknown method", tag: "RTC::Router::HandleRequest()"},
+		{level: 1, message: "plain line", tag: ""},
+		{level: -1, message: "failed assertion `x': bar", tag: "RTC::Transport::Foo()"},
+	}, logs)
+	assert.Len(t, raw, 3)
+
+	// Lines are still passed to OnLog when not forwarded.
+	logs = nil
+	w.forwardLogs(strings.NewReader("RTC::Router::Foo() | bar\n"), 1, false)
+	assert.Empty(t, logs)
+	assert.Len(t, raw, 4)
+}
+
+func TestRunShutdownStages(t *testing.T) {
+	var (
+		closed       []string
+		closedLocker sync.Mutex
+	)
+	step := func(id string, delay time.Duration) shutdownStep {
+		return shutdownStep{id: id, run: func() {
+			time.Sleep(delay)
+			closedLocker.Lock()
+			closed = append(closed, id)
+			closedLocker.Unlock()
+		}}
+	}
+	closedIds := func() []string {
+		closedLocker.Lock()
+		defer closedLocker.Unlock()
+		return append([]string(nil), closed...)
+	}
+
+	// A stage starts once the previous one is completed, even by a slower entity.
+	unclosed, err := runShutdownStages(context.Background(), [][]shutdownStep{
+		{step("consumer1", 5*time.Millisecond), step("consumer2", 0)},
+		{step("producer", 0)},
+		{step("transport", 0)},
+		{step("router", 0)},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, unclosed)
+	assert.Equal(t, []string{"consumer2", "consumer1", "producer", "transport", "router"}, closedIds())
+
+	// An entity not closing in time stops the shutdown at the deadline.
+	closed = nil
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	unclosed, err = runShutdownStages(ctx, [][]shutdownStep{
+		{step("consumer", 0)},
+		{step("producer1", 0), step("producer2", time.Second)},
+		{step("transport", 0)},
+	})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, []string{"producer2", "transport"}, unclosed)
+	assert.Equal(t, []string{"consumer", "producer1"}, closedIds())
+	assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+}